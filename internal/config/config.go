@@ -2,8 +2,10 @@ package config
 
 import (
 	"fmt"
+	"math"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -27,12 +29,31 @@ type ServerConfig struct {
 }
 
 type StoreConfig struct {
-	MaxMemory        string        `yaml:"max_memory"`
-	EvictionPolicy   string        `yaml:"eviction_policy"`
-	TTLEnabled       bool          `yaml:"ttl_enabled"`
-	SnapshotEnabled  bool          `yaml:"snapshot_enabled"`
-	SnapshotPath     string        `yaml:"snapshot_path"`
-	SnapshotInterval time.Duration `yaml:"snapshot_interval"`
+	Databases            int           `yaml:"databases"`       // numbered logical databases, selected with SELECT
+	Shards               int           `yaml:"shards"`          // hash partitions of each database, each with its own lock
+	MaxMemory            string        `yaml:"max_memory"`      // e.g. 512MB, 1GB; empty for no limit
+	EvictionPolicy       string        `yaml:"eviction_policy"` // noeviction, allkeys-lru, allkeys-lfu, volatile-lru, volatile-lfu or volatile-ttl
+	EvictionSamples      int           `yaml:"eviction_samples"`
+	LFULogFactor         int           `yaml:"lfu_log_factor"`
+	LFUDecayTime         time.Duration `yaml:"lfu_decay_time"`         // negative disables decay
+	SetMaxIntsetEntries  int           `yaml:"set_max_intset_entries"` // integer-only sets up to this size use the compact encoding
+	MoneyScale           int           `yaml:"money_scale"`            // decimal places of money keys created without SCALE
+	LedgerIdempotencyTTL time.Duration `yaml:"ledger_idempotency_ttl"` // how long LEDGER.TRANSFER remembers idempotency keys
+	IdempotencyTTL       time.Duration `yaml:"idempotency_ttl"`        // how long completed idempotency keys keep their response
+	IdempotencyLockTTL   time.Duration `yaml:"idempotency_lock_ttl"`   // how long an idempotency key stays in flight if never completed
+	TTLEnabled           bool          `yaml:"ttl_enabled"`
+	ActiveExpireHz       int           `yaml:"active_expire_hz"`
+	ActiveExpireCPU      int           `yaml:"active_expire_cpu_percent"` // share of each cycle spent expiring
+	NotifyKeyspaceEvents string        `yaml:"notify_keyspace_events"`    // Redis-style flags, e.g. "KEA"; empty disables
+	SnapshotEnabled      bool          `yaml:"snapshot_enabled"`
+	SnapshotPath         string        `yaml:"snapshot_path"`
+	SnapshotInterval     time.Duration `yaml:"snapshot_interval"`
+
+	AOFEnabled           bool   `yaml:"aof_enabled"`
+	AOFPath              string `yaml:"aof_path"`
+	AOFFsync             string `yaml:"aof_fsync"` // always, everysec or no
+	AOFRewritePercentage int    `yaml:"aof_rewrite_percentage"`
+	AOFRewriteMinSize    int64  `yaml:"aof_rewrite_min_size"` // bytes
 }
 
 type RedisConfig struct {
@@ -50,12 +71,14 @@ type RedisConfig struct {
 }
 
 type APIConfig struct {
-	Enabled      bool          `yaml:"enabled"`
-	Port         int           `yaml:"port"`
-	ReadTimeout  time.Duration `yaml:"read_timeout"`
-	WriteTimeout time.Duration `yaml:"write_timeout"`
-	CORSEnabled  bool          `yaml:"cors_enabled"`
-	RateLimit    int           `yaml:"rate_limit"`
+	Enabled         bool          `yaml:"enabled"`
+	Port            int           `yaml:"port"`
+	ReadTimeout     time.Duration `yaml:"read_timeout"`
+	WriteTimeout    time.Duration `yaml:"write_timeout"`
+	CORSEnabled     bool          `yaml:"cors_enabled"`
+	RateLimit       int           `yaml:"rate_limit"`        // requests per client per rate_limit_period; 0 disables
+	RateLimitPeriod time.Duration `yaml:"rate_limit_period"` // 1s if unset
+	IdempotencyWait time.Duration `yaml:"idempotency_wait"`  // how long a request waits for one in flight with its Idempotency-Key; 0 answers 409 at once
 }
 
 func Load(path string) (*Config, error) {
@@ -96,12 +119,31 @@ func loadFromEnv() *Config {
 			EnableHealth:   getEnv("FINCACHE_ENABLE_HEALTH", "true") == "true",
 		},
 		Store: StoreConfig{
-			MaxMemory:        getEnv("FINCACHE_MAX_MEMORY", "1GB"),
-			EvictionPolicy:   getEnv("FINCACHE_EVICTION_POLICY", "lru"),
-			TTLEnabled:       getEnv("FINCACHE_TTL_ENABLED", "true") == "true",
-			SnapshotEnabled:  getEnv("FINCACHE_SNAPSHOT_ENABLED", "true") == "true",
-			SnapshotPath:     getEnv("FINCACHE_SNAPSHOT_PATH", "./data/snapshot.rdb"),
-			SnapshotInterval: 5 * time.Minute,
+			Databases:            16,
+			Shards:               16,
+			MaxMemory:            getEnv("FINCACHE_MAX_MEMORY", "1GB"),
+			EvictionPolicy:       getEnv("FINCACHE_EVICTION_POLICY", "lru"),
+			EvictionSamples:      5,
+			LFULogFactor:         10,
+			LFUDecayTime:         time.Minute,
+			SetMaxIntsetEntries:  512,
+			MoneyScale:           2,
+			LedgerIdempotencyTTL: 24 * time.Hour,
+			IdempotencyTTL:       24 * time.Hour,
+			IdempotencyLockTTL:   30 * time.Second,
+			NotifyKeyspaceEvents: getEnv("FINCACHE_NOTIFY_KEYSPACE_EVENTS", ""),
+			TTLEnabled:           getEnv("FINCACHE_TTL_ENABLED", "true") == "true",
+			ActiveExpireHz:       10,
+			ActiveExpireCPU:      25,
+			SnapshotEnabled:      getEnv("FINCACHE_SNAPSHOT_ENABLED", "true") == "true",
+			SnapshotPath:         getEnv("FINCACHE_SNAPSHOT_PATH", "./data/snapshot.rdb"),
+			SnapshotInterval:     5 * time.Minute,
+
+			AOFEnabled:           getEnv("FINCACHE_AOF_ENABLED", "true") == "true",
+			AOFPath:              getEnv("FINCACHE_AOF_PATH", "./data/appendonly.aof"),
+			AOFFsync:             getEnv("FINCACHE_AOF_FSYNC", "everysec"),
+			AOFRewritePercentage: 100,
+			AOFRewriteMinSize:    64 << 20,
 		},
 		Redis: RedisConfig{
 			Enabled:      getEnv("FINCACHE_REDIS_ENABLED", "false") == "true",
@@ -117,16 +159,56 @@ func loadFromEnv() *Config {
 			WriteTimeout: 3 * time.Second,
 		},
 		API: APIConfig{
-			Enabled:      getEnv("FINCACHE_API_ENABLED", "true") == "true",
-			Port:         apiPort,
-			ReadTimeout:  30 * time.Second,
-			WriteTimeout: 30 * time.Second,
-			CORSEnabled:  getEnv("FINCACHE_CORS_ENABLED", "true") == "true",
-			RateLimit:    rateLimit,
+			Enabled:         getEnv("FINCACHE_API_ENABLED", "true") == "true",
+			Port:            apiPort,
+			ReadTimeout:     30 * time.Second,
+			WriteTimeout:    30 * time.Second,
+			CORSEnabled:     getEnv("FINCACHE_CORS_ENABLED", "true") == "true",
+			RateLimit:       rateLimit,
+			RateLimitPeriod: time.Second,
 		},
 	}
 }
 
+// ParseSize parses a memory size such as "512MB", "1GB" or "1048576" into
+// bytes. Units are binary (1KB = 1024 bytes) and case-insensitive; an empty
+// string yields 0.
+func ParseSize(size string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(size))
+	if s == "" {
+		return 0, nil
+	}
+
+	units := []struct {
+		suffix     string
+		multiplier int64
+	}{
+		{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10},
+		{"T", 1 << 40}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10},
+		{"B", 1},
+	}
+
+	multiplier := int64(1)
+	for _, unit := range units {
+		if strings.HasSuffix(s, unit.suffix) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, unit.suffix))
+			multiplier = unit.multiplier
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", size)
+	}
+
+	bytes := n * float64(multiplier)
+	if bytes > math.MaxInt64 {
+		return 0, fmt.Errorf("size %q is too large", size)
+	}
+	return int64(bytes), nil
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -0,0 +1,221 @@
+package protocol
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/chaitanyayendru/fincache/internal/store"
+)
+
+// handleSetBit serves SETBIT key offset value, replying with the previous
+// bit.
+func (rs *RedisServer) handleSetBit(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 3 {
+		return fmt.Errorf("ERR wrong number of arguments for 'setbit' command")
+	}
+
+	offset, err := strconv.ParseInt(cmd.Args[1], 10, 64)
+	if err != nil {
+		return storeError(store.ErrBitOffset)
+	}
+	value, err := strconv.Atoi(cmd.Args[2])
+	if err != nil {
+		return storeError(store.ErrBitValue)
+	}
+	old, err := rs.db(cmd).SetBit(cmd.Args[0], offset, value)
+	if err != nil {
+		return storeError(err)
+	}
+	return old
+}
+
+// handleGetBit serves GETBIT key offset.
+func (rs *RedisServer) handleGetBit(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 2 {
+		return fmt.Errorf("ERR wrong number of arguments for 'getbit' command")
+	}
+
+	offset, err := strconv.ParseInt(cmd.Args[1], 10, 64)
+	if err != nil {
+		return storeError(store.ErrBitOffset)
+	}
+	bit, err := rs.db(cmd).GetBit(cmd.Args[0], offset)
+	if err != nil {
+		return storeError(err)
+	}
+	return bit
+}
+
+// parseBitRange parses the [start [end [BYTE|BIT]]] arguments of BITCOUNT
+// and BITPOS, returning nil without a start.
+func parseBitRange(args []string) (*store.BitRange, error) {
+	if len(args) == 0 {
+		return nil, nil
+	}
+	if len(args) > 3 {
+		return nil, fmt.Errorf("ERR syntax error")
+	}
+
+	start, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("ERR value is not an integer or out of range")
+	}
+	r := &store.BitRange{Start: start}
+	if len(args) > 1 {
+		end, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("ERR value is not an integer or out of range")
+		}
+		r.End = &end
+	}
+	if len(args) > 2 {
+		switch strings.ToUpper(args[2]) {
+		case "BYTE":
+		case "BIT":
+			r.Bits = true
+		default:
+			return nil, fmt.Errorf("ERR syntax error")
+		}
+	}
+	return r, nil
+}
+
+// handleBitCount serves BITCOUNT key [start end [BYTE|BIT]].
+func (rs *RedisServer) handleBitCount(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 1 {
+		return fmt.Errorf("ERR wrong number of arguments for 'bitcount' command")
+	}
+	if len(cmd.Args) == 2 {
+		return fmt.Errorf("ERR syntax error")
+	}
+
+	r, err := parseBitRange(cmd.Args[1:])
+	if err != nil {
+		return err
+	}
+	count, err := rs.db(cmd).BitCount(cmd.Args[0], r)
+	if err != nil {
+		return storeError(err)
+	}
+	return int(count)
+}
+
+// handleBitPos serves BITPOS key bit [start [end [BYTE|BIT]]].
+func (rs *RedisServer) handleBitPos(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 2 {
+		return fmt.Errorf("ERR wrong number of arguments for 'bitpos' command")
+	}
+
+	bit, err := strconv.Atoi(cmd.Args[1])
+	if err != nil || bit != 0 && bit != 1 {
+		return fmt.Errorf("ERR The bit argument must be 1 or 0.")
+	}
+	r, err := parseBitRange(cmd.Args[2:])
+	if err != nil {
+		return err
+	}
+	pos, err := rs.db(cmd).BitPos(cmd.Args[0], bit, r)
+	if err != nil {
+		return storeError(err)
+	}
+	return int(pos)
+}
+
+// handleBitOp serves BITOP AND|OR|XOR|NOT destkey key [key ...], replying
+// with the length of the result.
+func (rs *RedisServer) handleBitOp(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 3 {
+		return fmt.Errorf("ERR wrong number of arguments for 'bitop' command")
+	}
+
+	switch strings.ToUpper(cmd.Args[0]) {
+	case "AND", "OR", "XOR", "NOT":
+	default:
+		return fmt.Errorf("ERR syntax error")
+	}
+	n, err := rs.db(cmd).BitOp(cmd.Args[0], cmd.Args[1], cmd.Args[2:]...)
+	if err != nil {
+		return storeError(err)
+	}
+	return int(n)
+}
+
+// handleBitField serves BITFIELD key [GET type offset] [SET type offset
+// value] [INCRBY type offset increment] [OVERFLOW WRAP|SAT|FAIL] ...,
+// replying with a value per GET, SET and INCRBY. An offset prefixed with #
+// counts in units of the type, e.g. #2 of u8 is bit 16.
+func (rs *RedisServer) handleBitField(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 1 {
+		return fmt.Errorf("ERR wrong number of arguments for 'bitfield' command")
+	}
+
+	var ops []store.BitFieldOp
+	overflow := store.OverflowWrap
+	args := cmd.Args[1:]
+	for i := 0; i < len(args); {
+		sub := strings.ToUpper(args[i])
+		if sub == "OVERFLOW" {
+			if i+1 >= len(args) {
+				return fmt.Errorf("ERR syntax error")
+			}
+			policy, err := store.ParseOverflow(args[i+1])
+			if err != nil {
+				return fmt.Errorf("ERR %v", err)
+			}
+			overflow = policy
+			i += 2
+			continue
+		}
+
+		var op store.BitFieldOp
+		n := 3
+		switch sub {
+		case "GET":
+			op.Kind = store.BitFieldGet
+		case "SET":
+			op.Kind, n = store.BitFieldSet, 4
+		case "INCRBY":
+			op.Kind, n = store.BitFieldIncrBy, 4
+		default:
+			return fmt.Errorf("ERR syntax error")
+		}
+		if i+n > len(args) {
+			return fmt.Errorf("ERR syntax error")
+		}
+
+		t, err := store.ParseBitFieldType(args[i+1])
+		if err != nil {
+			return storeError(err)
+		}
+		offset := args[i+2]
+		multiplier := int64(1)
+		if strings.HasPrefix(offset, "#") {
+			offset, multiplier = offset[1:], int64(t.Bits)
+		}
+		o, err := strconv.ParseInt(offset, 10, 64)
+		if err != nil || o < 0 || o > 1<<32 {
+			return storeError(store.ErrBitOffset)
+		}
+		op.Type, op.Offset, op.Overflow = t, o*multiplier, overflow
+		if n == 4 {
+			if op.Value, err = strconv.ParseInt(args[i+3], 10, 64); err != nil {
+				return fmt.Errorf("ERR value is not an integer or out of range")
+			}
+		}
+		ops = append(ops, op)
+		i += n
+	}
+
+	results, err := rs.db(cmd).BitField(cmd.Args[0], ops)
+	if err != nil {
+		return storeError(err)
+	}
+	reply := make([]interface{}, len(results))
+	for i, v := range results {
+		if v != nil {
+			reply[i] = int(*v)
+		}
+	}
+	return reply
+}
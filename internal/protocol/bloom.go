@@ -0,0 +1,115 @@
+package protocol
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/chaitanyayendru/fincache/internal/store"
+)
+
+// boolReplies replies with 1 or 0 for each of results.
+func boolReplies(results []bool) []interface{} {
+	reply := make([]interface{}, len(results))
+	for i, ok := range results {
+		reply[i] = boolReply(ok)
+	}
+	return reply
+}
+
+func boolReply(ok bool) int {
+	if ok {
+		return 1
+	}
+	return 0
+}
+
+// handleBFReserve serves BF.RESERVE key error-rate capacity [EXPANSION n]
+// [NONSCALING].
+func (rs *RedisServer) handleBFReserve(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 3 {
+		return fmt.Errorf("ERR wrong number of arguments for 'bf.reserve' command")
+	}
+
+	errorRate, err := strconv.ParseFloat(cmd.Args[1], 64)
+	if err != nil {
+		return fmt.Errorf("ERR bad error rate")
+	}
+	capacity, err := strconv.ParseInt(cmd.Args[2], 10, 64)
+	if err != nil {
+		return fmt.Errorf("ERR bad capacity")
+	}
+	opts := store.BloomOptions{ErrorRate: errorRate, Capacity: capacity}
+	for i := 3; i < len(cmd.Args); i++ {
+		switch strings.ToUpper(cmd.Args[i]) {
+		case "EXPANSION":
+			if i+1 >= len(cmd.Args) {
+				return fmt.Errorf("ERR syntax error")
+			}
+			expansion, err := strconv.Atoi(cmd.Args[i+1])
+			if err != nil || expansion < 1 {
+				return fmt.Errorf("ERR bad expansion")
+			}
+			opts.Expansion = expansion
+			i++
+		case "NONSCALING":
+			opts.NonScaling = true
+		default:
+			return fmt.Errorf("ERR syntax error")
+		}
+	}
+
+	if err := rs.db(cmd).BFReserve(cmd.Args[0], opts); err != nil {
+		return storeError(err)
+	}
+	return "OK"
+}
+
+// handleBFAdd serves BF.ADD key item, replying with 1 if the item was added
+// and 0 if it may have been added before.
+func (rs *RedisServer) handleBFAdd(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 2 {
+		return fmt.Errorf("ERR wrong number of arguments for 'bf.add' command")
+	}
+
+	added, err := rs.db(cmd).BFAdd(cmd.Args[0], cmd.Args[1])
+	if err != nil {
+		return storeError(err)
+	}
+	return boolReply(added[0])
+}
+
+// handleBFMAdd serves BF.MADD key item [item ...]. An error ends the reply
+// after the items added before it.
+func (rs *RedisServer) handleBFMAdd(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 2 {
+		return fmt.Errorf("ERR wrong number of arguments for 'bf.madd' command")
+	}
+
+	added, err := rs.db(cmd).BFAdd(cmd.Args[0], cmd.Args[1:]...)
+	reply := boolReplies(added)
+	if err != nil {
+		if len(added) == 0 {
+			return storeError(err)
+		}
+		reply = append(reply, storeError(err))
+	}
+	return reply
+}
+
+// handleBFExists serves BF.EXISTS key item and, with multi, BF.MEXISTS key
+// item [item ...].
+func (rs *RedisServer) handleBFExists(cmd *RedisCommand, multi bool) interface{} {
+	if len(cmd.Args) < 2 || !multi && len(cmd.Args) != 2 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(cmd.Name))
+	}
+
+	exists, err := rs.db(cmd).BFExists(cmd.Args[0], cmd.Args[1:]...)
+	if err != nil {
+		return storeError(err)
+	}
+	if !multi {
+		return boolReply(exists[0])
+	}
+	return boolReplies(exists)
+}
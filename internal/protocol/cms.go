@@ -0,0 +1,143 @@
+package protocol
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/chaitanyayendru/fincache/internal/store"
+)
+
+// countReplies replies with each of counts as an integer.
+func countReplies(counts []uint64) []interface{} {
+	reply := make([]interface{}, len(counts))
+	for i, count := range counts {
+		reply[i] = int(count)
+	}
+	return reply
+}
+
+// handleCMSInitByDim serves CMS.INITBYDIM key width depth.
+func (rs *RedisServer) handleCMSInitByDim(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 3 {
+		return fmt.Errorf("ERR wrong number of arguments for 'cms.initbydim' command")
+	}
+
+	width, err := strconv.Atoi(cmd.Args[1])
+	if err != nil {
+		return fmt.Errorf("ERR bad width")
+	}
+	depth, err := strconv.Atoi(cmd.Args[2])
+	if err != nil {
+		return fmt.Errorf("ERR bad depth")
+	}
+	if err := rs.db(cmd).CMSInit(cmd.Args[0], width, depth); err != nil {
+		return storeError(err)
+	}
+	return "OK"
+}
+
+// handleCMSInitByProb serves CMS.INITBYPROB key error probability, sizing
+// the sketch to overcount by at most error of the total with the given
+// probability of exceeding it.
+func (rs *RedisServer) handleCMSInitByProb(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 3 {
+		return fmt.Errorf("ERR wrong number of arguments for 'cms.initbyprob' command")
+	}
+
+	errorRate, err := strconv.ParseFloat(cmd.Args[1], 64)
+	if err != nil {
+		return fmt.Errorf("ERR bad error rate")
+	}
+	probability, err := strconv.ParseFloat(cmd.Args[2], 64)
+	if err != nil {
+		return fmt.Errorf("ERR bad probability")
+	}
+	width, depth, err := store.CMSDimensions(errorRate, probability)
+	if err != nil {
+		return storeError(err)
+	}
+	if err := rs.db(cmd).CMSInit(cmd.Args[0], width, depth); err != nil {
+		return storeError(err)
+	}
+	return "OK"
+}
+
+// handleCMSIncrBy serves CMS.INCRBY key item increment [item increment ...],
+// replying with the new count of each item.
+func (rs *RedisServer) handleCMSIncrBy(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 3 || len(cmd.Args)%2 != 1 {
+		return fmt.Errorf("ERR wrong number of arguments for 'cms.incrby' command")
+	}
+
+	items, increments, err := parseIncrements(cmd.Args[1:])
+	if err != nil {
+		return err
+	}
+	counts, err := rs.db(cmd).CMSIncrBy(cmd.Args[0], items, increments)
+	if err != nil {
+		return storeError(err)
+	}
+	return countReplies(counts)
+}
+
+// handleCMSQuery serves CMS.QUERY key item [item ...].
+func (rs *RedisServer) handleCMSQuery(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 2 {
+		return fmt.Errorf("ERR wrong number of arguments for 'cms.query' command")
+	}
+
+	counts, err := rs.db(cmd).CMSQuery(cmd.Args[0], cmd.Args[1:]...)
+	if err != nil {
+		return storeError(err)
+	}
+	return countReplies(counts)
+}
+
+// handleCMSMerge serves CMS.MERGE destination numkeys source [source ...]
+// [WEIGHTS weight [weight ...]].
+func (rs *RedisServer) handleCMSMerge(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 3 {
+		return fmt.Errorf("ERR wrong number of arguments for 'cms.merge' command")
+	}
+
+	numKeys, err := strconv.Atoi(cmd.Args[1])
+	if err != nil || numKeys < 1 || 2+numKeys > len(cmd.Args) {
+		return fmt.Errorf("ERR invalid number of keys")
+	}
+	sources := cmd.Args[2 : 2+numKeys]
+	var weights []uint64
+	if rest := cmd.Args[2+numKeys:]; len(rest) > 0 {
+		if strings.ToUpper(rest[0]) != "WEIGHTS" || len(rest)-1 != numKeys {
+			return fmt.Errorf("ERR syntax error")
+		}
+		for _, arg := range rest[1:] {
+			weight, err := strconv.ParseUint(arg, 10, 64)
+			if err != nil {
+				return fmt.Errorf("ERR bad weight")
+			}
+			weights = append(weights, weight)
+		}
+	}
+
+	if err := rs.db(cmd).CMSMerge(cmd.Args[0], sources, weights); err != nil {
+		return storeError(err)
+	}
+	return "OK"
+}
+
+// parseIncrements splits item increment pairs, as taken by CMS.INCRBY and
+// TOPK.INCRBY.
+func parseIncrements(args []string) ([]string, []uint64, error) {
+	items := make([]string, 0, len(args)/2)
+	increments := make([]uint64, 0, len(args)/2)
+	for i := 0; i < len(args); i += 2 {
+		n, err := strconv.ParseUint(args[i+1], 10, 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("ERR bad increment")
+		}
+		items = append(items, args[i])
+		increments = append(increments, n)
+	}
+	return items, increments, nil
+}
@@ -0,0 +1,91 @@
+package protocol
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/chaitanyayendru/fincache/internal/store"
+)
+
+// handleCFReserve serves CF.RESERVE key capacity [BUCKETSIZE n]
+// [MAXITERATIONS n] [EXPANSION n]. The expansion defaults to 1; 0 makes the
+// filter fail once full.
+func (rs *RedisServer) handleCFReserve(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 2 {
+		return fmt.Errorf("ERR wrong number of arguments for 'cf.reserve' command")
+	}
+
+	capacity, err := strconv.ParseInt(cmd.Args[1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("ERR bad capacity")
+	}
+	opts := store.CuckooOptions{Capacity: capacity, Expansion: 1}
+	for i := 2; i < len(cmd.Args); i += 2 {
+		if i+1 >= len(cmd.Args) {
+			return fmt.Errorf("ERR syntax error")
+		}
+		n, err := strconv.Atoi(cmd.Args[i+1])
+		if err != nil || n < 0 {
+			return fmt.Errorf("ERR value is not an integer or out of range")
+		}
+		switch strings.ToUpper(cmd.Args[i]) {
+		case "BUCKETSIZE":
+			opts.BucketSize = n
+		case "MAXITERATIONS":
+			opts.MaxIterations = n
+		case "EXPANSION":
+			opts.Expansion = n
+		default:
+			return fmt.Errorf("ERR syntax error")
+		}
+	}
+
+	if err := rs.db(cmd).CFReserve(cmd.Args[0], opts); err != nil {
+		return storeError(err)
+	}
+	return "OK"
+}
+
+// handleCFAdd serves CF.ADD key item.
+func (rs *RedisServer) handleCFAdd(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 2 {
+		return fmt.Errorf("ERR wrong number of arguments for 'cf.add' command")
+	}
+
+	if err := rs.db(cmd).CFAdd(cmd.Args[0], cmd.Args[1]); err != nil {
+		return storeError(err)
+	}
+	return 1
+}
+
+// handleCFDel serves CF.DEL key item, replying with 1 if a copy of the item
+// was deleted.
+func (rs *RedisServer) handleCFDel(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 2 {
+		return fmt.Errorf("ERR wrong number of arguments for 'cf.del' command")
+	}
+
+	deleted, err := rs.db(cmd).CFDel(cmd.Args[0], cmd.Args[1])
+	if err != nil {
+		return storeError(err)
+	}
+	return boolReply(deleted)
+}
+
+// handleCFExists serves CF.EXISTS key item and, with multi, CF.MEXISTS key
+// item [item ...].
+func (rs *RedisServer) handleCFExists(cmd *RedisCommand, multi bool) interface{} {
+	if len(cmd.Args) < 2 || !multi && len(cmd.Args) != 2 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(cmd.Name))
+	}
+
+	exists, err := rs.db(cmd).CFExists(cmd.Args[0], cmd.Args[1:]...)
+	if err != nil {
+		return storeError(err)
+	}
+	if !multi {
+		return boolReply(exists[0])
+	}
+	return boolReplies(exists)
+}
@@ -0,0 +1,274 @@
+package protocol
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func (rs *RedisServer) handleHSet(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 3 || len(cmd.Args)%2 != 1 {
+		return fmt.Errorf("ERR wrong number of arguments for 'hset' command")
+	}
+
+	added, err := rs.db(cmd).HSet(cmd.Args[0], cmd.Args[1:]...)
+	if err != nil {
+		return storeError(err)
+	}
+
+	return added
+}
+
+func (rs *RedisServer) handleHGet(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 2 {
+		return fmt.Errorf("ERR wrong number of arguments for 'hget' command")
+	}
+
+	value, exists, err := rs.db(cmd).HGet(cmd.Args[0], cmd.Args[1])
+	if err != nil {
+		return storeError(err)
+	}
+	if !exists {
+		return nil
+	}
+
+	return []byte(value)
+}
+
+func (rs *RedisServer) handleHMGet(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 2 {
+		return fmt.Errorf("ERR wrong number of arguments for 'hmget' command")
+	}
+
+	values, err := rs.db(cmd).HMGet(cmd.Args[0], cmd.Args[1:]...)
+	if err != nil {
+		return storeError(err)
+	}
+
+	reply := make([]interface{}, len(values))
+	for i, value := range values {
+		if value != nil {
+			reply[i] = *value
+		}
+	}
+	return reply
+}
+
+func (rs *RedisServer) handleHDel(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 2 {
+		return fmt.Errorf("ERR wrong number of arguments for 'hdel' command")
+	}
+
+	deleted, err := rs.db(cmd).HDel(cmd.Args[0], cmd.Args[1:]...)
+	if err != nil {
+		return storeError(err)
+	}
+
+	return deleted
+}
+
+func (rs *RedisServer) handleHGetAll(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 1 {
+		return fmt.Errorf("ERR wrong number of arguments for 'hgetall' command")
+	}
+
+	all, err := rs.db(cmd).HGetAll(cmd.Args[0])
+	if err != nil {
+		return storeError(err)
+	}
+
+	fields := make([]string, 0, len(all))
+	for field := range all {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	pairs := make([]string, 0, 2*len(fields))
+	for _, field := range fields {
+		pairs = append(pairs, field, all[field])
+	}
+	return pairs
+}
+
+func (rs *RedisServer) handleHIncrBy(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 3 {
+		return fmt.Errorf("ERR wrong number of arguments for 'hincrby' command")
+	}
+
+	increment, err := strconv.ParseInt(cmd.Args[2], 10, 64)
+	if err != nil {
+		return fmt.Errorf("ERR value is not an integer or out of range")
+	}
+
+	value, err := rs.db(cmd).HIncrBy(cmd.Args[0], cmd.Args[1], increment)
+	if err != nil {
+		return storeError(err)
+	}
+
+	return int(value)
+}
+
+func (rs *RedisServer) handleHIncrByFloat(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 3 {
+		return fmt.Errorf("ERR wrong number of arguments for 'hincrbyfloat' command")
+	}
+
+	increment, err := strconv.ParseFloat(cmd.Args[2], 64)
+	if err != nil {
+		return fmt.Errorf("ERR value is not a valid float")
+	}
+
+	value, err := rs.db(cmd).HIncrByFloat(cmd.Args[0], cmd.Args[1], increment)
+	if err != nil {
+		return storeError(err)
+	}
+
+	return []byte(strconv.FormatFloat(value, 'f', -1, 64))
+}
+
+func (rs *RedisServer) handleHExists(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 2 {
+		return fmt.Errorf("ERR wrong number of arguments for 'hexists' command")
+	}
+
+	exists, err := rs.db(cmd).HExists(cmd.Args[0], cmd.Args[1])
+	if err != nil {
+		return storeError(err)
+	}
+	if !exists {
+		return 0
+	}
+
+	return 1
+}
+
+func (rs *RedisServer) handleHLen(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 1 {
+		return fmt.Errorf("ERR wrong number of arguments for 'hlen' command")
+	}
+
+	n, err := rs.db(cmd).HLen(cmd.Args[0])
+	if err != nil {
+		return storeError(err)
+	}
+
+	return n
+}
+
+func (rs *RedisServer) handleHScan(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 2 {
+		return fmt.Errorf("ERR wrong number of arguments for 'hscan' command")
+	}
+
+	cursor, err := strconv.Atoi(cmd.Args[1])
+	if err != nil || cursor < 0 {
+		return fmt.Errorf("ERR invalid cursor")
+	}
+
+	pattern, count, err := parseScanOptions(cmd.Args[2:])
+	if err != nil {
+		return err
+	}
+
+	next, pairs, err := rs.db(cmd).HScan(cmd.Args[0], cursor, pattern, count)
+	if err != nil {
+		return storeError(err)
+	}
+
+	return []interface{}{strconv.Itoa(next), pairs}
+}
+
+// parseScanOptions parses the optional "MATCH pattern" and "COUNT count"
+// arguments of the SCAN family.
+func parseScanOptions(args []string) (string, int, error) {
+	pattern, count := "", 10
+	for i := 0; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return "", 0, fmt.Errorf("ERR syntax error")
+		}
+		switch strings.ToUpper(args[i]) {
+		case "MATCH":
+			pattern = args[i+1]
+		case "COUNT":
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil || n < 1 {
+				return "", 0, fmt.Errorf("ERR value is not an integer or out of range")
+			}
+			count = n
+		default:
+			return "", 0, fmt.Errorf("ERR syntax error")
+		}
+	}
+	return pattern, count, nil
+}
+
+// parseFieldList parses the "FIELDS numfields field..." tail of the hash
+// field TTL commands.
+func parseFieldList(args []string) ([]string, error) {
+	if len(args) < 3 || strings.ToUpper(args[0]) != "FIELDS" {
+		return nil, fmt.Errorf("ERR mandatory argument FIELDS is missing or not at the right position")
+	}
+
+	n, err := strconv.Atoi(args[1])
+	if err != nil || n < 1 || n != len(args)-2 {
+		return nil, fmt.Errorf("ERR the numfields parameter must match the number of arguments")
+	}
+
+	return args[2:], nil
+}
+
+func (rs *RedisServer) handleHExpire(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 5 {
+		return fmt.Errorf("ERR wrong number of arguments for 'hexpire' command")
+	}
+
+	seconds, err := strconv.ParseInt(cmd.Args[1], 10, 64)
+	if err != nil || seconds < 0 {
+		return fmt.Errorf("ERR value is not an integer or out of range")
+	}
+	fields, err := parseFieldList(cmd.Args[2:])
+	if err != nil {
+		return err
+	}
+
+	results, err := rs.db(cmd).HExpire(cmd.Args[0], time.Duration(seconds)*time.Second, fields...)
+	if err != nil {
+		return storeError(err)
+	}
+
+	reply := make([]interface{}, len(fields))
+	for i := range fields {
+		reply[i] = -2 // the key does not exist
+		if results != nil {
+			reply[i] = results[i]
+		}
+	}
+	return reply
+}
+
+func (rs *RedisServer) handleHTTL(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 4 {
+		return fmt.Errorf("ERR wrong number of arguments for 'httl' command")
+	}
+
+	fields, err := parseFieldList(cmd.Args[1:])
+	if err != nil {
+		return err
+	}
+
+	ttls, err := rs.db(cmd).HTTL(cmd.Args[0], fields...)
+	if err != nil {
+		return storeError(err)
+	}
+
+	reply := make([]interface{}, len(fields))
+	for i := range fields {
+		reply[i] = -2 // the key does not exist
+		if ttls != nil {
+			reply[i] = int(ttls[i])
+		}
+	}
+	return reply
+}
@@ -0,0 +1,119 @@
+package protocol
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chaitanyayendru/fincache/internal/store"
+)
+
+// handleIdemReserve serves IDEM.RESERVE key [FINGERPRINT fingerprint]
+// [PX lock-ttl-ms] [WAIT timeout]. It replies with the state followed by the
+// token for "reserved" or the cached status and body for "completed".
+func (rs *RedisServer) handleIdemReserve(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 1 || len(cmd.Args)%2 != 1 {
+		return fmt.Errorf("ERR wrong number of arguments for 'idem.reserve' command")
+	}
+
+	var opts store.IdempotencyOptions
+	for i := 1; i < len(cmd.Args); i += 2 {
+		value := cmd.Args[i+1]
+		switch strings.ToUpper(cmd.Args[i]) {
+		case "FINGERPRINT":
+			opts.Fingerprint = value
+		case "PX":
+			ms, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || ms <= 0 {
+				return fmt.Errorf("ERR invalid expire time in 'idem.reserve' command")
+			}
+			opts.LockTTL = time.Duration(ms) * time.Millisecond
+		case "WAIT":
+			timeout, err := parseBlockTimeout(value)
+			if err != nil {
+				return err
+			}
+			opts.Wait, opts.Timeout = true, timeout
+		default:
+			return fmt.Errorf("ERR syntax error")
+		}
+	}
+
+	result, err := rs.db(cmd).IdempotencyReserve(rs.ctx, cmd.Args[0], opts)
+	if err != nil {
+		return storeError(err)
+	}
+
+	switch result.State {
+	case store.IdempotencyReserved:
+		return []interface{}{string(result.State), result.Token}
+	case store.IdempotencyCompleted:
+		return []interface{}{string(result.State), result.Status, result.Body}
+	default:
+		return []interface{}{string(result.State)}
+	}
+}
+
+// handleIdemComplete serves IDEM.COMPLETE key token status body [PX ttl-ms].
+func (rs *RedisServer) handleIdemComplete(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 4 && len(cmd.Args) != 6 {
+		return fmt.Errorf("ERR wrong number of arguments for 'idem.complete' command")
+	}
+
+	status, err := strconv.Atoi(cmd.Args[2])
+	if err != nil {
+		return fmt.Errorf("ERR value is not an integer or out of range")
+	}
+	var ttl time.Duration
+	if len(cmd.Args) == 6 {
+		if strings.ToUpper(cmd.Args[4]) != "PX" {
+			return fmt.Errorf("ERR syntax error")
+		}
+		ms, err := strconv.ParseInt(cmd.Args[5], 10, 64)
+		if err != nil || ms <= 0 {
+			return fmt.Errorf("ERR invalid expire time in 'idem.complete' command")
+		}
+		ttl = time.Duration(ms) * time.Millisecond
+	}
+
+	if err := rs.db(cmd).IdempotencyComplete(cmd.Args[0], cmd.Args[1], status, "", []byte(cmd.Args[3]), ttl); err != nil {
+		return storeError(err)
+	}
+
+	return "OK"
+}
+
+// handleIdemRelease serves IDEM.RELEASE key token.
+func (rs *RedisServer) handleIdemRelease(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 2 {
+		return fmt.Errorf("ERR wrong number of arguments for 'idem.release' command")
+	}
+
+	if err := rs.db(cmd).IdempotencyRelease(cmd.Args[0], cmd.Args[1]); err != nil {
+		return storeError(err)
+	}
+
+	return "OK"
+}
+
+// handleIdemGet serves IDEM.GET key, replying like IDEM.RESERVE but with
+// "in-flight" for a reservation and no token.
+func (rs *RedisServer) handleIdemGet(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 1 {
+		return fmt.Errorf("ERR wrong number of arguments for 'idem.get' command")
+	}
+
+	record, exists, err := rs.db(cmd).IdempotencyGet(cmd.Args[0])
+	if err != nil {
+		return storeError(err)
+	}
+	if !exists {
+		return nil
+	}
+
+	if record.State == store.IdempotencyCompleted {
+		return []interface{}{string(record.State), record.Status, record.Body}
+	}
+	return []interface{}{string(record.State)}
+}
@@ -0,0 +1,253 @@
+package protocol
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chaitanyayendru/fincache/internal/store"
+)
+
+func (rs *RedisServer) handleType(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 1 {
+		return fmt.Errorf("ERR wrong number of arguments for 'type' command")
+	}
+
+	return rs.db(cmd).Type(cmd.Args[0])
+}
+
+// handleTTL serves TTL and PTTL, which reply with the time left in unit, and
+// with absolute set EXPIRETIME and PEXPIRETIME, which reply with the expiry
+// as a Unix time in unit.
+func (rs *RedisServer) handleTTL(cmd *RedisCommand, unit time.Duration, absolute bool) interface{} {
+	if len(cmd.Args) != 1 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(cmd.Name))
+	}
+
+	expiresAt, exists := rs.db(cmd).ExpireTime(cmd.Args[0])
+	if !exists {
+		return -2
+	}
+	if expiresAt == nil {
+		return -1
+	}
+	if absolute {
+		return int(expiresAt.UnixMilli() / unit.Milliseconds())
+	}
+	return int((max(time.Until(*expiresAt), 0) + unit/2) / unit)
+}
+
+// handleExpire serves EXPIRE, PEXPIRE, EXPIREAT and PEXPIREAT key time
+// [NX|XX|GT|LT], with time in unit, as a Unix time if absolute is set.
+func (rs *RedisServer) handleExpire(cmd *RedisCommand, unit time.Duration, absolute bool) interface{} {
+	name := strings.ToLower(cmd.Name)
+	if len(cmd.Args) < 2 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", name)
+	}
+
+	n, err := strconv.ParseInt(cmd.Args[1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("ERR value is not an integer or out of range")
+	}
+
+	var opts store.ExpireOptions
+	for _, arg := range cmd.Args[2:] {
+		switch strings.ToUpper(arg) {
+		case "NX":
+			opts.NX = true
+		case "XX":
+			opts.XX = true
+		case "GT":
+			opts.GT = true
+		case "LT":
+			opts.LT = true
+		default:
+			return fmt.Errorf("ERR Unsupported option %s", arg)
+		}
+	}
+	if opts.NX && (opts.XX || opts.GT || opts.LT) {
+		return fmt.Errorf("ERR NX and XX, GT or LT options at the same time are not compatible")
+	}
+	if opts.GT && opts.LT {
+		return fmt.Errorf("ERR GT and LT options at the same time are not compatible")
+	}
+
+	invalid := fmt.Errorf("ERR invalid expire time in '%s' command", name)
+	perUnit := unit.Milliseconds()
+	if n > math.MaxInt64/perUnit || n < math.MinInt64/perUnit {
+		return invalid
+	}
+	ms := n * perUnit
+	if !absolute {
+		now := time.Now().UnixMilli()
+		if ms > math.MaxInt64-now {
+			return invalid
+		}
+		ms += now
+	}
+
+	set, err := rs.db(cmd).ExpireAt(cmd.Args[0], time.UnixMilli(ms), opts)
+	if err != nil {
+		return storeError(err)
+	}
+	if set {
+		return 1
+	}
+	return 0
+}
+
+func (rs *RedisServer) handlePersist(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 1 {
+		return fmt.Errorf("ERR wrong number of arguments for 'persist' command")
+	}
+
+	if rs.db(cmd).Persist(cmd.Args[0]) {
+		return 1
+	}
+	return 0
+}
+
+// handleRename serves RENAME and, with nx set, RENAMENX.
+func (rs *RedisServer) handleRename(cmd *RedisCommand, nx bool) interface{} {
+	if len(cmd.Args) != 2 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(cmd.Name))
+	}
+
+	renamed, err := rs.db(cmd).Rename(cmd.Args[0], cmd.Args[1], nx)
+	if err != nil {
+		return storeError(err)
+	}
+	if !nx {
+		return "OK"
+	}
+	if renamed {
+		return 1
+	}
+	return 0
+}
+
+func (rs *RedisServer) handleTouch(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 1 {
+		return fmt.Errorf("ERR wrong number of arguments for 'touch' command")
+	}
+
+	return rs.db(cmd).Touch(cmd.Args...)
+}
+
+func (rs *RedisServer) handleUnlink(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 1 {
+		return fmt.Errorf("ERR wrong number of arguments for 'unlink' command")
+	}
+
+	return rs.db(cmd).Unlink(cmd.Args...)
+}
+
+// handleCopy serves COPY source destination [DB index] [REPLACE].
+func (rs *RedisServer) handleCopy(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 2 {
+		return fmt.Errorf("ERR wrong number of arguments for 'copy' command")
+	}
+
+	index := rs.db(cmd).Index()
+	replace := false
+	for i := 2; i < len(cmd.Args); i++ {
+		switch strings.ToUpper(cmd.Args[i]) {
+		case "DB":
+			if i+1 >= len(cmd.Args) {
+				return fmt.Errorf("ERR syntax error")
+			}
+			n, err := strconv.Atoi(cmd.Args[i+1])
+			if err != nil {
+				return fmt.Errorf("ERR value is not an integer or out of range")
+			}
+			index = n
+			i++
+		case "REPLACE":
+			replace = true
+		default:
+			return fmt.Errorf("ERR syntax error")
+		}
+	}
+
+	copied, err := rs.db(cmd).Copy(cmd.Args[0], cmd.Args[1], index, replace)
+	if err != nil {
+		return storeError(err)
+	}
+	if copied {
+		return 1
+	}
+	return 0
+}
+
+func (rs *RedisServer) handleRandomKey(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 0 {
+		return fmt.Errorf("ERR wrong number of arguments for 'randomkey' command")
+	}
+
+	key, exists := rs.db(cmd).RandomKey()
+	if !exists {
+		return nil
+	}
+	return []byte(key)
+}
+
+func (rs *RedisServer) handleDump(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 1 {
+		return fmt.Errorf("ERR wrong number of arguments for 'dump' command")
+	}
+
+	payload, exists, err := rs.db(cmd).Dump(cmd.Args[0])
+	if err != nil {
+		return storeError(err)
+	}
+	if !exists {
+		return nil
+	}
+	return []byte(payload)
+}
+
+// handleRestore serves RESTORE key ttl payload [REPLACE] [ABSTTL], with ttl
+// in milliseconds, 0 for none.
+func (rs *RedisServer) handleRestore(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 3 {
+		return fmt.Errorf("ERR wrong number of arguments for 'restore' command")
+	}
+
+	ttl, err := strconv.ParseInt(cmd.Args[1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("ERR value is not an integer or out of range")
+	}
+	if ttl < 0 {
+		return fmt.Errorf("ERR Invalid TTL value, must be >= 0")
+	}
+
+	var opts store.RestoreOptions
+	absolute := false
+	for _, arg := range cmd.Args[3:] {
+		switch strings.ToUpper(arg) {
+		case "REPLACE":
+			opts.Replace = true
+		case "ABSTTL":
+			absolute = true
+		default:
+			return fmt.Errorf("ERR syntax error")
+		}
+	}
+	if ttl > 0 {
+		if !absolute {
+			now := time.Now().UnixMilli()
+			if ttl > math.MaxInt64-now {
+				return fmt.Errorf("ERR Invalid TTL value, must be >= 0")
+			}
+			ttl += now
+		}
+		opts.ExpiresAt = time.UnixMilli(ttl)
+	}
+
+	if err := rs.db(cmd).Restore(cmd.Args[0], cmd.Args[2], opts); err != nil {
+		return storeError(err)
+	}
+	return "OK"
+}
@@ -0,0 +1,45 @@
+package protocol
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/chaitanyayendru/fincache/internal/store"
+)
+
+// handleLedgerTransfer serves LEDGER.TRANSFER from to amount idempotency-key
+// [JOURNAL key].
+func (rs *RedisServer) handleLedgerTransfer(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 4 && len(cmd.Args) != 6 {
+		return fmt.Errorf("ERR wrong number of arguments for 'ledger.transfer' command")
+	}
+
+	t := store.LedgerTransfer{
+		From:           cmd.Args[0],
+		To:             cmd.Args[1],
+		Amount:         cmd.Args[2],
+		IdempotencyKey: cmd.Args[3],
+	}
+	if len(cmd.Args) == 6 {
+		if strings.ToUpper(cmd.Args[4]) != "JOURNAL" {
+			return fmt.Errorf("ERR syntax error")
+		}
+		t.Journal = cmd.Args[5]
+	}
+
+	receipt, err := rs.db(cmd).LedgerTransfer(t)
+	if err != nil {
+		return storeError(err)
+	}
+
+	duplicate := 0
+	if receipt.Duplicate {
+		duplicate = 1
+	}
+	return []interface{}{
+		"entry-id", receipt.EntryID,
+		"from-balance", []byte(receipt.FromBalance.String()),
+		"to-balance", []byte(receipt.ToBalance.String()),
+		"duplicate", duplicate,
+	}
+}
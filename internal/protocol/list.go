@@ -0,0 +1,265 @@
+package protocol
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chaitanyayendru/fincache/internal/store"
+)
+
+func (rs *RedisServer) handlePush(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 2 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(cmd.Name))
+	}
+
+	push := rs.db(cmd).RPush
+	if cmd.Name == "LPUSH" {
+		push = rs.db(cmd).LPush
+	}
+	n, err := push(cmd.Args[0], cmd.Args[1:]...)
+	if err != nil {
+		return storeError(err)
+	}
+
+	return n
+}
+
+func (rs *RedisServer) handlePop(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 1 && len(cmd.Args) != 2 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(cmd.Name))
+	}
+
+	count := 1
+	if len(cmd.Args) == 2 {
+		n, err := strconv.Atoi(cmd.Args[1])
+		if err != nil || n < 0 {
+			return fmt.Errorf("ERR value is out of range, must be positive")
+		}
+		count = n
+	}
+
+	pop := rs.db(cmd).RPop
+	if cmd.Name == "LPOP" {
+		pop = rs.db(cmd).LPop
+	}
+	values, err := pop(cmd.Args[0], count)
+	if err != nil {
+		return storeError(err)
+	}
+
+	// Without a count the reply is a single element
+	if len(cmd.Args) == 1 {
+		if len(values) == 0 {
+			return nil
+		}
+		return []byte(values[0])
+	}
+	if values == nil {
+		return nil
+	}
+	return values
+}
+
+func (rs *RedisServer) handleLRange(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 3 {
+		return fmt.Errorf("ERR wrong number of arguments for 'lrange' command")
+	}
+
+	start, err1 := strconv.Atoi(cmd.Args[1])
+	stop, err2 := strconv.Atoi(cmd.Args[2])
+	if err1 != nil || err2 != nil {
+		return fmt.Errorf("ERR value is not an integer or out of range")
+	}
+
+	values, err := rs.db(cmd).LRange(cmd.Args[0], start, stop)
+	if err != nil {
+		return storeError(err)
+	}
+
+	return values
+}
+
+func (rs *RedisServer) handleLLen(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 1 {
+		return fmt.Errorf("ERR wrong number of arguments for 'llen' command")
+	}
+
+	n, err := rs.db(cmd).LLen(cmd.Args[0])
+	if err != nil {
+		return storeError(err)
+	}
+
+	return n
+}
+
+func (rs *RedisServer) handleLIndex(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 2 {
+		return fmt.Errorf("ERR wrong number of arguments for 'lindex' command")
+	}
+
+	index, err := strconv.Atoi(cmd.Args[1])
+	if err != nil {
+		return fmt.Errorf("ERR value is not an integer or out of range")
+	}
+
+	value, ok, err := rs.db(cmd).LIndex(cmd.Args[0], index)
+	if err != nil {
+		return storeError(err)
+	}
+	if !ok {
+		return nil
+	}
+
+	return []byte(value)
+}
+
+func (rs *RedisServer) handleLSet(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 3 {
+		return fmt.Errorf("ERR wrong number of arguments for 'lset' command")
+	}
+
+	index, err := strconv.Atoi(cmd.Args[1])
+	if err != nil {
+		return fmt.Errorf("ERR value is not an integer or out of range")
+	}
+
+	if err := rs.db(cmd).LSet(cmd.Args[0], index, cmd.Args[2]); err != nil {
+		return storeError(err)
+	}
+
+	return "OK"
+}
+
+func (rs *RedisServer) handleLRem(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 3 {
+		return fmt.Errorf("ERR wrong number of arguments for 'lrem' command")
+	}
+
+	count, err := strconv.Atoi(cmd.Args[1])
+	if err != nil {
+		return fmt.Errorf("ERR value is not an integer or out of range")
+	}
+
+	removed, err := rs.db(cmd).LRem(cmd.Args[0], count, cmd.Args[2])
+	if err != nil {
+		return storeError(err)
+	}
+
+	return removed
+}
+
+func (rs *RedisServer) handleLTrim(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 3 {
+		return fmt.Errorf("ERR wrong number of arguments for 'ltrim' command")
+	}
+
+	start, err1 := strconv.Atoi(cmd.Args[1])
+	stop, err2 := strconv.Atoi(cmd.Args[2])
+	if err1 != nil || err2 != nil {
+		return fmt.Errorf("ERR value is not an integer or out of range")
+	}
+
+	if err := rs.db(cmd).LTrim(cmd.Args[0], start, stop); err != nil {
+		return storeError(err)
+	}
+
+	return "OK"
+}
+
+func (rs *RedisServer) handleLMove(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 4 {
+		return fmt.Errorf("ERR wrong number of arguments for 'lmove' command")
+	}
+
+	from, ok1 := store.ParseListEnd(cmd.Args[2])
+	to, ok2 := store.ParseListEnd(cmd.Args[3])
+	if !ok1 || !ok2 {
+		return fmt.Errorf("ERR syntax error")
+	}
+
+	value, ok, err := rs.db(cmd).LMove(cmd.Args[0], cmd.Args[1], from, to)
+	if err != nil {
+		return storeError(err)
+	}
+	if !ok {
+		return nil
+	}
+
+	return []byte(value)
+}
+
+// handleBPop serves BLPOP and BRPOP. The connection is parked until one of
+// the lists receives an element, the timeout passes, the client disconnects
+// or the server stops.
+func (rs *RedisServer) handleBPop(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 2 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(cmd.Name))
+	}
+
+	timeout, err := parseBlockTimeout(cmd.Args[len(cmd.Args)-1])
+	if err != nil {
+		return err
+	}
+
+	bpop := rs.db(cmd).BRPop
+	if cmd.Name == "BLPOP" {
+		bpop = rs.db(cmd).BLPop
+	}
+	ctx, done := rs.blockingContext(cmd)
+	defer done()
+
+	key, value, ok, err := bpop(ctx, cmd.Args[:len(cmd.Args)-1], timeout)
+	if err != nil {
+		return storeError(err)
+	}
+	if !ok {
+		return nil
+	}
+
+	return []string{key, value}
+}
+
+func (rs *RedisServer) handleBLMove(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 5 {
+		return fmt.Errorf("ERR wrong number of arguments for 'blmove' command")
+	}
+
+	from, ok1 := store.ParseListEnd(cmd.Args[2])
+	to, ok2 := store.ParseListEnd(cmd.Args[3])
+	if !ok1 || !ok2 {
+		return fmt.Errorf("ERR syntax error")
+	}
+	timeout, err := parseBlockTimeout(cmd.Args[4])
+	if err != nil {
+		return err
+	}
+
+	ctx, done := rs.blockingContext(cmd)
+	defer done()
+
+	value, ok, err := rs.db(cmd).BLMove(ctx, cmd.Args[0], cmd.Args[1], from, to, timeout)
+	if err != nil {
+		return storeError(err)
+	}
+	if !ok {
+		return nil
+	}
+
+	return []byte(value)
+}
+
+// parseBlockTimeout parses the timeout of a blocking command, in seconds with
+// an optional fraction; 0 blocks for ever.
+func parseBlockTimeout(arg string) (time.Duration, error) {
+	seconds, err := strconv.ParseFloat(arg, 64)
+	if err != nil {
+		return 0, fmt.Errorf("ERR timeout is not a float or out of range")
+	}
+	if seconds < 0 {
+		return 0, fmt.Errorf("ERR timeout is negative")
+	}
+
+	return time.Duration(seconds * float64(time.Second)), nil
+}
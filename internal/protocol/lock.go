@@ -0,0 +1,102 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/chaitanyayendru/fincache/internal/store"
+)
+
+// parseLease parses a lease TTL in milliseconds.
+func parseLease(arg string) (time.Duration, error) {
+	ms, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || ms <= 0 {
+		return 0, fmt.Errorf("ERR invalid lease TTL")
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// handleLockAcquire serves LOCK.ACQUIRE key owner ttl-ms, replying with the
+// fencing token, or nil if the lock is held.
+func (rs *RedisServer) handleLockAcquire(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 3 {
+		return fmt.Errorf("ERR wrong number of arguments for 'lock.acquire' command")
+	}
+
+	ttl, err := parseLease(cmd.Args[2])
+	if err != nil {
+		return err
+	}
+	result, err := rs.db(cmd).LockAcquire(cmd.Args[0], cmd.Args[1], ttl)
+	if err != nil {
+		return storeError(err)
+	}
+	if !result.Acquired {
+		return nil
+	}
+
+	return int(result.Token)
+}
+
+// handleLockRenew serves LOCK.RENEW key owner ttl-ms, replying 1 if the
+// lease was extended and 0 if owner does not hold the lock.
+func (rs *RedisServer) handleLockRenew(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 3 {
+		return fmt.Errorf("ERR wrong number of arguments for 'lock.renew' command")
+	}
+
+	ttl, err := parseLease(cmd.Args[2])
+	if err != nil {
+		return err
+	}
+	return lockReply(rs.db(cmd).LockRenew(cmd.Args[0], cmd.Args[1], ttl))
+}
+
+// handleLockRelease serves LOCK.RELEASE key owner, replying 1 if the lock
+// was released and 0 if owner does not hold it.
+func (rs *RedisServer) handleLockRelease(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 2 {
+		return fmt.Errorf("ERR wrong number of arguments for 'lock.release' command")
+	}
+
+	return lockReply(rs.db(cmd).LockRelease(cmd.Args[0], cmd.Args[1]))
+}
+
+func lockReply(err error) interface{} {
+	switch {
+	case errors.Is(err, store.ErrNotLockOwner):
+		return 0
+	case err != nil:
+		return storeError(err)
+	default:
+		return 1
+	}
+}
+
+// handleLockInfo serves LOCK.INFO key, replying with the owner, fencing token
+// and lease left in milliseconds, or nil if the lock is free.
+func (rs *RedisServer) handleLockInfo(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 1 {
+		return fmt.Errorf("ERR wrong number of arguments for 'lock.info' command")
+	}
+
+	state, ttl, held, err := rs.db(cmd).LockInfo(cmd.Args[0])
+	if err != nil {
+		return storeError(err)
+	}
+	if !held {
+		return nil
+	}
+
+	ms := int(ttl.Milliseconds())
+	if ttl < 0 {
+		ms = -1
+	}
+	return []interface{}{
+		"owner", state.Owner,
+		"token", int(state.Token),
+		"ttl", ms,
+	}
+}
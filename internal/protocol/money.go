@@ -0,0 +1,74 @@
+package protocol
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// handleMoneySet serves MONEY.SET key amount [SCALE scale].
+func (rs *RedisServer) handleMoneySet(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 2 && len(cmd.Args) != 4 {
+		return fmt.Errorf("ERR wrong number of arguments for 'money.set' command")
+	}
+
+	scale := -1
+	if len(cmd.Args) == 4 {
+		if strings.ToUpper(cmd.Args[2]) != "SCALE" {
+			return fmt.Errorf("ERR syntax error")
+		}
+		n, err := strconv.Atoi(cmd.Args[3])
+		if err != nil {
+			return fmt.Errorf("ERR value is not an integer or out of range")
+		}
+		scale = n
+	}
+
+	if _, err := rs.db(cmd).MoneySet(cmd.Args[0], cmd.Args[1], scale); err != nil {
+		return storeError(err)
+	}
+
+	return "OK"
+}
+
+func (rs *RedisServer) handleMoneyGet(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 1 {
+		return fmt.Errorf("ERR wrong number of arguments for 'money.get' command")
+	}
+
+	balance, exists, err := rs.db(cmd).MoneyGet(cmd.Args[0])
+	if err != nil {
+		return storeError(err)
+	}
+	if !exists {
+		return nil
+	}
+
+	return []byte(balance.String())
+}
+
+// handleMoneyAdd serves MONEY.ADD and MONEY.SUB key amount [FLOOR floor].
+func (rs *RedisServer) handleMoneyAdd(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 2 && len(cmd.Args) != 4 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(cmd.Name))
+	}
+
+	floor := ""
+	if len(cmd.Args) == 4 {
+		if strings.ToUpper(cmd.Args[2]) != "FLOOR" {
+			return fmt.Errorf("ERR syntax error")
+		}
+		floor = cmd.Args[3]
+	}
+
+	add := rs.db(cmd).MoneyAdd
+	if cmd.Name == "MONEY.SUB" {
+		add = rs.db(cmd).MoneySub
+	}
+	balance, err := add(cmd.Args[0], cmd.Args[1], floor)
+	if err != nil {
+		return storeError(err)
+	}
+
+	return []byte(balance.String())
+}
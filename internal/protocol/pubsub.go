@@ -1,10 +1,13 @@
 package protocol
 
 import (
+	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/chaitanyayendru/fincache/internal/store"
 	"go.uber.org/zap"
 )
 
@@ -33,7 +36,7 @@ type Subscriber struct {
 	conn     *RedisConnection
 	channels map[string]bool
 	patterns map[string]bool
-	lastSeen time.Time
+	lastSeen atomic.Int64 // Unix nanoseconds of the last message sent
 }
 
 type Message struct {
@@ -49,8 +52,97 @@ type RedisConnection struct {
 	subscribed bool
 }
 
+// pubsubOutputLimit bounds the bytes of published messages waiting to be
+// written to one connection. A subscriber that falls further behind is
+// disconnected, like with Redis's default pubsub client-output-buffer-limit.
+const pubsubOutputLimit = 32 << 20
+
+var (
+	errSubscriberGone = errors.New("subscriber connection closed")
+	errSubscriberSlow = errors.New("subscriber output buffer limit reached")
+)
+
+// ResponseWriter delivers published messages to a connection. Publish runs
+// with store shard locks held for keyspace notifications, so messages are
+// only buffered here and written to the socket by run.
 type ResponseWriter struct {
-	write func([]byte) error
+	write    func([]byte) error
+	overflow func() // called once the buffer limit is hit, to drop the client
+
+	mu      sync.Mutex
+	pending []byte // messages not yet written, in publish order
+	closed  bool
+	wake    chan struct{}
+	done    chan struct{}
+}
+
+func newResponseWriter(write func([]byte) error, overflow func()) *ResponseWriter {
+	w := &ResponseWriter{
+		write:    write,
+		overflow: overflow,
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// send buffers b without blocking.
+func (w *ResponseWriter) send(b []byte) error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return errSubscriberGone
+	}
+	if len(w.pending)+len(b) > pubsubOutputLimit {
+		w.closed, w.pending = true, nil
+		close(w.done)
+		w.mu.Unlock()
+		w.overflow()
+		return errSubscriberSlow
+	}
+	w.pending = append(w.pending, b...)
+	w.mu.Unlock()
+
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (w *ResponseWriter) run() {
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-w.wake:
+		}
+
+		w.mu.Lock()
+		b := w.pending
+		w.pending = nil
+		w.mu.Unlock()
+
+		if len(b) == 0 {
+			continue
+		}
+		if err := w.write(b); err != nil {
+			w.close()
+			return
+		}
+	}
+}
+
+// close stops delivery; messages still buffered are dropped.
+func (w *ResponseWriter) close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.closed {
+		w.closed, w.pending = true, nil
+		close(w.done)
+	}
 }
 
 func NewPubSubManager(logger *zap.Logger) *PubSubManager {
@@ -87,8 +179,8 @@ func (psm *PubSubManager) Subscribe(connID, channelName string, writer *Response
 		id:       connID,
 		conn:     &RedisConnection{id: connID, writer: writer, subscribed: true},
 		channels: make(map[string]bool),
-		lastSeen: time.Now(),
 	}
+	subscriber.lastSeen.Store(time.Now().UnixNano())
 
 	subscriber.channels[channelName] = true
 	channel.subscribers[connID] = subscriber
@@ -121,8 +213,8 @@ func (psm *PubSubManager) PSubscribe(connID, pattern string, writer *ResponseWri
 		id:       connID,
 		conn:     &RedisConnection{id: connID, writer: writer, subscribed: true},
 		patterns: make(map[string]bool),
-		lastSeen: time.Now(),
 	}
+	subscriber.lastSeen.Store(time.Now().UnixNano())
 
 	subscriber.patterns[pattern] = true
 	patternObj.subscribers[connID] = subscriber
@@ -217,9 +309,12 @@ func (psm *PubSubManager) Publish(channelName, message string) int {
 	// Send to pattern subscribers
 	for pattern, patternObj := range psm.patterns {
 		if psm.matchPattern(pattern, channelName) {
+			pmsg := *msg
+			pmsg.Pattern = pattern
+
 			patternObj.mu.RLock()
 			for _, subscriber := range patternObj.subscribers {
-				if err := psm.sendMessage(subscriber, msg); err == nil {
+				if err := psm.sendMessage(subscriber, &pmsg); err == nil {
 					recipients++
 				}
 			}
@@ -227,7 +322,7 @@ func (psm *PubSubManager) Publish(channelName, message string) int {
 		}
 	}
 
-	psm.logger.Info("Message published",
+	psm.logger.Debug("Message published",
 		zap.String("channel", channelName),
 		zap.String("message", message),
 		zap.Int("recipients", recipients))
@@ -239,7 +334,7 @@ func (psm *PubSubManager) sendMessage(subscriber *Subscriber, msg *Message) erro
 	// Format message according to Redis Pub/Sub protocol
 	var response string
 	if msg.Pattern != "" {
-		response = fmt.Sprintf("*3\r\n$8\r\npmessage\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n",
+		response = fmt.Sprintf("*4\r\n$8\r\npmessage\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n",
 			len(msg.Pattern), msg.Pattern,
 			len(msg.Channel), msg.Channel,
 			len(msg.Payload), msg.Payload)
@@ -250,22 +345,14 @@ func (psm *PubSubManager) sendMessage(subscriber *Subscriber, msg *Message) erro
 	}
 
 	// Update last seen
-	subscriber.lastSeen = time.Now()
+	subscriber.lastSeen.Store(time.Now().UnixNano())
 
-	// Send message
-	return subscriber.conn.writer.write([]byte(response))
+	// Buffer message; Publish must not wait for the network
+	return subscriber.conn.writer.send([]byte(response))
 }
 
 func (psm *PubSubManager) matchPattern(pattern, channel string) bool {
-	// Simple pattern matching (can be enhanced with regex)
-	if pattern == "*" {
-		return true
-	}
-	if pattern == channel {
-		return true
-	}
-	// Add more pattern matching logic here
-	return false
+	return store.MatchPattern(pattern, channel)
 }
 
 func (psm *PubSubManager) GetChannels(pattern string) []string {
@@ -305,7 +392,7 @@ func (psm *PubSubManager) cleanupExpiredSubscribers() {
 		for channelName, channel := range psm.channels {
 			channel.mu.Lock()
 			for connID, subscriber := range channel.subscribers {
-				if now.Sub(subscriber.lastSeen) > 30*time.Minute {
+				if now.Sub(time.Unix(0, subscriber.lastSeen.Load())) > 30*time.Minute {
 					delete(channel.subscribers, connID)
 					psm.logger.Info("Removed expired subscriber from channel",
 						zap.String("conn_id", connID),
@@ -322,7 +409,7 @@ func (psm *PubSubManager) cleanupExpiredSubscribers() {
 		for pattern, patternObj := range psm.patterns {
 			patternObj.mu.Lock()
 			for connID, subscriber := range patternObj.subscribers {
-				if now.Sub(subscriber.lastSeen) > 30*time.Minute {
+				if now.Sub(time.Unix(0, subscriber.lastSeen.Load())) > 30*time.Minute {
 					delete(patternObj.subscribers, connID)
 					psm.logger.Info("Removed expired subscriber from pattern",
 						zap.String("conn_id", connID),
@@ -0,0 +1,79 @@
+package protocol
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/chaitanyayendru/fincache/internal/store"
+)
+
+// parseRateLimit parses the mode, limit and period in milliseconds of the
+// rate limit commands.
+func parseRateLimit(args []string) (store.RateLimitConfig, error) {
+	mode, ok := store.ParseRateLimitMode(args[0])
+	if !ok {
+		return store.RateLimitConfig{}, fmt.Errorf("ERR syntax error")
+	}
+	limit, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return store.RateLimitConfig{}, fmt.Errorf("ERR value is not an integer or out of range")
+	}
+	ms, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return store.RateLimitConfig{}, fmt.Errorf("ERR value is not an integer or out of range")
+	}
+
+	return store.RateLimitConfig{Mode: mode, Limit: limit, Period: time.Duration(ms) * time.Millisecond}, nil
+}
+
+// handleRLConfig serves RL.CONFIG key BUCKET|WINDOW limit period-ms.
+func (rs *RedisServer) handleRLConfig(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 4 {
+		return fmt.Errorf("ERR wrong number of arguments for 'rl.config' command")
+	}
+
+	cfg, err := parseRateLimit(cmd.Args[1:])
+	if err != nil {
+		return err
+	}
+	if err := rs.db(cmd).RateLimitConfigure(cmd.Args[0], cfg); err != nil {
+		return storeError(err)
+	}
+
+	return "OK"
+}
+
+// handleRLAcquire serves RL.ACQUIRE key cost [BUCKET|WINDOW limit period-ms],
+// replying with whether it was allowed, what remains and the milliseconds
+// to wait before retrying.
+func (rs *RedisServer) handleRLAcquire(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 2 && len(cmd.Args) != 5 {
+		return fmt.Errorf("ERR wrong number of arguments for 'rl.acquire' command")
+	}
+
+	cost, err := strconv.ParseInt(cmd.Args[1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("ERR value is not an integer or out of range")
+	}
+	var cfg *store.RateLimitConfig
+	if len(cmd.Args) == 5 {
+		c, err := parseRateLimit(cmd.Args[2:])
+		if err != nil {
+			return err
+		}
+		cfg = &c
+	}
+
+	result, err := rs.db(cmd).RateLimitAcquire(cmd.Args[0], cost, cfg)
+	if err != nil {
+		return storeError(err)
+	}
+
+	allowed := 0
+	if result.Allowed {
+		allowed = 1
+	}
+	retryAfter := (result.RetryAfter + time.Millisecond - 1) / time.Millisecond
+	return []interface{}{allowed, int(result.Remaining), int(retryAfter)}
+}
@@ -3,10 +3,13 @@ package protocol
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/chaitanyayendru/fincache/internal/store"
@@ -15,6 +18,7 @@ import (
 
 type RedisServer struct {
 	store  *store.Store
+	pubsub *PubSubManager
 	logger *zap.Logger
 	ctx    context.Context
 	cancel context.CancelFunc
@@ -24,13 +28,76 @@ type RedisCommand struct {
 	Name   string
 	Args   []string
 	Client net.Conn
+
+	session *session
+}
+
+// session holds the per-connection state of a client.
+type session struct {
+	id string
+	db *store.Store // database picked with SELECT
+
+	// ctx is cancelled when the connection is closed or the server stops.
+	ctx    context.Context
+	conn   net.Conn
+	reader *bufio.Reader
+
+	// mu serialises writes to the connection between command replies and
+	// messages published to its subscriptions.
+	mu       sync.Mutex
+	out      *ResponseWriter
+	channels map[string]bool
+	patterns map[string]bool
 }
 
+func (s *session) subscriptions() int {
+	return len(s.channels) + len(s.patterns)
+}
+
+// blockingContext returns the context for a command that parks the
+// connection, such as BLPOP. It is also cancelled when the client hangs up
+// while the command waits: nothing else reads from the connection until the
+// command returns, so a goroutine peeks at it, which leaves any pipelined
+// command in the buffer. The returned function must be called before the
+// next command is read.
+func (s *session) blockingContext() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(s.ctx)
+	watched := make(chan struct{})
+
+	s.conn.SetReadDeadline(time.Time{})
+	go func() {
+		defer close(watched)
+		if _, err := s.reader.Peek(1); err != nil {
+			cancel()
+		}
+	}()
+
+	return ctx, func() {
+		// Interrupt the peek; the read loop resets the deadline
+		s.conn.SetReadDeadline(time.Now())
+		<-watched
+		cancel()
+	}
+}
+
+// maxBulkLen bounds a single command argument, like Redis's default
+// proto-max-bulk-len.
+const maxBulkLen = 512 << 20
+
+// multiReply is written as several consecutive replies, e.g. one
+// confirmation per channel for SUBSCRIBE.
+type multiReply []interface{}
+
 func NewRedisServer(store *store.Store, logger *zap.Logger) *RedisServer {
 	ctx, cancel := context.WithCancel(context.Background())
 
+	// Keyspace notifications are delivered to the server's subscribers
+	pubsub := NewPubSubManager(logger)
+	store.SetPublisher(pubsub)
+
 	return &RedisServer{
 		store:  store,
+		pubsub: pubsub,
 		logger: logger,
 		ctx:    ctx,
 		cancel: cancel,
@@ -73,31 +140,67 @@ func (rs *RedisServer) handleConnection(conn net.Conn) {
 	rs.logger.Info("New Redis client connected",
 		zap.String("remote_addr", conn.RemoteAddr().String()))
 
+	ctx, cancel := context.WithCancel(rs.ctx)
+	defer cancel()
+
 	reader := bufio.NewReader(conn)
 	writer := bufio.NewWriter(conn)
+	sess := &session{
+		id:       conn.RemoteAddr().String(),
+		db:       rs.store,
+		ctx:      ctx,
+		conn:     conn,
+		reader:   reader,
+		channels: make(map[string]bool),
+		patterns: make(map[string]bool),
+	}
+	sess.out = newResponseWriter(func(b []byte) error {
+		sess.mu.Lock()
+		defer sess.mu.Unlock()
+
+		if _, err := writer.Write(b); err != nil {
+			return err
+		}
+		return writer.Flush()
+	}, func() {
+		rs.logger.Warn("Disconnecting slow subscriber", zap.String("conn_id", sess.id))
+		conn.Close()
+	})
+	defer sess.out.close()
+	defer rs.unsubscribeAll(sess)
 
 	for {
 		select {
 		case <-rs.ctx.Done():
 			return
 		default:
-			// Set read timeout
-			conn.SetReadDeadline(time.Now().Add(30 * time.Second))
+			// Set read timeout; subscribers may stay silent indefinitely
+			if sess.subscriptions() > 0 {
+				conn.SetReadDeadline(time.Time{})
+			} else {
+				conn.SetReadDeadline(time.Now().Add(30 * time.Second))
+			}
 
 			command, err := rs.readCommand(reader)
 			if err != nil {
 				rs.logger.Error("Failed to read command", zap.Error(err))
+				sess.mu.Lock()
 				rs.writeError(writer, "ERR "+err.Error())
+				writer.Flush()
+				sess.mu.Unlock()
 				return
 			}
 
 			if command == nil {
 				continue
 			}
+			command.session = sess
 
 			response := rs.executeCommand(command)
+			sess.mu.Lock()
 			rs.writeResponse(writer, response)
 			writer.Flush()
+			sess.mu.Unlock()
 		}
 	}
 }
@@ -141,18 +244,16 @@ func (rs *RedisServer) readCommand(reader *bufio.Reader) (*RedisCommand, error)
 			return nil, fmt.Errorf("invalid argument length")
 		}
 
-		// Read the argument
-		arg := make([]byte, argLen)
-		_, err = reader.Read(arg)
-		if err != nil {
-			return nil, err
+		if argLen < 0 || argLen > maxBulkLen {
+			return nil, fmt.Errorf("invalid argument length")
 		}
 
-		// Read the newline
-		_, err = reader.ReadByte()
-		if err != nil {
+		// Read the argument and its trailing CRLF
+		arg := make([]byte, argLen+2)
+		if _, err := io.ReadFull(reader, arg); err != nil {
 			return nil, err
 		}
+		arg = arg[:argLen]
 
 		args = append(args, string(arg))
 	}
@@ -168,6 +269,15 @@ func (rs *RedisServer) readCommand(reader *bufio.Reader) (*RedisCommand, error)
 }
 
 func (rs *RedisServer) executeCommand(cmd *RedisCommand) interface{} {
+	// A subscribed client may only manage its subscriptions
+	if cmd.session != nil && cmd.session.subscriptions() > 0 {
+		switch cmd.Name {
+		case "SUBSCRIBE", "PSUBSCRIBE", "UNSUBSCRIBE", "PUNSUBSCRIBE", "PING", "QUIT":
+		default:
+			return fmt.Errorf("ERR Can't execute '%s': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT are allowed in this context", strings.ToLower(cmd.Name))
+		}
+	}
+
 	switch cmd.Name {
 	case "PING":
 		return "PONG"
@@ -187,13 +297,317 @@ func (rs *RedisServer) executeCommand(cmd *RedisCommand) interface{} {
 	case "KEYS":
 		return rs.handleKeys(cmd)
 	case "TTL":
-		return rs.handleTTL(cmd)
+		return rs.handleTTL(cmd, time.Second, false)
 	case "EXPIRE":
-		return rs.handleExpire(cmd)
+		return rs.handleExpire(cmd, time.Second, false)
 	case "FLUSHDB":
 		return rs.handleFlushDB(cmd)
+	case "FLUSHALL":
+		return rs.handleFlushAll(cmd)
+	case "SELECT":
+		return rs.handleSelect(cmd)
+	case "MOVE":
+		return rs.handleMove(cmd)
+	case "SWAPDB":
+		return rs.handleSwapDB(cmd)
+	case "DBSIZE":
+		return rs.handleDBSize(cmd)
+	case "OBJECT":
+		return rs.handleObject(cmd)
 	case "INFO":
 		return rs.handleInfo(cmd)
+	case "BGREWRITEAOF":
+		return rs.handleBgRewriteAOF(cmd)
+	case "LPUSH", "RPUSH":
+		return rs.handlePush(cmd)
+	case "LPOP", "RPOP":
+		return rs.handlePop(cmd)
+	case "LRANGE":
+		return rs.handleLRange(cmd)
+	case "LLEN":
+		return rs.handleLLen(cmd)
+	case "LINDEX":
+		return rs.handleLIndex(cmd)
+	case "LSET":
+		return rs.handleLSet(cmd)
+	case "LREM":
+		return rs.handleLRem(cmd)
+	case "LTRIM":
+		return rs.handleLTrim(cmd)
+	case "LMOVE":
+		return rs.handleLMove(cmd)
+	case "BLPOP", "BRPOP":
+		return rs.handleBPop(cmd)
+	case "BLMOVE":
+		return rs.handleBLMove(cmd)
+	case "HSET":
+		return rs.handleHSet(cmd)
+	case "HGET":
+		return rs.handleHGet(cmd)
+	case "HMGET":
+		return rs.handleHMGet(cmd)
+	case "HDEL":
+		return rs.handleHDel(cmd)
+	case "HGETALL":
+		return rs.handleHGetAll(cmd)
+	case "HINCRBY":
+		return rs.handleHIncrBy(cmd)
+	case "HINCRBYFLOAT":
+		return rs.handleHIncrByFloat(cmd)
+	case "HEXISTS":
+		return rs.handleHExists(cmd)
+	case "HLEN":
+		return rs.handleHLen(cmd)
+	case "HSCAN":
+		return rs.handleHScan(cmd)
+	case "HEXPIRE":
+		return rs.handleHExpire(cmd)
+	case "HTTL":
+		return rs.handleHTTL(cmd)
+	case "SADD":
+		return rs.handleSAdd(cmd)
+	case "SREM":
+		return rs.handleSRem(cmd)
+	case "SISMEMBER":
+		return rs.handleSIsMember(cmd)
+	case "SMISMEMBER":
+		return rs.handleSMIsMember(cmd)
+	case "SMEMBERS":
+		return rs.handleSMembers(cmd)
+	case "SCARD":
+		return rs.handleSCard(cmd)
+	case "SPOP":
+		return rs.handleSPop(cmd)
+	case "SRANDMEMBER":
+		return rs.handleSRandMember(cmd)
+	case "SSCAN":
+		return rs.handleSScan(cmd)
+	case "SUNION", "SINTER", "SDIFF":
+		return rs.handleSetAlgebra(cmd)
+	case "SUNIONSTORE", "SINTERSTORE", "SDIFFSTORE":
+		return rs.handleSetAlgebraStore(cmd)
+	case "XADD":
+		return rs.handleXAdd(cmd)
+	case "XTRIM":
+		return rs.handleXTrim(cmd)
+	case "XLEN":
+		return rs.handleXLen(cmd)
+	case "XRANGE", "XREVRANGE":
+		return rs.handleXRange(cmd)
+	case "XREAD":
+		return rs.handleXRead(cmd)
+	case "XREADGROUP":
+		return rs.handleXReadGroup(cmd)
+	case "XGROUP":
+		return rs.handleXGroup(cmd)
+	case "XACK":
+		return rs.handleXAck(cmd)
+	case "XPENDING":
+		return rs.handleXPending(cmd)
+	case "XCLAIM":
+		return rs.handleXClaim(cmd)
+	case "XAUTOCLAIM":
+		return rs.handleXAutoClaim(cmd)
+	case "XINFO":
+		return rs.handleXInfo(cmd)
+	case "MONEY.SET":
+		return rs.handleMoneySet(cmd)
+	case "MONEY.GET":
+		return rs.handleMoneyGet(cmd)
+	case "MONEY.ADD", "MONEY.SUB":
+		return rs.handleMoneyAdd(cmd)
+	case "LEDGER.TRANSFER":
+		return rs.handleLedgerTransfer(cmd)
+	case "IDEM.RESERVE":
+		return rs.handleIdemReserve(cmd)
+	case "IDEM.COMPLETE":
+		return rs.handleIdemComplete(cmd)
+	case "IDEM.RELEASE":
+		return rs.handleIdemRelease(cmd)
+	case "IDEM.GET":
+		return rs.handleIdemGet(cmd)
+	case "RL.CONFIG":
+		return rs.handleRLConfig(cmd)
+	case "RL.ACQUIRE":
+		return rs.handleRLAcquire(cmd)
+	case "LOCK.ACQUIRE":
+		return rs.handleLockAcquire(cmd)
+	case "LOCK.RENEW":
+		return rs.handleLockRenew(cmd)
+	case "LOCK.RELEASE":
+		return rs.handleLockRelease(cmd)
+	case "LOCK.INFO":
+		return rs.handleLockInfo(cmd)
+	case "TS.CREATE":
+		return rs.handleTSCreate(cmd)
+	case "TS.ADD":
+		return rs.handleTSAdd(cmd)
+	case "TS.MADD":
+		return rs.handleTSMAdd(cmd)
+	case "TS.GET":
+		return rs.handleTSGet(cmd)
+	case "TS.RANGE":
+		return rs.handleTSRange(cmd, false)
+	case "TS.REVRANGE":
+		return rs.handleTSRange(cmd, true)
+	case "TS.MRANGE":
+		return rs.handleTSMRange(cmd, false)
+	case "TS.MREVRANGE":
+		return rs.handleTSMRange(cmd, true)
+	case "TS.CREATERULE":
+		return rs.handleTSCreateRule(cmd)
+	case "TS.DELETERULE":
+		return rs.handleTSDeleteRule(cmd)
+	case "TS.INFO":
+		return rs.handleTSInfo(cmd)
+	case "BF.RESERVE":
+		return rs.handleBFReserve(cmd)
+	case "BF.ADD":
+		return rs.handleBFAdd(cmd)
+	case "BF.MADD":
+		return rs.handleBFMAdd(cmd)
+	case "BF.EXISTS":
+		return rs.handleBFExists(cmd, false)
+	case "BF.MEXISTS":
+		return rs.handleBFExists(cmd, true)
+	case "CF.RESERVE":
+		return rs.handleCFReserve(cmd)
+	case "CF.ADD":
+		return rs.handleCFAdd(cmd)
+	case "CF.DEL":
+		return rs.handleCFDel(cmd)
+	case "CF.EXISTS":
+		return rs.handleCFExists(cmd, false)
+	case "CF.MEXISTS":
+		return rs.handleCFExists(cmd, true)
+	case "CMS.INITBYDIM":
+		return rs.handleCMSInitByDim(cmd)
+	case "CMS.INITBYPROB":
+		return rs.handleCMSInitByProb(cmd)
+	case "CMS.INCRBY":
+		return rs.handleCMSIncrBy(cmd)
+	case "CMS.QUERY":
+		return rs.handleCMSQuery(cmd)
+	case "CMS.MERGE":
+		return rs.handleCMSMerge(cmd)
+	case "TOPK.RESERVE":
+		return rs.handleTopKReserve(cmd)
+	case "TOPK.ADD":
+		return rs.handleTopKAdd(cmd)
+	case "TOPK.INCRBY":
+		return rs.handleTopKIncrBy(cmd)
+	case "TOPK.QUERY":
+		return rs.handleTopKQuery(cmd)
+	case "TOPK.LIST":
+		return rs.handleTopKList(cmd)
+	case "TOPK.MERGE":
+		return rs.handleTopKMerge(cmd)
+	case "TDIGEST.CREATE":
+		return rs.handleTDigestCreate(cmd)
+	case "TDIGEST.ADD":
+		return rs.handleTDigestAdd(cmd)
+	case "TDIGEST.QUANTILE":
+		return rs.handleTDigestQuantile(cmd)
+	case "TDIGEST.CDF":
+		return rs.handleTDigestCDF(cmd)
+	case "TDIGEST.MERGE":
+		return rs.handleTDigestMerge(cmd)
+	case "TDIGEST.MIN":
+		return rs.handleTDigestMinMax(cmd, false)
+	case "TDIGEST.MAX":
+		return rs.handleTDigestMinMax(cmd, true)
+	case "TDIGEST.TRIMMED_MEAN":
+		return rs.handleTDigestTrimmedMean(cmd)
+	case "SETBIT":
+		return rs.handleSetBit(cmd)
+	case "GETBIT":
+		return rs.handleGetBit(cmd)
+	case "BITCOUNT":
+		return rs.handleBitCount(cmd)
+	case "BITPOS":
+		return rs.handleBitPos(cmd)
+	case "BITOP":
+		return rs.handleBitOp(cmd)
+	case "BITFIELD":
+		return rs.handleBitField(cmd)
+	case "SETNX":
+		return rs.handleSetNX(cmd)
+	case "SETEX":
+		return rs.handleSetEx(cmd, "EX")
+	case "PSETEX":
+		return rs.handleSetEx(cmd, "PX")
+	case "GETSET":
+		return rs.handleGetSet(cmd)
+	case "GETDEL":
+		return rs.handleGetDel(cmd)
+	case "GETEX":
+		return rs.handleGetEx(cmd)
+	case "INCR":
+		return rs.handleIncrBy(cmd, 1, false)
+	case "DECR":
+		return rs.handleIncrBy(cmd, -1, false)
+	case "INCRBY":
+		return rs.handleIncrBy(cmd, 1, true)
+	case "DECRBY":
+		return rs.handleIncrBy(cmd, -1, true)
+	case "INCRBYFLOAT":
+		return rs.handleIncrByFloat(cmd)
+	case "APPEND":
+		return rs.handleAppend(cmd)
+	case "STRLEN":
+		return rs.handleStrLen(cmd)
+	case "GETRANGE":
+		return rs.handleGetRange(cmd)
+	case "SETRANGE":
+		return rs.handleSetRange(cmd)
+	case "MGET":
+		return rs.handleMGet(cmd)
+	case "MSET":
+		return rs.handleMSet(cmd)
+	case "MSETNX":
+		return rs.handleMSetNX(cmd)
+	case "TYPE":
+		return rs.handleType(cmd)
+	case "PTTL":
+		return rs.handleTTL(cmd, time.Millisecond, false)
+	case "EXPIRETIME":
+		return rs.handleTTL(cmd, time.Second, true)
+	case "PEXPIRETIME":
+		return rs.handleTTL(cmd, time.Millisecond, true)
+	case "PEXPIRE":
+		return rs.handleExpire(cmd, time.Millisecond, false)
+	case "EXPIREAT":
+		return rs.handleExpire(cmd, time.Second, true)
+	case "PEXPIREAT":
+		return rs.handleExpire(cmd, time.Millisecond, true)
+	case "PERSIST":
+		return rs.handlePersist(cmd)
+	case "RENAME":
+		return rs.handleRename(cmd, false)
+	case "RENAMENX":
+		return rs.handleRename(cmd, true)
+	case "TOUCH":
+		return rs.handleTouch(cmd)
+	case "UNLINK":
+		return rs.handleUnlink(cmd)
+	case "COPY":
+		return rs.handleCopy(cmd)
+	case "RANDOMKEY":
+		return rs.handleRandomKey(cmd)
+	case "DUMP":
+		return rs.handleDump(cmd)
+	case "RESTORE":
+		return rs.handleRestore(cmd)
+	case "SUBSCRIBE":
+		return rs.handleSubscribe(cmd)
+	case "PSUBSCRIBE":
+		return rs.handlePSubscribe(cmd)
+	case "UNSUBSCRIBE":
+		return rs.handleUnsubscribe(cmd)
+	case "PUNSUBSCRIBE":
+		return rs.handlePUnsubscribe(cmd)
+	case "PUBLISH":
+		return rs.handlePublish(cmd)
 	case "QUIT":
 		return "OK"
 	default:
@@ -201,47 +615,32 @@ func (rs *RedisServer) executeCommand(cmd *RedisCommand) interface{} {
 	}
 }
 
-func (rs *RedisServer) handleSet(cmd *RedisCommand) interface{} {
-	if len(cmd.Args) < 2 {
-		return fmt.Errorf("ERR wrong number of arguments for 'set' command")
+// storeError turns an error from the store into a reply. Errors that already
+// carry a Redis error code are passed through.
+func storeError(err error) error {
+	if errors.Is(err, store.ErrOutOfMemory) || errors.Is(err, store.ErrWrongType) ||
+		errors.Is(err, store.ErrNoGroup) || errors.Is(err, store.ErrBusyGroup) ||
+		errors.Is(err, store.ErrInsufficientFunds) || errors.Is(err, store.ErrBusyKey) {
+		return err
 	}
+	return fmt.Errorf("ERR %v", err)
+}
 
-	key := cmd.Args[0]
-	value := cmd.Args[1]
-	var ttl time.Duration
-
-	// Check for TTL options
-	for i := 2; i < len(cmd.Args); i++ {
-		switch strings.ToUpper(cmd.Args[i]) {
-		case "EX":
-			if i+1 >= len(cmd.Args) {
-				return fmt.Errorf("ERR wrong number of arguments for 'set' command")
-			}
-			seconds, err := strconv.Atoi(cmd.Args[i+1])
-			if err != nil {
-				return fmt.Errorf("ERR value is not an integer or out of range")
-			}
-			ttl = time.Duration(seconds) * time.Second
-			i++ // Skip the next argument
-		case "PX":
-			if i+1 >= len(cmd.Args) {
-				return fmt.Errorf("ERR wrong number of arguments for 'set' command")
-			}
-			milliseconds, err := strconv.Atoi(cmd.Args[i+1])
-			if err != nil {
-				return fmt.Errorf("ERR value is not an integer or out of range")
-			}
-			ttl = time.Duration(milliseconds) * time.Millisecond
-			i++ // Skip the next argument
-		}
+// db returns the database selected by the client that sent cmd.
+func (rs *RedisServer) db(cmd *RedisCommand) *store.Store {
+	if cmd.session == nil {
+		return rs.store
 	}
+	return cmd.session.db
+}
 
-	err := rs.store.Set(key, value, ttl)
-	if err != nil {
-		return fmt.Errorf("ERR %v", err)
+// blockingContext is session.blockingContext, falling back to the server
+// context for commands that do not come from a connection.
+func (rs *RedisServer) blockingContext(cmd *RedisCommand) (context.Context, func()) {
+	if cmd.session == nil {
+		return rs.ctx, func() {}
 	}
-
-	return "OK"
+	return cmd.session.blockingContext()
 }
 
 func (rs *RedisServer) handleGet(cmd *RedisCommand) interface{} {
@@ -250,11 +649,17 @@ func (rs *RedisServer) handleGet(cmd *RedisCommand) interface{} {
 	}
 
 	key := cmd.Args[0]
-	value, err := rs.store.Get(key)
+	value, err := rs.db(cmd).Get(key)
+	if errors.Is(err, store.ErrWrongType) {
+		return err
+	}
 	if err != nil {
 		return nil // Redis returns nil for non-existent keys
 	}
 
+	if str, ok := value.(string); ok {
+		return []byte(str)
+	}
 	return value
 }
 
@@ -263,15 +668,7 @@ func (rs *RedisServer) handleDel(cmd *RedisCommand) interface{} {
 		return fmt.Errorf("ERR wrong number of arguments for 'del' command")
 	}
 
-	deleted := 0
-	for _, key := range cmd.Args {
-		err := rs.store.Delete(key)
-		if err == nil {
-			deleted++
-		}
-	}
-
-	return deleted
+	return rs.db(cmd).Del(cmd.Args...)
 }
 
 func (rs *RedisServer) handleExists(cmd *RedisCommand) interface{} {
@@ -281,7 +678,7 @@ func (rs *RedisServer) handleExists(cmd *RedisCommand) interface{} {
 
 	exists := 0
 	for _, key := range cmd.Args {
-		if rs.store.Exists(key) {
+		if rs.db(cmd).Exists(key) {
 			exists++
 		}
 	}
@@ -295,87 +692,321 @@ func (rs *RedisServer) handleKeys(cmd *RedisCommand) interface{} {
 	}
 
 	pattern := cmd.Args[0]
-	keys := rs.store.Keys(pattern)
+	keys := rs.db(cmd).Keys(pattern)
 
 	// Return as array
 	return keys
 }
 
-func (rs *RedisServer) handleTTL(cmd *RedisCommand) interface{} {
+func (rs *RedisServer) handleFlushDB(cmd *RedisCommand) interface{} {
+	err := rs.db(cmd).Flush()
+	if err != nil {
+		return fmt.Errorf("ERR %v", err)
+	}
+
+	return "OK"
+}
+
+func (rs *RedisServer) handleFlushAll(cmd *RedisCommand) interface{} {
+	err := rs.store.FlushAll()
+	if err != nil {
+		return fmt.Errorf("ERR %v", err)
+	}
+
+	return "OK"
+}
+
+func (rs *RedisServer) handleSelect(cmd *RedisCommand) interface{} {
 	if len(cmd.Args) != 1 {
-		return fmt.Errorf("ERR wrong number of arguments for 'ttl' command")
+		return fmt.Errorf("ERR wrong number of arguments for 'select' command")
 	}
 
-	key := cmd.Args[0]
-	ttl, err := rs.store.TTL(key)
+	index, err := strconv.Atoi(cmd.Args[0])
 	if err != nil {
-		return -2 // Key doesn't exist
+		return fmt.Errorf("ERR value is not an integer or out of range")
 	}
 
-	if ttl == -1 {
-		return -1 // No TTL
+	db, err := rs.store.Select(index)
+	if err != nil {
+		return fmt.Errorf("ERR %v", err)
+	}
+	if cmd.session != nil {
+		cmd.session.db = db
 	}
 
-	return int(ttl.Seconds())
+	return "OK"
 }
 
-func (rs *RedisServer) handleExpire(cmd *RedisCommand) interface{} {
+func (rs *RedisServer) handleMove(cmd *RedisCommand) interface{} {
 	if len(cmd.Args) != 2 {
-		return fmt.Errorf("ERR wrong number of arguments for 'expire' command")
+		return fmt.Errorf("ERR wrong number of arguments for 'move' command")
 	}
 
-	key := cmd.Args[0]
-	seconds, err := strconv.Atoi(cmd.Args[1])
+	index, err := strconv.Atoi(cmd.Args[1])
 	if err != nil {
 		return fmt.Errorf("ERR value is not an integer or out of range")
 	}
 
-	err = rs.store.Expire(key, time.Duration(seconds)*time.Second)
+	moved, err := rs.db(cmd).Move(cmd.Args[0], index)
 	if err != nil {
-		return 0 // Key doesn't exist
+		return fmt.Errorf("ERR %v", err)
+	}
+	if !moved {
+		return 0
 	}
 
-	return 1 // Success
+	return 1
 }
 
-func (rs *RedisServer) handleFlushDB(cmd *RedisCommand) interface{} {
-	err := rs.store.Flush()
-	if err != nil {
+func (rs *RedisServer) handleSwapDB(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 2 {
+		return fmt.Errorf("ERR wrong number of arguments for 'swapdb' command")
+	}
+
+	a, errA := strconv.Atoi(cmd.Args[0])
+	b, errB := strconv.Atoi(cmd.Args[1])
+	if errA != nil || errB != nil {
+		return fmt.Errorf("ERR invalid DB index")
+	}
+
+	if err := rs.store.SwapDB(a, b); err != nil {
 		return fmt.Errorf("ERR %v", err)
 	}
 
 	return "OK"
 }
 
+func (rs *RedisServer) handleDBSize(cmd *RedisCommand) interface{} {
+	return int(rs.db(cmd).DBSize())
+}
+
+func (rs *RedisServer) handleObject(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 1 {
+		return fmt.Errorf("ERR wrong number of arguments for 'object' command")
+	}
+
+	switch strings.ToUpper(cmd.Args[0]) {
+	case "FREQ":
+		if len(cmd.Args) != 2 {
+			return fmt.Errorf("ERR wrong number of arguments for 'object|freq' command")
+		}
+		freq, err := rs.db(cmd).ObjectFreq(cmd.Args[1])
+		if errors.Is(err, store.ErrLFUNotSelected) {
+			return fmt.Errorf("ERR %v", err)
+		}
+		if err != nil {
+			return nil
+		}
+		return freq
+	default:
+		return fmt.Errorf("ERR unknown subcommand '%s'", cmd.Args[0])
+	}
+}
+
+func (rs *RedisServer) handleBgRewriteAOF(cmd *RedisCommand) interface{} {
+	go func() {
+		if err := rs.store.RewriteAOF(); err != nil {
+			rs.logger.Error("Background AOF rewrite failed", zap.Error(err))
+		}
+	}()
+
+	return "Background append only file rewriting started"
+}
+
+func (rs *RedisServer) handleSubscribe(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 1 {
+		return fmt.Errorf("ERR wrong number of arguments for 'subscribe' command")
+	}
+	sess := cmd.session
+	if sess == nil {
+		return fmt.Errorf("ERR subscriptions need a client connection")
+	}
+
+	var replies multiReply
+	for _, channel := range cmd.Args {
+		if !sess.channels[channel] {
+			rs.pubsub.Subscribe(sess.id, channel, sess.out)
+			sess.channels[channel] = true
+		}
+		replies = append(replies, []interface{}{"subscribe", channel, sess.subscriptions()})
+	}
+	return replies
+}
+
+func (rs *RedisServer) handlePSubscribe(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 1 {
+		return fmt.Errorf("ERR wrong number of arguments for 'psubscribe' command")
+	}
+	sess := cmd.session
+	if sess == nil {
+		return fmt.Errorf("ERR subscriptions need a client connection")
+	}
+
+	var replies multiReply
+	for _, pattern := range cmd.Args {
+		if !sess.patterns[pattern] {
+			rs.pubsub.PSubscribe(sess.id, pattern, sess.out)
+			sess.patterns[pattern] = true
+		}
+		replies = append(replies, []interface{}{"psubscribe", pattern, sess.subscriptions()})
+	}
+	return replies
+}
+
+func (rs *RedisServer) handleUnsubscribe(cmd *RedisCommand) interface{} {
+	sess := cmd.session
+	if sess == nil {
+		return fmt.Errorf("ERR subscriptions need a client connection")
+	}
+
+	channels := cmd.Args
+	if len(channels) == 0 {
+		for channel := range sess.channels {
+			channels = append(channels, channel)
+		}
+	}
+
+	var replies multiReply
+	for _, channel := range channels {
+		rs.pubsub.Unsubscribe(sess.id, channel)
+		delete(sess.channels, channel)
+		replies = append(replies, []interface{}{"unsubscribe", channel, sess.subscriptions()})
+	}
+	if len(replies) == 0 {
+		replies = append(replies, []interface{}{"unsubscribe", nil, sess.subscriptions()})
+	}
+	return replies
+}
+
+func (rs *RedisServer) handlePUnsubscribe(cmd *RedisCommand) interface{} {
+	sess := cmd.session
+	if sess == nil {
+		return fmt.Errorf("ERR subscriptions need a client connection")
+	}
+
+	patterns := cmd.Args
+	if len(patterns) == 0 {
+		for pattern := range sess.patterns {
+			patterns = append(patterns, pattern)
+		}
+	}
+
+	var replies multiReply
+	for _, pattern := range patterns {
+		rs.pubsub.PUnsubscribe(sess.id, pattern)
+		delete(sess.patterns, pattern)
+		replies = append(replies, []interface{}{"punsubscribe", pattern, sess.subscriptions()})
+	}
+	if len(replies) == 0 {
+		replies = append(replies, []interface{}{"punsubscribe", nil, sess.subscriptions()})
+	}
+	return replies
+}
+
+// unsubscribeAll drops the subscriptions of a client that disconnected.
+func (rs *RedisServer) unsubscribeAll(sess *session) {
+	for channel := range sess.channels {
+		rs.pubsub.Unsubscribe(sess.id, channel)
+	}
+	for pattern := range sess.patterns {
+		rs.pubsub.PUnsubscribe(sess.id, pattern)
+	}
+}
+
+func (rs *RedisServer) handlePublish(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 2 {
+		return fmt.Errorf("ERR wrong number of arguments for 'publish' command")
+	}
+
+	return rs.pubsub.Publish(cmd.Args[0], cmd.Args[1])
+}
+
+// infoSections lists the INFO sections in the order they are printed.
+var infoSections = []string{"server", "stats", "memory", "keyspace"}
+
 func (rs *RedisServer) handleInfo(cmd *RedisCommand) interface{} {
+	wanted := make(map[string]bool)
+	for _, arg := range cmd.Args {
+		switch section := strings.ToLower(arg); section {
+		case "all", "default", "everything":
+			for _, name := range infoSections {
+				wanted[name] = true
+			}
+		default:
+			wanted[section] = true
+		}
+	}
+	if len(wanted) == 0 {
+		for _, name := range infoSections {
+			wanted[name] = true
+		}
+	}
+
 	stats := rs.store.Stats()
+	var b strings.Builder
+
+	for _, section := range infoSections {
+		if !wanted[section] {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString("\r\n")
+		}
+
+		switch section {
+		case "server":
+			b.WriteString("# Server\r\n")
+			b.WriteString("redis_version:1.0.0\r\n")
+			b.WriteString("os:Go\r\n")
+			b.WriteString("tcp_port:6379\r\n")
+		case "stats":
+			b.WriteString("# Stats\r\n")
+			fmt.Fprintf(&b, "keyspace_hits:%d\r\n", stats.KeyspaceHits)
+			fmt.Fprintf(&b, "keyspace_misses:%d\r\n", stats.KeyspaceMisses)
+			fmt.Fprintf(&b, "keyspace_hit_rate:%.4f\r\n", stats.HitRate)
+			fmt.Fprintf(&b, "expired_keys:%d\r\n", stats.ExpiredKeys)
+			fmt.Fprintf(&b, "evicted_keys:%d\r\n", stats.Evictions)
+		case "memory":
+			b.WriteString("# Memory\r\n")
+			fmt.Fprintf(&b, "used_memory:%d\r\n", stats.MemoryUsage)
+			fmt.Fprintf(&b, "used_memory_human:%s\r\n", bytesToHuman(stats.MemoryUsage))
+			fmt.Fprintf(&b, "maxmemory:%d\r\n", stats.MaxMemory)
+			fmt.Fprintf(&b, "maxmemory_human:%s\r\n", bytesToHuman(stats.MaxMemory))
+			fmt.Fprintf(&b, "maxmemory_policy:%s\r\n", rs.store.EvictionPolicy())
+		case "keyspace":
+			b.WriteString("# Keyspace\r\n")
+			for _, db := range rs.store.DBStats() {
+				fmt.Fprintf(&b, "db%d:keys=%d,expires=%d,avg_ttl=%d\r\n",
+					db.DB, db.Keys, db.Expires, db.AvgTTL)
+
+				var types []string
+				for _, typ := range rs.store.KeyTypes() {
+					if n := db.KeysByType[typ]; n > 0 {
+						types = append(types, fmt.Sprintf("%s=%d", typ, n))
+					}
+				}
+				fmt.Fprintf(&b, "db%d_types:%s\r\n", db.DB, strings.Join(types, ","))
+			}
+		}
+	}
+
+	// Multi-line replies must go out as a bulk string
+	return []byte(b.String())
+}
 
-	info := fmt.Sprintf(`# Server
-redis_version:1.0.0
-os:Go
-tcp_port:6379
-uptime_in_seconds:%d
-total_connections_received:0
-total_commands_processed:0
-
-# Keyspace
-db0:keys=%d,expires=0,avg_ttl=0
-
-# Memory
-used_memory:%d
-used_memory_human:%d
-used_memory_peak:%d
-used_memory_peak_human:%d
-`,
-		time.Now().Unix(),
-		stats.TotalKeys,
-		stats.MemoryUsage,
-		stats.MemoryUsage,
-		stats.MemoryUsage,
-		stats.MemoryUsage,
-	)
-
-	return info
+// bytesToHuman formats a byte count the way Redis does in INFO, e.g. "1.50M".
+func bytesToHuman(n int64) string {
+	units := []string{"B", "K", "M", "G", "T"}
+	value := float64(n)
+	i := 0
+	for value >= 1024 && i < len(units)-1 {
+		value /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%dB", n)
+	}
+	return fmt.Sprintf("%.2f%s", value, units[i])
 }
 
 func (rs *RedisServer) writeResponse(writer *bufio.Writer, response interface{}) {
@@ -386,6 +1017,21 @@ func (rs *RedisServer) writeResponse(writer *bufio.Writer, response interface{})
 		rs.writeInteger(writer, v)
 	case []string:
 		rs.writeArray(writer, v)
+	case []byte:
+		rs.writeBulkString(writer, string(v))
+	case []interface{}:
+		writer.WriteString("*" + strconv.Itoa(len(v)) + "\r\n")
+		for _, elem := range v {
+			if s, ok := elem.(string); ok {
+				rs.writeBulkString(writer, s)
+			} else {
+				rs.writeResponse(writer, elem)
+			}
+		}
+	case multiReply:
+		for _, reply := range v {
+			rs.writeResponse(writer, reply)
+		}
 	case nil:
 		rs.writeNull(writer)
 	case error:
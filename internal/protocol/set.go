@@ -0,0 +1,223 @@
+package protocol
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func (rs *RedisServer) handleSAdd(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 2 {
+		return fmt.Errorf("ERR wrong number of arguments for 'sadd' command")
+	}
+
+	added, err := rs.db(cmd).SAdd(cmd.Args[0], cmd.Args[1:]...)
+	if err != nil {
+		return storeError(err)
+	}
+
+	return added
+}
+
+func (rs *RedisServer) handleSRem(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 2 {
+		return fmt.Errorf("ERR wrong number of arguments for 'srem' command")
+	}
+
+	removed, err := rs.db(cmd).SRem(cmd.Args[0], cmd.Args[1:]...)
+	if err != nil {
+		return storeError(err)
+	}
+
+	return removed
+}
+
+func (rs *RedisServer) handleSIsMember(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 2 {
+		return fmt.Errorf("ERR wrong number of arguments for 'sismember' command")
+	}
+
+	isMember, err := rs.db(cmd).SIsMember(cmd.Args[0], cmd.Args[1])
+	if err != nil {
+		return storeError(err)
+	}
+	if !isMember {
+		return 0
+	}
+
+	return 1
+}
+
+func (rs *RedisServer) handleSMIsMember(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 2 {
+		return fmt.Errorf("ERR wrong number of arguments for 'smismember' command")
+	}
+
+	results, err := rs.db(cmd).SMIsMember(cmd.Args[0], cmd.Args[1:]...)
+	if err != nil {
+		return storeError(err)
+	}
+
+	reply := make([]interface{}, len(results))
+	for i, isMember := range results {
+		reply[i] = 0
+		if isMember {
+			reply[i] = 1
+		}
+	}
+	return reply
+}
+
+func (rs *RedisServer) handleSMembers(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 1 {
+		return fmt.Errorf("ERR wrong number of arguments for 'smembers' command")
+	}
+
+	members, err := rs.db(cmd).SMembers(cmd.Args[0])
+	if err != nil {
+		return storeError(err)
+	}
+
+	sort.Strings(members)
+	return members
+}
+
+func (rs *RedisServer) handleSCard(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 1 {
+		return fmt.Errorf("ERR wrong number of arguments for 'scard' command")
+	}
+
+	n, err := rs.db(cmd).SCard(cmd.Args[0])
+	if err != nil {
+		return storeError(err)
+	}
+
+	return n
+}
+
+func (rs *RedisServer) handleSPop(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 1 || len(cmd.Args) > 2 {
+		return fmt.Errorf("ERR wrong number of arguments for 'spop' command")
+	}
+
+	count := 1
+	if len(cmd.Args) == 2 {
+		n, err := strconv.Atoi(cmd.Args[1])
+		if err != nil || n < 0 {
+			return fmt.Errorf("ERR value is out of range, must be positive")
+		}
+		count = n
+	}
+
+	members, err := rs.db(cmd).SPop(cmd.Args[0], count)
+	if err != nil {
+		return storeError(err)
+	}
+
+	// Without a count the reply is a single member
+	if len(cmd.Args) == 1 {
+		if len(members) == 0 {
+			return nil
+		}
+		return []byte(members[0])
+	}
+	if members == nil {
+		members = []string{}
+	}
+	return members
+}
+
+func (rs *RedisServer) handleSRandMember(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 1 || len(cmd.Args) > 2 {
+		return fmt.Errorf("ERR wrong number of arguments for 'srandmember' command")
+	}
+
+	count := 1
+	if len(cmd.Args) == 2 {
+		n, err := strconv.Atoi(cmd.Args[1])
+		if err != nil {
+			return fmt.Errorf("ERR value is not an integer or out of range")
+		}
+		count = n
+	}
+
+	members, err := rs.db(cmd).SRandMember(cmd.Args[0], count)
+	if err != nil {
+		return storeError(err)
+	}
+
+	// Without a count the reply is a single member
+	if len(cmd.Args) == 1 {
+		if len(members) == 0 {
+			return nil
+		}
+		return []byte(members[0])
+	}
+	return members
+}
+
+func (rs *RedisServer) handleSScan(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 2 {
+		return fmt.Errorf("ERR wrong number of arguments for 'sscan' command")
+	}
+
+	cursor, err := strconv.Atoi(cmd.Args[1])
+	if err != nil || cursor < 0 {
+		return fmt.Errorf("ERR invalid cursor")
+	}
+	pattern, count, err := parseScanOptions(cmd.Args[2:])
+	if err != nil {
+		return err
+	}
+
+	next, members, err := rs.db(cmd).SScan(cmd.Args[0], cursor, pattern, count)
+	if err != nil {
+		return storeError(err)
+	}
+
+	return []interface{}{strconv.Itoa(next), members}
+}
+
+// handleSetAlgebra serves SUNION, SINTER and SDIFF.
+func (rs *RedisServer) handleSetAlgebra(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 1 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(cmd.Name))
+	}
+
+	db := rs.db(cmd)
+	op := map[string]func(...string) ([]string, error){
+		"SUNION": db.SUnion,
+		"SINTER": db.SInter,
+		"SDIFF":  db.SDiff,
+	}[cmd.Name]
+
+	members, err := op(cmd.Args...)
+	if err != nil {
+		return storeError(err)
+	}
+
+	sort.Strings(members)
+	return members
+}
+
+// handleSetAlgebraStore serves SUNIONSTORE, SINTERSTORE and SDIFFSTORE.
+func (rs *RedisServer) handleSetAlgebraStore(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 2 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(cmd.Name))
+	}
+
+	db := rs.db(cmd)
+	op := map[string]func(string, ...string) (int, error){
+		"SUNIONSTORE": db.SUnionStore,
+		"SINTERSTORE": db.SInterStore,
+		"SDIFFSTORE":  db.SDiffStore,
+	}[cmd.Name]
+
+	n, err := op(cmd.Args[0], cmd.Args[1:]...)
+	if err != nil {
+		return storeError(err)
+	}
+
+	return n
+}
@@ -0,0 +1,586 @@
+package protocol
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chaitanyayendru/fincache/internal/store"
+)
+
+// entryReply formats a stream entry as [id, [field, value, ...]], with a nil
+// field list for entries that were trimmed from the stream.
+func entryReply(entry store.StreamEntry) interface{} {
+	if entry.Fields == nil {
+		return []interface{}{entry.ID.String(), nil}
+	}
+	return []interface{}{entry.ID.String(), entry.Fields}
+}
+
+func entriesReply(entries []store.StreamEntry) []interface{} {
+	reply := make([]interface{}, len(entries))
+	for i, entry := range entries {
+		reply[i] = entryReply(entry)
+	}
+	return reply
+}
+
+// streamResultsReply formats the result of XREAD and XREADGROUP, nil if no
+// stream had entries.
+func streamResultsReply(results []store.StreamResult) interface{} {
+	if len(results) == 0 {
+		return nil
+	}
+	reply := make([]interface{}, len(results))
+	for i, result := range results {
+		reply[i] = []interface{}{result.Key, entriesReply(result.Entries)}
+	}
+	return reply
+}
+
+// parseStreamTrim parses "MAXLEN|MINID [=|~] threshold [LIMIT count]" at the
+// start of args and returns the trim and how many arguments it used. The
+// trim is always exact, so "~" and LIMIT are accepted and ignored.
+func parseStreamTrim(args []string) (*store.StreamTrim, int, error) {
+	strategy := strings.ToUpper(args[0])
+	i := 1
+	if i < len(args) && (args[i] == "=" || args[i] == "~") {
+		i++
+	}
+	if i >= len(args) {
+		return nil, 0, fmt.Errorf("ERR syntax error")
+	}
+
+	trim := &store.StreamTrim{}
+	if strategy == "MAXLEN" {
+		n, err := strconv.Atoi(args[i])
+		if err != nil || n < 0 {
+			return nil, 0, fmt.Errorf("ERR The MAXLEN argument must be >= 0.")
+		}
+		trim.MaxLen = n
+	} else {
+		trim.MinID = args[i]
+	}
+	i++
+
+	if i+1 < len(args) && strings.ToUpper(args[i]) == "LIMIT" {
+		if _, err := strconv.Atoi(args[i+1]); err != nil {
+			return nil, 0, fmt.Errorf("ERR value is not an integer or out of range")
+		}
+		i += 2
+	}
+	return trim, i, nil
+}
+
+func (rs *RedisServer) handleXAdd(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 4 {
+		return fmt.Errorf("ERR wrong number of arguments for 'xadd' command")
+	}
+
+	var opts store.XAddOptions
+	i := 1
+options:
+	for i < len(cmd.Args) {
+		switch strings.ToUpper(cmd.Args[i]) {
+		case "NOMKSTREAM":
+			opts.NoMkStream = true
+			i++
+		case "MAXLEN", "MINID":
+			trim, n, err := parseStreamTrim(cmd.Args[i:])
+			if err != nil {
+				return err
+			}
+			opts.Trim = trim
+			i += n
+		default:
+			break options
+		}
+	}
+
+	// What is left is the ID followed by field/value pairs
+	if len(cmd.Args)-i < 3 || (len(cmd.Args)-i)%2 != 1 {
+		return fmt.Errorf("ERR wrong number of arguments for 'xadd' command")
+	}
+
+	id, err := rs.db(cmd).XAdd(cmd.Args[0], cmd.Args[i], cmd.Args[i+1:], opts)
+	if err != nil {
+		return storeError(err)
+	}
+	if id == "" {
+		return nil
+	}
+
+	return []byte(id)
+}
+
+func (rs *RedisServer) handleXTrim(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 3 {
+		return fmt.Errorf("ERR wrong number of arguments for 'xtrim' command")
+	}
+
+	strategy := strings.ToUpper(cmd.Args[1])
+	if strategy != "MAXLEN" && strategy != "MINID" {
+		return fmt.Errorf("ERR syntax error")
+	}
+	trim, n, err := parseStreamTrim(cmd.Args[1:])
+	if err != nil {
+		return err
+	}
+	if n != len(cmd.Args)-1 {
+		return fmt.Errorf("ERR syntax error")
+	}
+
+	removed, err := rs.db(cmd).XTrim(cmd.Args[0], *trim)
+	if err != nil {
+		return storeError(err)
+	}
+
+	return removed
+}
+
+func (rs *RedisServer) handleXLen(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 1 {
+		return fmt.Errorf("ERR wrong number of arguments for 'xlen' command")
+	}
+
+	n, err := rs.db(cmd).XLen(cmd.Args[0])
+	if err != nil {
+		return storeError(err)
+	}
+
+	return n
+}
+
+// handleXRange serves XRANGE and XREVRANGE, which take their bounds in
+// opposite order.
+func (rs *RedisServer) handleXRange(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 3 && len(cmd.Args) != 5 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(cmd.Name))
+	}
+
+	count := 0
+	if len(cmd.Args) == 5 {
+		n, err := strconv.Atoi(cmd.Args[4])
+		if strings.ToUpper(cmd.Args[3]) != "COUNT" {
+			return fmt.Errorf("ERR syntax error")
+		}
+		if err != nil {
+			return fmt.Errorf("ERR value is not an integer or out of range")
+		}
+		if n <= 0 {
+			return []string{}
+		}
+		count = n
+	}
+
+	xrange := rs.db(cmd).XRange
+	if cmd.Name == "XREVRANGE" {
+		xrange = rs.db(cmd).XRevRange
+	}
+	entries, err := xrange(cmd.Args[0], cmd.Args[1], cmd.Args[2], count)
+	if err != nil {
+		return storeError(err)
+	}
+
+	return entriesReply(entries)
+}
+
+// parseXReadArgs parses the options of XREAD and XREADGROUP up to STREAMS
+// and splits the rest into keys and IDs.
+func parseXReadArgs(args []string, group bool) (store.XReadOptions, []string, []string, error) {
+	var opts store.XReadOptions
+	for i := 0; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "COUNT", "BLOCK":
+			if i+1 >= len(args) {
+				return opts, nil, nil, fmt.Errorf("ERR syntax error")
+			}
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil {
+				return opts, nil, nil, fmt.Errorf("ERR value is not an integer or out of range")
+			}
+			if strings.ToUpper(args[i]) == "COUNT" {
+				opts.Count = max(n, 0)
+			} else {
+				if n < 0 {
+					return opts, nil, nil, fmt.Errorf("ERR timeout is negative")
+				}
+				opts.Block, opts.Timeout = true, time.Duration(n)*time.Millisecond
+			}
+			i++
+		case "NOACK":
+			if !group {
+				return opts, nil, nil, fmt.Errorf("ERR syntax error")
+			}
+			opts.NoAck = true
+		case "STREAMS":
+			streams := args[i+1:]
+			if len(streams) == 0 || len(streams)%2 != 0 {
+				return opts, nil, nil, fmt.Errorf("ERR Unbalanced '%s' list of streams: for each stream key an ID or '$' must be specified.", map[bool]string{false: "xread", true: "xreadgroup"}[group])
+			}
+			return opts, streams[:len(streams)/2], streams[len(streams)/2:], nil
+		default:
+			return opts, nil, nil, fmt.Errorf("ERR syntax error")
+		}
+	}
+	return opts, nil, nil, fmt.Errorf("ERR syntax error")
+}
+
+// handleXRead serves XREAD. With BLOCK the connection is parked until one of
+// the streams receives an entry, the timeout passes, the client disconnects
+// or the server stops.
+func (rs *RedisServer) handleXRead(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 3 {
+		return fmt.Errorf("ERR wrong number of arguments for 'xread' command")
+	}
+
+	opts, keys, ids, err := parseXReadArgs(cmd.Args, false)
+	if err != nil {
+		return err
+	}
+
+	ctx, done := rs.blockingContext(cmd)
+	defer done()
+
+	results, err := rs.db(cmd).XRead(ctx, keys, ids, opts)
+	if err != nil {
+		return storeError(err)
+	}
+
+	return streamResultsReply(results)
+}
+
+func (rs *RedisServer) handleXReadGroup(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 6 || strings.ToUpper(cmd.Args[0]) != "GROUP" {
+		return fmt.Errorf("ERR wrong number of arguments for 'xreadgroup' command")
+	}
+
+	opts, keys, ids, err := parseXReadArgs(cmd.Args[3:], true)
+	if err != nil {
+		return err
+	}
+
+	ctx, done := rs.blockingContext(cmd)
+	defer done()
+
+	results, err := rs.db(cmd).XReadGroup(ctx, cmd.Args[1], cmd.Args[2], keys, ids, opts)
+	if err != nil {
+		return storeError(err)
+	}
+
+	return streamResultsReply(results)
+}
+
+func (rs *RedisServer) handleXGroup(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 1 {
+		return fmt.Errorf("ERR wrong number of arguments for 'xgroup' command")
+	}
+
+	db := rs.db(cmd)
+	sub, args := strings.ToUpper(cmd.Args[0]), cmd.Args[1:]
+	switch {
+	case sub == "CREATE" && (len(args) == 3 || len(args) == 4):
+		mkStream := len(args) == 4
+		if mkStream && strings.ToUpper(args[3]) != "MKSTREAM" {
+			return fmt.Errorf("ERR syntax error")
+		}
+		if err := db.XGroupCreate(args[0], args[1], args[2], mkStream); err != nil {
+			if err == store.ErrNoSuchKey {
+				return fmt.Errorf("ERR The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.")
+			}
+			return storeError(err)
+		}
+		return "OK"
+	case sub == "SETID" && len(args) == 3:
+		if err := db.XGroupSetID(args[0], args[1], args[2]); err != nil {
+			return storeError(err)
+		}
+		return "OK"
+	case sub == "DESTROY" && len(args) == 2:
+		destroyed, err := db.XGroupDestroy(args[0], args[1])
+		if err != nil {
+			return storeError(err)
+		}
+		if !destroyed {
+			return 0
+		}
+		return 1
+	case sub == "CREATECONSUMER" && len(args) == 3:
+		created, err := db.XGroupCreateConsumer(args[0], args[1], args[2])
+		if err != nil {
+			return storeError(err)
+		}
+		if !created {
+			return 0
+		}
+		return 1
+	case sub == "DELCONSUMER" && len(args) == 3:
+		pending, err := db.XGroupDelConsumer(args[0], args[1], args[2])
+		if err != nil {
+			return storeError(err)
+		}
+		return pending
+	default:
+		return fmt.Errorf("ERR unknown subcommand or wrong number of arguments for 'xgroup|%s'", strings.ToLower(sub))
+	}
+}
+
+func (rs *RedisServer) handleXAck(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 3 {
+		return fmt.Errorf("ERR wrong number of arguments for 'xack' command")
+	}
+
+	acked, err := rs.db(cmd).XAck(cmd.Args[0], cmd.Args[1], cmd.Args[2:]...)
+	if err != nil {
+		return storeError(err)
+	}
+
+	return acked
+}
+
+// handleXPending serves both forms of XPENDING: the summary, and the
+// extended form "[IDLE min-idle] start end count [consumer]".
+func (rs *RedisServer) handleXPending(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 2 {
+		return fmt.Errorf("ERR wrong number of arguments for 'xpending' command")
+	}
+
+	db := rs.db(cmd)
+	if len(cmd.Args) == 2 {
+		summary, err := db.XPending(cmd.Args[0], cmd.Args[1])
+		if err != nil {
+			return storeError(err)
+		}
+		if summary.Count == 0 {
+			return []interface{}{0, nil, nil, nil}
+		}
+
+		names := make([]string, 0, len(summary.Consumers))
+		for name := range summary.Consumers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		consumers := make([]interface{}, len(names))
+		for i, name := range names {
+			consumers[i] = []string{name, strconv.Itoa(summary.Consumers[name])}
+		}
+		return []interface{}{summary.Count, summary.Lowest, summary.Highest, consumers}
+	}
+
+	args := cmd.Args[2:]
+	var minIdle time.Duration
+	if strings.ToUpper(args[0]) == "IDLE" {
+		if len(args) < 2 {
+			return fmt.Errorf("ERR syntax error")
+		}
+		ms, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("ERR value is not an integer or out of range")
+		}
+		minIdle, args = time.Duration(ms)*time.Millisecond, args[2:]
+	}
+	if len(args) != 3 && len(args) != 4 {
+		return fmt.Errorf("ERR syntax error")
+	}
+	count, err := strconv.Atoi(args[2])
+	if err != nil {
+		return fmt.Errorf("ERR value is not an integer or out of range")
+	}
+	consumer := ""
+	if len(args) == 4 {
+		consumer = args[3]
+	}
+
+	pending, err := db.XPendingRange(cmd.Args[0], cmd.Args[1], args[0], args[1], max(count, 0), consumer, minIdle)
+	if err != nil {
+		return storeError(err)
+	}
+
+	now := time.Now()
+	reply := make([]interface{}, len(pending))
+	for i, pe := range pending {
+		reply[i] = []interface{}{pe.ID.String(), pe.Consumer, int(now.Sub(pe.DeliveredAt).Milliseconds()), pe.Deliveries}
+	}
+	return reply
+}
+
+// claimedReply formats claimed entries, as bare IDs with JUSTID.
+func claimedReply(entries []store.StreamEntry, justID bool) []interface{} {
+	if !justID {
+		return entriesReply(entries)
+	}
+	reply := make([]interface{}, len(entries))
+	for i, entry := range entries {
+		reply[i] = entry.ID.String()
+	}
+	return reply
+}
+
+// parseMinIdle parses a min-idle-time in milliseconds.
+func parseMinIdle(arg string) (time.Duration, error) {
+	ms, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || ms < 0 {
+		return 0, fmt.Errorf("ERR Invalid min-idle-time argument")
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+func (rs *RedisServer) handleXClaim(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 5 {
+		return fmt.Errorf("ERR wrong number of arguments for 'xclaim' command")
+	}
+
+	minIdle, err := parseMinIdle(cmd.Args[3])
+	if err != nil {
+		return err
+	}
+
+	var ids []string
+	var opts store.XClaimOptions
+	args := cmd.Args[4:]
+	for i := 0; i < len(args); i++ {
+		switch option := strings.ToUpper(args[i]); option {
+		case "FORCE":
+			opts.Force = true
+		case "JUSTID":
+			opts.JustID = true
+		case "IDLE", "TIME", "RETRYCOUNT", "LASTID":
+			if i+1 >= len(args) {
+				return fmt.Errorf("ERR syntax error")
+			}
+			i++
+			if option == "LASTID" {
+				opts.LastID = args[i]
+				continue
+			}
+			n, err := strconv.ParseInt(args[i], 10, 64)
+			if err != nil || n < 0 {
+				return fmt.Errorf("ERR Invalid %s option argument for XCLAIM", option)
+			}
+			switch option {
+			case "IDLE":
+				opts.DeliveredAt = time.Now().Add(-time.Duration(n) * time.Millisecond)
+			case "TIME":
+				opts.DeliveredAt = time.UnixMilli(n)
+			default:
+				opts.RetryCount = int(n)
+			}
+		default:
+			// IDs come before the options
+			if opts != (store.XClaimOptions{}) {
+				return fmt.Errorf("ERR syntax error")
+			}
+			ids = append(ids, args[i])
+		}
+	}
+
+	claimed, err := rs.db(cmd).XClaim(cmd.Args[0], cmd.Args[1], cmd.Args[2], minIdle, ids, opts)
+	if err != nil {
+		return storeError(err)
+	}
+
+	return claimedReply(claimed, opts.JustID)
+}
+
+func (rs *RedisServer) handleXAutoClaim(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 5 {
+		return fmt.Errorf("ERR wrong number of arguments for 'xautoclaim' command")
+	}
+
+	minIdle, err := parseMinIdle(cmd.Args[3])
+	if err != nil {
+		return err
+	}
+
+	count, justID := 100, false
+	args := cmd.Args[5:]
+	for i := 0; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "COUNT":
+			if i+1 >= len(args) {
+				return fmt.Errorf("ERR syntax error")
+			}
+			i++
+			if count, err = strconv.Atoi(args[i]); err != nil || count < 1 {
+				return fmt.Errorf("ERR COUNT must be > 0")
+			}
+		case "JUSTID":
+			justID = true
+		default:
+			return fmt.Errorf("ERR syntax error")
+		}
+	}
+
+	next, claimed, deleted, err := rs.db(cmd).XAutoClaim(cmd.Args[0], cmd.Args[1], cmd.Args[2], minIdle, cmd.Args[4], count, justID)
+	if err != nil {
+		return storeError(err)
+	}
+
+	return []interface{}{next, claimedReply(claimed, justID), deleted}
+}
+
+func (rs *RedisServer) handleXInfo(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 2 {
+		return fmt.Errorf("ERR wrong number of arguments for 'xinfo' command")
+	}
+
+	db := rs.db(cmd)
+	sub, args := strings.ToUpper(cmd.Args[0]), cmd.Args[1:]
+	switch {
+	case sub == "STREAM" && len(args) == 1:
+		info, err := db.XInfoStream(args[0])
+		if err != nil {
+			return storeError(err)
+		}
+		var first, last interface{}
+		if info.FirstEntry != nil {
+			first, last = entryReply(*info.FirstEntry), entryReply(*info.LastEntry)
+		}
+		return []interface{}{
+			"length", info.Length,
+			"last-generated-id", info.LastGeneratedID,
+			"entries-added", int(info.EntriesAdded),
+			"groups", info.Groups,
+			"first-entry", first,
+			"last-entry", last,
+		}
+	case sub == "GROUPS" && len(args) == 1:
+		groups, err := db.XInfoGroups(args[0])
+		if err != nil {
+			return storeError(err)
+		}
+		reply := make([]interface{}, len(groups))
+		for i, g := range groups {
+			reply[i] = []interface{}{
+				"name", g.Name,
+				"consumers", g.Consumers,
+				"pending", g.Pending,
+				"last-delivered-id", g.LastDeliveredID,
+			}
+		}
+		return reply
+	case sub == "CONSUMERS" && len(args) == 2:
+		consumers, err := db.XInfoConsumers(args[0], args[1])
+		if err != nil {
+			return storeError(err)
+		}
+		reply := make([]interface{}, len(consumers))
+		for i, c := range consumers {
+			inactive := -1
+			if c.Inactive >= 0 {
+				inactive = int(c.Inactive.Milliseconds())
+			}
+			reply[i] = []interface{}{
+				"name", c.Name,
+				"pending", c.Pending,
+				"idle", int(c.Idle.Milliseconds()),
+				"inactive", inactive,
+			}
+		}
+		return reply
+	default:
+		return fmt.Errorf("ERR unknown subcommand or wrong number of arguments for 'xinfo|%s'", strings.ToLower(sub))
+	}
+}
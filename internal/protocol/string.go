@@ -0,0 +1,342 @@
+package protocol
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chaitanyayendru/fincache/internal/store"
+)
+
+// parseExpiry parses the argument of an EX, PX, EXAT or PXAT option of
+// command into an absolute expiry.
+func parseExpiry(option, arg, command string) (time.Time, error) {
+	n, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("ERR value is not an integer or out of range")
+	}
+	invalid := fmt.Errorf("ERR invalid expire time in '%s' command", command)
+	if n <= 0 {
+		return time.Time{}, invalid
+	}
+	if option == "EX" || option == "EXAT" {
+		if n > math.MaxInt64/1000 {
+			return time.Time{}, invalid
+		}
+		n *= 1000
+	}
+	if option == "EX" || option == "PX" {
+		now := time.Now().UnixMilli()
+		if n > math.MaxInt64-now {
+			return time.Time{}, invalid
+		}
+		n += now
+	}
+	return time.UnixMilli(n), nil
+}
+
+// optionalString turns a string that may be missing into a bulk reply.
+func optionalString(str *string) interface{} {
+	if str == nil {
+		return nil
+	}
+	return []byte(*str)
+}
+
+// handleSet serves SET key value [NX|XX] [GET] [EX s|PX ms|EXAT s|PXAT ms|KEEPTTL].
+func (rs *RedisServer) handleSet(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 2 {
+		return fmt.Errorf("ERR wrong number of arguments for 'set' command")
+	}
+
+	var opts store.SetOptions
+	expiry := ""
+	for i := 2; i < len(cmd.Args); i++ {
+		switch option := strings.ToUpper(cmd.Args[i]); option {
+		case "NX":
+			opts.NX = true
+		case "XX":
+			opts.XX = true
+		case "GET":
+			opts.Get = true
+		case "KEEPTTL", "EX", "PX", "EXAT", "PXAT":
+			if expiry != "" {
+				return fmt.Errorf("ERR syntax error")
+			}
+			expiry = option
+			if option == "KEEPTTL" {
+				opts.KeepTTL = true
+				continue
+			}
+			if i+1 >= len(cmd.Args) {
+				return fmt.Errorf("ERR syntax error")
+			}
+			at, err := parseExpiry(option, cmd.Args[i+1], "set")
+			if err != nil {
+				return err
+			}
+			opts.ExpiresAt = at
+			i++
+		default:
+			return fmt.Errorf("ERR syntax error")
+		}
+	}
+	if opts.NX && opts.XX {
+		return fmt.Errorf("ERR syntax error")
+	}
+
+	old, written, err := rs.db(cmd).SetString(cmd.Args[0], cmd.Args[1], opts)
+	if err != nil {
+		return storeError(err)
+	}
+	if opts.Get {
+		return optionalString(old)
+	}
+	if !written {
+		return nil
+	}
+	return "OK"
+}
+
+// handleSetNX serves SETNX key value, replying 1 if it set the key.
+func (rs *RedisServer) handleSetNX(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 2 {
+		return fmt.Errorf("ERR wrong number of arguments for 'setnx' command")
+	}
+
+	_, written, err := rs.db(cmd).SetString(cmd.Args[0], cmd.Args[1], store.SetOptions{NX: true})
+	if err != nil {
+		return storeError(err)
+	}
+	if written {
+		return 1
+	}
+	return 0
+}
+
+// handleSetEx serves SETEX key seconds value and, with option "PX", PSETEX
+// key milliseconds value.
+func (rs *RedisServer) handleSetEx(cmd *RedisCommand, option string) interface{} {
+	name := "setex"
+	if option == "PX" {
+		name = "psetex"
+	}
+	if len(cmd.Args) != 3 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", name)
+	}
+
+	at, err := parseExpiry(option, cmd.Args[1], name)
+	if err != nil {
+		return err
+	}
+	if _, _, err := rs.db(cmd).SetString(cmd.Args[0], cmd.Args[2], store.SetOptions{ExpiresAt: at}); err != nil {
+		return storeError(err)
+	}
+	return "OK"
+}
+
+func (rs *RedisServer) handleGetSet(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 2 {
+		return fmt.Errorf("ERR wrong number of arguments for 'getset' command")
+	}
+
+	old, err := rs.db(cmd).GetSet(cmd.Args[0], cmd.Args[1])
+	if err != nil {
+		return storeError(err)
+	}
+	return optionalString(old)
+}
+
+func (rs *RedisServer) handleGetDel(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 1 {
+		return fmt.Errorf("ERR wrong number of arguments for 'getdel' command")
+	}
+
+	value, err := rs.db(cmd).GetDel(cmd.Args[0])
+	if err != nil {
+		return storeError(err)
+	}
+	return optionalString(value)
+}
+
+// handleGetEx serves GETEX key [EX s|PX ms|EXAT s|PXAT ms|PERSIST].
+func (rs *RedisServer) handleGetEx(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 1 {
+		return fmt.Errorf("ERR wrong number of arguments for 'getex' command")
+	}
+
+	var opts store.GetExOptions
+	switch rest := cmd.Args[1:]; {
+	case len(rest) == 0:
+	case len(rest) == 1 && strings.EqualFold(rest[0], "PERSIST"):
+		opts.Persist = true
+	case len(rest) == 2:
+		option := strings.ToUpper(rest[0])
+		if option != "EX" && option != "PX" && option != "EXAT" && option != "PXAT" {
+			return fmt.Errorf("ERR syntax error")
+		}
+		at, err := parseExpiry(option, rest[1], "getex")
+		if err != nil {
+			return err
+		}
+		opts.ExpiresAt = at
+	default:
+		return fmt.Errorf("ERR syntax error")
+	}
+
+	value, err := rs.db(cmd).GetEx(cmd.Args[0], opts)
+	if err != nil {
+		return storeError(err)
+	}
+	return optionalString(value)
+}
+
+// handleIncrBy serves INCR, DECR, INCRBY and DECRBY. sign is -1 for the
+// decrements, and by tells whether the command takes an increment.
+func (rs *RedisServer) handleIncrBy(cmd *RedisCommand, sign int64, by bool) interface{} {
+	name := strings.ToLower(cmd.Name)
+	if by && len(cmd.Args) != 2 || !by && len(cmd.Args) != 1 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", name)
+	}
+
+	increment := int64(1)
+	if by {
+		var err error
+		if increment, err = strconv.ParseInt(cmd.Args[1], 10, 64); err != nil {
+			return fmt.Errorf("ERR value is not an integer or out of range")
+		}
+		if sign < 0 && increment == math.MinInt64 {
+			return fmt.Errorf("ERR decrement would overflow")
+		}
+	}
+
+	value, err := rs.db(cmd).IncrBy(cmd.Args[0], sign*increment)
+	if err != nil {
+		return storeError(err)
+	}
+	return int(value)
+}
+
+func (rs *RedisServer) handleIncrByFloat(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 2 {
+		return fmt.Errorf("ERR wrong number of arguments for 'incrbyfloat' command")
+	}
+
+	increment, err := strconv.ParseFloat(cmd.Args[1], 64)
+	if err != nil || math.IsNaN(increment) || math.IsInf(increment, 0) {
+		return fmt.Errorf("ERR value is not a valid float")
+	}
+
+	value, err := rs.db(cmd).IncrByFloat(cmd.Args[0], increment)
+	if err != nil {
+		return storeError(err)
+	}
+	return []byte(strconv.FormatFloat(value, 'f', -1, 64))
+}
+
+func (rs *RedisServer) handleAppend(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 2 {
+		return fmt.Errorf("ERR wrong number of arguments for 'append' command")
+	}
+
+	length, err := rs.db(cmd).Append(cmd.Args[0], cmd.Args[1])
+	if err != nil {
+		return storeError(err)
+	}
+	return length
+}
+
+func (rs *RedisServer) handleStrLen(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 1 {
+		return fmt.Errorf("ERR wrong number of arguments for 'strlen' command")
+	}
+
+	length, err := rs.db(cmd).StrLen(cmd.Args[0])
+	if err != nil {
+		return storeError(err)
+	}
+	return length
+}
+
+// handleGetRange serves GETRANGE key start end.
+func (rs *RedisServer) handleGetRange(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 3 {
+		return fmt.Errorf("ERR wrong number of arguments for 'getrange' command")
+	}
+
+	start, err := strconv.ParseInt(cmd.Args[1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("ERR value is not an integer or out of range")
+	}
+	end, err := strconv.ParseInt(cmd.Args[2], 10, 64)
+	if err != nil {
+		return fmt.Errorf("ERR value is not an integer or out of range")
+	}
+
+	value, err := rs.db(cmd).GetRange(cmd.Args[0], start, end)
+	if err != nil {
+		return storeError(err)
+	}
+	return []byte(value)
+}
+
+// handleSetRange serves SETRANGE key offset value.
+func (rs *RedisServer) handleSetRange(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 3 {
+		return fmt.Errorf("ERR wrong number of arguments for 'setrange' command")
+	}
+
+	offset, err := strconv.ParseInt(cmd.Args[1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("ERR value is not an integer or out of range")
+	}
+
+	length, err := rs.db(cmd).SetRange(cmd.Args[0], offset, cmd.Args[2])
+	if err != nil {
+		return storeError(err)
+	}
+	return length
+}
+
+func (rs *RedisServer) handleMGet(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 1 {
+		return fmt.Errorf("ERR wrong number of arguments for 'mget' command")
+	}
+
+	values := rs.db(cmd).MGet(cmd.Args...)
+	reply := make([]interface{}, len(values))
+	for i, value := range values {
+		if value != nil {
+			reply[i] = *value
+		}
+	}
+	return reply
+}
+
+func (rs *RedisServer) handleMSet(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 2 || len(cmd.Args)%2 != 0 {
+		return fmt.Errorf("ERR wrong number of arguments for 'mset' command")
+	}
+
+	if err := rs.db(cmd).MSet(cmd.Args...); err != nil {
+		return storeError(err)
+	}
+	return "OK"
+}
+
+func (rs *RedisServer) handleMSetNX(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 2 || len(cmd.Args)%2 != 0 {
+		return fmt.Errorf("ERR wrong number of arguments for 'msetnx' command")
+	}
+
+	written, err := rs.db(cmd).MSetNX(cmd.Args...)
+	if err != nil {
+		return storeError(err)
+	}
+	if written {
+		return 1
+	}
+	return 0
+}
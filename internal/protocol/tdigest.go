@@ -0,0 +1,187 @@
+package protocol
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/chaitanyayendru/fincache/internal/store"
+)
+
+// floatReply replies with v as a bulk string, spelling NaN and infinities
+// the way Redis does.
+func floatReply(v float64) []byte {
+	switch {
+	case math.IsNaN(v):
+		return []byte("nan")
+	case math.IsInf(v, 1):
+		return []byte("inf")
+	case math.IsInf(v, -1):
+		return []byte("-inf")
+	}
+	return []byte(strconv.FormatFloat(v, 'f', -1, 64))
+}
+
+func floatReplies(values []float64) []interface{} {
+	reply := make([]interface{}, len(values))
+	for i, v := range values {
+		reply[i] = floatReply(v)
+	}
+	return reply
+}
+
+// parseFloats parses each of args as a float.
+func parseFloats(args []string) ([]float64, error) {
+	values := make([]float64, len(args))
+	for i, arg := range args {
+		v, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return nil, fmt.Errorf("ERR value is not a valid float")
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// handleTDigestCreate serves TDIGEST.CREATE key [COMPRESSION compression].
+func (rs *RedisServer) handleTDigestCreate(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 1 && len(cmd.Args) != 3 {
+		return fmt.Errorf("ERR wrong number of arguments for 'tdigest.create' command")
+	}
+
+	var compression float64
+	if len(cmd.Args) == 3 {
+		if strings.ToUpper(cmd.Args[1]) != "COMPRESSION" {
+			return fmt.Errorf("ERR syntax error")
+		}
+		var err error
+		if compression, err = strconv.ParseFloat(cmd.Args[2], 64); err != nil || compression <= 0 {
+			return fmt.Errorf("ERR bad compression")
+		}
+	}
+
+	if err := rs.db(cmd).TDigestCreate(cmd.Args[0], compression); err != nil {
+		return storeError(err)
+	}
+	return "OK"
+}
+
+// handleTDigestAdd serves TDIGEST.ADD key value [value ...].
+func (rs *RedisServer) handleTDigestAdd(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 2 {
+		return fmt.Errorf("ERR wrong number of arguments for 'tdigest.add' command")
+	}
+
+	values, err := parseFloats(cmd.Args[1:])
+	if err != nil {
+		return err
+	}
+	if err := rs.db(cmd).TDigestAdd(cmd.Args[0], values...); err != nil {
+		return storeError(err)
+	}
+	return "OK"
+}
+
+// handleTDigestQuantile serves TDIGEST.QUANTILE key quantile [quantile ...].
+func (rs *RedisServer) handleTDigestQuantile(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 2 {
+		return fmt.Errorf("ERR wrong number of arguments for 'tdigest.quantile' command")
+	}
+
+	quantiles, err := parseFloats(cmd.Args[1:])
+	if err != nil {
+		return err
+	}
+	values, err := rs.db(cmd).TDigestQuantile(cmd.Args[0], quantiles...)
+	if err != nil {
+		return storeError(err)
+	}
+	return floatReplies(values)
+}
+
+// handleTDigestCDF serves TDIGEST.CDF key value [value ...].
+func (rs *RedisServer) handleTDigestCDF(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 2 {
+		return fmt.Errorf("ERR wrong number of arguments for 'tdigest.cdf' command")
+	}
+
+	values, err := parseFloats(cmd.Args[1:])
+	if err != nil {
+		return err
+	}
+	fractions, err := rs.db(cmd).TDigestCDF(cmd.Args[0], values...)
+	if err != nil {
+		return storeError(err)
+	}
+	return floatReplies(fractions)
+}
+
+// handleTDigestMinMax serves TDIGEST.MIN key and, with largest, TDIGEST.MAX
+// key.
+func (rs *RedisServer) handleTDigestMinMax(cmd *RedisCommand, largest bool) interface{} {
+	if len(cmd.Args) != 1 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(cmd.Name))
+	}
+
+	info, err := rs.db(cmd).TDigestInfo(cmd.Args[0])
+	if err != nil {
+		return storeError(err)
+	}
+	if largest {
+		return floatReply(info.Max)
+	}
+	return floatReply(info.Min)
+}
+
+// handleTDigestTrimmedMean serves TDIGEST.TRIMMED_MEAN key low high.
+func (rs *RedisServer) handleTDigestTrimmedMean(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 3 {
+		return fmt.Errorf("ERR wrong number of arguments for 'tdigest.trimmed_mean' command")
+	}
+
+	bounds, err := parseFloats(cmd.Args[1:])
+	if err != nil {
+		return err
+	}
+	mean, err := rs.db(cmd).TDigestTrimmedMean(cmd.Args[0], bounds[0], bounds[1])
+	if err != nil {
+		return storeError(err)
+	}
+	return floatReply(mean)
+}
+
+// handleTDigestMerge serves TDIGEST.MERGE destination numkeys source
+// [source ...] [COMPRESSION compression] [OVERRIDE].
+func (rs *RedisServer) handleTDigestMerge(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 3 {
+		return fmt.Errorf("ERR wrong number of arguments for 'tdigest.merge' command")
+	}
+
+	numKeys, err := strconv.Atoi(cmd.Args[1])
+	if err != nil || numKeys < 1 || 2+numKeys > len(cmd.Args) {
+		return fmt.Errorf("ERR invalid number of keys")
+	}
+	var opts store.TDigestMergeOptions
+	for i := 2 + numKeys; i < len(cmd.Args); i++ {
+		switch strings.ToUpper(cmd.Args[i]) {
+		case "COMPRESSION":
+			if i+1 >= len(cmd.Args) {
+				return fmt.Errorf("ERR syntax error")
+			}
+			if opts.Compression, err = strconv.ParseFloat(cmd.Args[i+1], 64); err != nil || opts.Compression <= 0 {
+				return fmt.Errorf("ERR bad compression")
+			}
+			i++
+		case "OVERRIDE":
+			opts.Override = true
+		default:
+			return fmt.Errorf("ERR syntax error")
+		}
+	}
+
+	if err := rs.db(cmd).TDigestMerge(cmd.Args[0], cmd.Args[2:2+numKeys], opts); err != nil {
+		return storeError(err)
+	}
+	return "OK"
+}
@@ -0,0 +1,414 @@
+package protocol
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chaitanyayendru/fincache/internal/store"
+)
+
+// parseTSTimestamp parses a sample timestamp in Unix milliseconds, with "*"
+// for now.
+func parseTSTimestamp(arg string) (int64, error) {
+	if arg == "*" {
+		return time.Now().UnixMilli(), nil
+	}
+	t, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || t < 0 {
+		return 0, fmt.Errorf("ERR TSDB: invalid timestamp")
+	}
+	return t, nil
+}
+
+// parseTSBound parses the start or end of a range, with "-" for the oldest
+// sample and "+" for the newest.
+func parseTSBound(arg string) (int64, error) {
+	switch arg {
+	case "-":
+		return 0, nil
+	case "+":
+		return math.MaxInt64, nil
+	}
+	t, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("ERR TSDB: invalid range bound")
+	}
+	return t, nil
+}
+
+func parseTSValue(arg string) (float64, error) {
+	value, err := strconv.ParseFloat(arg, 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, fmt.Errorf("ERR TSDB: invalid value")
+	}
+	return value, nil
+}
+
+func parseTSMillis(arg string) (time.Duration, error) {
+	ms, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || ms < 0 {
+		return 0, fmt.Errorf("ERR value is not an integer or out of range")
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// parseTSOptions parses [RETENTION ms] [DUPLICATE_POLICY policy]
+// [ON_DUPLICATE policy] [LABELS label value ...] of TS.CREATE and TS.ADD;
+// ON_DUPLICATE is only accepted by TS.ADD.
+func parseTSOptions(args []string, add bool) (store.TSAddOptions, error) {
+	var opts store.TSAddOptions
+	for i := 0; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "RETENTION":
+			if i+1 >= len(args) {
+				return opts, fmt.Errorf("ERR syntax error")
+			}
+			retention, err := parseTSMillis(args[i+1])
+			if err != nil {
+				return opts, err
+			}
+			opts.Retention = retention
+			i++
+		case "DUPLICATE_POLICY", "ON_DUPLICATE":
+			if i+1 >= len(args) || strings.EqualFold(args[i], "ON_DUPLICATE") && !add {
+				return opts, fmt.Errorf("ERR syntax error")
+			}
+			policy, ok := store.ParseDuplicatePolicy(args[i+1])
+			if !ok {
+				return opts, fmt.Errorf("ERR TSDB: unknown duplicate policy")
+			}
+			if strings.EqualFold(args[i], "ON_DUPLICATE") {
+				opts.OnDuplicate = policy
+			} else {
+				opts.DuplicatePolicy = policy
+			}
+			i++
+		case "LABELS":
+			labels := args[i+1:]
+			if len(labels) == 0 || len(labels)%2 != 0 {
+				return opts, fmt.Errorf("ERR syntax error")
+			}
+			opts.Labels = make(map[string]string, len(labels)/2)
+			for j := 0; j < len(labels); j += 2 {
+				opts.Labels[labels[j]] = labels[j+1]
+			}
+			return opts, nil
+		default:
+			return opts, fmt.Errorf("ERR syntax error")
+		}
+	}
+	return opts, nil
+}
+
+// parseTSRangeOptions parses [COUNT n] [AGGREGATION aggregation bucket-ms] of
+// the range commands, stopping at FILTER for TS.MRANGE. It returns the
+// arguments left.
+func parseTSRangeOptions(args []string, opts *store.TSRangeOptions) ([]string, error) {
+	for len(args) > 0 {
+		switch strings.ToUpper(args[0]) {
+		case "COUNT":
+			if len(args) < 2 {
+				return nil, fmt.Errorf("ERR syntax error")
+			}
+			count, err := strconv.Atoi(args[1])
+			if err != nil || count < 0 {
+				return nil, fmt.Errorf("ERR value is not an integer or out of range")
+			}
+			opts.Count = count
+			args = args[2:]
+		case "AGGREGATION":
+			if len(args) < 3 {
+				return nil, fmt.Errorf("ERR syntax error")
+			}
+			aggregation, ok := store.ParseAggregation(args[1])
+			if !ok {
+				return nil, fmt.Errorf("ERR TSDB: unknown aggregation type")
+			}
+			bucket, err := parseTSMillis(args[2])
+			if err != nil {
+				return nil, err
+			}
+			if bucket == 0 {
+				return nil, storeError(store.ErrTSInvalidBucket)
+			}
+			opts.Aggregation, opts.Bucket = aggregation, bucket
+			args = args[3:]
+		default:
+			return args, nil
+		}
+	}
+	return args, nil
+}
+
+func tsSamples(samples []store.Sample) []interface{} {
+	reply := make([]interface{}, len(samples))
+	for i, sample := range samples {
+		reply[i] = tsSample(sample)
+	}
+	return reply
+}
+
+func tsSample(sample store.Sample) []interface{} {
+	return []interface{}{int(sample.Timestamp), []byte(strconv.FormatFloat(sample.Value, 'f', -1, 64))}
+}
+
+// tsLabels replies with labels as label-value pairs ordered by label.
+func tsLabels(labels map[string]string) []interface{} {
+	names := make([]string, 0, len(labels))
+	for label := range labels {
+		names = append(names, label)
+	}
+	sort.Strings(names)
+	reply := make([]interface{}, len(names))
+	for i, label := range names {
+		reply[i] = []interface{}{label, labels[label]}
+	}
+	return reply
+}
+
+// handleTSCreate serves TS.CREATE key [RETENTION ms] [DUPLICATE_POLICY
+// policy] [LABELS label value ...].
+func (rs *RedisServer) handleTSCreate(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 1 {
+		return fmt.Errorf("ERR wrong number of arguments for 'ts.create' command")
+	}
+
+	opts, err := parseTSOptions(cmd.Args[1:], false)
+	if err != nil {
+		return err
+	}
+	if err := rs.db(cmd).TSCreate(cmd.Args[0], opts.TSOptions); err != nil {
+		return storeError(err)
+	}
+
+	return "OK"
+}
+
+// handleTSAdd serves TS.ADD key timestamp|* value [RETENTION ms]
+// [DUPLICATE_POLICY policy] [ON_DUPLICATE policy] [LABELS label value ...],
+// replying with the timestamp of the sample. The options other than
+// ON_DUPLICATE only apply if the add creates the series.
+func (rs *RedisServer) handleTSAdd(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 3 {
+		return fmt.Errorf("ERR wrong number of arguments for 'ts.add' command")
+	}
+
+	t, err := parseTSTimestamp(cmd.Args[1])
+	if err != nil {
+		return err
+	}
+	value, err := parseTSValue(cmd.Args[2])
+	if err != nil {
+		return err
+	}
+	opts, err := parseTSOptions(cmd.Args[3:], true)
+	if err != nil {
+		return err
+	}
+
+	t, err = rs.db(cmd).TSAdd(cmd.Args[0], t, value, opts)
+	if err != nil {
+		return storeError(err)
+	}
+	return int(t)
+}
+
+// handleTSMAdd serves TS.MADD key timestamp|* value [key timestamp value ...],
+// replying with the timestamp or the error of each sample.
+func (rs *RedisServer) handleTSMAdd(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 3 || len(cmd.Args)%3 != 0 {
+		return fmt.Errorf("ERR wrong number of arguments for 'ts.madd' command")
+	}
+
+	samples := make([]store.TSInput, 0, len(cmd.Args)/3)
+	for i := 0; i < len(cmd.Args); i += 3 {
+		t, err := parseTSTimestamp(cmd.Args[i+1])
+		if err != nil {
+			return err
+		}
+		value, err := parseTSValue(cmd.Args[i+2])
+		if err != nil {
+			return err
+		}
+		samples = append(samples, store.TSInput{Key: cmd.Args[i], Timestamp: t, Value: value})
+	}
+
+	errs := rs.db(cmd).TSMAdd(samples)
+	reply := make([]interface{}, len(samples))
+	for i, err := range errs {
+		if err != nil {
+			reply[i] = storeError(err)
+		} else {
+			reply[i] = int(samples[i].Timestamp)
+		}
+	}
+	return reply
+}
+
+// handleTSGet serves TS.GET key, replying with the newest sample or an empty
+// array.
+func (rs *RedisServer) handleTSGet(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 1 {
+		return fmt.Errorf("ERR wrong number of arguments for 'ts.get' command")
+	}
+
+	sample, ok, err := rs.db(cmd).TSGet(cmd.Args[0])
+	if err != nil {
+		return storeError(err)
+	}
+	if !ok {
+		return []interface{}{}
+	}
+	return tsSample(sample)
+}
+
+// handleTSRange serves TS.RANGE and TS.REVRANGE key from|- to|+ [COUNT n]
+// [AGGREGATION aggregation bucket-ms].
+func (rs *RedisServer) handleTSRange(cmd *RedisCommand, reverse bool) interface{} {
+	if len(cmd.Args) < 3 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(cmd.Name))
+	}
+
+	from, err := parseTSBound(cmd.Args[1])
+	if err != nil {
+		return err
+	}
+	to, err := parseTSBound(cmd.Args[2])
+	if err != nil {
+		return err
+	}
+	opts := store.TSRangeOptions{Reverse: reverse}
+	rest, err := parseTSRangeOptions(cmd.Args[3:], &opts)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return fmt.Errorf("ERR syntax error")
+	}
+
+	samples, err := rs.db(cmd).TSRange(cmd.Args[0], from, to, opts)
+	if err != nil {
+		return storeError(err)
+	}
+	return tsSamples(samples)
+}
+
+// handleTSMRange serves TS.MRANGE and TS.MREVRANGE from|- to|+ [WITHLABELS]
+// [COUNT n] [AGGREGATION aggregation bucket-ms] FILTER filter ..., replying
+// with the key, labels and samples of each matching series.
+func (rs *RedisServer) handleTSMRange(cmd *RedisCommand, reverse bool) interface{} {
+	if len(cmd.Args) < 4 {
+		return fmt.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(cmd.Name))
+	}
+
+	from, err := parseTSBound(cmd.Args[0])
+	if err != nil {
+		return err
+	}
+	to, err := parseTSBound(cmd.Args[1])
+	if err != nil {
+		return err
+	}
+	rest := cmd.Args[2:]
+	withLabels := false
+	if strings.EqualFold(rest[0], "WITHLABELS") {
+		withLabels = true
+		rest = rest[1:]
+	}
+	opts := store.TSRangeOptions{Reverse: reverse}
+	if rest, err = parseTSRangeOptions(rest, &opts); err != nil {
+		return err
+	}
+	if len(rest) < 2 || !strings.EqualFold(rest[0], "FILTER") {
+		return fmt.Errorf("ERR syntax error")
+	}
+
+	results, err := rs.db(cmd).TSMRange(from, to, rest[1:], opts)
+	if err != nil {
+		return storeError(err)
+	}
+
+	reply := make([]interface{}, len(results))
+	for i, result := range results {
+		labels := []interface{}{}
+		if withLabels {
+			labels = tsLabels(result.Labels)
+		}
+		reply[i] = []interface{}{result.Key, labels, tsSamples(result.Samples)}
+	}
+	return reply
+}
+
+// handleTSCreateRule serves TS.CREATERULE src dest AGGREGATION aggregation
+// bucket-ms.
+func (rs *RedisServer) handleTSCreateRule(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 5 {
+		return fmt.Errorf("ERR wrong number of arguments for 'ts.createrule' command")
+	}
+	if !strings.EqualFold(cmd.Args[2], "AGGREGATION") {
+		return fmt.Errorf("ERR syntax error")
+	}
+
+	aggregation, ok := store.ParseAggregation(cmd.Args[3])
+	if !ok {
+		return fmt.Errorf("ERR TSDB: unknown aggregation type")
+	}
+	bucket, err := parseTSMillis(cmd.Args[4])
+	if err != nil {
+		return err
+	}
+	if err := rs.db(cmd).TSCreateRule(cmd.Args[0], cmd.Args[1], aggregation, bucket); err != nil {
+		return storeError(err)
+	}
+
+	return "OK"
+}
+
+// handleTSDeleteRule serves TS.DELETERULE src dest.
+func (rs *RedisServer) handleTSDeleteRule(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 2 {
+		return fmt.Errorf("ERR wrong number of arguments for 'ts.deleterule' command")
+	}
+
+	if err := rs.db(cmd).TSDeleteRule(cmd.Args[0], cmd.Args[1]); err != nil {
+		return storeError(err)
+	}
+
+	return "OK"
+}
+
+// handleTSInfo serves TS.INFO key.
+func (rs *RedisServer) handleTSInfo(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 1 {
+		return fmt.Errorf("ERR wrong number of arguments for 'ts.info' command")
+	}
+
+	info, err := rs.db(cmd).TSInfo(cmd.Args[0])
+	if err != nil {
+		return storeError(err)
+	}
+
+	rules := []interface{}{}
+	for _, rule := range info.Rules {
+		rules = append(rules, []interface{}{rule.Dest, int(rule.Bucket.Milliseconds()), rule.Aggregation.String()})
+	}
+	var source interface{}
+	if info.Source != "" {
+		source = info.Source
+	}
+	return []interface{}{
+		"totalSamples", info.TotalSamples,
+		"memoryUsage", int(info.MemoryUsage),
+		"firstTimestamp", int(info.FirstTimestamp),
+		"lastTimestamp", int(info.LastTimestamp),
+		"retentionTime", int(info.Retention.Milliseconds()),
+		"duplicatePolicy", strings.ToLower(info.DuplicatePolicy.String()),
+		"labels", tsLabels(info.Labels),
+		"sourceKey", source,
+		"rules", rules,
+	}
+}
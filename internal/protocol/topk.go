@@ -0,0 +1,139 @@
+package protocol
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/chaitanyayendru/fincache/internal/store"
+)
+
+// expelledReplies replies with the item each add expelled from the top k, or
+// a null.
+func expelledReplies(expelled []*store.TopKItem) []interface{} {
+	reply := make([]interface{}, len(expelled))
+	for i, e := range expelled {
+		if e != nil {
+			reply[i] = e.Item
+		}
+	}
+	return reply
+}
+
+// handleTopKReserve serves TOPK.RESERVE key topk [width depth decay].
+func (rs *RedisServer) handleTopKReserve(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 2 && len(cmd.Args) != 5 {
+		return fmt.Errorf("ERR wrong number of arguments for 'topk.reserve' command")
+	}
+
+	k, err := strconv.Atoi(cmd.Args[1])
+	if err != nil {
+		return fmt.Errorf("ERR bad k")
+	}
+	opts := store.TopKOptions{K: k}
+	if len(cmd.Args) == 5 {
+		if opts.Width, err = strconv.Atoi(cmd.Args[2]); err != nil || opts.Width < 1 {
+			return fmt.Errorf("ERR bad width")
+		}
+		if opts.Depth, err = strconv.Atoi(cmd.Args[3]); err != nil || opts.Depth < 1 {
+			return fmt.Errorf("ERR bad depth")
+		}
+		if opts.Decay, err = strconv.ParseFloat(cmd.Args[4], 64); err != nil || opts.Decay <= 0 {
+			return fmt.Errorf("ERR bad decay")
+		}
+	}
+
+	if err := rs.db(cmd).TopKReserve(cmd.Args[0], opts); err != nil {
+		return storeError(err)
+	}
+	return "OK"
+}
+
+// handleTopKAdd serves TOPK.ADD key item [item ...], replying with the item
+// each one expelled from the top k, or a null. An error ends the reply after
+// the items added before it.
+func (rs *RedisServer) handleTopKAdd(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 2 {
+		return fmt.Errorf("ERR wrong number of arguments for 'topk.add' command")
+	}
+
+	expelled, err := rs.db(cmd).TopKAdd(cmd.Args[0], cmd.Args[1:]...)
+	return topkAddReply(expelled, err)
+}
+
+// handleTopKIncrBy serves TOPK.INCRBY key item increment [item increment
+// ...], replying like TOPK.ADD.
+func (rs *RedisServer) handleTopKIncrBy(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 3 || len(cmd.Args)%2 != 1 {
+		return fmt.Errorf("ERR wrong number of arguments for 'topk.incrby' command")
+	}
+
+	items, increments, err := parseIncrements(cmd.Args[1:])
+	if err != nil {
+		return err
+	}
+	expelled, err := rs.db(cmd).TopKIncrBy(cmd.Args[0], items, increments)
+	return topkAddReply(expelled, err)
+}
+
+func topkAddReply(expelled []*store.TopKItem, err error) interface{} {
+	reply := expelledReplies(expelled)
+	if err != nil {
+		if len(expelled) == 0 {
+			return storeError(err)
+		}
+		reply = append(reply, storeError(err))
+	}
+	return reply
+}
+
+// handleTopKQuery serves TOPK.QUERY key item [item ...], replying with 1 for
+// each item in the top k.
+func (rs *RedisServer) handleTopKQuery(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 2 {
+		return fmt.Errorf("ERR wrong number of arguments for 'topk.query' command")
+	}
+
+	found, err := rs.db(cmd).TopKQuery(cmd.Args[0], cmd.Args[1:]...)
+	if err != nil {
+		return storeError(err)
+	}
+	return boolReplies(found)
+}
+
+// handleTopKList serves TOPK.LIST key [WITHCOUNT], replying with the top k
+// by descending count, each followed by its count with WITHCOUNT.
+func (rs *RedisServer) handleTopKList(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) != 1 && len(cmd.Args) != 2 {
+		return fmt.Errorf("ERR wrong number of arguments for 'topk.list' command")
+	}
+	withCount := len(cmd.Args) == 2
+	if withCount && strings.ToUpper(cmd.Args[1]) != "WITHCOUNT" {
+		return fmt.Errorf("ERR syntax error")
+	}
+
+	list, err := rs.db(cmd).TopKList(cmd.Args[0])
+	if err != nil {
+		return storeError(err)
+	}
+	reply := make([]interface{}, 0, len(list))
+	for _, e := range list {
+		reply = append(reply, e.Item)
+		if withCount {
+			reply = append(reply, int(e.Count))
+		}
+	}
+	return reply
+}
+
+// handleTopKMerge serves TOPK.MERGE destination source [source ...].
+func (rs *RedisServer) handleTopKMerge(cmd *RedisCommand) interface{} {
+	if len(cmd.Args) < 2 {
+		return fmt.Errorf("ERR wrong number of arguments for 'topk.merge' command")
+	}
+
+	if err := rs.db(cmd).TopKMerge(cmd.Args[0], cmd.Args[1:]...); err != nil {
+		return storeError(err)
+	}
+	return "OK"
+}
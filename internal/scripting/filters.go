@@ -0,0 +1,114 @@
+package scripting
+
+import (
+	"github.com/chaitanyayendru/fincache/internal/store"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// registerFilters adds the Bloom and Cuckoo filter commands to the redis
+// table as redis.bf.* and redis.cf.*, e.g. redis.bf.add(key, item) for
+// BF.ADD. Membership answers are Lua booleans.
+func (le *LuaEngine) registerFilters(L *lua.LState, redis *lua.LTable) {
+	bf := L.NewTable()
+	redis.RawSetString("bf", bf)
+
+	// bf.reserve(key, error_rate, capacity)
+	bf.RawSetString("reserve", L.NewFunction(func(L *lua.LState) int {
+		opts := store.BloomOptions{
+			ErrorRate: float64(L.CheckNumber(2)),
+			Capacity:  int64(L.CheckNumber(3)),
+		}
+		if err := le.store.BFReserve(L.CheckString(1), opts); err != nil {
+			raise(L, err)
+		}
+		L.Push(lua.LString("OK"))
+		return 1
+	}))
+
+	// bf.add(key, item) and bf.madd(key, item...)
+	bf.RawSetString("add", L.NewFunction(func(L *lua.LState) int {
+		added, err := le.store.BFAdd(L.CheckString(1), L.CheckString(2))
+		if err != nil {
+			raise(L, err)
+		}
+		L.Push(lua.LBool(added[0]))
+		return 1
+	}))
+	bf.RawSetString("madd", L.NewFunction(func(L *lua.LState) int {
+		added, err := le.store.BFAdd(L.CheckString(1), checkStrings(L, 2)...)
+		if err != nil {
+			raise(L, err)
+		}
+		L.Push(boolsTable(L, added))
+		return 1
+	}))
+
+	// bf.exists(key, item) and bf.mexists(key, item...)
+	bf.RawSetString("exists", L.NewFunction(func(L *lua.LState) int {
+		exists, err := le.store.BFExists(L.CheckString(1), L.CheckString(2))
+		if err != nil {
+			raise(L, err)
+		}
+		L.Push(lua.LBool(exists[0]))
+		return 1
+	}))
+	bf.RawSetString("mexists", L.NewFunction(func(L *lua.LState) int {
+		exists, err := le.store.BFExists(L.CheckString(1), checkStrings(L, 2)...)
+		if err != nil {
+			raise(L, err)
+		}
+		L.Push(boolsTable(L, exists))
+		return 1
+	}))
+
+	cf := L.NewTable()
+	redis.RawSetString("cf", cf)
+
+	// cf.reserve(key, capacity)
+	cf.RawSetString("reserve", L.NewFunction(func(L *lua.LState) int {
+		opts := store.CuckooOptions{Capacity: int64(L.CheckNumber(2))}
+		if err := le.store.CFReserve(L.CheckString(1), opts); err != nil {
+			raise(L, err)
+		}
+		L.Push(lua.LString("OK"))
+		return 1
+	}))
+
+	// cf.add(key, item)
+	cf.RawSetString("add", L.NewFunction(func(L *lua.LState) int {
+		if err := le.store.CFAdd(L.CheckString(1), L.CheckString(2)); err != nil {
+			raise(L, err)
+		}
+		L.Push(lua.LTrue)
+		return 1
+	}))
+
+	// cf.del(key, item)
+	cf.RawSetString("del", L.NewFunction(func(L *lua.LState) int {
+		deleted, err := le.store.CFDel(L.CheckString(1), L.CheckString(2))
+		if err != nil {
+			raise(L, err)
+		}
+		L.Push(lua.LBool(deleted))
+		return 1
+	}))
+
+	// cf.exists(key, item)
+	cf.RawSetString("exists", L.NewFunction(func(L *lua.LState) int {
+		exists, err := le.store.CFExists(L.CheckString(1), L.CheckString(2))
+		if err != nil {
+			raise(L, err)
+		}
+		L.Push(lua.LBool(exists[0]))
+		return 1
+	}))
+}
+
+// checkStrings returns the arguments from n on, which must be at least one.
+func checkStrings(L *lua.LState, n int) []string {
+	values := []string{L.CheckString(n)}
+	for i := n + 1; i <= L.GetTop(); i++ {
+		values = append(values, L.CheckString(i))
+	}
+	return values
+}
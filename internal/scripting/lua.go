@@ -1,18 +1,23 @@
 package scripting
 
 import (
+	"errors"
 	"fmt"
 	"sync"
 	"time"
 
+	"github.com/chaitanyayendru/fincache/internal/store"
 	lua "github.com/yuin/gopher-lua"
 )
 
+// LuaEngine runs scripts against a store. Every execution gets a fresh Lua
+// state with the redis, math, time, json and finance functions registered.
 type LuaEngine struct {
-	mu      sync.RWMutex
-	state   *lua.LState
-	scripts map[string]*LuaScript
-	logger  interface{}
+	mu        sync.RWMutex
+	store     *store.Store
+	publisher store.Publisher // where redis.publish sends messages, if set
+	scripts   map[string]*LuaScript
+	logger    interface{}
 }
 
 type LuaScript struct {
@@ -28,94 +33,125 @@ type ScriptResult struct {
 	Error   string
 }
 
-func NewLuaEngine(logger interface{}) *LuaEngine {
-	L := lua.NewState()
-	defer L.Close()
-
-	engine := &LuaEngine{
-		state:   L,
+func NewLuaEngine(st *store.Store, logger interface{}) *LuaEngine {
+	return &LuaEngine{
+		store:   st,
 		scripts: make(map[string]*LuaScript),
 		logger:  logger,
 	}
+}
 
-	// Register custom functions
-	engine.registerFunctions()
+// SetPublisher sets where redis.publish sends messages. Until it is called
+// redis.publish reaches no one and returns 0.
+func (le *LuaEngine) SetPublisher(p store.Publisher) {
+	le.mu.Lock()
+	defer le.mu.Unlock()
 
-	return engine
+	le.publisher = p
 }
 
-func (le *LuaEngine) registerFunctions() {
+func (le *LuaEngine) registerFunctions(L *lua.LState) {
 	// Register Redis-like functions
-	le.state.SetGlobal("redis", le.state.NewTable())
-	redis := le.state.GetGlobal("redis").(*lua.LTable)
+	L.SetGlobal("redis", L.NewTable())
+	redis := L.GetGlobal("redis").(*lua.LTable)
 
 	// SET function
-	redis.RawSetString("set", le.state.NewFunction(func(L *lua.LState) int {
+	redis.RawSetString("set", L.NewFunction(func(L *lua.LState) int {
 		key := L.CheckString(1)
 		value := L.CheckString(2)
-		// Implementation would call the actual store
+		if err := le.store.Set(key, value, 0); err != nil {
+			raise(L, err)
+		}
 		L.Push(lua.LString("OK"))
 		return 1
 	}))
 
 	// GET function
-	redis.RawSetString("get", le.state.NewFunction(func(L *lua.LState) int {
+	redis.RawSetString("get", L.NewFunction(func(L *lua.LState) int {
 		key := L.CheckString(1)
-		// Implementation would call the actual store
-		L.Push(lua.LString("value"))
+		value, err := le.store.Get(key)
+		switch {
+		case errors.Is(err, store.ErrWrongType):
+			raise(L, err)
+		case err != nil:
+			L.Push(lua.LNil)
+		default:
+			L.Push(goValueToLua(value))
+		}
 		return 1
 	}))
 
 	// ZADD function
-	redis.RawSetString("zadd", le.state.NewFunction(func(L *lua.LState) int {
+	redis.RawSetString("zadd", L.NewFunction(func(L *lua.LState) int {
 		key := L.CheckString(1)
 		score := L.CheckNumber(2)
 		member := L.CheckString(3)
-		// Implementation would call the actual store
-		L.Push(lua.LNumber(1))
+		L.Push(lua.LNumber(le.store.ZAdd(key, float64(score), member)))
 		return 1
 	}))
 
-	// ZRANGE function
-	redis.RawSetString("zrange", le.state.NewFunction(func(L *lua.LState) int {
-		key := L.CheckString(1)
-		start := L.CheckInt(2)
-		stop := L.CheckInt(3)
-		// Implementation would call the actual store
-		result := le.state.NewTable()
-		L.Push(result)
+	// ZSCORE function
+	redis.RawSetString("zscore", L.NewFunction(func(L *lua.LState) int {
+		score, exists := le.store.ZScore(L.CheckString(1), L.CheckString(2))
+		if !exists {
+			L.Push(lua.LNil)
+			return 1
+		}
+		L.Push(lua.LNumber(score))
+		return 1
+	}))
+
+	// ZRANGE and ZREVRANGE functions
+	redis.RawSetString("zrange", L.NewFunction(func(L *lua.LState) int {
+		L.Push(stringsTable(L, le.store.ZRange(L.CheckString(1), L.CheckInt(2), L.CheckInt(3))))
+		return 1
+	}))
+	redis.RawSetString("zrevrange", L.NewFunction(func(L *lua.LState) int {
+		L.Push(stringsTable(L, le.store.ZRevRange(L.CheckString(1), L.CheckInt(2), L.CheckInt(3))))
 		return 1
 	}))
 
 	// PUBLISH function
-	redis.RawSetString("publish", le.state.NewFunction(func(L *lua.LState) int {
+	redis.RawSetString("publish", L.NewFunction(func(L *lua.LState) int {
 		channel := L.CheckString(1)
 		message := L.CheckString(2)
-		// Implementation would call the actual pub/sub
-		L.Push(lua.LNumber(1))
+		le.mu.RLock()
+		publisher := le.publisher
+		le.mu.RUnlock()
+		if publisher == nil {
+			L.Push(lua.LNumber(0))
+			return 1
+		}
+		L.Push(lua.LNumber(publisher.Publish(channel, message)))
 		return 1
 	}))
 
+	// Probabilistic filters: redis.bf.* and redis.cf.*
+	le.registerFilters(L, redis)
+
+	// Quantile sketches: redis.tdigest.*
+	le.registerTDigest(L, redis)
+
 	// Math functions
-	math := le.state.GetGlobal("math").(*lua.LTable)
-	math.RawSetString("round", le.state.NewFunction(func(L *lua.LState) int {
+	math := L.GetGlobal("math").(*lua.LTable)
+	math.RawSetString("round", L.NewFunction(func(L *lua.LState) int {
 		n := L.CheckNumber(1)
 		L.Push(lua.LNumber(float64(int(n + 0.5))))
 		return 1
 	}))
 
 	// Time functions
-	le.state.SetGlobal("time", le.state.NewTable())
-	timeTable := le.state.GetGlobal("time").(*lua.LTable)
-	timeTable.RawSetString("now", le.state.NewFunction(func(L *lua.LState) int {
+	L.SetGlobal("time", L.NewTable())
+	timeTable := L.GetGlobal("time").(*lua.LTable)
+	timeTable.RawSetString("now", L.NewFunction(func(L *lua.LState) int {
 		L.Push(lua.LNumber(time.Now().Unix()))
 		return 1
 	}))
 
 	// JSON functions
-	le.state.SetGlobal("json", le.state.NewTable())
-	json := le.state.GetGlobal("json").(*lua.LTable)
-	json.RawSetString("encode", le.state.NewFunction(func(L *lua.LState) int {
+	L.SetGlobal("json", L.NewTable())
+	json := L.GetGlobal("json").(*lua.LTable)
+	json.RawSetString("encode", L.NewFunction(func(L *lua.LState) int {
 		// Simple JSON encoding
 		table := L.CheckTable(1)
 		result := "{"
@@ -131,11 +167,11 @@ func (le *LuaEngine) registerFunctions() {
 	}))
 
 	// Financial functions
-	le.state.SetGlobal("finance", le.state.NewTable())
-	finance := le.state.GetGlobal("finance").(*lua.LTable)
+	L.SetGlobal("finance", L.NewTable())
+	finance := L.GetGlobal("finance").(*lua.LTable)
 
 	// Calculate moving average
-	finance.RawSetString("moving_average", le.state.NewFunction(func(L *lua.LState) int {
+	finance.RawSetString("moving_average", L.NewFunction(func(L *lua.LState) int {
 		table := L.CheckTable(1)
 		period := L.CheckInt(2)
 
@@ -162,7 +198,7 @@ func (le *LuaEngine) registerFunctions() {
 	}))
 
 	// Calculate volatility
-	finance.RawSetString("volatility", le.state.NewFunction(func(L *lua.LState) int {
+	finance.RawSetString("volatility", L.NewFunction(func(L *lua.LState) int {
 		table := L.CheckTable(1)
 		period := L.CheckInt(2)
 
@@ -201,7 +237,7 @@ func (le *LuaEngine) registerFunctions() {
 	}))
 
 	// Calculate price change percentage
-	finance.RawSetString("price_change", le.state.NewFunction(func(L *lua.LState) int {
+	finance.RawSetString("price_change", L.NewFunction(func(L *lua.LState) int {
 		oldPrice := L.CheckNumber(1)
 		newPrice := L.CheckNumber(2)
 
@@ -220,8 +256,10 @@ func (le *LuaEngine) LoadScript(name, source string) error {
 	le.mu.Lock()
 	defer le.mu.Unlock()
 
-	// Validate script
-	if err := le.state.DoString(source); err != nil {
+	// Validate script; compiling it does not run it
+	L := lua.NewState()
+	defer L.Close()
+	if _, err := L.LoadString(source); err != nil {
 		return fmt.Errorf("invalid script: %v", err)
 	}
 
@@ -250,7 +288,7 @@ func (le *LuaEngine) ExecuteScript(name string, keys []string, args []string) (*
 	defer L.Close()
 
 	// Register functions
-	le.registerFunctions()
+	le.registerFunctions(L)
 
 	// Set up keys and arguments
 	keysTable := L.NewTable()
@@ -273,9 +311,12 @@ func (le *LuaEngine) ExecuteScript(name string, keys []string, args []string) (*
 		}, nil
 	}
 
-	// Get result from stack
-	result := L.Get(-1)
-	L.Pop(1)
+	// Get result from stack; a script may return nothing
+	var result lua.LValue = lua.LNil
+	if L.GetTop() > 0 {
+		result = L.Get(-1)
+		L.Pop(1)
+	}
 
 	return &ScriptResult{
 		Success: true,
@@ -289,7 +330,7 @@ func (le *LuaEngine) ExecuteSource(source string, keys []string, args []string)
 	defer L.Close()
 
 	// Register functions
-	le.registerFunctions()
+	le.registerFunctions(L)
 
 	// Set up keys and arguments
 	keysTable := L.NewTable()
@@ -312,9 +353,12 @@ func (le *LuaEngine) ExecuteSource(source string, keys []string, args []string)
 		}, nil
 	}
 
-	// Get result from stack
-	result := L.Get(-1)
-	L.Pop(1)
+	// Get result from stack; a script may return nothing
+	var result lua.LValue = lua.LNil
+	if L.GetTop() > 0 {
+		result = L.Get(-1)
+		L.Pop(1)
+	}
 
 	return &ScriptResult{
 		Success: true,
@@ -360,6 +404,51 @@ func (le *LuaEngine) FlushScripts() {
 }
 
 // Helper functions
+
+// raise aborts the running script with err.
+func raise(L *lua.LState, err error) {
+	L.RaiseError("%s", err.Error())
+}
+
+func goValueToLua(value interface{}) lua.LValue {
+	switch v := value.(type) {
+	case nil:
+		return lua.LNil
+	case string:
+		return lua.LString(v)
+	case []byte:
+		return lua.LString(v)
+	case bool:
+		return lua.LBool(v)
+	case int:
+		return lua.LNumber(v)
+	case int64:
+		return lua.LNumber(v)
+	case float64:
+		return lua.LNumber(v)
+	default:
+		return lua.LString(fmt.Sprint(v))
+	}
+}
+
+// stringsTable returns values as a Lua array.
+func stringsTable(L *lua.LState, values []string) *lua.LTable {
+	table := L.CreateTable(len(values), 0)
+	for _, v := range values {
+		table.Append(lua.LString(v))
+	}
+	return table
+}
+
+// boolsTable returns values as a Lua array.
+func boolsTable(L *lua.LState, values []bool) *lua.LTable {
+	table := L.CreateTable(len(values), 0)
+	for _, v := range values {
+		table.Append(lua.LBool(v))
+	}
+	return table
+}
+
 func luaValueToInterface(value lua.LValue) interface{} {
 	switch v := value.(type) {
 	case lua.LString:
@@ -370,7 +459,7 @@ func luaValueToInterface(value lua.LValue) interface{} {
 		return bool(v)
 	case *lua.LTable:
 		return tableToMap(v)
-	case lua.LNilType:
+	case *lua.LNilType:
 		return nil
 	default:
 		return v.String()
@@ -0,0 +1,119 @@
+package scripting
+
+import (
+	"testing"
+
+	"github.com/chaitanyayendru/fincache/internal/config"
+	"github.com/chaitanyayendru/fincache/internal/store"
+)
+
+func newTestEngine(t *testing.T) (*LuaEngine, *store.Store) {
+	st := store.NewStore(config.StoreConfig{})
+	t.Cleanup(func() { st.Close() })
+	return NewLuaEngine(st, nil), st
+}
+
+func run(t *testing.T, engine *LuaEngine, source string, args ...string) interface{} {
+	t.Helper()
+	result, err := engine.ExecuteSource(source, nil, args)
+	if err != nil || !result.Success {
+		t.Fatalf("Expected the script to succeed, got %+v (%v)", result, err)
+	}
+	return result.Result
+}
+
+func TestLuaStoreFunctions(t *testing.T) {
+	engine, st := newTestEngine(t)
+
+	run(t, engine, `redis.set(ARGV[1], ARGV[2]); redis.zadd("book", 101.5, "ask")`, "price", "100")
+	if v, _ := st.Get("price"); v != "100" {
+		t.Errorf("Expected redis.set to write to the store, got %v", v)
+	}
+	if got := run(t, engine, `return tonumber(redis.get("price")) + redis.zscore("book", "ask")`); got != 201.5 {
+		t.Errorf("Expected 201.5, got %v", got)
+	}
+	if got := run(t, engine, `return redis.get("missing") == nil`); got != true {
+		t.Errorf("Expected nil for a missing key, got %v", got)
+	}
+}
+
+func TestLuaFilters(t *testing.T) {
+	engine, st := newTestEngine(t)
+
+	got := run(t, engine, `
+		redis.bf.reserve("cards", 0.01, 1000)
+		local added = redis.bf.add("cards", "4242")
+		local seen = redis.bf.mexists("cards", "4242", "5555")
+		return {added, redis.bf.add("cards", "4242"), seen[1], seen[2]}
+	`)
+	want := map[string]interface{}{"1": true, "2": false, "3": true, "4": false}
+	if !equalMaps(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+	if exists, _ := st.BFExists("cards", "4242"); !exists[0] {
+		t.Error("Expected the item added from Lua to be in the store")
+	}
+
+	got = run(t, engine, `
+		redis.cf.add("devices", "d1")
+		local before = redis.cf.exists("devices", "d1")
+		return {before, redis.cf.del("devices", "d1"), redis.cf.exists("devices", "d1")}
+	`)
+	want = map[string]interface{}{"1": true, "2": true, "3": false}
+	if !equalMaps(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	st.Set("plain", "value", 0)
+	if result, _ := engine.ExecuteSource(`return redis.bf.add("plain", "x")`, nil, nil); result.Success {
+		t.Error("Expected a wrong type error to fail the script")
+	}
+}
+
+func TestLuaTDigest(t *testing.T) {
+	engine, st := newTestEngine(t)
+
+	got := run(t, engine, `
+		redis.tdigest.create("latency")
+		for i = 1, 100 do
+			redis.tdigest.add("latency", i)
+		end
+		local q = redis.tdigest.quantile("latency", 0.5, 0.99)
+		return {q[1], q[2], redis.tdigest.min("latency"), redis.tdigest.max("latency")}
+	`)
+	values, ok := got.(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected a table, got %v", got)
+	}
+	if p50 := values["1"].(float64); p50 < 45 || p50 > 55 {
+		t.Errorf("Expected p50 near 50, got %v", p50)
+	}
+	if p99 := values["2"].(float64); p99 < 95 {
+		t.Errorf("Expected p99 near 99, got %v", p99)
+	}
+	if values["3"] != 1.0 || values["4"] != 100.0 {
+		t.Errorf("Expected min 1 and max 100, got %v and %v", values["3"], values["4"])
+	}
+
+	run(t, engine, `redis.tdigest.create("other"); redis.tdigest.add("other", 1000); redis.tdigest.merge("all", "latency", "other")`)
+	if info, err := st.TDigestInfo("all"); err != nil || info.Count != 101 || info.Max != 1000 {
+		t.Errorf("Expected the merged digest in the store, got %+v (%v)", info, err)
+	}
+
+	if result, _ := engine.ExecuteSource(`redis.tdigest.add("missing", 1)`, nil, nil); result.Success {
+		t.Error("Expected adding to a missing digest to fail the script")
+	}
+}
+
+func equalMaps(got interface{}, want map[string]interface{}) bool {
+	m, ok := got.(map[string]interface{})
+	if !ok || len(m) != len(want) {
+		return false
+	}
+	for k, v := range want {
+		if m[k] != v {
+			return false
+		}
+	}
+	return true
+}
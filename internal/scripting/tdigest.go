@@ -0,0 +1,107 @@
+package scripting
+
+import (
+	"github.com/chaitanyayendru/fincache/internal/store"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// registerTDigest adds the t-digest commands to the redis table as
+// redis.tdigest.*, e.g. redis.tdigest.quantile(key, 0.5, 0.99) for
+// TDIGEST.QUANTILE. Like the commands, quantile and cdf return an array with
+// one estimate per argument; estimates of an empty digest are NaN.
+func (le *LuaEngine) registerTDigest(L *lua.LState, redis *lua.LTable) {
+	td := L.NewTable()
+	redis.RawSetString("tdigest", td)
+
+	// tdigest.create(key [, compression])
+	td.RawSetString("create", L.NewFunction(func(L *lua.LState) int {
+		compression := float64(L.OptNumber(2, 0))
+		if err := le.store.TDigestCreate(L.CheckString(1), compression); err != nil {
+			raise(L, err)
+		}
+		L.Push(lua.LString("OK"))
+		return 1
+	}))
+
+	// tdigest.add(key, value...)
+	td.RawSetString("add", L.NewFunction(func(L *lua.LState) int {
+		if err := le.store.TDigestAdd(L.CheckString(1), checkNumbers(L, 2)...); err != nil {
+			raise(L, err)
+		}
+		L.Push(lua.LString("OK"))
+		return 1
+	}))
+
+	// tdigest.quantile(key, quantile...) and tdigest.cdf(key, value...)
+	td.RawSetString("quantile", L.NewFunction(func(L *lua.LState) int {
+		values, err := le.store.TDigestQuantile(L.CheckString(1), checkNumbers(L, 2)...)
+		if err != nil {
+			raise(L, err)
+		}
+		L.Push(numbersTable(L, values))
+		return 1
+	}))
+	td.RawSetString("cdf", L.NewFunction(func(L *lua.LState) int {
+		fractions, err := le.store.TDigestCDF(L.CheckString(1), checkNumbers(L, 2)...)
+		if err != nil {
+			raise(L, err)
+		}
+		L.Push(numbersTable(L, fractions))
+		return 1
+	}))
+
+	// tdigest.min(key) and tdigest.max(key)
+	for name, largest := range map[string]bool{"min": false, "max": true} {
+		largest := largest
+		td.RawSetString(name, L.NewFunction(func(L *lua.LState) int {
+			info, err := le.store.TDigestInfo(L.CheckString(1))
+			if err != nil {
+				raise(L, err)
+			}
+			if largest {
+				L.Push(lua.LNumber(info.Max))
+			} else {
+				L.Push(lua.LNumber(info.Min))
+			}
+			return 1
+		}))
+	}
+
+	// tdigest.trimmed_mean(key, low, high)
+	td.RawSetString("trimmed_mean", L.NewFunction(func(L *lua.LState) int {
+		mean, err := le.store.TDigestTrimmedMean(L.CheckString(1), float64(L.CheckNumber(2)), float64(L.CheckNumber(3)))
+		if err != nil {
+			raise(L, err)
+		}
+		L.Push(lua.LNumber(mean))
+		return 1
+	}))
+
+	// tdigest.merge(dest, source...)
+	td.RawSetString("merge", L.NewFunction(func(L *lua.LState) int {
+		err := le.store.TDigestMerge(L.CheckString(1), checkStrings(L, 2), store.TDigestMergeOptions{})
+		if err != nil {
+			raise(L, err)
+		}
+		L.Push(lua.LString("OK"))
+		return 1
+	}))
+}
+
+// checkNumbers returns the arguments from n on, which must be at least one.
+func checkNumbers(L *lua.LState, n int) []float64 {
+	values := []float64{float64(L.CheckNumber(n))}
+	for i := n + 1; i <= L.GetTop(); i++ {
+		values = append(values, float64(L.CheckNumber(i)))
+	}
+	return values
+}
+
+// numbersTable returns values as a Lua array.
+func numbersTable(L *lua.LState, values []float64) *lua.LTable {
+	table := L.CreateTable(len(values), 0)
+	for _, v := range values {
+		table.Append(lua.LNumber(v))
+	}
+	return table
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/chaitanyayendru/fincache/internal/store"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// idempotencyKeyPrefix namespaces the store keys behind the Idempotency-Key
+// header.
+const idempotencyKeyPrefix = "idempotency:"
+
+// idempotencyMiddleware runs a write request carrying an Idempotency-Key
+// header at most once. The response of the first request with a key is
+// cached and replayed to retries, marked with Idempotent-Replayed. A retry
+// that arrives while the first is still running waits for it up to
+// api.idempotency_wait, then gets 409 Conflict; reusing a key for a request
+// with another method, path or body gets 422. Server errors are not cached,
+// so the request can be retried.
+func (s *Server) idempotencyMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		idempotencyKey := c.GetHeader("Idempotency-Key")
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			idempotencyKey = ""
+		}
+		if idempotencyKey == "" {
+			c.Next()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		sum := sha256.Sum256(body)
+
+		key := idempotencyKeyPrefix + idempotencyKey
+		wait := s.config.API.IdempotencyWait
+		result, err := s.store.IdempotencyReserve(c.Request.Context(), key, store.IdempotencyOptions{
+			Fingerprint: c.Request.Method + " " + c.Request.URL.Path + " " + hex.EncodeToString(sum[:]),
+			Wait:        wait > 0,
+			Timeout:     wait,
+		})
+		switch {
+		case errors.Is(err, store.ErrIdempotencyMismatch):
+			c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		switch result.State {
+		case store.IdempotencyCompleted:
+			c.Header("Idempotent-Replayed", "true")
+			if result.ContentType != "" {
+				c.Header("Content-Type", result.ContentType)
+			}
+			c.Status(result.Status)
+			c.Writer.Write(result.Body)
+			c.Abort()
+			return
+		case store.IdempotencyInFlight:
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "a request with this Idempotency-Key is in progress"})
+			return
+		}
+
+		// Release the key unless the response is cached, including when the
+		// handler panics, so the client can retry
+		completed := false
+		defer func() {
+			if completed {
+				return
+			}
+			if err := s.store.IdempotencyRelease(key, result.Token); err != nil {
+				s.logger.Warn("Failed to release idempotency key", zap.String("key", idempotencyKey), zap.Error(err))
+			}
+		}()
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		if status := recorder.Status(); status < http.StatusInternalServerError {
+			contentType := recorder.Header().Get("Content-Type")
+			if err := s.store.IdempotencyComplete(key, result.Token, status, contentType, recorder.body.Bytes(), 0); err != nil {
+				s.logger.Warn("Failed to cache idempotent response", zap.String("key", idempotencyKey), zap.Error(err))
+				return
+			}
+			completed = true
+		}
+	}
+}
+
+// responseRecorder keeps a copy of the response body written through it.
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(p []byte) (int, error) {
+	w.body.Write(p)
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/chaitanyayendru/fincache/internal/config"
+	"github.com/chaitanyayendru/fincache/internal/store"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// newTestServer returns a Server with only what the middlewares need; it does
+// not register metrics, so tests can create as many as they like.
+func newTestServer(t *testing.T, api config.APIConfig) *Server {
+	st := store.NewStore(config.StoreConfig{})
+	t.Cleanup(func() { st.Close() })
+
+	return &Server{
+		config: &config.Config{API: api},
+		store:  st,
+		logger: zap.NewNop(),
+	}
+}
+
+func newTestRouter(middleware gin.HandlerFunc, handler gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middleware)
+	router.POST("/charges", handler)
+	return router
+}
+
+func post(router http.Handler, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/charges", strings.NewReader(body))
+	if key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestIdempotencyMiddlewareReplays(t *testing.T) {
+	s := newTestServer(t, config.APIConfig{})
+
+	calls := 0
+	router := newTestRouter(s.idempotencyMiddleware(), func(c *gin.Context) {
+		calls++
+		c.Data(http.StatusCreated, "text/csv", []byte("id,amount\n1,100\n"))
+	})
+
+	first := post(router, "charge-1", "amount=100")
+	replay := post(router, "charge-1", "amount=100")
+
+	if calls != 1 {
+		t.Errorf("Expected the handler to run once, ran %d times", calls)
+	}
+	if first.Header().Get("Idempotent-Replayed") != "" {
+		t.Error("Expected the first response not to be marked as replayed")
+	}
+	if replay.Header().Get("Idempotent-Replayed") != "true" {
+		t.Error("Expected the retry to be marked as replayed")
+	}
+	if replay.Code != http.StatusCreated || replay.Body.String() != first.Body.String() {
+		t.Errorf("Expected %d %q, got %d %q", http.StatusCreated, first.Body.String(), replay.Code, replay.Body.String())
+	}
+	if ct := replay.Header().Get("Content-Type"); ct != "text/csv" {
+		t.Errorf("Expected the original content type, got %q", ct)
+	}
+
+	// Requests without a key always run
+	post(router, "", "amount=100")
+	if calls != 2 {
+		t.Errorf("Expected a request without a key to run, ran %d times", calls)
+	}
+}
+
+func TestIdempotencyMiddlewareRetriesServerErrors(t *testing.T) {
+	s := newTestServer(t, config.APIConfig{})
+
+	calls := 0
+	router := newTestRouter(s.idempotencyMiddleware(), func(c *gin.Context) {
+		calls++
+		if calls == 1 {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "try again"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	})
+
+	post(router, "charge-1", "amount=100")
+	if w := post(router, "charge-1", "amount=100"); w.Code != http.StatusOK || calls != 2 {
+		t.Errorf("Expected the retry to run after a server error, got %d after %d calls", w.Code, calls)
+	}
+}
+
+func TestIdempotencyMiddlewareConflicts(t *testing.T) {
+	s := newTestServer(t, config.APIConfig{})
+
+	router := newTestRouter(s.idempotencyMiddleware(), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	})
+
+	post(router, "charge-1", "amount=100")
+	if w := post(router, "charge-1", "amount=200"); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected %d for a reused key with another body, got %d", http.StatusUnprocessableEntity, w.Code)
+	}
+}
+
+func TestIdempotencyMiddlewareInProgress(t *testing.T) {
+	s := newTestServer(t, config.APIConfig{})
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	router := newTestRouter(s.idempotencyMiddleware(), func(c *gin.Context) {
+		close(started)
+		<-release
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	})
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- post(router, "charge-1", "amount=100") }()
+	<-started
+
+	if w := post(router, "charge-1", "amount=100"); w.Code != http.StatusConflict {
+		t.Errorf("Expected %d while the first request runs, got %d", http.StatusConflict, w.Code)
+	}
+
+	close(release)
+	if w := <-done; w.Code != http.StatusOK {
+		t.Errorf("Expected the first request to succeed, got %d", w.Code)
+	}
+}
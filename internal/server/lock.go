@@ -0,0 +1,132 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/chaitanyayendru/fincache/internal/store"
+	"github.com/gin-gonic/gin"
+)
+
+// lockRequest is the body of the lock acquire and renew endpoints.
+type lockRequest struct {
+	Owner string `json:"owner" binding:"required"`
+	TTL   int64  `json:"ttl_ms" binding:"required"` // lease in milliseconds
+}
+
+func (s *Server) acquireLockHandler(c *gin.Context) {
+	start := time.Now()
+	defer func() {
+		s.metrics.requestDuration.Observe(time.Since(start).Seconds())
+	}()
+
+	s.metrics.requestsTotal.Inc()
+
+	var req lockRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	name := c.Param("name")
+	result, err := s.store.LockAcquire(name, req.Owner, time.Duration(req.TTL)*time.Millisecond)
+	if err != nil {
+		c.JSON(lockErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if !result.Acquired {
+		c.JSON(http.StatusConflict, gin.H{
+			"acquired": false,
+			"owner":    result.Owner,
+			"ttl_ms":   result.TTL.Milliseconds(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"acquired": true,
+		"lock":     name,
+		"token":    result.Token,
+		"ttl_ms":   req.TTL,
+	})
+}
+
+func (s *Server) renewLockHandler(c *gin.Context) {
+	start := time.Now()
+	defer func() {
+		s.metrics.requestDuration.Observe(time.Since(start).Seconds())
+	}()
+
+	s.metrics.requestsTotal.Inc()
+
+	var req lockRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := s.store.LockRenew(c.Param("name"), req.Owner, time.Duration(req.TTL)*time.Millisecond); err != nil {
+		c.JSON(lockErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "ttl_ms": req.TTL})
+}
+
+func (s *Server) releaseLockHandler(c *gin.Context) {
+	start := time.Now()
+	defer func() {
+		s.metrics.requestDuration.Observe(time.Since(start).Seconds())
+	}()
+
+	s.metrics.requestsTotal.Inc()
+
+	owner := c.Query("owner")
+	if owner == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "owner is required"})
+		return
+	}
+
+	if err := s.store.LockRelease(c.Param("name"), owner); err != nil {
+		c.JSON(lockErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+func (s *Server) getLockHandler(c *gin.Context) {
+	s.metrics.requestsTotal.Inc()
+
+	name := c.Param("name")
+	state, ttl, held, err := s.store.LockInfo(name)
+	if err != nil {
+		c.JSON(lockErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if !held {
+		c.JSON(http.StatusNotFound, gin.H{"error": "lock is not held"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"lock":        name,
+		"owner":       state.Owner,
+		"token":       state.Token,
+		"acquired_at": state.AcquiredAt,
+		"ttl_ms":      ttl.Milliseconds(),
+	})
+}
+
+// lockErrorStatus maps the errors of the lock methods to HTTP statuses.
+func lockErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, store.ErrNotLockOwner):
+		return http.StatusConflict
+	case errors.Is(err, store.ErrInvalidLease), errors.Is(err, store.ErrWrongType):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
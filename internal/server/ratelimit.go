@@ -0,0 +1,97 @@
+package server
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/chaitanyayendru/fincache/internal/store"
+	"github.com/gin-gonic/gin"
+)
+
+// rateLimitMiddleware enforces api.rate_limit requests per
+// api.rate_limit_period for each client IP with a token bucket, so a client
+// can burst up to the limit. Rejected requests get 429 with Retry-After.
+func (s *Server) rateLimitMiddleware() gin.HandlerFunc {
+	cfg := store.RateLimitConfig{
+		Mode:   store.RateLimitTokenBucket,
+		Limit:  int64(s.config.API.RateLimit),
+		Period: s.config.API.RateLimitPeriod,
+	}
+	if cfg.Period <= 0 {
+		cfg.Period = time.Second
+	}
+	limit := strconv.FormatInt(cfg.Limit, 10)
+	limiter := newClientLimiter(cfg)
+
+	return func(c *gin.Context) {
+		if cfg.Limit <= 0 {
+			c.Next()
+			return
+		}
+
+		result := limiter.acquire(c.ClientIP(), time.Now())
+
+		c.Header("X-RateLimit-Limit", limit)
+		c.Header("X-RateLimit-Remaining", strconv.FormatInt(result.Remaining, 10))
+		c.Header("X-RateLimit-Reset", strconv.Itoa(int(math.Ceil(result.ResetAfter.Seconds()))))
+		if !result.Allowed {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(result.RetryAfter.Seconds()))))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "rate limit exceeded"})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// clientLimiter keeps the rate limiter of each API client in process, so
+// limiting requests neither writes to the keyspace and the log nor is undone
+// by a flush or an eviction. A limiter that is back to its full limit is the
+// same as a new one, so those are dropped at most once per period.
+type clientLimiter struct {
+	config store.RateLimitConfig
+
+	mu        sync.Mutex
+	clients   map[string]*clientLimit
+	lastSweep time.Time
+}
+
+type clientLimit struct {
+	limiter *store.RateLimiter
+	fullAt  time.Time // when the limiter will be back to its full limit
+}
+
+func newClientLimiter(cfg store.RateLimitConfig) *clientLimiter {
+	return &clientLimiter{
+		config:  cfg,
+		clients: make(map[string]*clientLimit),
+	}
+}
+
+// acquire takes one request from the limiter of client.
+func (l *clientLimiter) acquire(client string, now time.Time) store.RateLimitResult {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) >= l.config.Period {
+		for id, limit := range l.clients {
+			if !now.Before(limit.fullAt) {
+				delete(l.clients, id)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	limit, exists := l.clients[client]
+	if !exists {
+		limit = &clientLimit{limiter: store.NewRateLimiter(l.config)}
+		l.clients[client] = limit
+	}
+
+	result := limit.limiter.Acquire(1, now)
+	limit.fullAt = now.Add(result.ResetAfter)
+	return result
+}
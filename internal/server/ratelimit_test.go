@@ -0,0 +1,83 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/chaitanyayendru/fincache/internal/config"
+	"github.com/chaitanyayendru/fincache/internal/store"
+	"github.com/gin-gonic/gin"
+)
+
+func postFrom(router http.Handler, addr string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/charges", nil)
+	req.RemoteAddr = addr
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	s := newTestServer(t, config.APIConfig{RateLimit: 2, RateLimitPeriod: time.Minute})
+	router := newTestRouter(s.rateLimitMiddleware(), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	for i := 0; i < 2; i++ {
+		if w := postFrom(router, "192.0.2.1:1000"); w.Code != http.StatusNoContent {
+			t.Fatalf("Expected request %d to be allowed, got %d", i+1, w.Code)
+		}
+	}
+
+	w := postFrom(router, "192.0.2.1:1000")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected %d once the limit is used up, got %d", http.StatusTooManyRequests, w.Code)
+	}
+	if w.Header().Get("Retry-After") != "30" || w.Header().Get("X-RateLimit-Remaining") != "0" {
+		t.Errorf("Expected Retry-After 30 and nothing remaining, got %v", w.Header())
+	}
+
+	if w := postFrom(router, "192.0.2.2:1000"); w.Code != http.StatusNoContent {
+		t.Errorf("Expected another client to have its own limit, got %d", w.Code)
+	}
+
+	// The limits live in process, not in the keyspace
+	if n := s.store.DBSize(); n != 0 {
+		t.Errorf("Expected no keys to be written, got %d", n)
+	}
+	s.store.Flush()
+	if w := postFrom(router, "192.0.2.1:1000"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected a flush to leave the limits alone, got %d", w.Code)
+	}
+}
+
+func TestRateLimitMiddlewareDisabled(t *testing.T) {
+	s := newTestServer(t, config.APIConfig{})
+	router := newTestRouter(s.rateLimitMiddleware(), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	for i := 0; i < 10; i++ {
+		if w := postFrom(router, "192.0.2.1:1000"); w.Code != http.StatusNoContent || w.Header().Get("X-RateLimit-Limit") != "" {
+			t.Fatalf("Expected requests to be unlimited, got %d %v", w.Code, w.Header())
+		}
+	}
+}
+
+func TestClientLimiterDropsRefilledLimiters(t *testing.T) {
+	limiter := newClientLimiter(store.RateLimitConfig{Mode: store.RateLimitTokenBucket, Limit: 10, Period: time.Second})
+
+	now := time.Now()
+	limiter.acquire("a", now)
+	limiter.acquire("b", now)
+	limiter.acquire("b", now.Add(1500*time.Millisecond))
+
+	if _, exists := limiter.clients["a"]; exists {
+		t.Error("Expected the limiter of an idle client to be dropped")
+	}
+	if len(limiter.clients) != 1 {
+		t.Errorf("Expected 1 limiter, got %d", len(limiter.clients))
+	}
+}
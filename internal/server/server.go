@@ -28,7 +28,16 @@ type Metrics struct {
 	requestsTotal     prometheus.Counter
 	requestDuration   prometheus.Histogram
 	activeConnections prometheus.Gauge
-	storeSize         prometheus.Gauge
+	storeSize         prometheus.GaugeFunc
+
+	// Store counters, read from store.Stats on every scrape
+	keyspaceHits   prometheus.CounterFunc
+	keyspaceMisses prometheus.CounterFunc
+	expiredKeys    prometheus.CounterFunc
+	evictedKeys    prometheus.CounterFunc
+	memoryUsed     prometheus.GaugeFunc
+	memoryMax      prometheus.GaugeFunc
+	keysByType     []prometheus.Collector
 }
 
 func NewServer(cfg *config.Config, store *store.Store, logger *zap.Logger) *Server {
@@ -50,20 +59,61 @@ func NewServer(cfg *config.Config, store *store.Store, logger *zap.Logger) *Serv
 				Name: "fincache_active_connections",
 				Help: "Number of active connections",
 			}),
-			storeSize: prometheus.NewGauge(prometheus.GaugeOpts{
+			storeSize: prometheus.NewGaugeFunc(prometheus.GaugeOpts{
 				Name: "fincache_store_size",
 				Help: "Number of keys in store",
-			}),
+			}, func() float64 { return float64(store.Stats().TotalKeys) }),
+			keyspaceHits: prometheus.NewCounterFunc(prometheus.CounterOpts{
+				Name: "fincache_keyspace_hits_total",
+				Help: "Number of successful key lookups",
+			}, func() float64 { return float64(store.Stats().KeyspaceHits) }),
+			keyspaceMisses: prometheus.NewCounterFunc(prometheus.CounterOpts{
+				Name: "fincache_keyspace_misses_total",
+				Help: "Number of failed key lookups",
+			}, func() float64 { return float64(store.Stats().KeyspaceMisses) }),
+			expiredKeys: prometheus.NewCounterFunc(prometheus.CounterOpts{
+				Name: "fincache_expired_keys_total",
+				Help: "Number of keys deleted after their TTL expired",
+			}, func() float64 { return float64(store.Stats().ExpiredKeys) }),
+			evictedKeys: prometheus.NewCounterFunc(prometheus.CounterOpts{
+				Name: "fincache_evicted_keys_total",
+				Help: "Number of keys evicted to stay under max memory",
+			}, func() float64 { return float64(store.Stats().Evictions) }),
+			memoryUsed: prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Name: "fincache_memory_used_bytes",
+				Help: "Estimated memory used by the keyspace",
+			}, func() float64 { return float64(store.Stats().MemoryUsage) }),
+			memoryMax: prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Name: "fincache_memory_max_bytes",
+				Help: "Configured memory limit, 0 if unlimited",
+			}, func() float64 { return float64(store.MaxMemory()) }),
 		},
 	}
 
+	for _, typ := range store.KeyTypes() {
+		typ := typ
+		server.metrics.keysByType = append(server.metrics.keysByType,
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Name:        "fincache_keys",
+				Help:        "Number of keys by type",
+				ConstLabels: prometheus.Labels{"type": typ},
+			}, func() float64 { return float64(store.Stats().KeysByType[typ]) }))
+	}
+
 	// Register metrics
 	prometheus.MustRegister(
 		server.metrics.requestsTotal,
 		server.metrics.requestDuration,
 		server.metrics.activeConnections,
 		server.metrics.storeSize,
+		server.metrics.keyspaceHits,
+		server.metrics.keyspaceMisses,
+		server.metrics.expiredKeys,
+		server.metrics.evictedKeys,
+		server.metrics.memoryUsed,
+		server.metrics.memoryMax,
 	)
+	prometheus.MustRegister(server.metrics.keysByType...)
 
 	// Initialize Redis protocol server
 	server.redisServer = protocol.NewRedisServer(store, logger)
@@ -96,16 +146,23 @@ func (s *Server) setupHTTPServer() {
 		router.GET("/metrics", gin.WrapH(promhttp.Handler()))
 	}
 
-	// API endpoints
-	api := router.Group("/api/v1")
+	// API endpoints, rate limited per client; writes with an
+	// Idempotency-Key header run at most once
+	api := router.Group("/api/v1", s.rateLimitMiddleware(), s.idempotencyMiddleware())
 	{
 		api.GET("/keys/:key", s.getKeyHandler)
 		api.POST("/keys/:key", s.setKeyHandler)
 		api.DELETE("/keys/:key", s.deleteKeyHandler)
 		api.GET("/keys", s.listKeysHandler)
 		api.GET("/stats", s.statsHandler)
+		api.GET("/stats/percentiles/:key", s.percentilesHandler)
 		api.POST("/flush", s.flushHandler)
 		api.GET("/sandbox", s.sandboxHandler)
+
+		api.GET("/locks/:name", s.getLockHandler)
+		api.POST("/locks/:name", s.acquireLockHandler)
+		api.PUT("/locks/:name", s.renewLockHandler)
+		api.DELETE("/locks/:name", s.releaseLockHandler)
 	}
 
 	// WebSocket endpoint for real-time updates
@@ -216,6 +273,7 @@ func (s *Server) getKeyHandler(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{
 		"key":   key,
+		"type":  s.store.Type(key),
 		"value": value,
 	})
 }
@@ -298,7 +356,6 @@ func (s *Server) statsHandler(c *gin.Context) {
 	s.metrics.requestsTotal.Inc()
 
 	stats := s.store.Stats()
-	s.metrics.storeSize.Set(float64(stats.TotalKeys))
 
 	c.JSON(http.StatusOK, stats)
 }
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/chaitanyayendru/fincache/internal/store"
+	"github.com/gin-gonic/gin"
+)
+
+// defaultPercentiles are reported when a request names no quantile.
+var defaultPercentiles = []string{"0.5", "0.9", "0.99"}
+
+// percentilesHandler reports quantiles of the t-digest at :key, those given
+// as repeated quantile query parameters or p50, p90 and p99, e.g. the p99
+// settlement latency or the median amount of a merchant.
+func (s *Server) percentilesHandler(c *gin.Context) {
+	start := time.Now()
+	defer func() {
+		s.metrics.requestDuration.Observe(time.Since(start).Seconds())
+	}()
+
+	s.metrics.requestsTotal.Inc()
+
+	names := c.QueryArray("quantile")
+	if len(names) == 0 {
+		names = defaultPercentiles
+	}
+	quantiles := make([]float64, len(names))
+	for i, name := range names {
+		q, err := strconv.ParseFloat(name, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "quantile must be a number between 0 and 1"})
+			return
+		}
+		quantiles[i] = q
+	}
+
+	key := c.Param("key")
+	info, err := s.store.TDigestInfo(key)
+	if err != nil {
+		c.JSON(tdigestErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if info.Count == 0 {
+		// Quantiles of no values are NaN, which JSON cannot carry
+		c.JSON(http.StatusOK, gin.H{"key": key, "count": 0})
+		return
+	}
+	values, err := s.store.TDigestQuantile(key, quantiles...)
+	if err != nil {
+		c.JSON(tdigestErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	percentiles := make(gin.H, len(names))
+	for i, name := range names {
+		percentiles[name] = values[i]
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"key":       key,
+		"count":     info.Count,
+		"min":       info.Min,
+		"max":       info.Max,
+		"quantiles": percentiles,
+	})
+}
+
+// tdigestErrorStatus maps the errors of the t-digest methods to HTTP
+// statuses.
+func tdigestErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, store.ErrNoSuchKey):
+		return http.StatusNotFound
+	case errors.Is(err, store.ErrInvalidRank), errors.Is(err, store.ErrWrongType):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
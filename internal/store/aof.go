@@ -0,0 +1,1169 @@
+package store
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Fsync policies for the append-only log.
+const (
+	FsyncAlways   = "always"
+	FsyncEverySec = "everysec"
+	FsyncNo       = "no"
+)
+
+// The append-only log records every mutating operation as a RESP array, the
+// same framing Redis uses for its AOF. It is split into segments named
+// "<aof_path>.<epoch>": every snapshot bumps the epoch and starts a new
+// segment, and records the epoch in its header. On startup the store loads
+// the snapshot and replays the segments whose epoch is at least the
+// snapshot's, so a snapshot doubles as the compacted base of the log.
+//
+// Like in Redis, commands are logged against the database they ran in: a
+// SELECT record is written whenever the database differs from that of the
+// previous record, and replay starts every segment in database 0.
+type appendOnlyLog struct {
+	mu     sync.Mutex
+	path   string
+	fsync  string
+	file   *os.File
+	epoch  uint64
+	db     int // database of the last record, -1 if unknown
+	size   int64
+	dirty  bool
+	buf    []byte
+	logger *zap.Logger
+}
+
+type aofSegment struct {
+	path  string
+	epoch uint64
+}
+
+var errAOFDisabled = errors.New("append-only log is disabled")
+
+func openAppendOnlyLog(path, fsync string, epoch uint64, logger *zap.Logger) (*appendOnlyLog, error) {
+	switch fsync {
+	case FsyncAlways, FsyncEverySec, FsyncNo:
+	case "":
+		fsync = FsyncEverySec
+	default:
+		return nil, fmt.Errorf("invalid aof fsync policy %q", fsync)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create aof directory: %w", err)
+	}
+
+	l := &appendOnlyLog{
+		path:   path,
+		fsync:  fsync,
+		logger: logger,
+	}
+	if err := l.openSegment(epoch); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func segmentPath(path string, epoch uint64) string {
+	return fmt.Sprintf("%s.%d", path, epoch)
+}
+
+// listSegments returns the existing segments of the log at path ordered by
+// epoch.
+func listSegments(path string) ([]aofSegment, error) {
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		return nil, err
+	}
+
+	var segments []aofSegment
+	for _, match := range matches {
+		epoch, err := strconv.ParseUint(strings.TrimPrefix(match, path+"."), 10, 64)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, aofSegment{path: match, epoch: epoch})
+	}
+
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].epoch < segments[j].epoch
+	})
+	return segments, nil
+}
+
+func (l *appendOnlyLog) openSegment(epoch uint64) error {
+	file, err := os.OpenFile(segmentPath(l.path, epoch), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open aof segment: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat aof segment: %w", err)
+	}
+
+	l.file = file
+	l.epoch = epoch
+	l.db = -1
+	l.size = info.Size()
+	l.dirty = false
+	return nil
+}
+
+// append writes one command run in database db to the log, syncing it
+// straight away under the "always" policy.
+func (l *appendOnlyLog) append(db int, args ...string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.buf = l.buf[:0]
+	if db != l.db {
+		l.buf = appendRESPArray(l.buf, []string{"SELECT", strconv.Itoa(db)})
+		l.db = db
+	}
+	l.buf = appendRESPArray(l.buf, args)
+	n, err := l.file.Write(l.buf)
+	l.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write aof: %w", err)
+	}
+
+	if l.fsync == FsyncAlways {
+		return l.file.Sync()
+	}
+	l.dirty = true
+	return nil
+}
+
+func appendRESPArray(buf []byte, args []string) []byte {
+	buf = append(buf, '*')
+	buf = strconv.AppendInt(buf, int64(len(args)), 10)
+	buf = append(buf, '\r', '\n')
+	for _, arg := range args {
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(arg)), 10)
+		buf = append(buf, '\r', '\n')
+		buf = append(buf, arg...)
+		buf = append(buf, '\r', '\n')
+	}
+	return buf
+}
+
+// sync flushes pending writes to stable storage; used by the "everysec"
+// policy.
+func (l *appendOnlyLog) sync() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.dirty {
+		return nil
+	}
+	l.dirty = false
+	return l.file.Sync()
+}
+
+// rotate closes the current segment and starts a new one for epoch. The
+// caller must make sure no writes are in flight, i.e. hold every shard lock.
+func (l *appendOnlyLog) rotate(epoch uint64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.fsync != FsyncNo {
+		l.file.Sync()
+	}
+	if err := l.file.Close(); err != nil {
+		return fmt.Errorf("failed to close aof segment: %w", err)
+	}
+	return l.openSegment(epoch)
+}
+
+// removeBefore deletes the segments that are fully covered by the snapshot
+// taken at epoch.
+func (l *appendOnlyLog) removeBefore(epoch uint64) {
+	segments, err := listSegments(l.path)
+	if err != nil {
+		l.logger.Error("Failed to list aof segments", zap.Error(err))
+		return
+	}
+
+	for _, seg := range segments {
+		if seg.epoch >= epoch {
+			break
+		}
+		if err := os.Remove(seg.path); err != nil {
+			l.logger.Error("Failed to remove aof segment",
+				zap.String("path", seg.path), zap.Error(err))
+		}
+	}
+}
+
+func (l *appendOnlyLog) currentSize() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.size
+}
+
+func (l *appendOnlyLog) close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.fsync != FsyncNo {
+		l.file.Sync()
+	}
+	return l.file.Close()
+}
+
+// readSegment calls fn for every command in the segment. A command cut short
+// by a crash at the end of the file is reported through truncatedAt so the
+// caller can drop the partial tail; corruption anywhere else is an error.
+func readSegment(path string, fn func(args []string) error) (truncatedAt int64, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return -1, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var offset int64
+
+	for {
+		args, n, err := readRESPArray(reader)
+		if err == io.EOF && n == 0 {
+			return -1, nil
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return offset, nil
+		}
+		if err != nil {
+			return -1, fmt.Errorf("corrupt aof at offset %d: %w", offset, err)
+		}
+
+		if err := fn(args); err != nil {
+			return -1, fmt.Errorf("failed to replay aof at offset %d: %w", offset, err)
+		}
+		offset += int64(n)
+	}
+}
+
+// maxAOFBulkLen bounds a single argument read back from the log, matching the
+// default proto-max-bulk-len, so a corrupt length cannot make us allocate
+// gigabytes.
+const maxAOFBulkLen = 512 << 20
+
+// readRESPArray reads one "*N\r\n$len\r\narg\r\n..." record and returns the
+// number of bytes consumed.
+func readRESPArray(r *bufio.Reader) ([]string, int, error) {
+	consumed := 0
+
+	readLine := func(prefix byte) (int, error) {
+		line, err := r.ReadString('\n')
+		consumed += len(line)
+		if err != nil {
+			return 0, err
+		}
+		if len(line) < 3 || line[0] != prefix || line[len(line)-2] != '\r' {
+			return 0, fmt.Errorf("malformed line %q", line)
+		}
+		return strconv.Atoi(line[1 : len(line)-2])
+	}
+
+	count, err := readLine('*')
+	if err != nil {
+		return nil, consumed, err
+	}
+	if count < 0 {
+		return nil, consumed, fmt.Errorf("invalid argument count %d", count)
+	}
+
+	args := make([]string, 0, min(count, 1024))
+	for i := 0; i < count; i++ {
+		size, err := readLine('$')
+		if err == io.EOF {
+			return nil, consumed, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, consumed, err
+		}
+		if size < 0 || size > maxAOFBulkLen {
+			return nil, consumed, fmt.Errorf("invalid argument length %d", size)
+		}
+
+		buf := make([]byte, size+2)
+		n, err := io.ReadFull(r, buf)
+		consumed += n
+		if err != nil {
+			return nil, consumed, io.ErrUnexpectedEOF
+		}
+		args = append(args, string(buf[:size]))
+	}
+
+	return args, consumed, nil
+}
+
+// openAOF replays the log written since the snapshot at s.epoch and opens it
+// for appending. It runs from NewStore before any background work starts.
+func (s *Store) openAOF() error {
+	path := s.config.AOFPath
+	if path == "" {
+		return errors.New("aof path is not configured")
+	}
+
+	segments, err := listSegments(path)
+	if err != nil {
+		return fmt.Errorf("failed to list aof segments: %w", err)
+	}
+
+	replayed := 0
+	for _, seg := range segments {
+		if seg.epoch < s.epoch {
+			continue
+		}
+
+		db := s.dbs[0]
+		truncatedAt, err := readSegment(seg.path, func(args []string) error {
+			replayed++
+			if len(args) == 2 && args[0] == "SELECT" {
+				index, err := parseDBIndex(args[1])
+				if err != nil {
+					return err
+				}
+				db, err = s.Select(index)
+				return err
+			}
+			return db.replayCommand(args)
+		})
+		if err != nil {
+			return err
+		}
+		if truncatedAt >= 0 {
+			s.logger.Warn("Truncating incomplete aof record",
+				zap.String("path", seg.path), zap.Int64("offset", truncatedAt))
+			if err := os.Truncate(seg.path, truncatedAt); err != nil {
+				return fmt.Errorf("failed to truncate aof: %w", err)
+			}
+		}
+		s.epoch = seg.epoch
+	}
+
+	log, err := openAppendOnlyLog(path, s.config.AOFFsync, s.epoch, s.logger)
+	if err != nil {
+		return err
+	}
+	log.removeBefore(s.epoch)
+	s.aof = log
+
+	if replayed > 0 {
+		s.logger.Info("Append-only log replayed",
+			zap.String("path", path), zap.Int("commands", replayed))
+	}
+	return nil
+}
+
+// propagate appends a mutating command to the log. The caller must hold the
+// write lock of every shard the command touches, so the log order matches the
+// order the writes were applied in.
+func (s *Store) propagate(args ...string) {
+	if s.aof == nil {
+		return
+	}
+	if err := s.aof.append(s.db, args...); err != nil {
+		s.logger.Error("Failed to append to aof", zap.Error(err))
+	}
+}
+
+// replayCommand applies a command read back from the log.
+func (s *Store) replayCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New("empty command")
+	}
+
+	// The log is disabled while it is replayed, so the public methods can be
+	// used for commands that span databases without logging them again.
+	cmd, args := args[0], args[1:]
+	switch cmd {
+	case "FLUSHALL":
+		return s.FlushAll()
+	case "FLUSHDB":
+		return s.Flush()
+	case "MOVE":
+		if len(args) != 2 {
+			return fmt.Errorf("wrong number of arguments for %s", cmd)
+		}
+		index, err := parseDBIndex(args[1])
+		if err != nil {
+			return err
+		}
+		_, err = s.Move(args[0], index)
+		return err
+	case "SWAPDB":
+		if len(args) != 2 {
+			return fmt.Errorf("wrong number of arguments for %s", cmd)
+		}
+		a, err := parseDBIndex(args[0])
+		if err != nil {
+			return err
+		}
+		b, err := parseDBIndex(args[1])
+		if err != nil {
+			return err
+		}
+		return s.SwapDB(a, b)
+	case "TS.ADD":
+		// TS.ADD key timestamp value, with the value already resolved. The
+		// rule destinations are only known once the series is found.
+		if len(args) != 3 {
+			return fmt.Errorf("wrong number of arguments for %s", cmd)
+		}
+		t, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return err
+		}
+		value, err := strconv.ParseFloat(args[2], 64)
+		if err != nil {
+			return err
+		}
+		return s.withRules(args[0], func() error {
+			return s.tsAdd(args[0], t, value, TSAddOptions{OnDuplicate: DuplicateLast}, true)
+		})
+	case "TS.CREATERULE":
+		// TS.CREATERULE src dest aggregation bucket-ms
+		if len(args) != 4 {
+			return fmt.Errorf("wrong number of arguments for %s", cmd)
+		}
+		aggregation, ok := ParseAggregation(args[2])
+		if !ok {
+			return fmt.Errorf("invalid aggregation %q", args[2])
+		}
+		ms, err := strconv.ParseInt(args[3], 10, 64)
+		if err != nil {
+			return err
+		}
+		return s.TSCreateRule(args[0], args[1], aggregation, time.Duration(ms)*time.Millisecond)
+	case "TS.DELETERULE":
+		if len(args) != 2 {
+			return fmt.Errorf("wrong number of arguments for %s", cmd)
+		}
+		return s.TSDeleteRule(args[0], args[1])
+	}
+
+	if len(args) == 0 {
+		return fmt.Errorf("wrong number of arguments for %s", cmd)
+	}
+	keys := args[:1]
+	switch cmd {
+	case "DEL":
+		keys = args
+	case "LMOVE":
+		if len(args) != 4 {
+			return fmt.Errorf("wrong number of arguments for %s", cmd)
+		}
+		keys = args[:2]
+	case "RENAME":
+		if len(args) != 2 {
+			return fmt.Errorf("wrong number of arguments for %s", cmd)
+		}
+		keys = args
+	case "XGROUP":
+		// XGROUP subcommand key group ...
+		if len(args) < 3 {
+			return fmt.Errorf("wrong number of arguments for %s", cmd)
+		}
+		keys = args[1:2]
+	case "LEDGER.TRANSFER":
+		// LEDGER.TRANSFER from to amount idempotency-key journal id ms
+		if len(args) != 7 {
+			return fmt.Errorf("wrong number of arguments for %s", cmd)
+		}
+		keys = []string{args[0], args[1], args[4], ledgerIdempotencyPrefix + args[3]}
+	}
+	unlock := s.lockKeys(keys...)
+	defer unlock()
+
+	sh := s.shardFor(args[0])
+	switch cmd {
+	case "SET":
+		// SET key payload [PXAT ms]
+		if len(args) != 2 && len(args) != 4 {
+			return fmt.Errorf("wrong number of arguments for %s", cmd)
+		}
+		value, err := unmarshalValue(args[1])
+		if err != nil {
+			return err
+		}
+		var expiresAt *time.Time
+		if len(args) == 4 {
+			at, err := parseUnixMilli(args[3])
+			if err != nil {
+				return err
+			}
+			if time.Now().After(at) {
+				s.del(sh, args[0])
+				return nil
+			}
+			expiresAt = &at
+		}
+		s.set(sh, args[0], value, expiresAt)
+	case "DEL":
+		for _, key := range args {
+			s.del(s.shardFor(key), key)
+		}
+	case "PEXPIREAT":
+		if len(args) != 2 {
+			return fmt.Errorf("wrong number of arguments for %s", cmd)
+		}
+		at, err := parseUnixMilli(args[1])
+		if err != nil {
+			return err
+		}
+		s.expireAt(sh, args[0], at)
+	case "PERSIST":
+		if len(args) != 1 {
+			return fmt.Errorf("wrong number of arguments for %s", cmd)
+		}
+		s.persist(sh, args[0])
+	case "RENAME":
+		// A source that has expired since was renamed with its TTL, so the
+		// destination would have expired as well.
+		if s.liveKey(sh, args[0]) && args[0] != args[1] {
+			s.rename(args[0], args[1])
+		}
+	case "RESTORE":
+		// RESTORE key payload [PXAT ms], the payload without DUMP's trailer
+		if len(args) != 2 && len(args) != 4 {
+			return fmt.Errorf("wrong number of arguments for %s", cmd)
+		}
+		value, err := unmarshalValue(args[1])
+		if err != nil {
+			return err
+		}
+		var expiresAt *time.Time
+		if len(args) == 4 {
+			at, err := parseUnixMilli(args[3])
+			if err != nil {
+				return err
+			}
+			if time.Now().After(at) {
+				s.del(sh, args[0])
+				return nil
+			}
+			expiresAt = &at
+		}
+		return s.restore(sh, args[0], value, expiresAt)
+	case "ZADD":
+		if len(args) != 3 {
+			return fmt.Errorf("wrong number of arguments for %s", cmd)
+		}
+		score, err := strconv.ParseFloat(args[1], 64)
+		if err != nil {
+			return err
+		}
+		s.zadd(sh, args[0], score, args[2])
+	case "ZINCRBY":
+		if len(args) != 3 {
+			return fmt.Errorf("wrong number of arguments for %s", cmd)
+		}
+		increment, err := strconv.ParseFloat(args[1], 64)
+		if err != nil {
+			return err
+		}
+		s.zincrby(sh, args[0], increment, args[2])
+	case "ZREM":
+		if len(args) < 2 {
+			return fmt.Errorf("wrong number of arguments for %s", cmd)
+		}
+		s.zrem(sh, args[0], args[1:]...)
+	case "LPUSH", "RPUSH":
+		if len(args) < 2 {
+			return fmt.Errorf("wrong number of arguments for %s", cmd)
+		}
+		if _, _, err := s.writeList(sh, args[0]); err != nil {
+			return err
+		}
+		end := ListRight
+		if cmd == "LPUSH" {
+			end = ListLeft
+		}
+		s.pushList(sh, end, args[0], args[1:])
+	case "LPOP", "RPOP":
+		if len(args) != 2 {
+			return fmt.Errorf("wrong number of arguments for %s", cmd)
+		}
+		count, err := strconv.Atoi(args[1])
+		if err != nil {
+			return err
+		}
+		end := ListRight
+		if cmd == "LPOP" {
+			end = ListLeft
+		}
+		_, err = s.popList(sh, end, args[0], count)
+		return err
+	case "LSET", "LREM", "LTRIM":
+		if len(args) != 3 {
+			return fmt.Errorf("wrong number of arguments for %s", cmd)
+		}
+		n, err := strconv.Atoi(args[1])
+		if err != nil {
+			return err
+		}
+		switch cmd {
+		case "LSET":
+			return s.lset(sh, args[0], n, args[2])
+		case "LREM":
+			_, err = s.lrem(sh, args[0], n, args[2])
+			return err
+		default:
+			stop, err := strconv.Atoi(args[2])
+			if err != nil {
+				return err
+			}
+			return s.ltrim(sh, args[0], n, stop)
+		}
+	case "SADD", "SREM":
+		if len(args) < 2 {
+			return fmt.Errorf("wrong number of arguments for %s", cmd)
+		}
+		var err error
+		if cmd == "SADD" {
+			_, err = s.sadd(sh, args[0], args[1:])
+		} else {
+			_, err = s.srem(sh, args[0], args[1:])
+		}
+		return err
+	case "XADD":
+		// XADD key id field value...
+		if len(args) < 4 {
+			return fmt.Errorf("wrong number of arguments for %s", cmd)
+		}
+		_, err := s.xadd(sh, args[0], args[1], args[2:], XAddOptions{})
+		return err
+	case "XTRIM":
+		// XTRIM key MAXLEN n
+		if len(args) != 3 || args[1] != "MAXLEN" {
+			return fmt.Errorf("wrong number of arguments for %s", cmd)
+		}
+		maxLen, err := strconv.Atoi(args[2])
+		if err != nil {
+			return err
+		}
+		_, err = s.xtrim(sh, args[0], StreamTrim{MaxLen: maxLen})
+		return err
+	case "XGROUP":
+		return s.replayXGroup(args)
+	case "XACK":
+		if len(args) < 3 {
+			return fmt.Errorf("wrong number of arguments for %s", cmd)
+		}
+		_, err := s.xack(sh, args[0], args[1], args[2:])
+		return err
+	case "XCLAIM":
+		return s.replayXClaim(sh, args)
+	case "RL.CONFIG":
+		// RL.CONFIG key mode limit period-ms
+		if len(args) != 4 {
+			return fmt.Errorf("wrong number of arguments for %s", cmd)
+		}
+		cfg, err := parseRateLimitArgs(args[1:])
+		if err != nil {
+			return err
+		}
+		return s.rateLimitConfigure(sh, args[0], cfg)
+	case "RL.ACQUIRE":
+		// RL.ACQUIRE key cost ms [mode limit period-ms]
+		if len(args) != 3 && len(args) != 6 {
+			return fmt.Errorf("wrong number of arguments for %s", cmd)
+		}
+		cost, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return err
+		}
+		at, err := parseUnixMilli(args[2])
+		if err != nil {
+			return err
+		}
+		var cfg *RateLimitConfig
+		if len(args) == 6 {
+			c, err := parseRateLimitArgs(args[3:])
+			if err != nil {
+				return err
+			}
+			cfg = &c
+		}
+		// A limiter created on the fly may have expired since
+		if _, err := s.rateLimitAcquire(sh, args[0], cost, cfg, at); err != nil && !errors.Is(err, ErrNoRateLimit) {
+			return err
+		}
+	case "LEDGER.TRANSFER":
+		expiresAt, err := parseUnixMilli(args[6])
+		if err != nil {
+			return err
+		}
+		t := LedgerTransfer{From: args[0], To: args[1], Amount: args[2], IdempotencyKey: args[3], Journal: args[4]}
+		_, err = s.ledgerTransfer(t, args[5], expiresAt, time.Now())
+		return err
+	case "TS.CREATE":
+		// TS.CREATE key retention-ms policy [label value ...]
+		if len(args) < 3 || len(args)%2 != 1 {
+			return fmt.Errorf("wrong number of arguments for %s", cmd)
+		}
+		retention, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return err
+		}
+		policy, ok := ParseDuplicatePolicy(args[2])
+		if !ok {
+			return fmt.Errorf("invalid duplicate policy %q", args[2])
+		}
+		opts := TSOptions{Retention: time.Duration(retention) * time.Millisecond, DuplicatePolicy: policy, Labels: make(map[string]string)}
+		for i := 3; i < len(args); i += 2 {
+			opts.Labels[args[i]] = args[i+1]
+		}
+		return s.tsCreate(sh, args[0], newTimeSeries(opts))
+	case "BF.RESERVE":
+		// BF.RESERVE key error-rate capacity expansion [NONSCALING]
+		if len(args) != 4 && len(args) != 5 {
+			return fmt.Errorf("wrong number of arguments for %s", cmd)
+		}
+		errorRate, err := strconv.ParseFloat(args[1], 64)
+		if err != nil {
+			return err
+		}
+		capacity, err := strconv.ParseInt(args[2], 10, 64)
+		if err != nil {
+			return err
+		}
+		expansion, err := strconv.Atoi(args[3])
+		if err != nil {
+			return err
+		}
+		opts := BloomOptions{ErrorRate: errorRate, Capacity: capacity, Expansion: expansion, NonScaling: len(args) == 5}
+		if err := opts.validate(); err != nil {
+			return err
+		}
+		return s.bfReserve(sh, args[0], opts)
+	case "BF.ADD":
+		if len(args) != 2 {
+			return fmt.Errorf("wrong number of arguments for %s", cmd)
+		}
+		_, err := s.bfAdd(sh, args[0], args[1:])
+		return err
+	case "CF.RESERVE":
+		// CF.RESERVE key capacity bucket-size max-iterations expansion
+		if len(args) != 5 {
+			return fmt.Errorf("wrong number of arguments for %s", cmd)
+		}
+		var n [4]int64
+		for i := range n {
+			v, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				return err
+			}
+			n[i] = v
+		}
+		opts := CuckooOptions{Capacity: n[0], BucketSize: int(n[1]), MaxIterations: int(n[2]), Expansion: int(n[3])}
+		if err := opts.validate(); err != nil {
+			return err
+		}
+		return s.cfReserve(sh, args[0], opts)
+	case "CF.ADD":
+		if len(args) != 2 {
+			return fmt.Errorf("wrong number of arguments for %s", cmd)
+		}
+		return s.cfAdd(sh, args[0], args[1])
+	case "CF.DEL":
+		if len(args) != 2 {
+			return fmt.Errorf("wrong number of arguments for %s", cmd)
+		}
+		_, err := s.cfDel(sh, args[0], args[1])
+		return err
+	case "CMS.INITBYDIM":
+		if len(args) != 3 {
+			return fmt.Errorf("wrong number of arguments for %s", cmd)
+		}
+		width, err := strconv.ParseUint(args[1], 10, 32)
+		if err != nil {
+			return err
+		}
+		depth, err := strconv.ParseUint(args[2], 10, 32)
+		if err != nil {
+			return err
+		}
+		if width == 0 || depth == 0 || width*depth > maxSketchCounters {
+			return ErrInvalidSketch
+		}
+		return s.cmsInit(sh, args[0], uint32(width), uint32(depth))
+	case "CMS.INCRBY":
+		if len(args) < 3 || len(args)%2 != 1 {
+			return fmt.Errorf("wrong number of arguments for %s", cmd)
+		}
+		items, increments, err := parseIncrements(args[1:])
+		if err != nil {
+			return err
+		}
+		_, err = s.cmsIncrBy(sh, args[0], items, increments)
+		return err
+	case "TOPK.RESERVE":
+		// TOPK.RESERVE key k width depth decay
+		if len(args) != 5 {
+			return fmt.Errorf("wrong number of arguments for %s", cmd)
+		}
+		var n [3]int
+		for i := range n {
+			v, err := strconv.Atoi(args[i+1])
+			if err != nil {
+				return err
+			}
+			n[i] = v
+		}
+		decay, err := strconv.ParseFloat(args[4], 64)
+		if err != nil {
+			return err
+		}
+		opts := TopKOptions{K: n[0], Width: n[1], Depth: n[2], Decay: decay}
+		if err := opts.validate(); err != nil {
+			return err
+		}
+		return s.topkReserve(sh, args[0], opts)
+	case "TOPK.INCRBY":
+		if len(args) < 3 || len(args)%2 != 1 {
+			return fmt.Errorf("wrong number of arguments for %s", cmd)
+		}
+		items, increments, err := parseIncrements(args[1:])
+		if err != nil {
+			return err
+		}
+		_, err = s.topkIncrBy(sh, args[0], items, increments)
+		return err
+	case "TDIGEST.CREATE":
+		if len(args) != 2 {
+			return fmt.Errorf("wrong number of arguments for %s", cmd)
+		}
+		compression, err := strconv.ParseFloat(args[1], 64)
+		if err != nil {
+			return err
+		}
+		if compression, err = validCompression(compression); err != nil {
+			return err
+		}
+		return s.tdigestCreate(sh, args[0], compression)
+	case "TDIGEST.ADD":
+		if len(args) < 2 {
+			return fmt.Errorf("wrong number of arguments for %s", cmd)
+		}
+		values := make([]float64, len(args)-1)
+		for i, arg := range args[1:] {
+			v, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				return err
+			}
+			values[i] = v
+		}
+		return s.tdigestAdd(sh, args[0], values)
+	case "SETBIT":
+		if len(args) != 3 {
+			return fmt.Errorf("wrong number of arguments for %s", cmd)
+		}
+		offset, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil || offset < 0 || offset > maxBitOffset {
+			return ErrBitOffset
+		}
+		value, err := strconv.Atoi(args[2])
+		if err != nil || value != 0 && value != 1 {
+			return ErrBitValue
+		}
+		_, err = s.setbit(sh, args[0], offset, value)
+		return err
+	case "BITFIELD":
+		// BITFIELD key SET type offset value [SET type offset value ...]
+		if len(args) < 5 || len(args)%4 != 1 {
+			return fmt.Errorf("wrong number of arguments for %s", cmd)
+		}
+		var ops []BitFieldOp
+		for i := 1; i < len(args); i += 4 {
+			t, err := ParseBitFieldType(args[i+1])
+			if err != nil {
+				return err
+			}
+			offset, err := strconv.ParseInt(args[i+2], 10, 64)
+			if err != nil || offset < 0 || offset+int64(t.Bits)-1 > maxBitOffset {
+				return ErrBitOffset
+			}
+			value, err := strconv.ParseInt(args[i+3], 10, 64)
+			if err != nil {
+				return err
+			}
+			ops = append(ops, BitFieldOp{Kind: BitFieldSet, Type: t, Offset: offset, Value: value})
+		}
+		_, err := s.bitfield(sh, args[0], ops)
+		return err
+	case "INCRBY":
+		if len(args) != 2 {
+			return fmt.Errorf("wrong number of arguments for %s", cmd)
+		}
+		increment, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return err
+		}
+		_, err = s.incrBy(sh, args[0], increment)
+		return err
+	case "APPEND":
+		if len(args) != 2 {
+			return fmt.Errorf("wrong number of arguments for %s", cmd)
+		}
+		_, err := s.append(sh, args[0], args[1])
+		return err
+	case "SETRANGE":
+		if len(args) != 3 {
+			return fmt.Errorf("wrong number of arguments for %s", cmd)
+		}
+		offset, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil || offset < 0 {
+			return ErrOffset
+		}
+		_, err = s.setRange(sh, args[0], offset, args[2])
+		return err
+	case "HSET":
+		if len(args) < 3 || len(args)%2 != 1 {
+			return fmt.Errorf("wrong number of arguments for %s", cmd)
+		}
+		_, err := s.hset(sh, args[0], args[1:])
+		return err
+	case "HDEL":
+		if len(args) < 2 {
+			return fmt.Errorf("wrong number of arguments for %s", cmd)
+		}
+		_, err := s.hdel(sh, args[0], args[1:])
+		return err
+	case "HINCRBY":
+		if len(args) != 3 {
+			return fmt.Errorf("wrong number of arguments for %s", cmd)
+		}
+		increment, err := strconv.ParseInt(args[2], 10, 64)
+		if err != nil {
+			return err
+		}
+		_, err = s.hincrby(sh, args[0], args[1], increment)
+		return err
+	case "HPEXPIREAT":
+		// HPEXPIREAT key ms FIELDS n field...
+		if len(args) < 5 || args[2] != "FIELDS" || args[3] != strconv.Itoa(len(args)-4) {
+			return fmt.Errorf("wrong number of arguments for %s", cmd)
+		}
+		at, err := parseUnixMilli(args[1])
+		if err != nil {
+			return err
+		}
+		_, err = s.hexpireAt(sh, args[0], at, args[4:])
+		return err
+	case "LMOVE":
+		from, ok1 := ParseListEnd(args[2])
+		to, ok2 := ParseListEnd(args[3])
+		if !ok1 || !ok2 {
+			return fmt.Errorf("invalid direction for %s", cmd)
+		}
+		_, _, err := s.lmove(args[0], args[1], from, to)
+		return err
+	default:
+		return fmt.Errorf("unknown command %q", cmd)
+	}
+
+	return nil
+}
+
+// aofWorker fsyncs the log once a second under the "everysec" policy and
+// compacts it once it has grown past the configured threshold.
+func (s *Store) aofWorker() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	var rewriting atomic.Bool
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			if s.aof.fsync == FsyncEverySec {
+				if err := s.aof.sync(); err != nil {
+					s.logger.Error("Failed to fsync aof", zap.Error(err))
+				}
+			}
+
+			if s.config.SnapshotPath == "" || !s.aofNeedsRewrite() || !rewriting.CompareAndSwap(false, true) {
+				continue
+			}
+			go func() {
+				defer rewriting.Store(false)
+				if err := s.RewriteAOF(); err != nil {
+					s.logger.Error("Failed to rewrite aof", zap.Error(err))
+				}
+			}()
+		}
+	}
+}
+
+// aofNeedsRewrite reports whether the current segment has outgrown both the
+// minimum rewrite size and the configured percentage of the last snapshot.
+func (s *Store) aofNeedsRewrite() bool {
+	size := s.aof.currentSize()
+
+	minSize := s.config.AOFRewriteMinSize
+	if minSize <= 0 {
+		minSize = 64 << 20
+	}
+	if size < minSize {
+		return false
+	}
+
+	percentage := s.config.AOFRewritePercentage
+	if percentage <= 0 {
+		return true
+	}
+	return size >= s.baseSize.Load()*int64(percentage)/100
+}
+
+// RewriteAOF compacts the append-only log by writing a fresh snapshot, which
+// becomes the new base of the log, and dropping the segments it covers.
+func (s *Store) RewriteAOF() error {
+	if s.aof == nil {
+		return errAOFDisabled
+	}
+	return s.SaveSnapshot()
+}
+
+// parseIncrements splits item increment pairs as logged by CMS.INCRBY and
+// TOPK.INCRBY.
+func parseIncrements(args []string) ([]string, []uint64, error) {
+	items := make([]string, 0, len(args)/2)
+	increments := make([]uint64, 0, len(args)/2)
+	for i := 0; i < len(args); i += 2 {
+		n, err := strconv.ParseUint(args[i+1], 10, 64)
+		if err != nil {
+			return nil, nil, err
+		}
+		items = append(items, args[i])
+		increments = append(increments, n)
+	}
+	return items, increments, nil
+}
+
+func formatUnixMilli(t time.Time) string {
+	return strconv.FormatInt(t.UnixMilli(), 10)
+}
+
+func parseUnixMilli(s string) (time.Time, error) {
+	ms, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp %q", s)
+	}
+	return time.UnixMilli(ms), nil
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// parseRateLimitArgs parses the mode, limit and period in milliseconds logged
+// by the rate limit commands.
+func parseRateLimitArgs(args []string) (RateLimitConfig, error) {
+	mode, ok := ParseRateLimitMode(args[0])
+	if !ok {
+		return RateLimitConfig{}, fmt.Errorf("invalid rate limit mode %q", args[0])
+	}
+	limit, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return RateLimitConfig{}, err
+	}
+	ms, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return RateLimitConfig{}, err
+	}
+	return RateLimitConfig{Mode: mode, Limit: limit, Period: time.Duration(ms) * time.Millisecond}, nil
+}
+
+// replayXGroup replays the XGROUP subcommands logged by the stream commands.
+// The caller must hold the shard lock of the key.
+func (s *Store) replayXGroup(args []string) error {
+	sub, key, group := args[0], args[1], args[2]
+	sh := s.shardFor(key)
+	var err error
+	switch {
+	case sub == "CREATE" && (len(args) == 4 || len(args) == 5 && args[4] == "MKSTREAM"):
+		err = s.xgroupCreate(sh, key, group, args[3], len(args) == 5)
+	case sub == "SETID" && len(args) == 4:
+		err = s.xgroupSetID(sh, key, group, args[3])
+	case sub == "DESTROY" && len(args) == 3:
+		_, err = s.xgroupDestroy(sh, key, group)
+	case sub == "CREATECONSUMER" && len(args) == 4:
+		_, err = s.xgroupCreateConsumer(sh, key, group, args[3])
+	case sub == "DELCONSUMER" && len(args) == 4:
+		_, err = s.xgroupDelConsumer(sh, key, group, args[3])
+	default:
+		err = fmt.Errorf("invalid XGROUP record %v", args)
+	}
+	return err
+}
+
+// replayXClaim replays the forced claims that record stream deliveries:
+// XCLAIM key group consumer min-idle id... [TIME ms] [RETRYCOUNT n] [FORCE]
+// [JUSTID] [LASTID id]. The caller must hold sh.mu.
+func (s *Store) replayXClaim(sh *shard, args []string) error {
+	if len(args) < 5 {
+		return fmt.Errorf("wrong number of arguments for XCLAIM")
+	}
+	minIdle, err := strconv.ParseInt(args[3], 10, 64)
+	if err != nil {
+		return err
+	}
+
+	var ids []string
+	var opts XClaimOptions
+	for i := 4; i < len(args); i++ {
+		switch args[i] {
+		case "TIME", "RETRYCOUNT", "LASTID":
+			if i+1 >= len(args) {
+				return fmt.Errorf("missing value for %s in XCLAIM", args[i])
+			}
+			i++
+			switch args[i-1] {
+			case "TIME":
+				at, err := parseUnixMilli(args[i])
+				if err != nil {
+					return err
+				}
+				opts.DeliveredAt = at
+			case "RETRYCOUNT":
+				if opts.RetryCount, err = strconv.Atoi(args[i]); err != nil {
+					return err
+				}
+			default:
+				opts.LastID = args[i]
+			}
+		case "FORCE":
+			opts.Force = true
+		case "JUSTID":
+			opts.JustID = true
+		default:
+			ids = append(ids, args[i])
+		}
+	}
+
+	_, err = s.xclaim(sh, args[0], args[1], args[2], time.Duration(minIdle)*time.Millisecond, ids, opts)
+	return err
+}
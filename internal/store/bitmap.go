@@ -0,0 +1,587 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxBitOffset is the highest bit a bitmap may address, which caps a string
+// grown by SETBIT or BITFIELD at 512MB, as in Redis.
+const maxBitOffset = 1<<32 - 1
+
+var (
+	ErrBitOffset    = errors.New("bit offset is not an integer or out of range")
+	ErrBitValue     = errors.New("bit is not an integer or out of range")
+	ErrBitFieldType = errors.New("invalid bitfield type; use something like i16 u8, signed up to 64 bits and unsigned up to 63")
+	ErrBitOp        = errors.New("BITOP NOT must be called with a single source key")
+)
+
+// Bitmaps are plain string values addressed bit by bit, most significant bit
+// of the first byte first. Strings are immutable, so every write copies the
+// string; a bitmap grows with zero bytes to the highest bit written.
+
+// readString returns the string at key for a read, with ok false if there
+// is none. Values of other types fail with ErrWrongType. The caller must
+// hold sh.mu.
+func (s *Store) readString(sh *shard, key string) (string, bool, error) {
+	item, exists := sh.data[key]
+	if exists && item.ExpiresAt != nil && time.Now().After(*item.ExpiresAt) {
+		exists = false
+	}
+	if !exists {
+		if _, isZSet := sh.sortedSets[key]; isZSet {
+			return "", false, ErrWrongType
+		}
+		s.stats.recordLookup(false)
+		return "", false, nil
+	}
+
+	str, ok := item.Value.(string)
+	if !ok {
+		return "", false, ErrWrongType
+	}
+	s.stats.recordLookup(true)
+	s.touch(item)
+	return str, true, nil
+}
+
+// writeString returns the item holding the string at key for a write,
+// deleting it first if it has expired. It returns a nil item if there is no
+// string. The caller must hold sh.mu.
+func (s *Store) writeString(sh *shard, key string) (*Item, string, error) {
+	if _, isZSet := sh.sortedSets[key]; isZSet {
+		return nil, "", ErrWrongType
+	}
+	item, exists := sh.data[key]
+	if !exists {
+		return nil, "", nil
+	}
+	if item.ExpiresAt != nil && time.Now().After(*item.ExpiresAt) {
+		s.deleteExpired(sh, key)
+		return nil, "", nil
+	}
+
+	str, ok := item.Value.(string)
+	if !ok {
+		return nil, "", ErrWrongType
+	}
+	s.touch(item)
+	return item, str, nil
+}
+
+// storeString writes str to key, updating item in place to keep its TTL or
+// creating the key if item is nil. The caller must hold sh.mu and log the
+// write.
+func (s *Store) storeString(sh *shard, key string, item *Item, str string) error {
+	if item == nil {
+		if err := s.reserveMemory(sh, key, itemSize(key, str)); err != nil {
+			return err
+		}
+		s.set(sh, key, str, nil)
+		return nil
+	}
+
+	delta := valueSize(str) - valueSize(item.Value)
+	if err := s.reserveMemory(sh, key, delta); err != nil {
+		return err
+	}
+	item.Value = str
+	item.UpdatedAt = time.Now()
+	s.resize(item, delta)
+	return nil
+}
+
+// growBytes returns a copy of str as bytes, padded with zero bytes to hold
+// bit.
+func growBytes(str string, bit int64) []byte {
+	b := make([]byte, max(int64(len(str)), bit/8+1))
+	copy(b, str)
+	return b
+}
+
+// getBit returns a bit of a string or of one being written to as bytes.
+func getBit[T string | []byte](data T, bit int64) int {
+	if bit/8 >= int64(len(data)) {
+		return 0
+	}
+	return int(data[bit/8]>>(7-bit%8)) & 1
+}
+
+func setBit(b []byte, bit int64, value int) {
+	mask := byte(1) << (7 - bit%8)
+	if value == 1 {
+		b[bit/8] |= mask
+	} else {
+		b[bit/8] &^= mask
+	}
+}
+
+// SetBit sets the bit at offset of the string at key to value, 0 or 1,
+// growing or creating the string as needed, and returns the previous bit.
+func (s *Store) SetBit(key string, offset int64, value int) (int, error) {
+	if offset < 0 || offset > maxBitOffset {
+		return 0, ErrBitOffset
+	}
+	if value != 0 && value != 1 {
+		return 0, ErrBitValue
+	}
+
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	return s.setbit(sh, key, offset, value)
+}
+
+// setbit implements SetBit. The caller must hold sh.mu.
+func (s *Store) setbit(sh *shard, key string, offset int64, value int) (int, error) {
+	item, str, err := s.writeString(sh, key)
+	if err != nil {
+		return 0, err
+	}
+
+	old := getBit(str, offset)
+	b := growBytes(str, offset)
+	setBit(b, offset, value)
+	if err := s.storeString(sh, key, item, string(b)); err != nil {
+		return 0, err
+	}
+
+	s.propagate("SETBIT", key, strconv.FormatInt(offset, 10), strconv.Itoa(value))
+	s.notify(notifyString, "setbit", key)
+	return old, nil
+}
+
+// GetBit returns the bit at offset of the string at key; bits past its end
+// and of a missing key are 0.
+func (s *Store) GetBit(key string, offset int64) (int, error) {
+	if offset < 0 || offset > maxBitOffset {
+		return 0, ErrBitOffset
+	}
+
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	str, _, err := s.readString(sh, key)
+	if err != nil {
+		return 0, err
+	}
+	return getBit(str, offset), nil
+}
+
+// BitRange selects part of a string for BitCount and BitPos. Start and End
+// are inclusive and count from the end of the string when negative.
+type BitRange struct {
+	Start int64
+	End   *int64 // nil runs to the end of the string
+	// Bits makes Start and End index bits rather than bytes.
+	Bits bool
+}
+
+// bits returns the first and last bit of r in a string of n bytes, with ok
+// false if r is empty.
+func (r *BitRange) bits(n int64) (first, last int64, ok bool) {
+	if r == nil {
+		return 0, n*8 - 1, n > 0
+	}
+	length := n
+	if r.Bits {
+		length = n * 8
+	}
+	start, end := r.Start, length-1
+	if r.End != nil {
+		end = *r.End
+	}
+	if start < 0 {
+		start = max(start+length, 0)
+	}
+	if end < 0 {
+		end = max(end+length, 0)
+	}
+	end = min(end, length-1)
+	if start > end {
+		return 0, 0, false
+	}
+	if r.Bits {
+		return start, end, true
+	}
+	return start * 8, end*8 + 7, true
+}
+
+// BitCount returns the number of set bits of the string at key within r,
+// or all of them if r is nil.
+func (s *Store) BitCount(key string, r *BitRange) (int64, error) {
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	str, _, err := s.readString(sh, key)
+	if err != nil {
+		return 0, err
+	}
+	first, last, ok := r.bits(int64(len(str)))
+	if !ok {
+		return 0, nil
+	}
+
+	var count int64
+	for bit := first; bit <= last; {
+		if bit%8 == 0 && bit+7 <= last {
+			count += int64(bits.OnesCount8(str[bit/8]))
+			bit += 8
+			continue
+		}
+		count += int64(getBit(str, bit))
+		bit++
+	}
+	return count, nil
+}
+
+// BitPos returns the position of the first bit set to value, 0 or 1, of
+// the string at key within r, or within all of it if r is nil, or -1 if
+// there is none. Looking for a 0 without an end treats the string as padded
+// with zeros, so it then returns the first bit past the end rather than -1.
+func (s *Store) BitPos(key string, value int, r *BitRange) (int64, error) {
+	if value != 0 && value != 1 {
+		return 0, ErrBitValue
+	}
+
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	str, _, err := s.readString(sh, key)
+	if err != nil {
+		return 0, err
+	}
+	if len(str) == 0 {
+		if value == 0 {
+			return 0, nil
+		}
+		return -1, nil
+	}
+
+	first, last, ok := r.bits(int64(len(str)))
+	if !ok {
+		return -1, nil
+	}
+	// Whole bytes without the bit are skipped at once
+	skip := byte(0)
+	if value == 0 {
+		skip = 0xff
+	}
+	for bit := first; bit <= last; {
+		if bit%8 == 0 && bit+7 <= last && str[bit/8] == skip {
+			bit += 8
+			continue
+		}
+		if getBit(str, bit) == value {
+			return bit, nil
+		}
+		bit++
+	}
+	if value == 0 && (r == nil || r.End == nil) {
+		return last + 1, nil
+	}
+	return -1, nil
+}
+
+// BitOp combines the strings at sources bit by bit with op, one of AND, OR,
+// XOR and NOT, and stores the result at dest, replacing any value there.
+// Shorter and missing sources count as zero bytes; NOT takes one source.
+// It returns the length of the result; an empty result deletes dest.
+func (s *Store) BitOp(op string, dest string, sources ...string) (int64, error) {
+	op = strings.ToUpper(op)
+	switch {
+	case op == "NOT" && len(sources) != 1:
+		return 0, ErrBitOp
+	case op != "AND" && op != "OR" && op != "XOR" && op != "NOT":
+		return 0, fmt.Errorf("unknown bit operation %q", op)
+	case len(sources) == 0:
+		return 0, errors.New("at least one source is required")
+	}
+
+	unlock := s.lockKeys(append([]string{dest}, sources...)...)
+	defer unlock()
+
+	strs := make([]string, len(sources))
+	var length int
+	for i, key := range sources {
+		str, _, err := s.readString(s.shardFor(key), key)
+		if err != nil {
+			return 0, err
+		}
+		strs[i] = str
+		length = max(length, len(str))
+	}
+
+	result := make([]byte, length)
+	for i := range result {
+		var b byte
+		if i < len(strs[0]) {
+			b = strs[0][i]
+		}
+		if op == "NOT" {
+			result[i] = ^b
+			continue
+		}
+		for _, str := range strs[1:] {
+			var other byte
+			if i < len(str) {
+				other = str[i]
+			}
+			switch op {
+			case "AND":
+				b &= other
+			case "OR":
+				b |= other
+			case "XOR":
+				b ^= other
+			}
+		}
+		result[i] = b
+	}
+
+	sh := s.shardFor(dest)
+	if _, isZSet := sh.sortedSets[dest]; isZSet {
+		return 0, ErrWrongType
+	}
+	if length == 0 {
+		if s.del(sh, dest) {
+			s.propagate("DEL", dest)
+			s.notify(notifyGeneric, "del", dest)
+		}
+		return 0, nil
+	}
+
+	str := string(result)
+	var payload string
+	if s.aof != nil {
+		var err error
+		if payload, err = marshalValue(str); err != nil {
+			return 0, err
+		}
+	}
+	delta := itemSize(dest, str)
+	if prev, exists := sh.data[dest]; exists {
+		delta -= prev.size
+	}
+	if err := s.reserveMemory(sh, dest, delta); err != nil {
+		return 0, err
+	}
+	s.set(sh, dest, str, nil)
+
+	s.propagate("SET", dest, payload)
+	s.notify(notifyString, "set", dest)
+	return int64(length), nil
+}
+
+// BitFieldType is the type of a BITFIELD integer: signed or unsigned, of
+// 1 to 64 bits signed or 1 to 63 unsigned.
+type BitFieldType struct {
+	Signed bool
+	Bits   uint
+}
+
+// ParseBitFieldType parses a type such as i8 or u16.
+func ParseBitFieldType(s string) (BitFieldType, error) {
+	if len(s) < 2 || (s[0] != 'i' && s[0] != 'I' && s[0] != 'u' && s[0] != 'U') {
+		return BitFieldType{}, ErrBitFieldType
+	}
+	n, err := strconv.ParseUint(s[1:], 10, 8)
+	t := BitFieldType{Signed: s[0] == 'i' || s[0] == 'I', Bits: uint(n)}
+	if err != nil || n < 1 || n > 64 || !t.Signed && n > 63 {
+		return BitFieldType{}, ErrBitFieldType
+	}
+	return t, nil
+}
+
+func (t BitFieldType) String() string {
+	if t.Signed {
+		return "i" + strconv.FormatUint(uint64(t.Bits), 10)
+	}
+	return "u" + strconv.FormatUint(uint64(t.Bits), 10)
+}
+
+// bounds returns the smallest and largest values of t.
+func (t BitFieldType) bounds() (int64, int64) {
+	if t.Signed {
+		return -1 << (t.Bits - 1), 1<<(t.Bits-1) - 1
+	}
+	return 0, 1<<t.Bits - 1
+}
+
+// truncate keeps the low bits of v that fit t, sign-extending signed types,
+// which wraps v around the range of t.
+func (t BitFieldType) truncate(v uint64) int64 {
+	shift := 64 - t.Bits
+	if t.Signed {
+		return int64(v<<shift) >> shift
+	}
+	return int64(v << shift >> shift)
+}
+
+// Overflow is how BITFIELD SET and INCRBY handle results out of the range of
+// their type.
+type Overflow int
+
+const (
+	OverflowWrap Overflow = iota // wrap around, as C integers do
+	OverflowSat                  // saturate at the smallest or largest value
+	OverflowFail                 // skip the write and reply with a null
+)
+
+// ParseOverflow parses WRAP, SAT or FAIL.
+func ParseOverflow(s string) (Overflow, error) {
+	switch strings.ToUpper(s) {
+	case "WRAP":
+		return OverflowWrap, nil
+	case "SAT":
+		return OverflowSat, nil
+	case "FAIL":
+		return OverflowFail, nil
+	}
+	return 0, fmt.Errorf("invalid OVERFLOW type %q", s)
+}
+
+// BitFieldKind is the subcommand of a BITFIELD operation.
+type BitFieldKind int
+
+const (
+	BitFieldGet BitFieldKind = iota
+	BitFieldSet
+	BitFieldIncrBy
+)
+
+// BitFieldOp is one operation of BitField on the integer of Type at bit
+// Offset.
+type BitFieldOp struct {
+	Kind     BitFieldKind
+	Type     BitFieldType
+	Offset   int64
+	Value    int64 // the value of a SET, the increment of an INCRBY
+	Overflow Overflow
+}
+
+// add returns value + increment in the range of t under overflow, with ok
+// false if it overflows under OverflowFail.
+func (t BitFieldType) add(value, increment int64, overflow Overflow) (int64, bool) {
+	lo, hi := t.bounds()
+	over := increment > 0 && value > hi-increment
+	under := increment < 0 && value < lo-increment
+	if !over && !under {
+		return value + increment, true
+	}
+	switch overflow {
+	case OverflowSat:
+		if over {
+			return hi, true
+		}
+		return lo, true
+	case OverflowFail:
+		return 0, false
+	}
+	return t.truncate(uint64(value) + uint64(increment)), true
+}
+
+func getField[T string | []byte](data T, t BitFieldType, offset int64) int64 {
+	var v uint64
+	for i := int64(0); i < int64(t.Bits); i++ {
+		v = v<<1 | uint64(getBit(data, offset+i))
+	}
+	return t.truncate(v)
+}
+
+func setField(b []byte, t BitFieldType, offset int64, value int64) {
+	for i := int64(0); i < int64(t.Bits); i++ {
+		setBit(b, offset+i, int(uint64(value)>>(int64(t.Bits)-1-i))&1)
+	}
+}
+
+// BitField runs ops in order on the string at key, growing or creating it
+// for writes, and returns for each op the value it read, the previous value
+// for a SET, the new value for an INCRBY, or nil for a write skipped by
+// OverflowFail.
+func (s *Store) BitField(key string, ops []BitFieldOp) ([]*int64, error) {
+	for _, op := range ops {
+		if op.Offset < 0 || op.Offset+int64(op.Type.Bits)-1 > maxBitOffset {
+			return nil, ErrBitOffset
+		}
+		if op.Type.Bits < 1 || op.Type.Bits > 64 || !op.Type.Signed && op.Type.Bits > 63 {
+			return nil, ErrBitFieldType
+		}
+	}
+
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	return s.bitfield(sh, key, ops)
+}
+
+// bitfield implements BitField. The caller must hold sh.mu.
+func (s *Store) bitfield(sh *shard, key string, ops []BitFieldOp) ([]*int64, error) {
+	item, str, err := s.writeString(sh, key)
+	if err != nil {
+		return nil, err
+	}
+
+	// Writes go to a copy grown to hold all of them, kept if one succeeds
+	var b []byte
+	last := int64(-1)
+	for _, op := range ops {
+		if op.Kind != BitFieldGet {
+			last = max(last, op.Offset+int64(op.Type.Bits)-1)
+		}
+	}
+	if last >= 0 {
+		b = growBytes(str, last)
+	}
+
+	results := make([]*int64, len(ops))
+	logged := []string{"BITFIELD", key}
+	for i, op := range ops {
+		var old int64
+		if b != nil {
+			old = getField(b, op.Type, op.Offset)
+		} else {
+			old = getField(str, op.Type, op.Offset)
+		}
+		if op.Kind == BitFieldGet {
+			results[i] = &old
+			continue
+		}
+
+		base := old
+		if op.Kind == BitFieldSet {
+			base = 0
+		}
+		value, ok := op.Type.add(base, op.Value, op.Overflow)
+		if !ok {
+			continue
+		}
+		setField(b, op.Type, op.Offset, value)
+		logged = append(logged, "SET", op.Type.String(), strconv.FormatInt(op.Offset, 10), strconv.FormatInt(value, 10))
+
+		if op.Kind == BitFieldSet {
+			results[i] = &old
+		} else {
+			results[i] = &value
+		}
+	}
+
+	if len(logged) > 2 {
+		if err := s.storeString(sh, key, item, string(b)); err != nil {
+			return nil, err
+		}
+		// Replay sets the resulting values, which needs no overflow handling
+		s.propagate(logged...)
+		s.notify(notifyString, "setbit", key)
+	}
+	return results, nil
+}
@@ -0,0 +1,183 @@
+package store
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/chaitanyayendru/fincache/internal/config"
+)
+
+func int64Ptr(v int64) *int64 { return &v }
+
+func TestBitmap(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	for _, customer := range []int64{1, 7, 100} {
+		if old, err := store.SetBit("active:0101", customer, 1); err != nil || old != 0 {
+			t.Fatalf("Expected the bit to be clear, got %d, %v", old, err)
+		}
+	}
+	if old, _ := store.SetBit("active:0101", 7, 1); old != 1 {
+		t.Errorf("Expected the previous bit, got %d", old)
+	}
+	value, _ := store.Get("active:0101")
+	if str, ok := value.(string); !ok || len(str) != 13 || str[0] != 0x41 {
+		t.Errorf("Expected a 13-byte string grown on demand, got %q", value)
+	}
+	if bit, _ := store.GetBit("active:0101", 100); bit != 1 {
+		t.Errorf("Expected bit 100 to be set")
+	}
+	if bit, _ := store.GetBit("active:0101", 10000); bit != 0 {
+		t.Errorf("Expected bits past the end to be clear")
+	}
+
+	store.Set("s", "foobar", 0)
+	tests := []struct {
+		r    *BitRange
+		want int64
+	}{
+		{nil, 26},
+		{&BitRange{Start: 0, End: int64Ptr(0)}, 4},
+		{&BitRange{Start: 1, End: int64Ptr(1)}, 6},
+		{&BitRange{Start: -2, End: int64Ptr(-1)}, 7},
+		{&BitRange{Start: 5, End: int64Ptr(30), Bits: true}, 17},
+		{&BitRange{Start: 4, End: int64Ptr(2)}, 0},
+	}
+	for _, tt := range tests {
+		if count, _ := store.BitCount("s", tt.r); count != tt.want {
+			t.Errorf("Expected %d set bits in %+v, got %d", tt.want, tt.r, count)
+		}
+	}
+
+	store.Set("p", "\xff\xf0\x00", 0)
+	positions := []struct {
+		bit  int
+		r    *BitRange
+		want int64
+	}{
+		{0, nil, 12},
+		{1, &BitRange{Start: 2}, -1},
+		{1, &BitRange{Start: 7, End: int64Ptr(15), Bits: true}, 7},
+		{0, &BitRange{Start: 0, End: int64Ptr(0)}, -1},
+	}
+	for _, tt := range positions {
+		if pos, _ := store.BitPos("p", tt.bit, tt.r); pos != tt.want {
+			t.Errorf("Expected bit %d at %d in %+v, got %d", tt.bit, tt.want, tt.r, pos)
+		}
+	}
+	store.Set("ones", "\xff", 0)
+	if pos, _ := store.BitPos("ones", 0, nil); pos != 8 {
+		t.Errorf("Expected the first clear bit past the end, got %d", pos)
+	}
+
+	if _, err := store.SetBit("s", maxBitOffset+1, 1); !errors.Is(err, ErrBitOffset) {
+		t.Errorf("Expected ErrBitOffset, got %v", err)
+	}
+	store.HSet("h", "f", "v")
+	if _, err := store.GetBit("h", 0); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType, got %v", err)
+	}
+}
+
+func TestBitOp(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	store.Set("a", "\xf0\x0f", 0)
+	store.Set("b", "\xff", 0)
+	tests := []struct {
+		op      string
+		sources []string
+		want    string
+	}{
+		{"AND", []string{"a", "b"}, "\xf0\x00"},
+		{"OR", []string{"a", "b"}, "\xff\x0f"},
+		{"XOR", []string{"a", "b", "missing"}, "\x0f\x0f"},
+		{"NOT", []string{"a"}, "\x0f\xf0"},
+	}
+	for _, tt := range tests {
+		if n, err := store.BitOp(tt.op, "dest", tt.sources...); err != nil || n != int64(len(tt.want)) {
+			t.Fatalf("Expected %s to return the length, got %d, %v", tt.op, n, err)
+		}
+		if value, _ := store.Get("dest"); value != tt.want {
+			t.Errorf("Expected %s to give %q, got %q", tt.op, tt.want, value)
+		}
+	}
+
+	if _, err := store.BitOp("NOT", "dest", "a", "b"); !errors.Is(err, ErrBitOp) {
+		t.Errorf("Expected ErrBitOp, got %v", err)
+	}
+	if n, _ := store.BitOp("OR", "dest", "missing"); n != 0 || store.Exists("dest") {
+		t.Errorf("Expected an empty result to delete dest")
+	}
+}
+
+func TestBitField(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	u8, _ := ParseBitFieldType("u8")
+	i5, _ := ParseBitFieldType("i5")
+	i64, _ := ParseBitFieldType("i64")
+	if _, err := ParseBitFieldType("u64"); !errors.Is(err, ErrBitFieldType) {
+		t.Errorf("Expected u64 to be rejected, got %v", err)
+	}
+
+	results, err := store.BitField("bf", []BitFieldOp{
+		{Kind: BitFieldSet, Type: u8, Offset: 0, Value: 200},
+		{Kind: BitFieldIncrBy, Type: u8, Offset: 0, Value: 100},
+		{Kind: BitFieldIncrBy, Type: u8, Offset: 0, Value: 250, Overflow: OverflowSat},
+		{Kind: BitFieldIncrBy, Type: u8, Offset: 0, Value: 1, Overflow: OverflowFail},
+		{Kind: BitFieldSet, Type: i5, Offset: 8, Value: -3},
+		{Kind: BitFieldIncrBy, Type: i5, Offset: 8, Value: -20, Overflow: OverflowWrap},
+		{Kind: BitFieldGet, Type: i5, Offset: 8},
+		{Kind: BitFieldIncrBy, Type: i64, Offset: 16, Value: 1<<63 - 1},
+		{Kind: BitFieldIncrBy, Type: i64, Offset: 16, Value: 1, Overflow: OverflowSat},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	want := []*int64{int64Ptr(0), int64Ptr(44), int64Ptr(255), nil, int64Ptr(0), int64Ptr(9), int64Ptr(9), int64Ptr(1<<63 - 1), int64Ptr(1<<63 - 1)}
+	for i := range want {
+		if (results[i] == nil) != (want[i] == nil) || results[i] != nil && *results[i] != *want[i] {
+			t.Errorf("Expected result %d to be %v, got %v", i, deref(want[i]), deref(results[i]))
+		}
+	}
+
+	if value, _ := store.Get("bf"); len(value.(string)) != 10 {
+		t.Errorf("Expected the string to grow to 10 bytes, got %q", value)
+	}
+}
+
+func deref(p *int64) interface{} {
+	if p == nil {
+		return nil
+	}
+	return *p
+}
+
+func TestBitmapPersists(t *testing.T) {
+	cfg := aofConfig(t.TempDir())
+	store := NewStore(cfg)
+	store.SetBit("flags", 3, 1)
+	if err := store.SaveSnapshot(); err != nil {
+		t.Fatalf("Expected no error when saving snapshot: %v", err)
+	}
+	store.SetBit("flags", 20, 1)
+	u4, _ := ParseBitFieldType("u4")
+	store.BitField("flags", []BitFieldOp{{Kind: BitFieldIncrBy, Type: u4, Offset: 32, Value: 20}})
+	store.BitOp("NOT", "inverted", "flags")
+	want, _ := store.Get("inverted")
+	store.Close()
+
+	restored := NewStore(cfg)
+	defer restored.Close()
+
+	if value, _ := restored.Get("inverted"); value != want {
+		t.Errorf("Expected %q after replay, got %q", want, value)
+	}
+	if value, _ := restored.Get("flags"); value != "\x10\x00\x08\x00\x40" {
+		t.Errorf("Expected the bits and fields after replay, got %q", value)
+	}
+}
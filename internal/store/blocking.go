@@ -0,0 +1,105 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// Blocking commands park the caller on the keys they wait for. A waiter is a
+// channel with room for one wakeup; writes that may serve a waiter signal
+// every channel registered on the key, and the woken callers retry under the
+// shard locks, so a wakeup is never lost and never acted on without checking
+// the keyspace again.
+
+// addWaiter registers wake on key. The caller must hold sh.mu.
+func (sh *shard) addWaiter(key string, wake chan struct{}) {
+	if sh.waiters == nil {
+		sh.waiters = make(map[string][]chan struct{})
+	}
+	sh.waiters[key] = append(sh.waiters[key], wake)
+}
+
+// removeWaiter unregisters wake from key. The caller must hold sh.mu.
+func (sh *shard) removeWaiter(key string, wake chan struct{}) {
+	waiters := sh.waiters[key]
+	for i, ch := range waiters {
+		if ch == wake {
+			waiters = append(waiters[:i], waiters[i+1:]...)
+			break
+		}
+	}
+	if len(waiters) == 0 {
+		delete(sh.waiters, key)
+	} else {
+		sh.waiters[key] = waiters
+	}
+}
+
+// signal wakes the callers blocked on key. The caller must hold sh.mu.
+func (sh *shard) signal(key string) {
+	for _, wake := range sh.waiters[key] {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// signalAll wakes every caller blocked on sh, e.g. after SWAPDB replaced its
+// keys. The caller must hold sh.mu.
+func (sh *shard) signalAll() {
+	for key := range sh.waiters {
+		sh.signal(key)
+	}
+}
+
+// block runs try with the shards of locked write-locked until it reports
+// that it served the request, waiting on waitKeys in between. A timeout of 0
+// waits forever. It reports false if the timeout passed first and returns
+// ctx.Err() if ctx was cancelled.
+func (s *Store) block(ctx context.Context, locked, waitKeys []string, timeout time.Duration, try func() (bool, error)) (bool, error) {
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	wake := make(chan struct{}, 1)
+	registered := false
+	for {
+		unlock := s.lockKeys(locked...)
+		if registered {
+			for _, key := range waitKeys {
+				s.shardFor(key).removeWaiter(key, wake)
+			}
+			registered = false
+		}
+
+		done, err := try()
+		if done || err != nil {
+			unlock()
+			return done, err
+		}
+
+		for _, key := range waitKeys {
+			s.shardFor(key).addWaiter(key, wake)
+		}
+		registered = true
+		unlock()
+
+		select {
+		case <-wake:
+			continue
+		case <-deadline:
+		case <-ctx.Done():
+		}
+
+		unlock = s.lockKeys(locked...)
+		for _, key := range waitKeys {
+			s.shardFor(key).removeWaiter(key, wake)
+		}
+		unlock()
+		return false, ctx.Err()
+	}
+}
@@ -0,0 +1,355 @@
+package store
+
+import (
+	"errors"
+	"hash/fnv"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Defaults of filters created by BFAdd, as in RedisBloom.
+const (
+	defaultBloomErrorRate = 0.01
+	defaultBloomCapacity  = 100
+	defaultBloomExpansion = 2
+
+	// bloomTightening shrinks the error rate of each new layer, so that the
+	// error rate of the whole filter stays below its target as it grows.
+	bloomTightening = 0.5
+
+	// maxBloomBits bounds the bits of a layer, 512MB, so a typo cannot
+	// allocate gigabytes.
+	maxBloomBits = 1 << 32
+)
+
+var (
+	ErrFilterExists = errors.New("item exists")
+	ErrFilterFull   = errors.New("filter is full and does not scale")
+	ErrInvalidBloom = errors.New("error rate must be between 0 and 1 and capacity positive")
+	ErrFilterTooBig = errors.New("filter exceeds the maximum size")
+)
+
+// BloomOptions configures a new Bloom filter.
+type BloomOptions struct {
+	ErrorRate float64 // target false positive rate
+	Capacity  int64   // items the first layer holds at that rate
+	// Expansion is how much larger each new layer is than the previous one;
+	// 0 uses the default.
+	Expansion int
+	// NonScaling makes adds fail with ErrFilterFull once the filter holds
+	// Capacity items, rather than add a layer.
+	NonScaling bool
+}
+
+func (opts *BloomOptions) validate() error {
+	if opts.Expansion == 0 {
+		opts.Expansion = defaultBloomExpansion
+	}
+	if !(opts.ErrorRate > 0 && opts.ErrorRate < 1) || opts.Capacity <= 0 || opts.Expansion < 1 {
+		return ErrInvalidBloom
+	}
+	if bloomBits(opts.Capacity, opts.ErrorRate*bloomTightening) > maxBloomBits {
+		return ErrFilterTooBig
+	}
+	return nil
+}
+
+// bloomLayer is a fixed-size Bloom filter, sized for capacity items at its
+// error rate.
+type bloomLayer struct {
+	bits     []uint64
+	m        uint64 // number of bits
+	k        uint32 // number of hash functions
+	capacity int64
+	count    int64
+}
+
+func newBloomLayer(capacity int64, errorRate float64) *bloomLayer {
+	m := uint64(bloomBits(capacity, errorRate))
+	k := uint32(math.Ceil(-math.Log2(errorRate)))
+	return &bloomLayer{bits: make([]uint64, (m+63)/64), m: m, k: max(k, 1), capacity: capacity}
+}
+
+// bloomBits returns the bits of a layer holding capacity items at errorRate,
+// as a float so that callers can check it before it overflows.
+func bloomBits(capacity int64, errorRate float64) float64 {
+	return max(math.Ceil(-float64(capacity)*math.Log(errorRate)/(math.Ln2*math.Ln2)), 64)
+}
+
+// filterHash returns two independent 64-bit hashes of item. It must never
+// change, as persisted filters depend on it.
+func filterHash(item string) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write([]byte(item))
+	// FNV alone barely spreads items that differ in their last bytes
+	h1 := fmix64(h.Sum64())
+	return h1, fmix64(h1 ^ 0x9e3779b97f4a7c15)
+}
+
+// fmix64 is the finalizer of MurmurHash3, which makes every input bit affect
+// every output bit.
+func fmix64(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+// test reports whether all the bits of an item hashed to h1 and h2 are set,
+// using double hashing to derive the k positions.
+func (l *bloomLayer) test(h1, h2 uint64) bool {
+	for i := uint64(0); i < uint64(l.k); i++ {
+		bit := (h1 + i*h2) % l.m
+		if l.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (l *bloomLayer) add(h1, h2 uint64) {
+	for i := uint64(0); i < uint64(l.k); i++ {
+		bit := (h1 + i*h2) % l.m
+		l.bits[bit/64] |= 1 << (bit % 64)
+	}
+	l.count++
+}
+
+func (l *bloomLayer) size() int64 {
+	return bloomLayerOverhead + int64(len(l.bits))*8
+}
+
+// BloomFilter is the value of a Bloom filter key: a scalable Bloom filter,
+// a stack of layers each larger and stricter than the previous one, of
+// which only the last takes new items. Like lists it is modified in place
+// under the lock of the shard holding it.
+type BloomFilter struct {
+	errorRate  float64
+	expansion  int
+	nonScaling bool
+	layers     []*bloomLayer
+}
+
+func newBloomFilter(opts BloomOptions) *BloomFilter {
+	return &BloomFilter{
+		errorRate:  opts.ErrorRate,
+		expansion:  opts.Expansion,
+		nonScaling: opts.NonScaling,
+		layers:     []*bloomLayer{newBloomLayer(opts.Capacity, opts.ErrorRate*bloomTightening)},
+	}
+}
+
+func (bf *BloomFilter) contains(h1, h2 uint64) bool {
+	for _, l := range bf.layers {
+		if l.test(h1, h2) {
+			return true
+		}
+	}
+	return false
+}
+
+// nextLayer returns the layer to add before the next item, nil if the last
+// one has room.
+func (bf *BloomFilter) nextLayer() (*bloomLayer, error) {
+	last := bf.layers[len(bf.layers)-1]
+	if last.count < last.capacity {
+		return nil, nil
+	}
+	if bf.nonScaling {
+		return nil, ErrFilterFull
+	}
+	errorRate := bf.errorRate * math.Pow(bloomTightening, float64(len(bf.layers)+1))
+	capacity := last.capacity * int64(bf.expansion)
+	if capacity/int64(bf.expansion) != last.capacity || bloomBits(capacity, errorRate) > maxBloomBits {
+		return nil, ErrFilterFull
+	}
+	return newBloomLayer(capacity, errorRate), nil
+}
+
+func (bf *BloomFilter) size() int64 {
+	size := int64(bloomFilterOverhead)
+	for _, l := range bf.layers {
+		size += l.size()
+	}
+	return size
+}
+
+func (bf *BloomFilter) clone() *BloomFilter {
+	c := *bf
+	c.layers = make([]*bloomLayer, len(bf.layers))
+	for i, l := range bf.layers {
+		lc := *l
+		lc.bits = append([]uint64(nil), l.bits...)
+		c.layers[i] = &lc
+	}
+	return &c
+}
+
+// Memory estimates for Bloom filters.
+const (
+	bloomFilterOverhead = 64 // BloomFilter struct and its layer slice
+	bloomLayerOverhead  = 64 // bloomLayer
+)
+
+// readBloom returns the Bloom filter at key for a read, or nil if there is
+// none. The caller must hold sh.mu.
+func (s *Store) readBloom(sh *shard, key string) (*BloomFilter, error) {
+	item, exists := sh.data[key]
+	if exists && item.ExpiresAt != nil && time.Now().After(*item.ExpiresAt) {
+		exists = false
+	}
+	if !exists {
+		if _, isZSet := sh.sortedSets[key]; isZSet {
+			return nil, ErrWrongType
+		}
+		s.stats.recordLookup(false)
+		return nil, nil
+	}
+
+	bf, ok := item.Value.(*BloomFilter)
+	if !ok {
+		return nil, ErrWrongType
+	}
+	s.stats.recordLookup(true)
+	s.touch(item)
+	return bf, nil
+}
+
+// writeBloom returns the item holding the Bloom filter at key for a write,
+// deleting it first if it has expired. It returns a nil item if there is no
+// filter. The caller must hold sh.mu.
+func (s *Store) writeBloom(sh *shard, key string) (*Item, *BloomFilter, error) {
+	if _, isZSet := sh.sortedSets[key]; isZSet {
+		return nil, nil, ErrWrongType
+	}
+	item, exists := sh.data[key]
+	if !exists {
+		return nil, nil, nil
+	}
+	if item.ExpiresAt != nil && time.Now().After(*item.ExpiresAt) {
+		s.deleteExpired(sh, key)
+		return nil, nil, nil
+	}
+
+	bf, ok := item.Value.(*BloomFilter)
+	if !ok {
+		return nil, nil, ErrWrongType
+	}
+	s.touch(item)
+	return item, bf, nil
+}
+
+// BFReserve creates an empty Bloom filter at key. It fails with
+// ErrFilterExists if the key holds a value of any type.
+func (s *Store) BFReserve(key string, opts BloomOptions) error {
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if item, _, err := s.writeBloom(sh, key); err != nil || item != nil {
+		return ErrFilterExists
+	}
+	return s.bfReserve(sh, key, opts)
+}
+
+// bfReserve stores a new filter with opts at key. The caller must hold
+// sh.mu.
+func (s *Store) bfReserve(sh *shard, key string, opts BloomOptions) error {
+	bf := newBloomFilter(opts)
+	if err := s.reserveMemory(sh, key, itemSize(key, bf)); err != nil {
+		return err
+	}
+	s.set(sh, key, bf, nil)
+
+	args := []string{"BF.RESERVE", key, formatFloat(opts.ErrorRate), strconv.FormatInt(opts.Capacity, 10), strconv.Itoa(opts.Expansion)}
+	if opts.NonScaling {
+		args = append(args, "NONSCALING")
+	}
+	s.propagate(args...)
+	s.notify(notifyModule, "bf.reserve", key)
+	return nil
+}
+
+// BFAdd adds items to the Bloom filter at key, creating it with the default
+// error rate and capacity if it does not exist, and reports for each item
+// whether it was added, i.e. was not already possibly in the filter. Items
+// added before an error are kept.
+func (s *Store) BFAdd(key string, items ...string) ([]bool, error) {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	return s.bfAdd(sh, key, items)
+}
+
+// bfAdd implements BFAdd. The caller must hold sh.mu.
+func (s *Store) bfAdd(sh *shard, key string, items []string) ([]bool, error) {
+	item, bf, err := s.writeBloom(sh, key)
+	if err != nil {
+		return nil, err
+	}
+	if item == nil {
+		opts := BloomOptions{ErrorRate: defaultBloomErrorRate, Capacity: defaultBloomCapacity, Expansion: defaultBloomExpansion}
+		if err := s.bfReserve(sh, key, opts); err != nil {
+			return nil, err
+		}
+		item = sh.data[key]
+		bf = item.Value.(*BloomFilter)
+	}
+
+	added := make([]bool, 0, len(items))
+	for _, member := range items {
+		h1, h2 := filterHash(member)
+		if bf.contains(h1, h2) {
+			added = append(added, false)
+			continue
+		}
+		layer, err := bf.nextLayer()
+		if err != nil {
+			return added, err
+		}
+		if layer != nil {
+			if err := s.reserveMemory(sh, key, layer.size()); err != nil {
+				return added, err
+			}
+			bf.layers = append(bf.layers, layer)
+			s.resize(item, layer.size())
+		}
+		bf.layers[len(bf.layers)-1].add(h1, h2)
+		item.UpdatedAt = time.Now()
+		added = append(added, true)
+
+		s.propagate("BF.ADD", key, member)
+		s.notify(notifyModule, "bf.add", key)
+	}
+	return added, nil
+}
+
+// BFExists reports for each of items whether it may be in the Bloom filter
+// at key; false is certain, true is wrong at most at the error rate. A
+// missing key holds no items.
+func (s *Store) BFExists(key string, items ...string) ([]bool, error) {
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	bf, err := s.readBloom(sh, key)
+	if err != nil {
+		return nil, err
+	}
+	exists := make([]bool, len(items))
+	if bf == nil {
+		return exists, nil
+	}
+	for i, member := range items {
+		exists[i] = bf.contains(filterHash(member))
+	}
+	return exists, nil
+}
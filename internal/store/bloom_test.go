@@ -0,0 +1,97 @@
+package store
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/chaitanyayendru/fincache/internal/config"
+)
+
+func TestBloomFilter(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	if err := store.BFReserve("cards", BloomOptions{ErrorRate: 0.01, Capacity: 1000}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := store.BFReserve("cards", BloomOptions{ErrorRate: 0.01, Capacity: 1000}); !errors.Is(err, ErrFilterExists) {
+		t.Errorf("Expected ErrFilterExists, got %v", err)
+	}
+
+	// Add well past the capacity, so that the filter has to scale
+	for i := 0; i < 5000; i++ {
+		store.BFAdd("cards", "card:"+strconv.Itoa(i))
+	}
+	added, _ := store.BFAdd("cards", "card:42", "card:new")
+	if added[0] || !added[1] {
+		t.Errorf("Expected only the new card to be added, got %v", added)
+	}
+	if layers := len(store.shardFor("cards").data["cards"].Value.(*BloomFilter).layers); layers < 3 {
+		t.Errorf("Expected the filter to have scaled, got %d layers", layers)
+	}
+
+	for i := 0; i < 5000; i++ {
+		if exists, _ := store.BFExists("cards", "card:"+strconv.Itoa(i)); !exists[0] {
+			t.Fatalf("Expected no false negatives, card:%d is missing", i)
+		}
+	}
+	falsePositives := 0
+	for i := 0; i < 10000; i++ {
+		if exists, _ := store.BFExists("cards", "other:"+strconv.Itoa(i)); exists[0] {
+			falsePositives++
+		}
+	}
+	if rate := float64(falsePositives) / 10000; rate > 0.01 {
+		t.Errorf("Expected a false positive rate below 1%%, got %.4f", rate)
+	}
+
+	if exists, err := store.BFExists("missing", "a"); err != nil || exists[0] {
+		t.Errorf("Expected a missing filter to hold nothing, got %v, %v", exists, err)
+	}
+}
+
+func TestBloomFilterNonScaling(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	store.BFReserve("fixed", BloomOptions{ErrorRate: 0.001, Capacity: 10, NonScaling: true})
+	for i := 0; i < 10; i++ {
+		if _, err := store.BFAdd("fixed", strconv.Itoa(i)); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	if _, err := store.BFAdd("fixed", "10"); !errors.Is(err, ErrFilterFull) {
+		t.Errorf("Expected ErrFilterFull, got %v", err)
+	}
+	if err := store.BFReserve("bad", BloomOptions{ErrorRate: 1, Capacity: 10}); !errors.Is(err, ErrInvalidBloom) {
+		t.Errorf("Expected ErrInvalidBloom, got %v", err)
+	}
+	if err := store.BFReserve("huge", BloomOptions{ErrorRate: 0.001, Capacity: 1 << 40}); !errors.Is(err, ErrFilterTooBig) {
+		t.Errorf("Expected ErrFilterTooBig, got %v", err)
+	}
+}
+
+func TestBloomFilterPersists(t *testing.T) {
+	cfg := aofConfig(t.TempDir())
+	store := NewStore(cfg)
+	store.BFReserve("seen", BloomOptions{ErrorRate: 0.01, Capacity: 10})
+	for i := 0; i < 15; i++ {
+		store.BFAdd("seen", "before:"+strconv.Itoa(i))
+	}
+	if err := store.SaveSnapshot(); err != nil {
+		t.Fatalf("Expected no error when saving snapshot: %v", err)
+	}
+	store.BFAdd("seen", "after")
+	store.BFAdd("implicit", "a", "b")
+	store.Close()
+
+	restored := NewStore(cfg)
+	defer restored.Close()
+
+	for _, tt := range []struct{ key, item string }{{"seen", "before:0"}, {"seen", "before:14"}, {"seen", "after"}, {"implicit", "b"}} {
+		if exists, _ := restored.BFExists(tt.key, tt.item); !exists[0] {
+			t.Errorf("Expected %s in %s after restart", tt.item, tt.key)
+		}
+	}
+}
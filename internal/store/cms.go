@@ -0,0 +1,310 @@
+package store
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrSketchExists   = errors.New("key already exists")
+	ErrSketchMismatch = errors.New("sketches must have the same dimensions")
+	ErrInvalidSketch  = errors.New("sketch dimensions must be positive")
+)
+
+// maxSketchCounters bounds width * depth, so a typo cannot allocate
+// gigabytes.
+const maxSketchCounters = 1 << 27
+
+// CountMinSketch is the value of a Count-Min Sketch key: depth rows of width
+// counters, each row hashing an item to one of its counters. The estimate
+// of an item is its smallest counter, which never undercounts and
+// overcounts by at most 2/width of the total with probability 1 - 1/2^depth.
+// Like lists it is modified in place under the lock of the shard holding it.
+type CountMinSketch struct {
+	width    uint32
+	depth    uint32
+	counters []uint64 // row after row
+	count    uint64   // total of all increments
+}
+
+func newCountMinSketch(width, depth uint32) *CountMinSketch {
+	return &CountMinSketch{width: width, depth: depth, counters: make([]uint64, int(width)*int(depth))}
+}
+
+// CMSDimensions returns the width and depth of a sketch that overcounts by
+// at most errorRate of the total with probability 1 - probability, as
+// CMS.INITBYPROB sizes it.
+func CMSDimensions(errorRate, probability float64) (int, int, error) {
+	if !(errorRate > 0 && errorRate < 1) || !(probability > 0 && probability < 1) {
+		return 0, 0, errors.New("error rate and probability must be between 0 and 1")
+	}
+	width := math.Ceil(2 / errorRate)
+	depth := math.Ceil(math.Log(probability) / math.Log(0.5))
+	return int(width), int(depth), nil
+}
+
+// cell returns the index of the counter of an item hashed to h1 and h2 in
+// row.
+func (cms *CountMinSketch) cell(h1, h2 uint64, row uint32) int {
+	return int(row)*int(cms.width) + int((h1+uint64(row)*h2)%uint64(cms.width))
+}
+
+func (cms *CountMinSketch) incrBy(item string, increment uint64) uint64 {
+	h1, h2 := filterHash(item)
+	estimate := uint64(math.MaxUint64)
+	for row := uint32(0); row < cms.depth; row++ {
+		i := cms.cell(h1, h2, row)
+		cms.counters[i] += increment
+		estimate = min(estimate, cms.counters[i])
+	}
+	cms.count += increment
+	return estimate
+}
+
+func (cms *CountMinSketch) query(item string) uint64 {
+	h1, h2 := filterHash(item)
+	estimate := uint64(math.MaxUint64)
+	for row := uint32(0); row < cms.depth; row++ {
+		estimate = min(estimate, cms.counters[cms.cell(h1, h2, row)])
+	}
+	return estimate
+}
+
+func (cms *CountMinSketch) size() int64 {
+	return cmsOverhead + int64(len(cms.counters))*8
+}
+
+func (cms *CountMinSketch) clone() *CountMinSketch {
+	c := *cms
+	c.counters = append([]uint64(nil), cms.counters...)
+	return &c
+}
+
+// Memory estimate of the CountMinSketch struct and its counter slice.
+const cmsOverhead = 64
+
+// readCMS returns the Count-Min Sketch at key for a read, or nil if there is
+// none. The caller must hold sh.mu.
+func (s *Store) readCMS(sh *shard, key string) (*CountMinSketch, error) {
+	item, exists := sh.data[key]
+	if exists && item.ExpiresAt != nil && time.Now().After(*item.ExpiresAt) {
+		exists = false
+	}
+	if !exists {
+		if _, isZSet := sh.sortedSets[key]; isZSet {
+			return nil, ErrWrongType
+		}
+		s.stats.recordLookup(false)
+		return nil, nil
+	}
+
+	cms, ok := item.Value.(*CountMinSketch)
+	if !ok {
+		return nil, ErrWrongType
+	}
+	s.stats.recordLookup(true)
+	s.touch(item)
+	return cms, nil
+}
+
+// writeCMS returns the item holding the Count-Min Sketch at key for a
+// write, deleting it first if it has expired. It returns a nil item if there
+// is no sketch. The caller must hold sh.mu.
+func (s *Store) writeCMS(sh *shard, key string) (*Item, *CountMinSketch, error) {
+	if _, isZSet := sh.sortedSets[key]; isZSet {
+		return nil, nil, ErrWrongType
+	}
+	item, exists := sh.data[key]
+	if !exists {
+		return nil, nil, nil
+	}
+	if item.ExpiresAt != nil && time.Now().After(*item.ExpiresAt) {
+		s.deleteExpired(sh, key)
+		return nil, nil, nil
+	}
+
+	cms, ok := item.Value.(*CountMinSketch)
+	if !ok {
+		return nil, nil, ErrWrongType
+	}
+	s.touch(item)
+	return item, cms, nil
+}
+
+// storeMerged writes merged, the result of a merge, to key, updating item
+// in place to keep its TTL or creating the key if item is nil. It logs the
+// result as a SET: replaying the merge itself could see sources that have
+// since expired. It serves all the mergeable sketches. The caller must hold
+// sh.mu.
+func (s *Store) storeMerged(sh *shard, key string, item *Item, merged interface{}, event string) error {
+	var payload string
+	if s.aof != nil {
+		var err error
+		if payload, err = marshalValue(merged); err != nil {
+			return err
+		}
+	}
+
+	if item == nil {
+		if err := s.reserveMemory(sh, key, itemSize(key, merged)); err != nil {
+			return err
+		}
+		s.set(sh, key, merged, nil)
+		item = sh.data[key]
+	} else {
+		delta := valueSize(merged) - valueSize(item.Value)
+		if err := s.reserveMemory(sh, key, delta); err != nil {
+			return err
+		}
+		item.Value = merged
+		item.UpdatedAt = time.Now()
+		s.resize(item, delta)
+	}
+
+	if item.ExpiresAt != nil {
+		s.propagate("SET", key, payload, "PXAT", formatUnixMilli(*item.ExpiresAt))
+	} else {
+		s.propagate("SET", key, payload)
+	}
+	s.notify(notifyModule, event, key)
+	return nil
+}
+
+// CMSInit creates an empty Count-Min Sketch at key. It fails with
+// ErrSketchExists if the key holds a value of any type.
+func (s *Store) CMSInit(key string, width, depth int) error {
+	if width <= 0 || depth <= 0 || width*depth > maxSketchCounters {
+		return ErrInvalidSketch
+	}
+
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if item, _, err := s.writeCMS(sh, key); err != nil || item != nil {
+		return ErrSketchExists
+	}
+	return s.cmsInit(sh, key, uint32(width), uint32(depth))
+}
+
+// cmsInit stores a new sketch of width by depth counters at key. The caller
+// must hold sh.mu.
+func (s *Store) cmsInit(sh *shard, key string, width, depth uint32) error {
+	cms := newCountMinSketch(width, depth)
+	if err := s.reserveMemory(sh, key, itemSize(key, cms)); err != nil {
+		return err
+	}
+	s.set(sh, key, cms, nil)
+
+	s.propagate("CMS.INITBYDIM", key, strconv.FormatUint(uint64(width), 10), strconv.FormatUint(uint64(depth), 10))
+	s.notify(notifyModule, "cms.init", key)
+	return nil
+}
+
+// CMSIncrBy increments the count of each of items by the matching
+// increment in the sketch at key and returns their new estimates. It fails
+// with ErrNoSuchKey if there is no sketch.
+func (s *Store) CMSIncrBy(key string, items []string, increments []uint64) ([]uint64, error) {
+	if len(items) != len(increments) {
+		return nil, errors.New("each item needs an increment")
+	}
+
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	return s.cmsIncrBy(sh, key, items, increments)
+}
+
+// cmsIncrBy implements CMSIncrBy. The caller must hold sh.mu.
+func (s *Store) cmsIncrBy(sh *shard, key string, items []string, increments []uint64) ([]uint64, error) {
+	item, cms, err := s.writeCMS(sh, key)
+	if err != nil {
+		return nil, err
+	}
+	if item == nil {
+		return nil, ErrNoSuchKey
+	}
+
+	estimates := make([]uint64, len(items))
+	args := []string{"CMS.INCRBY", key}
+	for i, member := range items {
+		estimates[i] = cms.incrBy(member, increments[i])
+		args = append(args, member, strconv.FormatUint(increments[i], 10))
+	}
+	item.UpdatedAt = time.Now()
+
+	s.propagate(args...)
+	s.notify(notifyModule, "cms.incrby", key)
+	return estimates, nil
+}
+
+// CMSQuery returns the estimated count of each of items in the sketch at
+// key. It fails with ErrNoSuchKey if there is no sketch.
+func (s *Store) CMSQuery(key string, items ...string) ([]uint64, error) {
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	cms, err := s.readCMS(sh, key)
+	if err != nil {
+		return nil, err
+	}
+	if cms == nil {
+		return nil, ErrNoSuchKey
+	}
+	counts := make([]uint64, len(items))
+	for i, member := range items {
+		counts[i] = cms.query(member)
+	}
+	return counts, nil
+}
+
+// CMSMerge replaces the sketch at dest with the sum of the sketches at
+// sources, each multiplied by the matching weight, or 1 without weights;
+// e.g. merging the sketches of the last hours gives the counts of the day.
+// All of them must exist and have the same dimensions. dest may be one of
+// the sources.
+func (s *Store) CMSMerge(dest string, sources []string, weights []uint64) error {
+	if len(sources) == 0 || weights != nil && len(weights) != len(sources) {
+		return errors.New("each source needs a weight")
+	}
+
+	unlock := s.lockKeys(append([]string{dest}, sources...)...)
+	defer unlock()
+
+	sh := s.shardFor(dest)
+	item, target, err := s.writeCMS(sh, dest)
+	if err != nil {
+		return err
+	}
+	if item == nil {
+		return ErrNoSuchKey
+	}
+
+	merged := newCountMinSketch(target.width, target.depth)
+	for i, key := range sources {
+		_, cms, err := s.writeCMS(s.shardFor(key), key)
+		if err != nil {
+			return err
+		}
+		if cms == nil {
+			return ErrNoSuchKey
+		}
+		if cms.width != merged.width || cms.depth != merged.depth {
+			return ErrSketchMismatch
+		}
+		weight := uint64(1)
+		if weights != nil {
+			weight = weights[i]
+		}
+		for j, counter := range cms.counters {
+			merged.counters[j] += counter * weight
+		}
+		merged.count += cms.count * weight
+	}
+
+	return s.storeMerged(sh, dest, item, merged, "cms.merge")
+}
@@ -0,0 +1,107 @@
+package store
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/chaitanyayendru/fincache/internal/config"
+)
+
+func TestCountMinSketch(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	width, depth, err := CMSDimensions(0.001, 0.01)
+	if err != nil || width != 2000 || depth != 7 {
+		t.Fatalf("Expected a 2000x7 sketch, got %dx%d, %v", width, depth, err)
+	}
+	if err := store.CMSInit("hits", width, depth); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := store.CMSInit("hits", width, depth); !errors.Is(err, ErrSketchExists) {
+		t.Errorf("Expected ErrSketchExists, got %v", err)
+	}
+
+	counts, _ := store.CMSIncrBy("hits", []string{"home", "about"}, []uint64{100, 3})
+	if !slices.Equal(counts, []uint64{100, 3}) {
+		t.Errorf("Expected the new counts, got %v", counts)
+	}
+	for i := 0; i < 1000; i++ {
+		store.CMSIncrBy("hits", []string{"page:" + strconv.Itoa(i)}, []uint64{1})
+	}
+	// 1103 increments overcount by at most 0.1% of them with 99% probability
+	counts, _ = store.CMSQuery("hits", "home", "about", "never")
+	if counts[0] < 100 || counts[0] > 102 || counts[1] < 3 || counts[1] > 5 || counts[2] > 2 {
+		t.Errorf("Expected estimates within the error bound, got %v", counts)
+	}
+
+	if _, err := store.CMSIncrBy("missing", []string{"a"}, []uint64{1}); !errors.Is(err, ErrNoSuchKey) {
+		t.Errorf("Expected ErrNoSuchKey, got %v", err)
+	}
+	store.Set("plain", "value", 0)
+	if _, err := store.CMSQuery("plain", "a"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType, got %v", err)
+	}
+}
+
+func TestCountMinSketchMerge(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	for _, key := range []string{"hits:1", "hits:2", "hits:day"} {
+		store.CMSInit(key, 100, 5)
+	}
+	store.CMSInit("other", 50, 5)
+	store.CMSIncrBy("hits:1", []string{"a", "b"}, []uint64{5, 1})
+	store.CMSIncrBy("hits:2", []string{"a", "c"}, []uint64{2, 4})
+
+	if err := store.CMSMerge("hits:day", []string{"hits:1", "hits:2"}, []uint64{1, 10}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if counts, _ := store.CMSQuery("hits:day", "a", "b", "c"); !slices.Equal(counts, []uint64{25, 1, 40}) {
+		t.Errorf("Expected the weighted sums, got %v", counts)
+	}
+	// Merging a sketch into itself keeps folding in new windows
+	store.Expire("hits:day", time.Hour)
+	if err := store.CMSMerge("hits:day", []string{"hits:day", "hits:1"}, nil); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if counts, _ := store.CMSQuery("hits:day", "a"); counts[0] != 30 {
+		t.Errorf("Expected 30, got %v", counts)
+	}
+	if ttl, _ := store.TTL("hits:day"); ttl <= 0 {
+		t.Errorf("Expected the merge to keep the TTL, got %v", ttl)
+	}
+
+	if err := store.CMSMerge("hits:day", []string{"other"}, nil); !errors.Is(err, ErrSketchMismatch) {
+		t.Errorf("Expected ErrSketchMismatch, got %v", err)
+	}
+	if err := store.CMSMerge("hits:day", []string{"missing"}, nil); !errors.Is(err, ErrNoSuchKey) {
+		t.Errorf("Expected ErrNoSuchKey, got %v", err)
+	}
+}
+
+func TestCountMinSketchPersists(t *testing.T) {
+	cfg := aofConfig(t.TempDir())
+	store := NewStore(cfg)
+	store.CMSInit("hits", 100, 4)
+	store.CMSInit("hits:1", 100, 4)
+	store.CMSIncrBy("hits", []string{"a"}, []uint64{3})
+	if err := store.SaveSnapshot(); err != nil {
+		t.Fatalf("Expected no error when saving snapshot: %v", err)
+	}
+	store.CMSIncrBy("hits:1", []string{"a", "b"}, []uint64{4, 2})
+	store.CMSMerge("hits", []string{"hits", "hits:1"}, nil)
+	store.Delete("hits:1")
+	store.Close()
+
+	restored := NewStore(cfg)
+	defer restored.Close()
+
+	if counts, err := restored.CMSQuery("hits", "a", "b"); err != nil || !slices.Equal(counts, []uint64{7, 2}) {
+		t.Errorf("Expected the merged counts after replay, got %v, %v", counts, err)
+	}
+}
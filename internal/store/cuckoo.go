@@ -0,0 +1,405 @@
+package store
+
+import (
+	"errors"
+	"math/bits"
+	"strconv"
+	"time"
+)
+
+// Defaults of filters created by CFAdd, as in RedisBloom.
+const (
+	defaultCuckooCapacity      = 1024
+	defaultCuckooBucketSize    = 2
+	defaultCuckooMaxIterations = 20
+	defaultCuckooExpansion     = 1
+)
+
+var ErrInvalidCuckoo = errors.New("capacity, bucket size and max iterations must be positive")
+
+// maxCuckooSlots bounds the fingerprints of a layer, 512MB, so a typo cannot
+// allocate gigabytes.
+const maxCuckooSlots = 1 << 28
+
+// CuckooOptions configures a new Cuckoo filter.
+type CuckooOptions struct {
+	Capacity      int64 // items the first layer holds
+	BucketSize    int   // fingerprints per bucket; 0 uses the default
+	MaxIterations int   // relocations before an add gives up; 0 uses the default
+	// Expansion is how much larger each new layer is than the previous one,
+	// rounded up to a power of two; 0 makes the filter fail with
+	// ErrFilterFull once the first layer is full.
+	Expansion int
+}
+
+func (opts *CuckooOptions) validate() error {
+	if opts.BucketSize == 0 {
+		opts.BucketSize = defaultCuckooBucketSize
+	}
+	if opts.MaxIterations == 0 {
+		opts.MaxIterations = defaultCuckooMaxIterations
+	}
+	if opts.Capacity <= 0 || opts.BucketSize < 1 || opts.BucketSize > 255 || opts.MaxIterations < 1 || opts.Expansion < 0 {
+		return ErrInvalidCuckoo
+	}
+	if opts.Capacity > maxCuckooSlots || cuckooBuckets(opts.Capacity, opts.BucketSize)*uint64(opts.BucketSize) > maxCuckooSlots {
+		return ErrFilterTooBig
+	}
+	return nil
+}
+
+// cuckooLayer is a fixed-size Cuckoo filter: buckets of bucketSize 16-bit
+// fingerprints, where an item can live in one of two buckets. A fingerprint
+// of 0 marks an empty slot.
+type cuckooLayer struct {
+	slots      []uint16 // numBuckets * bucketSize
+	numBuckets uint64   // a power of two, so the alternate bucket is an xor
+	count      int64
+}
+
+func newCuckooLayer(numBuckets uint64, bucketSize int) *cuckooLayer {
+	return &cuckooLayer{slots: make([]uint16, numBuckets*uint64(bucketSize)), numBuckets: numBuckets}
+}
+
+// cuckooBuckets returns how many buckets hold capacity items.
+func cuckooBuckets(capacity int64, bucketSize int) uint64 {
+	n := max(uint64(capacity+int64(bucketSize)-1)/uint64(bucketSize), 1)
+	return 1 << bits.Len64(n-1)
+}
+
+// fingerprint returns the fingerprint of an item hashed to h1 and h2 and its
+// first bucket in the layer.
+func (l *cuckooLayer) fingerprint(h1, h2 uint64) (uint16, uint64) {
+	return uint16(h2%0xffff) + 1, h1 & (l.numBuckets - 1)
+}
+
+// altBucket returns the other bucket of fingerprint fp stored in bucket i.
+// It is its own inverse.
+func (l *cuckooLayer) altBucket(i uint64, fp uint16) uint64 {
+	return (i ^ uint64(fp)*0x5bd1e995) & (l.numBuckets - 1)
+}
+
+// find returns the index in slots of fingerprint fp in bucket i, or of an
+// empty slot if fp is 0, and -1 if there is none.
+func (l *cuckooLayer) find(i uint64, fp uint16, bucketSize int) int {
+	start := int(i) * bucketSize
+	for j := start; j < start+bucketSize; j++ {
+		if l.slots[j] == fp {
+			return j
+		}
+	}
+	return -1
+}
+
+func (l *cuckooLayer) contains(h1, h2 uint64, bucketSize int) bool {
+	fp, i := l.fingerprint(h1, h2)
+	return l.find(i, fp, bucketSize) >= 0 || l.find(l.altBucket(i, fp), fp, bucketSize) >= 0
+}
+
+// insert stores the fingerprint of an item, relocating others along a
+// deterministic path for at most maxIterations, so that replaying the adds
+// rebuilds the same filter. If that fails the relocations are undone and it
+// reports false.
+func (l *cuckooLayer) insert(h1, h2 uint64, bucketSize, maxIterations int) bool {
+	fp, i := l.fingerprint(h1, h2)
+	for _, b := range []uint64{i, l.altBucket(i, fp)} {
+		if j := l.find(b, 0, bucketSize); j >= 0 {
+			l.slots[j] = fp
+			l.count++
+			return true
+		}
+	}
+
+	type relocation struct {
+		slot int
+		prev uint16
+	}
+	path := make([]relocation, 0, maxIterations)
+	b := l.altBucket(i, fp)
+	for n := 0; n < maxIterations; n++ {
+		j := int(b)*bucketSize + n%bucketSize
+		path = append(path, relocation{j, l.slots[j]})
+		fp, l.slots[j] = l.slots[j], fp
+		b = l.altBucket(b, fp)
+		if j := l.find(b, 0, bucketSize); j >= 0 {
+			l.slots[j] = fp
+			l.count++
+			return true
+		}
+	}
+	for n := len(path) - 1; n >= 0; n-- {
+		l.slots[path[n].slot] = path[n].prev
+	}
+	return false
+}
+
+// remove deletes one copy of the fingerprint of an item and reports whether
+// there was one.
+func (l *cuckooLayer) remove(h1, h2 uint64, bucketSize int) bool {
+	fp, i := l.fingerprint(h1, h2)
+	j := l.find(i, fp, bucketSize)
+	if j < 0 {
+		j = l.find(l.altBucket(i, fp), fp, bucketSize)
+	}
+	if j < 0 {
+		return false
+	}
+	l.slots[j] = 0
+	l.count--
+	return true
+}
+
+func (l *cuckooLayer) size() int64 {
+	return cuckooLayerOverhead + int64(len(l.slots))*2
+}
+
+// CuckooFilter is the value of a Cuckoo filter key. Unlike a Bloom filter it
+// supports deleting items, and it scales by adding layers once an item
+// cannot be placed in the last one. Like lists it is modified in place under
+// the lock of the shard holding it.
+type CuckooFilter struct {
+	bucketSize    int
+	maxIterations int
+	expansion     int
+	layers        []*cuckooLayer
+}
+
+func newCuckooFilter(opts CuckooOptions) *CuckooFilter {
+	return &CuckooFilter{
+		bucketSize:    opts.BucketSize,
+		maxIterations: opts.MaxIterations,
+		expansion:     opts.Expansion,
+		layers:        []*cuckooLayer{newCuckooLayer(cuckooBuckets(opts.Capacity, opts.BucketSize), opts.BucketSize)},
+	}
+}
+
+func (cf *CuckooFilter) contains(h1, h2 uint64) bool {
+	for _, l := range cf.layers {
+		if l.contains(h1, h2, cf.bucketSize) {
+			return true
+		}
+	}
+	return false
+}
+
+// nextLayer returns the layer to add when an item does not fit in the last
+// one.
+func (cf *CuckooFilter) nextLayer() (*cuckooLayer, error) {
+	if cf.expansion == 0 {
+		return nil, ErrFilterFull
+	}
+	last := cf.layers[len(cf.layers)-1]
+	growth := uint64(1) << bits.Len64(uint64(cf.expansion)-1)
+	if growth > maxCuckooSlots || last.numBuckets*growth*uint64(cf.bucketSize) > maxCuckooSlots {
+		return nil, ErrFilterFull
+	}
+	return newCuckooLayer(last.numBuckets*growth, cf.bucketSize), nil
+}
+
+func (cf *CuckooFilter) size() int64 {
+	size := int64(cuckooFilterOverhead)
+	for _, l := range cf.layers {
+		size += l.size()
+	}
+	return size
+}
+
+func (cf *CuckooFilter) clone() *CuckooFilter {
+	c := *cf
+	c.layers = make([]*cuckooLayer, len(cf.layers))
+	for i, l := range cf.layers {
+		lc := *l
+		lc.slots = append([]uint16(nil), l.slots...)
+		c.layers[i] = &lc
+	}
+	return &c
+}
+
+// Memory estimates for Cuckoo filters.
+const (
+	cuckooFilterOverhead = 64 // CuckooFilter struct and its layer slice
+	cuckooLayerOverhead  = 48 // cuckooLayer
+)
+
+// readCuckoo returns the Cuckoo filter at key for a read, or nil if there is
+// none. The caller must hold sh.mu.
+func (s *Store) readCuckoo(sh *shard, key string) (*CuckooFilter, error) {
+	item, exists := sh.data[key]
+	if exists && item.ExpiresAt != nil && time.Now().After(*item.ExpiresAt) {
+		exists = false
+	}
+	if !exists {
+		if _, isZSet := sh.sortedSets[key]; isZSet {
+			return nil, ErrWrongType
+		}
+		s.stats.recordLookup(false)
+		return nil, nil
+	}
+
+	cf, ok := item.Value.(*CuckooFilter)
+	if !ok {
+		return nil, ErrWrongType
+	}
+	s.stats.recordLookup(true)
+	s.touch(item)
+	return cf, nil
+}
+
+// writeCuckoo returns the item holding the Cuckoo filter at key for a write,
+// deleting it first if it has expired. It returns a nil item if there is no
+// filter. The caller must hold sh.mu.
+func (s *Store) writeCuckoo(sh *shard, key string) (*Item, *CuckooFilter, error) {
+	if _, isZSet := sh.sortedSets[key]; isZSet {
+		return nil, nil, ErrWrongType
+	}
+	item, exists := sh.data[key]
+	if !exists {
+		return nil, nil, nil
+	}
+	if item.ExpiresAt != nil && time.Now().After(*item.ExpiresAt) {
+		s.deleteExpired(sh, key)
+		return nil, nil, nil
+	}
+
+	cf, ok := item.Value.(*CuckooFilter)
+	if !ok {
+		return nil, nil, ErrWrongType
+	}
+	s.touch(item)
+	return item, cf, nil
+}
+
+// CFReserve creates an empty Cuckoo filter at key. It fails with
+// ErrFilterExists if the key holds a value of any type.
+func (s *Store) CFReserve(key string, opts CuckooOptions) error {
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if item, _, err := s.writeCuckoo(sh, key); err != nil || item != nil {
+		return ErrFilterExists
+	}
+	return s.cfReserve(sh, key, opts)
+}
+
+// cfReserve stores a new filter with opts at key. The caller must hold
+// sh.mu.
+func (s *Store) cfReserve(sh *shard, key string, opts CuckooOptions) error {
+	cf := newCuckooFilter(opts)
+	if err := s.reserveMemory(sh, key, itemSize(key, cf)); err != nil {
+		return err
+	}
+	s.set(sh, key, cf, nil)
+
+	s.propagate("CF.RESERVE", key, strconv.FormatInt(opts.Capacity, 10), strconv.Itoa(opts.BucketSize),
+		strconv.Itoa(opts.MaxIterations), strconv.Itoa(opts.Expansion))
+	s.notify(notifyModule, "cf.reserve", key)
+	return nil
+}
+
+// CFAdd adds item to the Cuckoo filter at key, creating it with the default
+// capacity if it does not exist. An item can be added more than once, and
+// is then in the filter until it has been deleted as many times.
+func (s *Store) CFAdd(key, item string) error {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	return s.cfAdd(sh, key, item)
+}
+
+// cfAdd implements CFAdd. The caller must hold sh.mu.
+func (s *Store) cfAdd(sh *shard, key, member string) error {
+	item, cf, err := s.writeCuckoo(sh, key)
+	if err != nil {
+		return err
+	}
+	if item == nil {
+		opts := CuckooOptions{
+			Capacity:      defaultCuckooCapacity,
+			BucketSize:    defaultCuckooBucketSize,
+			MaxIterations: defaultCuckooMaxIterations,
+			Expansion:     defaultCuckooExpansion,
+		}
+		if err := s.cfReserve(sh, key, opts); err != nil {
+			return err
+		}
+		item = sh.data[key]
+		cf = item.Value.(*CuckooFilter)
+	}
+
+	h1, h2 := filterHash(member)
+	if !cf.layers[len(cf.layers)-1].insert(h1, h2, cf.bucketSize, cf.maxIterations) {
+		layer, err := cf.nextLayer()
+		if err != nil {
+			return err
+		}
+		if err := s.reserveMemory(sh, key, layer.size()); err != nil {
+			return err
+		}
+		// A new layer has room for any item without relocations
+		layer.insert(h1, h2, cf.bucketSize, cf.maxIterations)
+		cf.layers = append(cf.layers, layer)
+		s.resize(item, layer.size())
+	}
+	item.UpdatedAt = time.Now()
+
+	s.propagate("CF.ADD", key, member)
+	s.notify(notifyModule, "cf.add", key)
+	return nil
+}
+
+// CFDel deletes one copy of item from the Cuckoo filter at key and reports
+// whether it was found. Only delete items that were added: deleting one
+// that merely matches another's fingerprint removes that one instead.
+func (s *Store) CFDel(key, item string) (bool, error) {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	return s.cfDel(sh, key, item)
+}
+
+// cfDel implements CFDel. The caller must hold sh.mu.
+func (s *Store) cfDel(sh *shard, key, member string) (bool, error) {
+	item, cf, err := s.writeCuckoo(sh, key)
+	if err != nil || item == nil {
+		return false, err
+	}
+
+	h1, h2 := filterHash(member)
+	for i := len(cf.layers) - 1; i >= 0; i-- {
+		if cf.layers[i].remove(h1, h2, cf.bucketSize) {
+			item.UpdatedAt = time.Now()
+			s.propagate("CF.DEL", key, member)
+			s.notify(notifyModule, "cf.del", key)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// CFExists reports for each of items whether it may be in the Cuckoo filter
+// at key; false is certain. A missing key holds no items.
+func (s *Store) CFExists(key string, items ...string) ([]bool, error) {
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	cf, err := s.readCuckoo(sh, key)
+	if err != nil {
+		return nil, err
+	}
+	exists := make([]bool, len(items))
+	if cf == nil {
+		return exists, nil
+	}
+	for i, member := range items {
+		exists[i] = cf.contains(filterHash(member))
+	}
+	return exists, nil
+}
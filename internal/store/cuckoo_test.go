@@ -0,0 +1,108 @@
+package store
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/chaitanyayendru/fincache/internal/config"
+)
+
+func TestCuckooFilter(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	if err := store.CFReserve("devices", CuckooOptions{Capacity: 100, Expansion: 1}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	// Add well past the capacity, so that the filter has to scale
+	for i := 0; i < 1000; i++ {
+		if err := store.CFAdd("devices", "device:"+strconv.Itoa(i)); err != nil {
+			t.Fatalf("Expected no error adding device %d, got %v", i, err)
+		}
+	}
+	if layers := len(store.shardFor("devices").data["devices"].Value.(*CuckooFilter).layers); layers < 2 {
+		t.Errorf("Expected the filter to have scaled, got %d layers", layers)
+	}
+	for i := 0; i < 1000; i++ {
+		if exists, _ := store.CFExists("devices", "device:"+strconv.Itoa(i)); !exists[0] {
+			t.Fatalf("Expected no false negatives, device:%d is missing", i)
+		}
+	}
+
+	if deleted, _ := store.CFDel("devices", "device:7"); !deleted {
+		t.Error("Expected device:7 to be deleted")
+	}
+	if exists, _ := store.CFExists("devices", "device:7", "device:8"); !slices.Equal(exists, []bool{false, true}) {
+		t.Errorf("Expected only device:7 to be gone, got %v", exists)
+	}
+
+	// Duplicates are counted
+	store.CFAdd("devices", "twice")
+	store.CFAdd("devices", "twice")
+	store.CFDel("devices", "twice")
+	if exists, _ := store.CFExists("devices", "twice"); !exists[0] {
+		t.Error("Expected one copy of twice to remain")
+	}
+	store.CFDel("devices", "twice")
+	if deleted, _ := store.CFDel("devices", "twice"); deleted {
+		t.Error("Expected no copy of twice to remain")
+	}
+}
+
+func TestCuckooFilterFull(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	store.CFReserve("fixed", CuckooOptions{Capacity: 8, BucketSize: 2})
+	var err error
+	for i := 0; i < 100 && err == nil; i++ {
+		err = store.CFAdd("fixed", strconv.Itoa(i))
+	}
+	if !errors.Is(err, ErrFilterFull) {
+		t.Fatalf("Expected ErrFilterFull, got %v", err)
+	}
+
+	// A failed add leaves the filter as it was
+	for i := 0; i < 8; i++ {
+		if exists, _ := store.CFExists("fixed", strconv.Itoa(i)); !exists[0] {
+			t.Errorf("Expected %d to survive the failed add", i)
+		}
+	}
+
+	if err := store.CFReserve("huge", CuckooOptions{Capacity: 1 << 40}); !errors.Is(err, ErrFilterTooBig) {
+		t.Errorf("Expected ErrFilterTooBig, got %v", err)
+	}
+}
+
+func TestCuckooFilterPersists(t *testing.T) {
+	cfg := aofConfig(t.TempDir())
+	store := NewStore(cfg)
+	store.CFReserve("seen", CuckooOptions{Capacity: 16, Expansion: 2})
+	for i := 0; i < 10; i++ {
+		store.CFAdd("seen", strconv.Itoa(i))
+	}
+	if err := store.SaveSnapshot(); err != nil {
+		t.Fatalf("Expected no error when saving snapshot: %v", err)
+	}
+	for i := 10; i < 40; i++ {
+		store.CFAdd("seen", strconv.Itoa(i))
+	}
+	store.CFDel("seen", "3")
+	b := store.shardFor("seen").data["seen"].Value.(*CuckooFilter)
+	store.Close()
+
+	restored := NewStore(cfg)
+	defer restored.Close()
+
+	a := restored.shardFor("seen").data["seen"].Value.(*CuckooFilter)
+	if len(a.layers) != len(b.layers) {
+		t.Fatalf("Expected %d layers after replay, got %d", len(b.layers), len(a.layers))
+	}
+	for i := range a.layers {
+		if !slices.Equal(a.layers[i].slots, b.layers[i].slots) {
+			t.Errorf("Expected replay to rebuild layer %d exactly", i)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const defaultDatabases = 16
+
+var (
+	ErrDBIndexOutOfRange = errors.New("DB index is out of range")
+	ErrSameDB            = errors.New("source and destination objects are the same")
+)
+
+// DBStats describes the keyspace of one database, as reported by INFO
+// keyspace.
+type DBStats struct {
+	DB         int              `json:"db"`
+	Keys       int64            `json:"keys"`
+	Expires    int64            `json:"expires"`
+	AvgTTL     int64            `json:"avg_ttl_ms"`
+	KeysByType map[string]int64 `json:"keys_by_type"`
+}
+
+// Select returns the database with the given index.
+func (s *Store) Select(index int) (*Store, error) {
+	if index < 0 || index >= len(s.dbs) {
+		return nil, ErrDBIndexOutOfRange
+	}
+	return s.dbs[index], nil
+}
+
+// Index returns the number of the database.
+func (s *Store) Index() int {
+	return s.db
+}
+
+// Databases returns the number of databases.
+func (s *Store) Databases() int {
+	return len(s.dbs)
+}
+
+// DBSize returns the number of keys in the database.
+func (s *Store) DBSize() int64 {
+	var n int64
+	for _, counter := range s.stats.typeCounts {
+		n += counter.Load()
+	}
+	return n
+}
+
+// DBStats returns the keyspace of every database that holds keys.
+func (s *Store) DBStats() []DBStats {
+	var stats []DBStats
+	now := time.Now().UnixMilli()
+
+	for _, db := range s.dbs {
+		dbStats := DBStats{
+			DB:         db.db,
+			Expires:    db.stats.volatileKeys.Load(),
+			KeysByType: make(map[string]int64, len(keyTypes)),
+		}
+		for _, typ := range keyTypes {
+			n := db.stats.typeCounts[typ].Load()
+			dbStats.KeysByType[typ] = n
+			dbStats.Keys += n
+		}
+		if dbStats.Keys == 0 {
+			continue
+		}
+
+		if dbStats.Expires > 0 {
+			dbStats.AvgTTL = max(db.stats.ttlSum.Load()/dbStats.Expires-now, 0)
+		}
+		stats = append(stats, dbStats)
+	}
+	return stats
+}
+
+// FlushAll empties every database.
+func (s *Store) FlushAll() error {
+	s.lockAllDBs()
+	defer s.unlockAllDBs()
+
+	for _, db := range s.dbs {
+		db.flush()
+	}
+	s.propagate("FLUSHALL")
+	return nil
+}
+
+// Move moves key to database index. It reports false if key does not exist
+// in s or already exists in the destination.
+func (s *Store) Move(key string, index int) (bool, error) {
+	dst, err := s.Select(index)
+	if err != nil {
+		return false, err
+	}
+	if dst == s {
+		return false, ErrSameDB
+	}
+
+	src, dstShard := s.shardFor(key), dst.shardFor(key)
+	unlock := lockShards(src, dstShard)
+	defer unlock()
+
+	if !s.liveKey(src, key) || dst.liveKey(dstShard, key) {
+		return false, nil
+	}
+	if _, expired := dstShard.data[key]; expired {
+		dst.deleteExpired(dstShard, key)
+	}
+
+	if item, exists := src.data[key]; exists {
+		s.del(src, key)
+		dstShard.data[key] = item
+		dst.accountItem(item, nil)
+		dst.stats.countType(item.Type, 1)
+		if item.ExpiresAt != nil {
+			dst.setTTL(dstShard, key, *item.ExpiresAt)
+		}
+		if hash, ok := item.Value.(*Hash); ok && len(hash.expires) > 0 {
+			dstShard.trackHashTTL(key)
+		}
+		dstShard.signal(key)
+	}
+	if sortedSet, exists := src.sortedSets[key]; exists {
+		delete(src.sortedSets, key)
+		s.stats.countType("zset", -1)
+		dstShard.sortedSets[key] = sortedSet
+		dst.stats.countType("zset", 1)
+	}
+
+	s.propagate("MOVE", key, strconv.Itoa(index))
+	s.notify(notifyGeneric, "move_from", key)
+	dst.notify(notifyGeneric, "move_to", key)
+	return true, nil
+}
+
+// liveKey reports whether key exists in sh and has not expired. The caller
+// must hold sh.mu.
+func (s *Store) liveKey(sh *shard, key string) bool {
+	if _, exists := sh.sortedSets[key]; exists {
+		return true
+	}
+	item, exists := sh.data[key]
+	return exists && (item.ExpiresAt == nil || time.Now().Before(*item.ExpiresAt))
+}
+
+// SwapDB exchanges the content of two databases. Clients that have selected
+// one of them see the other's keys from then on.
+func (s *Store) SwapDB(a, b int) error {
+	dbA, err := s.Select(a)
+	if err != nil {
+		return err
+	}
+	dbB, err := s.Select(b)
+	if err != nil {
+		return err
+	}
+	if a == b {
+		return nil
+	}
+
+	unlock := lockShards(append(append([]*shard(nil), dbA.shards...), dbB.shards...)...)
+	defer unlock()
+
+	// Both databases hash keys the same way, so swapping shard by shard keeps
+	// every key in the right place.
+	for i := range dbA.shards {
+		x, y := dbA.shards[i], dbB.shards[i]
+		x.data, y.data = y.data, x.data
+		x.ttl, y.ttl = y.ttl, x.ttl
+		x.sortedSets, y.sortedSets = y.sortedSets, x.sortedSets
+		x.hashTTL, y.hashTTL = y.hashTTL, x.hashTTL
+
+		// Blocked callers stay with their database but may now be served
+		x.signalAll()
+		y.signalAll()
+	}
+	dbA.stats.swapKeyspace(dbB.stats)
+
+	s.propagate("SWAPDB", strconv.Itoa(a), strconv.Itoa(b))
+	return nil
+}
+
+// parseDBIndex parses a database number from a command argument.
+func parseDBIndex(arg string) (int, error) {
+	index, err := strconv.Atoi(arg)
+	if err != nil {
+		return 0, fmt.Errorf("invalid DB index %q", arg)
+	}
+	return index, nil
+}
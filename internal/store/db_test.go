@@ -0,0 +1,182 @@
+package store
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/chaitanyayendru/fincache/internal/config"
+)
+
+func mustSelect(t *testing.T, s *Store, index int) *Store {
+	t.Helper()
+	db, err := s.Select(index)
+	if err != nil {
+		t.Fatalf("Expected database %d to exist: %v", index, err)
+	}
+	return db
+}
+
+func TestSelectIsolatesDatabases(t *testing.T) {
+	store := NewStore(config.StoreConfig{Databases: 4})
+	defer store.Close()
+
+	if store.Databases() != 4 {
+		t.Errorf("Expected 4 databases, got %d", store.Databases())
+	}
+	if _, err := store.Select(4); !errors.Is(err, ErrDBIndexOutOfRange) {
+		t.Errorf("Expected ErrDBIndexOutOfRange, got %v", err)
+	}
+
+	db1 := mustSelect(t, store, 1)
+	store.Set("key", "db0", 0)
+	db1.Set("key", "db1", 0)
+
+	if v, _ := store.Get("key"); v != "db0" {
+		t.Errorf("Expected 'db0', got %v", v)
+	}
+	if v, _ := db1.Get("key"); v != "db1" {
+		t.Errorf("Expected 'db1', got %v", v)
+	}
+	if store.DBSize() != 1 || db1.DBSize() != 1 || store.Stats().TotalKeys != 2 {
+		t.Errorf("Expected one key per database, got %d and %d", store.DBSize(), db1.DBSize())
+	}
+
+	db1.Flush()
+	if !store.Exists("key") || db1.Exists("key") {
+		t.Error("Expected FLUSHDB to empty only the selected database")
+	}
+}
+
+func TestMove(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	db1 := mustSelect(t, store, 1)
+	store.Set("order", "open", time.Hour)
+	store.ZAdd("book", 1, "bid")
+
+	if moved, err := store.Move("order", 1); err != nil || !moved {
+		t.Fatalf("Expected key to be moved, got %v (%v)", moved, err)
+	}
+	if moved, _ := store.Move("book", 1); !moved {
+		t.Fatal("Expected sorted set to be moved")
+	}
+	if store.Exists("order") || !db1.Exists("order") {
+		t.Error("Expected key to live only in the destination")
+	}
+	if ttl, _ := db1.TTL("order"); ttl <= 0 {
+		t.Errorf("Expected key to keep its TTL, got %v", ttl)
+	}
+	if _, ok := db1.ZScore("book", "bid"); !ok {
+		t.Error("Expected sorted set to live in the destination")
+	}
+	if store.DBSize() != 0 || db1.DBSize() != 2 {
+		t.Errorf("Expected key counts 0 and 2, got %d and %d", store.DBSize(), db1.DBSize())
+	}
+
+	store.Set("order", "other", 0)
+	if moved, _ := store.Move("order", 1); moved {
+		t.Error("Expected move onto an existing key to fail")
+	}
+	if moved, _ := store.Move("missing", 1); moved {
+		t.Error("Expected move of a missing key to fail")
+	}
+	if _, err := store.Move("order", 0); !errors.Is(err, ErrSameDB) {
+		t.Errorf("Expected ErrSameDB, got %v", err)
+	}
+}
+
+func TestSwapDB(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	db1 := mustSelect(t, store, 1)
+	store.Set("a", "1", time.Hour)
+	db1.Set("b", "2", 0)
+	db1.Set("c", "3", 0)
+
+	if err := store.SwapDB(0, 1); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if store.Exists("a") || !store.Exists("b") || !db1.Exists("a") {
+		t.Error("Expected database contents to be exchanged")
+	}
+	if store.DBSize() != 2 || db1.DBSize() != 1 {
+		t.Errorf("Expected key counts 2 and 1, got %d and %d", store.DBSize(), db1.DBSize())
+	}
+
+	stats := store.DBStats()
+	if len(stats) != 2 || stats[1].DB != 1 || stats[1].Expires != 1 || stats[0].Expires != 0 {
+		t.Errorf("Expected per-database stats to follow the swap, got %+v", stats)
+	}
+}
+
+func TestFlushAll(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	db2 := mustSelect(t, store, 2)
+	store.Set("a", "1", 0)
+	db2.Set("b", "2", 0)
+
+	store.FlushAll()
+	if store.Stats().TotalKeys != 0 || store.UsedMemory() != 0 {
+		t.Errorf("Expected every database to be empty, got %d keys", store.Stats().TotalKeys)
+	}
+}
+
+func TestDatabasesSurviveRestart(t *testing.T) {
+	dir := t.TempDir()
+	cfg := aofConfig(dir)
+
+	store := NewStore(cfg)
+	db3 := mustSelect(t, store, 3)
+	db3.Set("snap", "3", 0)
+	store.Set("snap", "0", 0)
+	if err := store.SaveSnapshot(); err != nil {
+		t.Fatalf("Expected no error when saving snapshot: %v", err)
+	}
+	db3.Set("logged", "3", 0)
+	store.Set("logged", "0", 0)
+	store.Set("moved", "x", 0)
+	store.Move("moved", 3)
+	store.SwapDB(1, 3)
+	store.Close()
+
+	restored := NewStore(cfg)
+	defer restored.Close()
+
+	db1 := mustSelect(t, restored, 1)
+	for _, key := range []string{"snap", "logged"} {
+		if v, _ := restored.Get(key); v != "0" {
+			t.Errorf("Expected %s in db 0 to be '0', got %v", key, v)
+		}
+		if v, _ := db1.Get(key); v != "3" {
+			t.Errorf("Expected %s in db 1 to be '3', got %v", key, v)
+		}
+	}
+	if !db1.Exists("moved") || restored.Exists("moved") {
+		t.Error("Expected MOVE and SWAPDB to be replayed")
+	}
+}
+
+func TestSnapshotDropsExtraDatabases(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.rdb")
+
+	store := NewStore(config.StoreConfig{SnapshotPath: path, Databases: 4})
+	mustSelect(t, store, 3).Set("key", "value", 0)
+	store.Set("key", "value", 0)
+	if err := store.SaveSnapshot(); err != nil {
+		t.Fatalf("Expected no error when saving snapshot: %v", err)
+	}
+	store.Close()
+
+	restored := NewStore(config.StoreConfig{SnapshotPath: path, Databases: 2})
+	defer restored.Close()
+
+	if !restored.Exists("key") || restored.Stats().TotalKeys != 1 {
+		t.Errorf("Expected only database 0 to be loaded, got %d keys", restored.Stats().TotalKeys)
+	}
+}
@@ -0,0 +1,842 @@
+package store
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// Value tags used by the binary encoding shared by snapshots and the
+// append-only log. Tags are part of the on-disk format: never renumber them,
+// only append new ones.
+const (
+	valueNil byte = iota
+	valueString
+	valueInt
+	valueInt32
+	valueInt64
+	valueFloat32
+	valueFloat64
+	valueBool
+	valueArray
+	valueObject
+	valueList
+	valueHash
+	valueSet
+	valueStream
+	valueDecimal
+	valueIdempotency
+	valueRateLimiter
+	valueLock
+	valueTimeSeries
+	valueBloom
+	valueCuckoo
+	valueCMS
+	valueTopK
+	valueTDigest
+	valueSortedSet
+)
+
+// encoder writes the primitive types of the binary format. The first error is
+// sticky so callers can write a whole record and check err once.
+type encoder struct {
+	w   io.Writer
+	buf [binary.MaxVarintLen64]byte
+	err error
+}
+
+func newEncoder(w io.Writer) *encoder {
+	return &encoder{w: w}
+}
+
+func (e *encoder) write(p []byte) {
+	if e.err != nil {
+		return
+	}
+	_, e.err = e.w.Write(p)
+}
+
+func (e *encoder) writeByte(b byte) {
+	e.buf[0] = b
+	e.write(e.buf[:1])
+}
+
+func (e *encoder) writeUvarint(v uint64) {
+	n := binary.PutUvarint(e.buf[:], v)
+	e.write(e.buf[:n])
+}
+
+func (e *encoder) writeVarint(v int64) {
+	n := binary.PutVarint(e.buf[:], v)
+	e.write(e.buf[:n])
+}
+
+func (e *encoder) writeFloat64(f float64) {
+	binary.BigEndian.PutUint64(e.buf[:8], math.Float64bits(f))
+	e.write(e.buf[:8])
+}
+
+func (e *encoder) writeString(s string) {
+	e.writeUvarint(uint64(len(s)))
+	if e.err != nil {
+		return
+	}
+	_, e.err = io.WriteString(e.w, s)
+}
+
+func (e *encoder) writeTime(t time.Time) {
+	e.writeVarint(t.UnixNano())
+}
+
+func (e *encoder) writeValue(value interface{}) {
+	switch v := value.(type) {
+	case nil:
+		e.writeByte(valueNil)
+	case string:
+		e.writeByte(valueString)
+		e.writeString(v)
+	case int:
+		e.writeByte(valueInt)
+		e.writeVarint(int64(v))
+	case int32:
+		e.writeByte(valueInt32)
+		e.writeVarint(int64(v))
+	case int64:
+		e.writeByte(valueInt64)
+		e.writeVarint(v)
+	case float32:
+		e.writeByte(valueFloat32)
+		e.writeFloat64(float64(v))
+	case float64:
+		e.writeByte(valueFloat64)
+		e.writeFloat64(v)
+	case bool:
+		e.writeByte(valueBool)
+		if v {
+			e.writeByte(1)
+		} else {
+			e.writeByte(0)
+		}
+	case []interface{}:
+		e.writeByte(valueArray)
+		e.writeUvarint(uint64(len(v)))
+		for _, elem := range v {
+			e.writeValue(elem)
+		}
+	case map[string]interface{}:
+		e.writeByte(valueObject)
+		e.writeUvarint(uint64(len(v)))
+		for k, elem := range v {
+			e.writeString(k)
+			e.writeValue(elem)
+		}
+	case *List:
+		e.writeByte(valueList)
+		e.writeUvarint(uint64(v.Len()))
+		for i := 0; i < v.Len(); i++ {
+			e.writeString(v.at(i))
+		}
+	case *Set:
+		e.writeByte(valueSet)
+		e.writeUvarint(uint64(v.Len()))
+		for _, member := range v.list() {
+			e.writeString(member)
+		}
+	case Decimal:
+		e.writeByte(valueDecimal)
+		e.writeVarint(v.units)
+		e.writeByte(v.scale)
+	case IdempotencyRecord:
+		e.writeByte(valueIdempotency)
+		e.writeString(string(v.State))
+		e.writeString(v.Token)
+		e.writeString(v.Fingerprint)
+		e.writeVarint(int64(v.Status))
+		e.writeString(v.ContentType)
+		e.writeString(string(v.Body))
+		e.writeTime(v.CreatedAt)
+	case LockState:
+		e.writeByte(valueLock)
+		e.writeString(v.Owner)
+		e.writeVarint(v.Token)
+		e.writeTime(v.AcquiredAt)
+	case *RateLimiter:
+		e.writeByte(valueRateLimiter)
+		e.writeByte(byte(v.config.Mode))
+		e.writeVarint(v.config.Limit)
+		e.writeVarint(int64(v.config.Period))
+		e.writeFloat64(v.tokens)
+		e.writeTime(v.last)
+		e.writeUvarint(uint64(len(v.log)))
+		for _, entry := range v.log {
+			e.writeTime(entry.at)
+			e.writeVarint(entry.cost)
+		}
+	case *TimeSeries:
+		e.writeByte(valueTimeSeries)
+		e.writeTimeSeries(v)
+	case *BloomFilter:
+		e.writeByte(valueBloom)
+		e.writeBloom(v)
+	case *CuckooFilter:
+		e.writeByte(valueCuckoo)
+		e.writeCuckoo(v)
+	case *CountMinSketch:
+		e.writeByte(valueCMS)
+		e.writeCMS(v)
+	case *TopK:
+		e.writeByte(valueTopK)
+		e.writeTopK(v)
+	case *TDigest:
+		e.writeByte(valueTDigest)
+		e.writeTDigest(v)
+	case *Stream:
+		e.writeByte(valueStream)
+		e.writeStream(v)
+	case *SortedSet:
+		// Sorted sets are not item values; the tag serves DUMP and RESTORE.
+		e.writeByte(valueSortedSet)
+		members := v.ZRangeWithScores("", 0, -1)
+		e.writeUvarint(uint64(len(members)))
+		for _, m := range members {
+			e.writeString(m.Member)
+			e.writeFloat64(m.Score)
+		}
+	case *Hash:
+		e.writeByte(valueHash)
+		e.writeUvarint(uint64(len(v.fields)))
+		for field, value := range v.fields {
+			e.writeString(field)
+			e.writeString(value)
+			if expiresAt, exists := v.expires[field]; exists {
+				e.writeByte(1)
+				e.writeTime(expiresAt)
+			} else {
+				e.writeByte(0)
+			}
+		}
+	default:
+		if e.err == nil {
+			e.err = fmt.Errorf("unsupported value type %T", value)
+		}
+	}
+}
+
+// decoder is the reading counterpart of encoder.
+type decoder struct {
+	r *bufio.Reader
+	// src is the input under r if it knows its length, which bounds the
+	// lengths read from it.
+	src interface{ Len() int }
+	buf [8]byte
+	err error
+}
+
+func newDecoder(r io.Reader) *decoder {
+	if br, ok := r.(*bufio.Reader); ok {
+		return &decoder{r: br}
+	}
+	src, _ := r.(interface{ Len() int })
+	return &decoder{r: bufio.NewReader(r), src: src}
+}
+
+// remaining returns how many bytes are left to read, or math.MaxInt32 if the
+// input does not know.
+func (d *decoder) remaining() int {
+	if d.src == nil {
+		return math.MaxInt32
+	}
+	return d.src.Len() + d.r.Buffered()
+}
+
+func (d *decoder) readByte() byte {
+	if d.err != nil {
+		return 0
+	}
+	b, err := d.r.ReadByte()
+	if err != nil {
+		d.err = unexpectedEOF(err)
+	}
+	return b
+}
+
+func (d *decoder) readUvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		d.err = unexpectedEOF(err)
+	}
+	return v
+}
+
+func (d *decoder) readVarint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, err := binary.ReadVarint(d.r)
+	if err != nil {
+		d.err = unexpectedEOF(err)
+	}
+	return v
+}
+
+func (d *decoder) readFloat64() float64 {
+	if d.err != nil {
+		return 0
+	}
+	if _, err := io.ReadFull(d.r, d.buf[:8]); err != nil {
+		d.err = unexpectedEOF(err)
+		return 0
+	}
+	return math.Float64frombits(binary.BigEndian.Uint64(d.buf[:8]))
+}
+
+// readLen reads a collection or string length and rejects values that cannot
+// possibly be backed by the remaining input, as every byte of a string and
+// every element of a collection takes at least a byte, so a corrupt length
+// cannot make us allocate gigabytes.
+func (d *decoder) readLen() int {
+	n := d.readUvarint()
+	if d.err == nil && n > uint64(d.remaining()) {
+		d.err = fmt.Errorf("invalid length %d", n)
+		return 0
+	}
+	return int(n)
+}
+
+func (d *decoder) readString() string {
+	n := d.readLen()
+	if d.err != nil {
+		return ""
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(d.r, buf); err != nil {
+		d.err = unexpectedEOF(err)
+		return ""
+	}
+	return string(buf)
+}
+
+func (d *decoder) readTime() time.Time {
+	return time.Unix(0, d.readVarint())
+}
+
+func (d *decoder) readValue() interface{} {
+	tag := d.readByte()
+	if d.err != nil {
+		return nil
+	}
+
+	switch tag {
+	case valueNil:
+		return nil
+	case valueString:
+		return d.readString()
+	case valueInt:
+		return int(d.readVarint())
+	case valueInt32:
+		return int32(d.readVarint())
+	case valueInt64:
+		return d.readVarint()
+	case valueFloat32:
+		return float32(d.readFloat64())
+	case valueFloat64:
+		return d.readFloat64()
+	case valueBool:
+		return d.readByte() == 1
+	case valueArray:
+		n := d.readLen()
+		arr := make([]interface{}, 0, min(n, 1024))
+		for i := 0; i < n && d.err == nil; i++ {
+			arr = append(arr, d.readValue())
+		}
+		return arr
+	case valueObject:
+		n := d.readLen()
+		obj := make(map[string]interface{}, min(n, 1024))
+		for i := 0; i < n && d.err == nil; i++ {
+			k := d.readString()
+			obj[k] = d.readValue()
+		}
+		return obj
+	case valueList:
+		n := d.readLen()
+		values := make([]string, 0, min(n, 1024))
+		for i := 0; i < n && d.err == nil; i++ {
+			values = append(values, d.readString())
+		}
+		list := newList()
+		list.reset(values)
+		return list
+	case valueHash:
+		n := d.readLen()
+		hash := &Hash{fields: make(map[string]string, min(n, 1024))}
+		for i := 0; i < n && d.err == nil; i++ {
+			field := d.readString()
+			hash.fields[field] = d.readString()
+			if d.readByte() == 1 {
+				hash.setExpiry(field, d.readTime())
+			}
+		}
+		return hash
+	case valueDecimal:
+		units := d.readVarint()
+		scale := d.readByte()
+		if scale > MaxDecimalScale {
+			d.err = fmt.Errorf("invalid decimal scale %d", scale)
+			return nil
+		}
+		return Decimal{units: units, scale: scale}
+	case valueIdempotency:
+		return IdempotencyRecord{
+			State:       IdempotencyState(d.readString()),
+			Token:       d.readString(),
+			Fingerprint: d.readString(),
+			Status:      int(d.readVarint()),
+			ContentType: d.readString(),
+			Body:        []byte(d.readString()),
+			CreatedAt:   d.readTime(),
+		}
+	case valueLock:
+		return LockState{Owner: d.readString(), Token: d.readVarint(), AcquiredAt: d.readTime()}
+	case valueRateLimiter:
+		rl := &RateLimiter{config: RateLimitConfig{
+			Mode:   RateLimitMode(d.readByte()),
+			Limit:  d.readVarint(),
+			Period: time.Duration(d.readVarint()),
+		}}
+		rl.tokens = d.readFloat64()
+		rl.last = d.readTime()
+		n := d.readLen()
+		for i := 0; i < n && d.err == nil; i++ {
+			entry := rateLimitEntry{at: d.readTime(), cost: d.readVarint()}
+			rl.log = append(rl.log, entry)
+			rl.used += entry.cost
+		}
+		if d.err == nil && !validRateLimit(rl.config) {
+			d.err = fmt.Errorf("invalid rate limiter")
+			return nil
+		}
+		return rl
+	case valueTimeSeries:
+		return d.readTimeSeries()
+	case valueBloom:
+		return d.readBloom()
+	case valueCuckoo:
+		return d.readCuckoo()
+	case valueCMS:
+		return d.readCMS()
+	case valueTopK:
+		return d.readTopK()
+	case valueTDigest:
+		return d.readTDigest()
+	case valueStream:
+		return d.readStream()
+	case valueSortedSet:
+		ss := NewSortedSet()
+		n := d.readLen()
+		for i := 0; i < n && d.err == nil; i++ {
+			member := d.readString()
+			ss.zadd(d.readFloat64(), member)
+		}
+		return ss
+	case valueSet:
+		n := d.readLen()
+		set := newSet()
+		for i := 0; i < n && d.err == nil; i++ {
+			set.add(d.readString(), defaultSetMaxIntsetEntries)
+		}
+		return set
+	default:
+		d.err = fmt.Errorf("unknown value tag %d", tag)
+		return nil
+	}
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// marshalValue encodes a single value, e.g. for an append-only log argument.
+func marshalValue(value interface{}) (string, error) {
+	var b strings.Builder
+	enc := newEncoder(&b)
+	enc.writeValue(value)
+	return b.String(), enc.err
+}
+
+func unmarshalValue(payload string) (interface{}, error) {
+	dec := newDecoder(strings.NewReader(payload))
+	value := dec.readValue()
+	return value, dec.err
+}
+
+func (e *encoder) writeStreamID(id StreamID) {
+	e.writeUvarint(id.Ms)
+	e.writeUvarint(id.Seq)
+}
+
+func (d *decoder) readStreamID() StreamID {
+	return StreamID{Ms: d.readUvarint(), Seq: d.readUvarint()}
+}
+
+// writeStream writes the entries of a stream followed by its consumer
+// groups with their consumers and PELs.
+func (e *encoder) writeStream(st *Stream) {
+	e.writeStreamID(st.lastID)
+	e.writeUvarint(st.entriesAdded)
+	e.writeUvarint(uint64(len(st.entries)))
+	for _, entry := range st.entries {
+		e.writeStreamID(entry.ID)
+		e.writeUvarint(uint64(len(entry.Fields)))
+		for _, field := range entry.Fields {
+			e.writeString(field)
+		}
+	}
+
+	e.writeUvarint(uint64(len(st.groups)))
+	for name, g := range st.groups {
+		e.writeString(name)
+		e.writeStreamID(g.lastDelivered)
+		e.writeUvarint(uint64(len(g.consumers)))
+		for consumer, c := range g.consumers {
+			e.writeString(consumer)
+			e.writeTime(c.seenAt)
+			if c.activeAt.IsZero() {
+				e.writeByte(0)
+			} else {
+				e.writeByte(1)
+				e.writeTime(c.activeAt)
+			}
+		}
+		e.writeUvarint(uint64(len(g.pending)))
+		for _, pe := range g.pending {
+			e.writeStreamID(pe.ID)
+			e.writeString(pe.Consumer)
+			e.writeTime(pe.DeliveredAt)
+			e.writeUvarint(uint64(pe.Deliveries))
+		}
+	}
+}
+
+func (d *decoder) readStream() *Stream {
+	st := newStream()
+	st.lastID = d.readStreamID()
+	st.entriesAdded = d.readUvarint()
+	n := d.readLen()
+	st.entries = make([]StreamEntry, 0, min(n, 1024))
+	for i := 0; i < n && d.err == nil; i++ {
+		entry := StreamEntry{ID: d.readStreamID()}
+		fields := d.readLen()
+		entry.Fields = make([]string, 0, min(fields, 1024))
+		for j := 0; j < fields && d.err == nil; j++ {
+			entry.Fields = append(entry.Fields, d.readString())
+		}
+		st.entries = append(st.entries, entry)
+	}
+
+	groups := d.readLen()
+	for i := 0; i < groups && d.err == nil; i++ {
+		name := d.readString()
+		g := newConsumerGroup(d.readStreamID())
+		consumers := d.readLen()
+		for j := 0; j < consumers && d.err == nil; j++ {
+			consumer := d.readString()
+			c := &streamConsumer{seenAt: d.readTime()}
+			if d.readByte() == 1 {
+				c.activeAt = d.readTime()
+			}
+			g.consumers[consumer] = c
+		}
+		pending := d.readLen()
+		for j := 0; j < pending && d.err == nil; j++ {
+			pe := &PendingEntry{ID: d.readStreamID(), Consumer: d.readString()}
+			pe.DeliveredAt = d.readTime()
+			pe.Deliveries = int(d.readUvarint())
+			c, exists := g.consumers[pe.Consumer]
+			if !exists {
+				d.err = fmt.Errorf("pending entry %s of unknown consumer %q", pe.ID, pe.Consumer)
+				break
+			}
+			c.pending++
+			g.pending[pe.ID] = pe
+		}
+		st.groups[name] = g
+	}
+	return st
+}
+
+// writeTimeSeries writes the settings and rules of a time series followed by
+// its samples.
+func (e *encoder) writeTimeSeries(ts *TimeSeries) {
+	e.writeVarint(ts.retention)
+	e.writeByte(byte(ts.policy))
+	e.writeUvarint(uint64(len(ts.labels)))
+	for label, value := range ts.labels {
+		e.writeString(label)
+		e.writeString(value)
+	}
+	e.writeString(ts.source)
+	e.writeUvarint(uint64(len(ts.rules)))
+	for _, rule := range ts.rules {
+		e.writeString(rule.Dest)
+		e.writeByte(byte(rule.Aggregation))
+		e.writeVarint(rule.Bucket.Milliseconds())
+	}
+	e.writeUvarint(uint64(len(ts.samples)))
+	for _, sample := range ts.samples {
+		e.writeVarint(sample.Timestamp)
+		e.writeFloat64(sample.Value)
+	}
+}
+
+func (d *decoder) readTimeSeries() *TimeSeries {
+	ts := &TimeSeries{
+		retention: d.readVarint(),
+		policy:    DuplicatePolicy(d.readByte()),
+		labels:    make(map[string]string),
+	}
+	labels := d.readLen()
+	for i := 0; i < labels && d.err == nil; i++ {
+		label := d.readString()
+		ts.labels[label] = d.readString()
+	}
+	ts.source = d.readString()
+	rules := d.readLen()
+	for i := 0; i < rules && d.err == nil; i++ {
+		rule := CompactionRule{Dest: d.readString(), Aggregation: Aggregation(d.readByte())}
+		rule.Bucket = time.Duration(d.readVarint()) * time.Millisecond
+		if rule.Bucket < time.Millisecond {
+			d.err = fmt.Errorf("invalid compaction bucket")
+			return nil
+		}
+		ts.rules = append(ts.rules, rule)
+	}
+	n := d.readLen()
+	ts.samples = make([]Sample, 0, min(n, 1024))
+	for i := 0; i < n && d.err == nil; i++ {
+		ts.samples = append(ts.samples, Sample{Timestamp: d.readVarint(), Value: d.readFloat64()})
+	}
+	return ts
+}
+
+// writeBloom writes the settings of a Bloom filter followed by its layers.
+func (e *encoder) writeBloom(bf *BloomFilter) {
+	e.writeFloat64(bf.errorRate)
+	e.writeUvarint(uint64(bf.expansion))
+	if bf.nonScaling {
+		e.writeByte(1)
+	} else {
+		e.writeByte(0)
+	}
+	e.writeUvarint(uint64(len(bf.layers)))
+	for _, l := range bf.layers {
+		e.writeUvarint(l.m)
+		e.writeUvarint(uint64(l.k))
+		e.writeVarint(l.capacity)
+		e.writeVarint(l.count)
+		e.writeUint64s(l.bits)
+	}
+}
+
+func (d *decoder) readBloom() *BloomFilter {
+	bf := &BloomFilter{errorRate: d.readFloat64(), expansion: int(d.readUvarint()), nonScaling: d.readByte() == 1}
+	n := d.readLen()
+	for i := 0; i < n && d.err == nil; i++ {
+		l := &bloomLayer{m: d.readUvarint(), k: uint32(d.readUvarint()), capacity: d.readVarint(), count: d.readVarint()}
+		if l.m == 0 || l.m > maxBloomBits || (l.m+63)/64*8 > uint64(d.remaining()) {
+			d.err = fmt.Errorf("invalid bloom filter size %d", l.m)
+			return nil
+		}
+		l.bits = make([]uint64, (l.m+63)/64)
+		d.readUint64s(l.bits)
+		bf.layers = append(bf.layers, l)
+	}
+	if d.err == nil && len(bf.layers) == 0 {
+		d.err = fmt.Errorf("bloom filter without layers")
+		return nil
+	}
+	return bf
+}
+
+// writeCuckoo writes the settings of a Cuckoo filter followed by its layers.
+func (e *encoder) writeCuckoo(cf *CuckooFilter) {
+	e.writeUvarint(uint64(cf.bucketSize))
+	e.writeUvarint(uint64(cf.maxIterations))
+	e.writeUvarint(uint64(cf.expansion))
+	e.writeUvarint(uint64(len(cf.layers)))
+	for _, l := range cf.layers {
+		e.writeUvarint(l.numBuckets)
+		e.writeVarint(l.count)
+		e.writeUint16s(l.slots)
+	}
+}
+
+func (d *decoder) readCuckoo() *CuckooFilter {
+	cf := &CuckooFilter{bucketSize: int(d.readUvarint()), maxIterations: int(d.readUvarint()), expansion: int(d.readUvarint())}
+	if d.err == nil && (cf.bucketSize < 1 || cf.bucketSize > 255) {
+		d.err = fmt.Errorf("invalid cuckoo bucket size %d", cf.bucketSize)
+		return nil
+	}
+	n := d.readLen()
+	for i := 0; i < n && d.err == nil; i++ {
+		numBuckets := d.readUvarint()
+		if numBuckets == 0 || numBuckets&(numBuckets-1) != 0 || numBuckets > maxCuckooSlots ||
+			2*numBuckets*uint64(cf.bucketSize) > uint64(d.remaining()) {
+			d.err = fmt.Errorf("invalid cuckoo filter size %d", numBuckets)
+			return nil
+		}
+		l := newCuckooLayer(numBuckets, cf.bucketSize)
+		l.count = d.readVarint()
+		d.readUint16s(l.slots)
+		cf.layers = append(cf.layers, l)
+	}
+	if d.err == nil && len(cf.layers) == 0 {
+		d.err = fmt.Errorf("cuckoo filter without layers")
+		return nil
+	}
+	return cf
+}
+
+// writeCMS writes the dimensions and total of a Count-Min Sketch followed by
+// its counters.
+func (e *encoder) writeCMS(cms *CountMinSketch) {
+	e.writeUvarint(uint64(cms.width))
+	e.writeUvarint(uint64(cms.depth))
+	e.writeUvarint(cms.count)
+	e.writeUint64s(cms.counters)
+}
+
+func (d *decoder) readCMS() *CountMinSketch {
+	width, depth := d.readUvarint(), d.readUvarint()
+	if d.err == nil && (width == 0 || depth == 0 || width*depth > maxSketchCounters || 8*width*depth > uint64(d.remaining())) {
+		d.err = fmt.Errorf("invalid count-min sketch size %dx%d", width, depth)
+		return nil
+	}
+	cms := newCountMinSketch(uint32(width), uint32(depth))
+	cms.count = d.readUvarint()
+	d.readUint64s(cms.counters)
+	return cms
+}
+
+// writeTopK writes the settings of a Top-K sketch, its counters and its heavy
+// hitters.
+func (e *encoder) writeTopK(tk *TopK) {
+	e.writeUvarint(uint64(tk.k))
+	e.writeUvarint(uint64(tk.width))
+	e.writeUvarint(uint64(tk.depth))
+	e.writeFloat64(tk.decay)
+	e.writeUvarint(tk.rng)
+	for _, b := range tk.buckets {
+		e.writeUvarint(uint64(b.fp))
+		e.writeUvarint(b.count)
+	}
+	e.writeUvarint(uint64(len(tk.heap)))
+	for _, entry := range tk.heap {
+		e.writeString(entry.Item)
+		e.writeUvarint(entry.Count)
+	}
+}
+
+func (d *decoder) readTopK() *TopK {
+	opts := TopKOptions{K: int(d.readUvarint()), Width: int(d.readUvarint()), Depth: int(d.readUvarint()), Decay: d.readFloat64()}
+	if d.err == nil && (opts.validate() != nil || 2*opts.Width*opts.Depth > d.remaining()) {
+		d.err = fmt.Errorf("invalid top-k sketch %dx%d", opts.Width, opts.Depth)
+		return nil
+	}
+	tk := newTopK(opts)
+	tk.rng = d.readUvarint()
+	for i := range tk.buckets {
+		tk.buckets[i] = topkBucket{fp: uint32(d.readUvarint()), count: d.readUvarint()}
+	}
+	n := d.readLen()
+	for i := 0; i < n && d.err == nil; i++ {
+		tk.heap = append(tk.heap, TopKItem{Item: d.readString(), Count: d.readUvarint()})
+	}
+	return tk
+}
+
+// writeTDigest writes the compression and range of a t-digest followed by
+// its centroids.
+func (e *encoder) writeTDigest(td *TDigest) {
+	e.writeFloat64(td.compression)
+	e.writeFloat64(td.min)
+	e.writeFloat64(td.max)
+	e.writeUvarint(uint64(len(td.centroids)))
+	for _, c := range td.centroids {
+		e.writeFloat64(c.mean)
+		e.writeFloat64(c.weight)
+	}
+}
+
+func (d *decoder) readTDigest() *TDigest {
+	td := &TDigest{compression: d.readFloat64(), min: d.readFloat64(), max: d.readFloat64()}
+	if _, err := validCompression(td.compression); d.err == nil && (err != nil || td.compression == 0) {
+		d.err = fmt.Errorf("invalid t-digest compression %v", td.compression)
+		return nil
+	}
+	n := d.readLen()
+	for i := 0; i < n && d.err == nil; i++ {
+		c := centroid{mean: d.readFloat64(), weight: d.readFloat64()}
+		td.centroids = append(td.centroids, c)
+		td.count += c.weight
+	}
+	return td
+}
+
+// writeUint64s writes words as a fixed-size block, e.g. the bits of a filter.
+func (e *encoder) writeUint64s(words []uint64) {
+	b := make([]byte, 8*len(words))
+	for i, w := range words {
+		binary.BigEndian.PutUint64(b[8*i:], w)
+	}
+	e.write(b)
+}
+
+// readUint64s fills words with a block written by writeUint64s.
+func (d *decoder) readUint64s(words []uint64) {
+	if d.err != nil {
+		return
+	}
+	b := make([]byte, 8*len(words))
+	if _, err := io.ReadFull(d.r, b); err != nil {
+		d.err = unexpectedEOF(err)
+		return
+	}
+	for i := range words {
+		words[i] = binary.BigEndian.Uint64(b[8*i:])
+	}
+}
+
+// writeUint16s writes values as a fixed-size block.
+func (e *encoder) writeUint16s(values []uint16) {
+	b := make([]byte, 2*len(values))
+	for i, v := range values {
+		binary.BigEndian.PutUint16(b[2*i:], v)
+	}
+	e.write(b)
+}
+
+// readUint16s fills values with a block written by writeUint16s.
+func (d *decoder) readUint16s(values []uint16) {
+	if d.err != nil {
+		return
+	}
+	b := make([]byte, 2*len(values))
+	if _, err := io.ReadFull(d.r, b); err != nil {
+		d.err = unexpectedEOF(err)
+		return
+	}
+	for i := range values {
+		values[i] = binary.BigEndian.Uint16(b[2*i:])
+	}
+}
@@ -0,0 +1,122 @@
+package store
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Active expiry follows the Redis algorithm: ActiveExpireHz times a second
+// the store samples keys from the ttl index of each shard and deletes the
+// expired ones, repeating while more than a quarter of the sample was
+// expired. Each cycle may use at most ActiveExpireCPU percent of its period,
+// and the shard lock is released between samples, so a large backlog of
+// expired keys is worked off gradually instead of stalling clients.
+const (
+	defaultActiveExpireHz         = 10
+	defaultActiveExpireCPUPercent = 25
+
+	activeExpireSamples   = 20
+	activeExpireStalePerc = 25
+)
+
+func (s *Store) activeExpireLoop() {
+	hz := s.config.ActiveExpireHz
+	if hz <= 0 {
+		hz = defaultActiveExpireHz
+	}
+	cpuPercent := s.config.ActiveExpireCPU
+	if cpuPercent <= 0 || cpuPercent > 100 {
+		cpuPercent = defaultActiveExpireCPUPercent
+	}
+
+	period := time.Second / time.Duration(hz)
+	budget := period * time.Duration(cpuPercent) / 100
+
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			if expired := s.activeExpireCycle(budget); expired > 0 {
+				s.logger.Debug("Expired keys", zap.Int("count", expired))
+			}
+		}
+	}
+}
+
+// activeExpireCycle runs one expiry cycle and returns the number of keys it
+// deleted. The shards of every database are visited round robin, continuing
+// from where the previous cycle ran out of time.
+func (s *Store) activeExpireCycle(budget time.Duration) int {
+	start := time.Now()
+	total := 0
+
+	for range s.allShards {
+		sh := s.allShards[s.expireCursor]
+		s.expireCursor = (s.expireCursor + 1) % len(s.allShards)
+		db := s.dbs[sh.db]
+
+		for {
+			sampled, expired := db.expireSample(sh, activeExpireSamples)
+			total += expired
+
+			if time.Since(start) > budget {
+				return total
+			}
+			if sampled == 0 || expired*100 <= sampled*activeExpireStalePerc {
+				break
+			}
+		}
+	}
+	return total
+}
+
+// expireSample checks up to n keys of sh that have a TTL and deletes those
+// that have expired, then does the same for hash fields. Go randomises map
+// iteration order, so ranging over the ttl index is a random sample.
+func (s *Store) expireSample(sh *shard, n int) (sampled, expired int) {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	now := time.Now()
+	for key, expiresAt := range sh.ttl {
+		if sampled >= n {
+			break
+		}
+		sampled++
+		if now.After(expiresAt) {
+			s.deleteExpired(sh, key)
+			expired++
+		}
+	}
+
+	// Hash fields with a TTL are sampled the same way, a hash at a time
+	hashes, fields := s.expireHashSample(sh, n, now)
+	return sampled + hashes, expired + fields
+}
+
+// deleteExpired removes a key whose TTL has passed, logging the deletion and
+// counting it in the stats. The caller must hold sh.mu.
+func (s *Store) deleteExpired(sh *shard, key string) {
+	if s.del(sh, key) {
+		s.propagate("DEL", key)
+		s.stats.expiredKeys.Add(1)
+		s.notify(notifyExpired, "expired", key)
+	}
+}
+
+// expireIfNeeded deletes key if it has expired. Readers find expired keys
+// under the read lock, so this takes the write lock and checks again.
+func (s *Store) expireIfNeeded(key string) {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if expiresAt, exists := sh.ttl[key]; exists && time.Now().After(expiresAt) {
+		s.deleteExpired(sh, key)
+	}
+}
@@ -0,0 +1,69 @@
+package store
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/chaitanyayendru/fincache/internal/config"
+)
+
+func TestLazyExpiry(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	store.Set("a", "value", time.Millisecond)
+	store.Set("b", "value", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	if _, err := store.Get("a"); err == nil {
+		t.Error("Expected error when getting expired key")
+	}
+	if store.Exists("b") {
+		t.Error("Expected expired key not to exist")
+	}
+
+	stats := store.Stats()
+	if stats.TotalKeys != 0 || stats.ExpiredKeys != 2 {
+		t.Errorf("Expected both keys to be deleted on access, got %+v", stats)
+	}
+}
+
+func TestActiveExpireCycle(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	for i := 0; i < 1000; i++ {
+		store.Set(fmt.Sprintf("short%d", i), "value", time.Millisecond)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	// Every sample is fully expired, so the cycle keeps going until done
+	if expired := store.activeExpireCycle(time.Second); expired != 1000 {
+		t.Errorf("Expected all 1000 keys to expire in one cycle, got %d", expired)
+	}
+
+	for i := 0; i < 100; i++ {
+		store.Set(fmt.Sprintf("long%d", i), "value", time.Hour)
+	}
+	if expired := store.activeExpireCycle(time.Second); expired != 0 {
+		t.Errorf("Expected live keys to be left alone, got %d expired", expired)
+	}
+
+	stats := store.Stats()
+	if stats.ExpiredKeys != 1000 || stats.TotalKeys != 100 {
+		t.Errorf("Expected stats to reflect 1000 expired keys, got %+v", stats)
+	}
+}
+
+func TestActiveExpireLoop(t *testing.T) {
+	store := NewStore(config.StoreConfig{TTLEnabled: true, ActiveExpireHz: 100})
+	defer store.Close()
+
+	store.Set("short", "value", 10*time.Millisecond)
+	time.Sleep(200 * time.Millisecond)
+
+	if n := store.Stats().TotalKeys; n != 0 {
+		t.Errorf("Expected expired key to be removed in the background, got %d keys", n)
+	}
+}
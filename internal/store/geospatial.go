@@ -146,7 +146,7 @@ func (gs *GeoStore) GeoRadius(key string, longitude, latitude, radius float64, u
 	var results []*GeoPoint
 	center := &GeoPoint{Longitude: longitude, Latitude: latitude}
 
-	for name, point := range gs.points {
+	for _, point := range gs.points {
 		distance := gs.calculateDistance(center, point)
 		if distance <= radiusKm {
 			pointCopy := *point
@@ -177,7 +177,7 @@ func (gs *GeoStore) GeoRadiusByMember(key string, member string, radius float64,
 
 	var results []*GeoPoint
 
-	for name, point := range gs.points {
+	for _, point := range gs.points {
 		distance := gs.calculateDistance(center, point)
 		if distance <= radiusKm {
 			pointCopy := *point
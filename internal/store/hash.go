@@ -0,0 +1,642 @@
+package store
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrHashNotInteger = errors.New("hash value is not an integer")
+	ErrHashNotFloat   = errors.New("hash value is not a float")
+	ErrIncrOverflow   = errors.New("increment or decrement would overflow")
+)
+
+// Results of HEXPIRE for each field, as in Redis.
+const (
+	HashFieldMissing = -2 // no such field
+	HashFieldDeleted = 2  // the TTL was not in the future, so the field was deleted
+	HashFieldExpire  = 1  // the TTL was set
+)
+
+// Hash is the value of a hash key. Fields may expire on their own: expired
+// fields are invisible to readers and removed by the next write to the hash
+// or by active expiry. It is guarded by the lock of the shard holding the key.
+type Hash struct {
+	fields  map[string]string
+	expires map[string]time.Time // fields with a TTL
+}
+
+func newHash() *Hash {
+	return &Hash{fields: make(map[string]string)}
+}
+
+func (h *Hash) expired(field string, now time.Time) bool {
+	expiresAt, exists := h.expires[field]
+	return exists && !now.Before(expiresAt)
+}
+
+func (h *Hash) get(field string, now time.Time) (string, bool) {
+	value, exists := h.fields[field]
+	if !exists || h.expired(field, now) {
+		return "", false
+	}
+	return value, true
+}
+
+// Len returns the number of fields, including expired ones that have not
+// been removed yet.
+func (h *Hash) Len() int {
+	return len(h.fields)
+}
+
+func (h *Hash) liveLen(now time.Time) int {
+	n := len(h.fields)
+	for field := range h.expires {
+		if h.expired(field, now) {
+			n--
+		}
+	}
+	return n
+}
+
+func (h *Hash) setExpiry(field string, expiresAt time.Time) {
+	if h.expires == nil {
+		h.expires = make(map[string]time.Time)
+	}
+	h.expires[field] = expiresAt
+}
+
+func (h *Hash) remove(field string) {
+	delete(h.fields, field)
+	delete(h.expires, field)
+}
+
+func (h *Hash) clone() *Hash {
+	c := &Hash{fields: make(map[string]string, len(h.fields))}
+	for field, value := range h.fields {
+		c.fields[field] = value
+	}
+	for field, expiresAt := range h.expires {
+		c.setExpiry(field, expiresAt)
+	}
+	return c
+}
+
+func hashFieldSize(field, value string) int64 {
+	return entryOverhead + 2*stringOverhead + int64(len(field)+len(value))
+}
+
+// hashTTLSize is the cost of a field TTL.
+const hashTTLSize = entryOverhead + 24
+
+// readHash returns the hash at key for a read, nil if there is none, and
+// records the lookup. The caller must hold sh.mu for reading.
+func (s *Store) readHash(sh *shard, key string) (*Hash, error) {
+	item, exists := sh.data[key]
+	if exists && item.ExpiresAt != nil && time.Now().After(*item.ExpiresAt) {
+		exists = false
+	}
+	if !exists {
+		if _, isZSet := sh.sortedSets[key]; isZSet {
+			return nil, ErrWrongType
+		}
+		s.stats.recordLookup(false)
+		return nil, nil
+	}
+
+	hash, ok := item.Value.(*Hash)
+	if !ok {
+		return nil, ErrWrongType
+	}
+	s.stats.recordLookup(true)
+	s.touch(item)
+	return hash, nil
+}
+
+// writeHash returns the item holding the hash at key for a write, after
+// removing the key if it expired and any fields that expired. It returns a
+// nil item if there is no hash. The caller must hold sh.mu.
+func (s *Store) writeHash(sh *shard, key string) (*Item, *Hash, error) {
+	if _, isZSet := sh.sortedSets[key]; isZSet {
+		return nil, nil, ErrWrongType
+	}
+	item, exists := sh.data[key]
+	if !exists {
+		return nil, nil, nil
+	}
+	if item.ExpiresAt != nil && time.Now().After(*item.ExpiresAt) {
+		s.deleteExpired(sh, key)
+		return nil, nil, nil
+	}
+
+	hash, ok := item.Value.(*Hash)
+	if !ok {
+		return nil, nil, ErrWrongType
+	}
+	if s.expireFields(sh, key, item, hash, time.Now()) > 0 && hash.Len() == 0 {
+		return nil, nil, nil
+	}
+	s.touch(item)
+	return item, hash, nil
+}
+
+// hashItem returns the item holding the hash at key, creating an empty one if
+// needed. The caller must hold sh.mu and have checked the key's type.
+func (s *Store) hashItem(sh *shard, key string) (*Item, *Hash) {
+	item, exists := sh.data[key]
+	if !exists {
+		s.set(sh, key, newHash(), nil)
+		item = sh.data[key]
+	}
+	return item, item.Value.(*Hash)
+}
+
+// expireFields removes the fields of hash whose TTL has passed, logging and
+// announcing their deletion, and deletes the key once no field is left. It
+// returns how many fields it removed. The caller must hold sh.mu.
+func (s *Store) expireFields(sh *shard, key string, item *Item, hash *Hash, now time.Time) int {
+	var expired []string
+	for field := range hash.expires {
+		if hash.expired(field, now) {
+			expired = append(expired, field)
+		}
+	}
+	if len(expired) == 0 {
+		return 0
+	}
+
+	var delta int64
+	for _, field := range expired {
+		delta -= hashFieldSize(field, hash.fields[field]) + hashTTLSize
+		hash.remove(field)
+	}
+	s.resize(item, delta)
+
+	s.propagate(append([]string{"HDEL", key}, expired...)...)
+	s.notify(notifyHash, "hexpired", key)
+	s.afterHashWrite(sh, key, item, hash)
+	return len(expired)
+}
+
+// afterHashWrite deletes the hash at key once it has no fields, as Redis
+// never keeps empty hashes, and otherwise marks it updated. The caller must
+// hold sh.mu.
+func (s *Store) afterHashWrite(sh *shard, key string, item *Item, hash *Hash) {
+	if hash.Len() == 0 {
+		s.del(sh, key)
+		s.notify(notifyGeneric, "del", key)
+		return
+	}
+	item.UpdatedAt = time.Now()
+	if len(hash.expires) > 0 {
+		sh.trackHashTTL(key)
+	}
+}
+
+// trackHashTTL records that the hash at key has fields with a TTL, so active
+// expiry visits it. Stale entries are dropped by active expiry. The caller
+// must hold sh.mu.
+func (sh *shard) trackHashTTL(key string) {
+	if sh.hashTTL == nil {
+		sh.hashTTL = make(map[string]struct{})
+	}
+	sh.hashTTL[key] = struct{}{}
+}
+
+// HSet sets field-value pairs of the hash at key, creating it if needed, and
+// returns how many fields were added. Overwriting a field clears its TTL.
+func (s *Store) HSet(key string, fieldValues ...string) (int, error) {
+	if len(fieldValues) == 0 || len(fieldValues)%2 != 0 {
+		return 0, errors.New("wrong number of arguments for HSET")
+	}
+
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	return s.hset(sh, key, fieldValues)
+}
+
+// hset implements HSet. The caller must hold sh.mu.
+func (s *Store) hset(sh *shard, key string, fieldValues []string) (int, error) {
+	item, hash, err := s.writeHash(sh, key)
+	if err != nil {
+		return 0, err
+	}
+
+	var delta int64
+	if item == nil {
+		delta = itemSize(key, newHash())
+	}
+	for i := 0; i < len(fieldValues); i += 2 {
+		field, value := fieldValues[i], fieldValues[i+1]
+		delta += hashFieldSize(field, value)
+		if hash != nil {
+			if prev, exists := hash.fields[field]; exists {
+				delta -= hashFieldSize(field, prev)
+			}
+			if _, exists := hash.expires[field]; exists {
+				delta -= hashTTLSize
+			}
+		}
+	}
+	if err := s.reserveMemory(sh, key, delta); err != nil {
+		return 0, err
+	}
+
+	item, hash = s.hashItem(sh, key)
+	added := 0
+	delta = 0
+	for i := 0; i < len(fieldValues); i += 2 {
+		field, value := fieldValues[i], fieldValues[i+1]
+		if prev, exists := hash.fields[field]; exists {
+			delta -= hashFieldSize(field, prev)
+		} else {
+			added++
+		}
+		if _, exists := hash.expires[field]; exists {
+			delta -= hashTTLSize
+		}
+		hash.remove(field)
+		hash.fields[field] = value
+		delta += hashFieldSize(field, value)
+	}
+	s.resize(item, delta)
+	item.UpdatedAt = time.Now()
+
+	s.propagate(append([]string{"HSET", key}, fieldValues...)...)
+	s.notify(notifyHash, "hset", key)
+	return added, nil
+}
+
+// HGet returns the value of field in the hash at key and whether it exists.
+func (s *Store) HGet(key, field string) (string, bool, error) {
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	hash, err := s.readHash(sh, key)
+	if err != nil || hash == nil {
+		return "", false, err
+	}
+	value, exists := hash.get(field, time.Now())
+	return value, exists, nil
+}
+
+// HMGet returns the values of fields in the hash at key, nil for missing
+// fields.
+func (s *Store) HMGet(key string, fields ...string) ([]*string, error) {
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	values := make([]*string, len(fields))
+	hash, err := s.readHash(sh, key)
+	if err != nil || hash == nil {
+		return values, err
+	}
+
+	now := time.Now()
+	for i, field := range fields {
+		if value, exists := hash.get(field, now); exists {
+			values[i] = &value
+		}
+	}
+	return values, nil
+}
+
+// HGetAll returns every live field of the hash at key.
+func (s *Store) HGetAll(key string) (map[string]string, error) {
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	all := make(map[string]string)
+	hash, err := s.readHash(sh, key)
+	if err != nil || hash == nil {
+		return all, err
+	}
+
+	now := time.Now()
+	for field, value := range hash.fields {
+		if !hash.expired(field, now) {
+			all[field] = value
+		}
+	}
+	return all, nil
+}
+
+// HExists reports whether field exists in the hash at key.
+func (s *Store) HExists(key, field string) (bool, error) {
+	_, exists, err := s.HGet(key, field)
+	return exists, err
+}
+
+// HLen returns the number of fields in the hash at key.
+func (s *Store) HLen(key string) (int, error) {
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	hash, err := s.readHash(sh, key)
+	if err != nil || hash == nil {
+		return 0, err
+	}
+	return hash.liveLen(time.Now()), nil
+}
+
+// HDel removes fields from the hash at key and returns how many existed.
+func (s *Store) HDel(key string, fields ...string) (int, error) {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	return s.hdel(sh, key, fields)
+}
+
+// hdel implements HDel. The caller must hold sh.mu.
+func (s *Store) hdel(sh *shard, key string, fields []string) (int, error) {
+	item, hash, err := s.writeHash(sh, key)
+	if err != nil || item == nil {
+		return 0, err
+	}
+
+	var deleted []string
+	var delta int64
+	for _, field := range fields {
+		value, exists := hash.fields[field]
+		if !exists {
+			continue
+		}
+		delta -= hashFieldSize(field, value)
+		if _, exists := hash.expires[field]; exists {
+			delta -= hashTTLSize
+		}
+		hash.remove(field)
+		deleted = append(deleted, field)
+	}
+	if len(deleted) == 0 {
+		return 0, nil
+	}
+	s.resize(item, delta)
+
+	s.propagate(append([]string{"HDEL", key}, deleted...)...)
+	s.notify(notifyHash, "hdel", key)
+	s.afterHashWrite(sh, key, item, hash)
+	return len(deleted), nil
+}
+
+// HIncrBy adds increment to the integer value of field, which is created as
+// 0 if it does not exist, and returns the new value. The field keeps its TTL.
+func (s *Store) HIncrBy(key, field string, increment int64) (int64, error) {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	return s.hincrby(sh, key, field, increment)
+}
+
+// hincrby implements HIncrBy. The caller must hold sh.mu.
+func (s *Store) hincrby(sh *shard, key, field string, increment int64) (int64, error) {
+	_, hash, err := s.writeHash(sh, key)
+	if err != nil {
+		return 0, err
+	}
+
+	var current int64
+	if hash != nil {
+		if value, exists := hash.fields[field]; exists {
+			if current, err = strconv.ParseInt(value, 10, 64); err != nil {
+				return 0, ErrHashNotInteger
+			}
+		}
+	}
+	if (increment > 0 && current > math.MaxInt64-increment) || (increment < 0 && current < math.MinInt64-increment) {
+		return 0, ErrIncrOverflow
+	}
+
+	result := current + increment
+	if err := s.setField(sh, key, field, strconv.FormatInt(result, 10)); err != nil {
+		return 0, err
+	}
+
+	s.propagate("HINCRBY", key, field, strconv.FormatInt(increment, 10))
+	s.notify(notifyHash, "hincrby", key)
+	return result, nil
+}
+
+// HIncrByFloat adds increment to the floating point value of field, which is
+// created as 0 if it does not exist, and returns the new value. The field
+// keeps its TTL.
+func (s *Store) HIncrByFloat(key, field string, increment float64) (float64, error) {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	_, hash, err := s.writeHash(sh, key)
+	if err != nil {
+		return 0, err
+	}
+
+	var current float64
+	if hash != nil {
+		if value, exists := hash.fields[field]; exists {
+			if current, err = strconv.ParseFloat(value, 64); err != nil {
+				return 0, ErrHashNotFloat
+			}
+		}
+	}
+	if sum := current + increment; math.IsNaN(sum) || math.IsInf(sum, 0) {
+		return 0, ErrIncrOverflow
+	}
+
+	value, result := addFloats(current, increment)
+	if math.IsInf(result, 0) {
+		return 0, ErrIncrOverflow
+	}
+	if err := s.setField(sh, key, field, value); err != nil {
+		return 0, err
+	}
+
+	// Floating point results are logged as the value written, as Redis does,
+	// so replay cannot drift. HSET clears TTLs, so a TTL is logged again.
+	hash = sh.data[key].Value.(*Hash)
+	s.propagate("HSET", key, field, value)
+	if expiresAt, exists := hash.expires[field]; exists {
+		s.propagate("HPEXPIREAT", key, formatUnixMilli(expiresAt), "FIELDS", "1", field)
+	}
+	s.notify(notifyHash, "hincrbyfloat", key)
+	return result, nil
+}
+
+// setField sets field of the hash at key to value, keeping its TTL. The caller
+// must hold sh.mu and have checked the key's type.
+func (s *Store) setField(sh *shard, key, field, value string) error {
+	delta := hashFieldSize(field, value)
+	if _, exists := sh.data[key]; !exists {
+		delta += itemSize(key, newHash())
+	}
+	if err := s.reserveMemory(sh, key, delta); err != nil {
+		return err
+	}
+
+	item, hash := s.hashItem(sh, key)
+	if prev, exists := hash.fields[field]; exists {
+		delta = hashFieldSize(field, value) - hashFieldSize(field, prev)
+	} else {
+		delta = hashFieldSize(field, value)
+	}
+	hash.fields[field] = value
+	s.resize(item, delta)
+	item.UpdatedAt = time.Now()
+	return nil
+}
+
+// HExpire sets a TTL on fields of the hash at key and returns, for each field,
+// HashFieldMissing, HashFieldExpire or, if ttl is not positive,
+// HashFieldDeleted. It returns nil if the key does not exist.
+func (s *Store) HExpire(key string, ttl time.Duration, fields ...string) ([]int, error) {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	return s.hexpireAt(sh, key, time.Now().Add(ttl), fields)
+}
+
+// hexpireAt implements HExpire with an absolute expiry. The caller must hold
+// sh.mu.
+func (s *Store) hexpireAt(sh *shard, key string, expiresAt time.Time, fields []string) ([]int, error) {
+	item, hash, err := s.writeHash(sh, key)
+	if err != nil || item == nil {
+		return nil, err
+	}
+
+	results := make([]int, len(fields))
+	var set, deleted []string
+	var delta int64
+	for i, field := range fields {
+		value, exists := hash.fields[field]
+		switch {
+		case !exists:
+			results[i] = HashFieldMissing
+		case !time.Now().Before(expiresAt):
+			delta -= hashFieldSize(field, value)
+			if _, exists := hash.expires[field]; exists {
+				delta -= hashTTLSize
+			}
+			hash.remove(field)
+			deleted = append(deleted, field)
+			results[i] = HashFieldDeleted
+		default:
+			if _, exists := hash.expires[field]; !exists {
+				delta += hashTTLSize
+			}
+			hash.setExpiry(field, expiresAt)
+			set = append(set, field)
+			results[i] = HashFieldExpire
+		}
+	}
+	s.resize(item, delta)
+
+	if len(set) > 0 {
+		args := []string{"HPEXPIREAT", key, formatUnixMilli(expiresAt), "FIELDS", strconv.Itoa(len(set))}
+		s.propagate(append(args, set...)...)
+		s.notify(notifyHash, "hexpire", key)
+	}
+	if len(deleted) > 0 {
+		s.propagate(append([]string{"HDEL", key}, deleted...)...)
+		s.notify(notifyHash, "hdel", key)
+	}
+	s.afterHashWrite(sh, key, item, hash)
+	return results, nil
+}
+
+// HTTL returns the remaining TTL in seconds of fields of the hash at key: -2
+// for a missing field and -1 for one without a TTL. It returns nil if the key
+// does not exist.
+func (s *Store) HTTL(key string, fields ...string) ([]int64, error) {
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	hash, err := s.readHash(sh, key)
+	if err != nil || hash == nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	results := make([]int64, len(fields))
+	for i, field := range fields {
+		if _, exists := hash.get(field, now); !exists {
+			results[i] = -2
+		} else if expiresAt, exists := hash.expires[field]; !exists {
+			results[i] = -1
+		} else {
+			// Round up, so a field is never reported with 0 seconds left
+			results[i] = int64((expiresAt.Sub(now) + time.Second - 1) / time.Second)
+		}
+	}
+	return results, nil
+}
+
+// HScan iterates the fields of the hash at key starting at cursor; it looks
+// at about count fields per call, returns the field-value pairs whose field
+// matches pattern (empty for all) and the cursor to continue from, 0 once the
+// scan is complete. Fields present for the whole scan are returned once, as
+// in Redis.
+func (s *Store) HScan(key string, cursor int, pattern string, count int) (int, []string, error) {
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	hash, err := s.readHash(sh, key)
+	if err != nil || hash == nil {
+		return 0, []string{}, err
+	}
+
+	now := time.Now()
+	fields, next := scanPage(cursor, count, func(visit func(string)) {
+		for field := range hash.fields {
+			if !hash.expired(field, now) {
+				visit(field)
+			}
+		}
+	})
+
+	pairs := []string{}
+	for _, field := range fields {
+		if pattern == "" || MatchPattern(pattern, field) {
+			pairs = append(pairs, field, hash.fields[field])
+		}
+	}
+	return next, pairs, nil
+}
+
+// expireHashSample removes expired fields from up to n hashes of sh that have
+// field TTLs and returns how many hashes it visited and fields it removed.
+// The caller must hold sh.mu.
+func (s *Store) expireHashSample(sh *shard, n int, now time.Time) (sampled, expired int) {
+	for key := range sh.hashTTL {
+		if sampled >= n {
+			break
+		}
+		sampled++
+
+		var hash *Hash
+		item, exists := sh.data[key]
+		if exists {
+			hash, _ = item.Value.(*Hash)
+		}
+		if hash == nil || len(hash.expires) == 0 {
+			delete(sh.hashTTL, key)
+			continue
+		}
+		expired += s.expireFields(sh, key, item, hash, now)
+		if len(hash.expires) == 0 {
+			delete(sh.hashTTL, key)
+		}
+	}
+	return sampled, expired
+}
@@ -0,0 +1,227 @@
+package store
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/chaitanyayendru/fincache/internal/config"
+)
+
+func TestHashBasics(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	if added, err := store.HSet("customer:1", "name", "Ada", "tier", "gold"); err != nil || added != 2 {
+		t.Fatalf("Expected 2 fields added, got %d (%v)", added, err)
+	}
+	if added, _ := store.HSet("customer:1", "tier", "platinum", "country", "UK"); added != 1 {
+		t.Errorf("Expected 1 field added, got %d", added)
+	}
+
+	if v, ok, _ := store.HGet("customer:1", "tier"); !ok || v != "platinum" {
+		t.Errorf("Expected 'platinum', got %q", v)
+	}
+	values, _ := store.HMGet("customer:1", "name", "missing")
+	if values[0] == nil || *values[0] != "Ada" || values[1] != nil {
+		t.Errorf("Expected [Ada nil], got %v", values)
+	}
+	if n, _ := store.HLen("customer:1"); n != 3 {
+		t.Errorf("Expected 3 fields, got %d", n)
+	}
+	all, _ := store.HGetAll("customer:1")
+	if !reflect.DeepEqual(all, map[string]string{"name": "Ada", "tier": "platinum", "country": "UK"}) {
+		t.Errorf("Unexpected HGETALL result %v", all)
+	}
+
+	if n, _ := store.HDel("customer:1", "name", "missing"); n != 1 {
+		t.Errorf("Expected 1 field deleted, got %d", n)
+	}
+	if exists, _ := store.HExists("customer:1", "name"); exists {
+		t.Error("Expected deleted field to be gone")
+	}
+
+	store.HDel("customer:1", "tier", "country")
+	if store.Exists("customer:1") {
+		t.Error("Expected empty hash to be deleted")
+	}
+	if store.UsedMemory() != 0 || store.Stats().KeysByType["hash"] != 0 {
+		t.Errorf("Expected accounting to return to zero, got %d bytes", store.UsedMemory())
+	}
+}
+
+func TestHashIncrements(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	if v, _ := store.HIncrBy("limits", "daily", 5); v != 5 {
+		t.Errorf("Expected 5, got %d", v)
+	}
+	if v, _ := store.HIncrBy("limits", "daily", -2); v != 3 {
+		t.Errorf("Expected 3, got %d", v)
+	}
+	if v, _ := store.HIncrByFloat("limits", "rate", 0.1); v != 0.1 {
+		t.Errorf("Expected 0.1, got %v", v)
+	}
+	store.HIncrByFloat("limits", "rate", 0.2)
+	if v, _, _ := store.HGet("limits", "rate"); v != "0.3" {
+		t.Errorf("Expected 0.3, got %q", v)
+	}
+
+	store.HSet("limits", "name", "retail")
+	if _, err := store.HIncrBy("limits", "name", 1); !errors.Is(err, ErrHashNotInteger) {
+		t.Errorf("Expected ErrHashNotInteger, got %v", err)
+	}
+	store.HSet("limits", "max", "9223372036854775807")
+	if _, err := store.HIncrBy("limits", "max", 1); !errors.Is(err, ErrIncrOverflow) {
+		t.Errorf("Expected ErrIncrOverflow, got %v", err)
+	}
+
+	store.Set("plain", "value", 0)
+	if _, err := store.HSet("plain", "f", "v"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType, got %v", err)
+	}
+	if _, err := store.Get("limits"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType from Get on a hash, got %v", err)
+	}
+}
+
+func TestHashFieldTTL(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	store.HSet("customer:1", "name", "Ada", "otp", "123456")
+	results, _ := store.HExpire("customer:1", 30*time.Millisecond, "otp", "missing")
+	if !reflect.DeepEqual(results, []int{HashFieldExpire, HashFieldMissing}) {
+		t.Errorf("Unexpected HEXPIRE results %v", results)
+	}
+	if results, _ := store.HExpire("nokey", time.Second, "otp"); results != nil {
+		t.Errorf("Expected nil for a missing key, got %v", results)
+	}
+
+	ttls, _ := store.HTTL("customer:1", "otp", "name", "missing")
+	if ttls[0] != 1 || ttls[1] != -1 || ttls[2] != -2 {
+		t.Errorf("Unexpected HTTL results %v", ttls)
+	}
+
+	time.Sleep(40 * time.Millisecond)
+	if _, ok, _ := store.HGet("customer:1", "otp"); ok {
+		t.Error("Expected expired field to be invisible")
+	}
+	if n, _ := store.HLen("customer:1"); n != 1 {
+		t.Errorf("Expected 1 live field, got %d", n)
+	}
+
+	// A write removes the expired field for good
+	store.HSet("customer:1", "tier", "gold")
+	sh := store.shardFor("customer:1")
+	sh.mu.RLock()
+	hash := sh.data["customer:1"].Value.(*Hash)
+	if _, exists := hash.fields["otp"]; exists {
+		t.Error("Expected expired field to be removed on write")
+	}
+	sh.mu.RUnlock()
+
+	// Overwriting a field clears its TTL; a TTL in the past deletes it
+	store.HExpire("customer:1", time.Hour, "tier")
+	store.HSet("customer:1", "tier", "silver")
+	if ttls, _ := store.HTTL("customer:1", "tier"); ttls[0] != -1 {
+		t.Errorf("Expected HSET to clear the TTL, got %d", ttls[0])
+	}
+	if results, _ := store.HExpire("customer:1", 0, "tier"); results[0] != HashFieldDeleted {
+		t.Errorf("Expected field to be deleted, got %v", results)
+	}
+}
+
+func TestHashFieldActiveExpiry(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	store.HSet("session", "otp", "1")
+	store.HExpire("session", time.Millisecond, "otp")
+	time.Sleep(5 * time.Millisecond)
+
+	store.activeExpireCycle(time.Second)
+	if store.Exists("session") {
+		t.Error("Expected active expiry to delete the hash once its last field expired")
+	}
+	if store.UsedMemory() != 0 {
+		t.Errorf("Expected memory to be released, got %d", store.UsedMemory())
+	}
+}
+
+func TestHScan(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	store.HSet("h", "a1", "1", "a2", "2", "b1", "3", "a3", "4")
+
+	pairs := map[string]string{}
+	cursor := 0
+	for {
+		next, page, err := store.HScan("h", cursor, "a*", 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < len(page); i += 2 {
+			pairs[page[i]] = page[i+1]
+		}
+		if next == 0 {
+			break
+		}
+		cursor = next
+	}
+	if !reflect.DeepEqual(pairs, map[string]string{"a1": "1", "a2": "2", "a3": "4"}) {
+		t.Errorf("Unexpected HSCAN result %v", pairs)
+	}
+
+	// Deleting fields already returned must not skip others
+	store.HSet("fees", "a", "1", "b", "2", "c", "3", "d", "4", "e", "5")
+	seen := map[string]bool{}
+	cursor = 0
+	for {
+		next, page, _ := store.HScan("fees", cursor, "", 2)
+		for i := 0; i < len(page); i += 2 {
+			seen[page[i]] = true
+			store.HDel("fees", page[i])
+		}
+		if cursor = next; cursor == 0 {
+			break
+		}
+	}
+	if len(seen) != 5 {
+		t.Errorf("Expected all 5 fields, got %v", seen)
+	}
+}
+
+func TestHashPersistence(t *testing.T) {
+	cfg := aofConfig(t.TempDir())
+
+	store := NewStore(cfg)
+	store.HSet("snap", "a", "1", "otp", "x")
+	store.HExpire("snap", time.Hour, "otp")
+	if err := store.SaveSnapshot(); err != nil {
+		t.Fatalf("Expected no error when saving snapshot: %v", err)
+	}
+	store.HSet("log", "n", "1", "gone", "x", "f", "0")
+	store.HIncrBy("log", "n", 41)
+	store.HExpire("log", time.Hour, "f")
+	store.HIncrByFloat("log", "f", 1.5)
+	store.HDel("log", "gone")
+	store.Close()
+
+	restored := NewStore(cfg)
+	defer restored.Close()
+
+	if ttls, _ := restored.HTTL("snap", "otp", "a"); ttls[0] <= 0 || ttls[1] != -1 {
+		t.Errorf("Expected field TTLs to survive the snapshot, got %v", ttls)
+	}
+	all, _ := restored.HGetAll("log")
+	if !reflect.DeepEqual(all, map[string]string{"n": "42", "f": "1.5"}) {
+		t.Errorf("Unexpected replayed hash %v", all)
+	}
+	if ttls, _ := restored.HTTL("log", "f"); ttls[0] <= 0 {
+		t.Errorf("Expected HINCRBYFLOAT to keep the TTL, got %v", ttls)
+	}
+}
@@ -0,0 +1,308 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+const (
+	defaultIdempotencyTTL     = 24 * time.Hour
+	defaultIdempotencyLockTTL = 30 * time.Second
+)
+
+var (
+	ErrIdempotencyMismatch = errors.New("idempotency key was already used with a different request")
+	ErrNotReserved         = errors.New("idempotency key is not reserved with this token")
+)
+
+// IdempotencyState is the state of an idempotency key.
+type IdempotencyState string
+
+const (
+	// IdempotencyReserved is returned to the caller that reserved the key,
+	// which must then complete or release it.
+	IdempotencyReserved IdempotencyState = "reserved"
+	// IdempotencyInFlight means another caller holds the reservation.
+	IdempotencyInFlight IdempotencyState = "in-flight"
+	// IdempotencyCompleted means the request ran and its response is cached.
+	IdempotencyCompleted IdempotencyState = "completed"
+)
+
+// IdempotencyRecord is the value of an idempotency key: a reservation while
+// the request runs, then the response it produced. It is stored in
+// Item.Value like the other scalars, and the key's TTL cleans it up: the
+// lock TTL while in flight, so a crashed caller cannot hold the key for
+// ever, and the response TTL once completed.
+type IdempotencyRecord struct {
+	State       IdempotencyState `json:"state"` // in-flight or completed
+	Token       string           `json:"-"`     // proves ownership of the reservation
+	Fingerprint string           `json:"fingerprint,omitempty"`
+	Status      int              `json:"status,omitempty"`
+	ContentType string           `json:"content_type,omitempty"`
+	Body        []byte           `json:"body,omitempty"`
+	CreatedAt   time.Time        `json:"created_at"`
+}
+
+// IdempotencyOptions holds the optional arguments of IdempotencyReserve.
+type IdempotencyOptions struct {
+	// Fingerprint identifies the request, e.g. a hash of its method, path
+	// and body. A later request with the same key but another fingerprint
+	// fails with ErrIdempotencyMismatch.
+	Fingerprint string
+	// LockTTL bounds how long the reservation is held if it is never
+	// completed or released; 0 uses the configured default.
+	LockTTL time.Duration
+	// Wait makes a duplicate of an in-flight request wait for it to finish
+	// rather than return IdempotencyInFlight at once.
+	Wait    bool
+	Timeout time.Duration // how long to wait, 0 for ever
+}
+
+// IdempotencyResult is the outcome of IdempotencyReserve.
+type IdempotencyResult struct {
+	State       IdempotencyState
+	Token       string // set if State is IdempotencyReserved
+	Status      int    // the cached response if State is IdempotencyCompleted
+	ContentType string
+	Body        []byte
+}
+
+func (s *Store) idempotencyTTL() time.Duration {
+	if s.config.IdempotencyTTL > 0 {
+		return s.config.IdempotencyTTL
+	}
+	return defaultIdempotencyTTL
+}
+
+func (s *Store) idempotencyLockTTL() time.Duration {
+	if s.config.IdempotencyLockTTL > 0 {
+		return s.config.IdempotencyLockTTL
+	}
+	return defaultIdempotencyLockTTL
+}
+
+// IdempotencyReserve claims key for a request. The first caller gets
+// IdempotencyReserved and a token to complete or release the key with.
+// While it holds the reservation duplicates get IdempotencyInFlight, or with
+// opts.Wait block until it is completed, released or its lock TTL passes,
+// returning IdempotencyInFlight only if the timeout passes first. Once the
+// key is completed duplicates get the cached response.
+func (s *Store) IdempotencyReserve(ctx context.Context, key string, opts IdempotencyOptions) (IdempotencyResult, error) {
+	if opts.LockTTL <= 0 {
+		opts.LockTTL = s.idempotencyLockTTL()
+	}
+
+	var result IdempotencyResult
+	var lockExpiresAt time.Time
+	try := func() (bool, error) {
+		sh := s.shardFor(key)
+		record, item, err := s.writeIdempotency(sh, key)
+		if err != nil {
+			return false, err
+		}
+		if item == nil {
+			result, err = s.reserveIdempotency(sh, key, opts)
+			return err == nil, err
+		}
+		if record.Fingerprint != opts.Fingerprint {
+			return false, ErrIdempotencyMismatch
+		}
+		if record.State == IdempotencyCompleted {
+			result = IdempotencyResult{State: IdempotencyCompleted, Status: record.Status, ContentType: record.ContentType, Body: record.Body}
+			return true, nil
+		}
+
+		result = IdempotencyResult{State: IdempotencyInFlight}
+		lockExpiresAt = time.Now().Add(opts.LockTTL)
+		if item.ExpiresAt != nil {
+			lockExpiresAt = *item.ExpiresAt
+		}
+		return !opts.Wait, nil
+	}
+
+	unlock := s.lockKeys(key)
+	done, err := try()
+	unlock()
+	if done || err != nil {
+		return result, err
+	}
+
+	var deadline time.Time
+	if opts.Timeout > 0 {
+		deadline = time.Now().Add(opts.Timeout)
+	}
+	for {
+		// Expiry does not wake waiters, so wait no longer than the lock
+		// TTL before checking again
+		wait := time.Until(lockExpiresAt)
+		if remaining := time.Until(deadline); !deadline.IsZero() && remaining < wait {
+			wait = remaining
+		}
+		done, err := s.block(ctx, []string{key}, []string{key}, max(wait, time.Millisecond), try)
+		if done || err != nil {
+			return result, err
+		}
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			return result, nil
+		}
+	}
+}
+
+// reserveIdempotency stores a new reservation at key. The caller must hold
+// sh.mu.
+func (s *Store) reserveIdempotency(sh *shard, key string, opts IdempotencyOptions) (IdempotencyResult, error) {
+	token, err := newIdempotencyToken()
+	if err != nil {
+		return IdempotencyResult{}, err
+	}
+	record := IdempotencyRecord{
+		State:       IdempotencyInFlight,
+		Token:       token,
+		Fingerprint: opts.Fingerprint,
+		CreatedAt:   time.Now(),
+	}
+	if err := s.storeIdempotency(sh, key, record, opts.LockTTL, "idem.reserve"); err != nil {
+		return IdempotencyResult{}, err
+	}
+	return IdempotencyResult{State: IdempotencyReserved, Token: token}, nil
+}
+
+// IdempotencyComplete caches the response of the request that reserved key
+// with token, for ttl or the configured default if ttl is 0, and wakes the
+// duplicates waiting for it. contentType may be empty if the response has
+// none.
+func (s *Store) IdempotencyComplete(key, token string, status int, contentType string, body []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		ttl = s.idempotencyTTL()
+	}
+
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	record, err := s.reservation(sh, key, token)
+	if err != nil {
+		return err
+	}
+	record.State, record.Token = IdempotencyCompleted, ""
+	record.Status, record.ContentType = status, contentType
+	record.Body = append([]byte(nil), body...)
+	if err := s.storeIdempotency(sh, key, record, ttl, "idem.complete"); err != nil {
+		return err
+	}
+	sh.signal(key)
+	return nil
+}
+
+// IdempotencyRelease drops the reservation of key held with token, e.g.
+// because the request failed in a way that is safe to retry. A waiting
+// duplicate then gets the reservation.
+func (s *Store) IdempotencyRelease(key, token string) error {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if _, err := s.reservation(sh, key, token); err != nil {
+		return err
+	}
+	s.del(sh, key)
+	s.propagate("DEL", key)
+	s.notify(notifyString, "idem.release", key)
+	sh.signal(key)
+	return nil
+}
+
+// IdempotencyGet returns the record at key and whether it exists.
+func (s *Store) IdempotencyGet(key string) (IdempotencyRecord, bool, error) {
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	item, exists := sh.data[key]
+	if !exists || item.ExpiresAt != nil && time.Now().After(*item.ExpiresAt) {
+		s.stats.recordLookup(false)
+		return IdempotencyRecord{}, false, nil
+	}
+	record, ok := item.Value.(IdempotencyRecord)
+	if !ok {
+		return IdempotencyRecord{}, false, ErrWrongType
+	}
+	s.stats.recordLookup(true)
+	s.touch(item)
+	return record, true, nil
+}
+
+// reservation returns the in-flight record at key if it is held with token.
+// The caller must hold sh.mu.
+func (s *Store) reservation(sh *shard, key, token string) (IdempotencyRecord, error) {
+	record, item, err := s.writeIdempotency(sh, key)
+	if err != nil {
+		return IdempotencyRecord{}, err
+	}
+	if item == nil || record.State != IdempotencyInFlight || record.Token != token {
+		return IdempotencyRecord{}, ErrNotReserved
+	}
+	return record, nil
+}
+
+// writeIdempotency returns the record at key for a write along with its
+// item, deleting the key first if it has expired. It returns a nil item if
+// there is no record. The caller must hold sh.mu.
+func (s *Store) writeIdempotency(sh *shard, key string) (IdempotencyRecord, *Item, error) {
+	if _, isZSet := sh.sortedSets[key]; isZSet {
+		return IdempotencyRecord{}, nil, ErrWrongType
+	}
+	item, exists := sh.data[key]
+	if !exists {
+		return IdempotencyRecord{}, nil, nil
+	}
+	if item.ExpiresAt != nil && time.Now().After(*item.ExpiresAt) {
+		s.deleteExpired(sh, key)
+		return IdempotencyRecord{}, nil, nil
+	}
+
+	record, ok := item.Value.(IdempotencyRecord)
+	if !ok {
+		return IdempotencyRecord{}, nil, ErrWrongType
+	}
+	s.touch(item)
+	return record, item, nil
+}
+
+// storeIdempotency writes record to key with ttl and logs it as a SET. The
+// caller must hold sh.mu.
+func (s *Store) storeIdempotency(sh *shard, key string, record IdempotencyRecord, ttl time.Duration, event string) error {
+	var payload string
+	if s.aof != nil {
+		var err error
+		if payload, err = marshalValue(record); err != nil {
+			return err
+		}
+	}
+
+	delta := itemSize(key, record)
+	if prev, exists := sh.data[key]; exists {
+		delta -= prev.size
+	}
+	if err := s.reserveMemory(sh, key, delta); err != nil {
+		return err
+	}
+
+	expiresAt := time.Now().Add(ttl)
+	s.set(sh, key, record, &expiresAt)
+
+	s.propagate("SET", key, payload, "PXAT", formatUnixMilli(expiresAt))
+	s.notify(notifyString, event, key)
+	return nil
+}
+
+func newIdempotencyToken() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
@@ -0,0 +1,103 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/chaitanyayendru/fincache/internal/config"
+)
+
+func TestIdempotencyLifecycle(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	ctx := context.Background()
+	opts := IdempotencyOptions{Fingerprint: "POST /charges abc"}
+	first, err := store.IdempotencyReserve(ctx, "pay-1", opts)
+	if err != nil || first.State != IdempotencyReserved || first.Token == "" {
+		t.Fatalf("Expected a reservation, got %+v (%v)", first, err)
+	}
+
+	if dup, _ := store.IdempotencyReserve(ctx, "pay-1", opts); dup.State != IdempotencyInFlight {
+		t.Errorf("Expected a duplicate to see the request in flight, got %+v", dup)
+	}
+	if _, err := store.IdempotencyReserve(ctx, "pay-1", IdempotencyOptions{Fingerprint: "other"}); !errors.Is(err, ErrIdempotencyMismatch) {
+		t.Errorf("Expected ErrIdempotencyMismatch, got %v", err)
+	}
+	if err := store.IdempotencyComplete("pay-1", "wrong", 201, "", nil, 0); !errors.Is(err, ErrNotReserved) {
+		t.Errorf("Expected ErrNotReserved for a wrong token, got %v", err)
+	}
+
+	if err := store.IdempotencyComplete("pay-1", first.Token, 201, "", []byte(`{"id":1}`), time.Hour); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	replay, _ := store.IdempotencyReserve(ctx, "pay-1", opts)
+	if replay.State != IdempotencyCompleted || replay.Status != 201 || string(replay.Body) != `{"id":1}` {
+		t.Errorf("Expected the cached response, got %+v", replay)
+	}
+	if ttl, _ := store.TTL("pay-1"); ttl <= 30*time.Second {
+		t.Errorf("Expected completion to extend the TTL to an hour, got %v", ttl)
+	}
+
+	// A released key can be reserved again
+	second, _ := store.IdempotencyReserve(ctx, "pay-2", opts)
+	if err := store.IdempotencyRelease("pay-2", second.Token); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if again, _ := store.IdempotencyReserve(ctx, "pay-2", opts); again.State != IdempotencyReserved {
+		t.Errorf("Expected to reserve a released key, got %+v", again)
+	}
+}
+
+func TestIdempotencyWait(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	ctx := context.Background()
+	first, _ := store.IdempotencyReserve(ctx, "pay", IdempotencyOptions{})
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		store.IdempotencyComplete("pay", first.Token, 200, "", []byte("done"), 0)
+	}()
+
+	result, err := store.IdempotencyReserve(ctx, "pay", IdempotencyOptions{Wait: true, Timeout: 5 * time.Second})
+	if err != nil || result.State != IdempotencyCompleted || string(result.Body) != "done" {
+		t.Errorf("Expected to wait for the response, got %+v (%v)", result, err)
+	}
+
+	// A waiter takes over a reservation whose lock TTL runs out
+	store.IdempotencyReserve(ctx, "stuck", IdempotencyOptions{LockTTL: 50 * time.Millisecond})
+	result, _ = store.IdempotencyReserve(ctx, "stuck", IdempotencyOptions{Wait: true, Timeout: 5 * time.Second})
+	if result.State != IdempotencyReserved {
+		t.Errorf("Expected to reserve once the lock expired, got %+v", result)
+	}
+
+	store.IdempotencyReserve(ctx, "slow", IdempotencyOptions{})
+	start := time.Now()
+	result, _ = store.IdempotencyReserve(ctx, "slow", IdempotencyOptions{Wait: true, Timeout: 50 * time.Millisecond})
+	if result.State != IdempotencyInFlight || time.Since(start) > time.Second {
+		t.Errorf("Expected in-flight after the timeout, got %+v after %v", result, time.Since(start))
+	}
+}
+
+func TestIdempotencyPersists(t *testing.T) {
+	cfg := aofConfig(t.TempDir())
+	store := NewStore(cfg)
+	ctx := context.Background()
+	done, _ := store.IdempotencyReserve(ctx, "done", IdempotencyOptions{Fingerprint: "f"})
+	store.IdempotencyComplete("done", done.Token, 200, "text/plain", []byte("ok"), 0)
+	pending, _ := store.IdempotencyReserve(ctx, "pending", IdempotencyOptions{})
+	store.Close()
+
+	restored := NewStore(cfg)
+	defer restored.Close()
+
+	if result, _ := restored.IdempotencyReserve(ctx, "done", IdempotencyOptions{Fingerprint: "f"}); result.State != IdempotencyCompleted || result.ContentType != "text/plain" || string(result.Body) != "ok" {
+		t.Errorf("Expected the cached response after replay, got %+v", result)
+	}
+	if err := restored.IdempotencyComplete("pending", pending.Token, 200, "", nil, 0); err != nil {
+		t.Errorf("Expected the reservation token to survive a restart, got %v", err)
+	}
+}
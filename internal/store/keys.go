@@ -0,0 +1,445 @@
+package store
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc64"
+	"math/rand"
+	"time"
+)
+
+// dumpVersion is the version of the DUMP payload format. RESTORE refuses
+// payloads of later versions.
+const dumpVersion = 1
+
+var (
+	ErrBusyKey     = errors.New("BUSYKEY Target key name already exists.")
+	ErrDumpPayload = errors.New("DUMP payload version or checksum are wrong")
+	ErrZSetTTL     = errors.New("sorted sets cannot expire")
+)
+
+// Type returns the type of the value at key as recorded in Item.Type,
+// "zset" for sorted sets and "none" if the key does not exist.
+func (s *Store) Type(key string) string {
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	if !s.liveKey(sh, key) {
+		return "none"
+	}
+	if item, exists := sh.data[key]; exists {
+		return item.Type
+	}
+	return "zset"
+}
+
+// ExpireOptions are the conditions of ExpireAt. NX cannot be combined with
+// the others, nor GT with LT.
+type ExpireOptions struct {
+	NX bool // only if the key has no TTL
+	XX bool // only if the key has a TTL
+	GT bool // only if the new expiry is later; a key without TTL never expires
+	LT bool // only if the new expiry is earlier
+}
+
+// ExpireAt sets the expiry of key to at if opts allow it, deleting the key if
+// at has passed, and reports whether it did. Sorted sets cannot expire, so
+// for them an expiry that has not passed fails with ErrZSetTTL.
+func (s *Store) ExpireAt(key string, at time.Time, opts ExpireOptions) (bool, error) {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	var current *time.Time
+	_, isZSet := sh.sortedSets[key]
+	if item, exists := sh.data[key]; exists {
+		if item.ExpiresAt != nil && time.Now().After(*item.ExpiresAt) {
+			s.deleteExpired(sh, key)
+			return false, nil
+		}
+		current = item.ExpiresAt
+	} else if !isZSet {
+		return false, nil
+	}
+
+	if opts.NX && current != nil || opts.XX && current == nil ||
+		opts.GT && (current == nil || !at.After(*current)) ||
+		opts.LT && current != nil && !at.Before(*current) {
+		return false, nil
+	}
+
+	if !time.Now().Before(at) {
+		s.del(sh, key)
+		s.propagate("DEL", key)
+		s.notify(notifyGeneric, "del", key)
+		return true, nil
+	}
+	if isZSet {
+		return false, ErrZSetTTL
+	}
+	s.expireAt(sh, key, at)
+	s.propagate("PEXPIREAT", key, formatUnixMilli(at))
+	s.notify(notifyGeneric, "expire", key)
+	return true, nil
+}
+
+// ExpireTime returns the expiry of key, nil if it has none, as is always the
+// case for sorted sets, and whether the key exists.
+func (s *Store) ExpireTime(key string) (*time.Time, bool) {
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	if !s.liveKey(sh, key) {
+		return nil, false
+	}
+	if item, exists := sh.data[key]; exists {
+		return item.ExpiresAt, true
+	}
+	return nil, true
+}
+
+// Persist removes the TTL of key and reports whether it had one. Sorted sets
+// never have one.
+func (s *Store) Persist(key string) bool {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if !s.persist(sh, key) {
+		return false
+	}
+	s.propagate("PERSIST", key)
+	s.notify(notifyGeneric, "persist", key)
+	return true
+}
+
+// persist removes the TTL of key if it has one that has not passed. The
+// caller must hold sh.mu.
+func (s *Store) persist(sh *shard, key string) bool {
+	item, exists := sh.data[key]
+	if !exists || item.ExpiresAt == nil || time.Now().After(*item.ExpiresAt) {
+		return false
+	}
+	item.ExpiresAt = nil
+	item.UpdatedAt = time.Now()
+	s.clearTTL(sh, key)
+	return true
+}
+
+// Touch updates the access time of keys, as a read would, and returns how
+// many of them exist.
+func (s *Store) Touch(keys ...string) int {
+	unlock := s.lockKeys(keys...)
+	defer unlock()
+
+	touched := 0
+	for _, key := range keys {
+		sh := s.shardFor(key)
+		if !s.liveKey(sh, key) {
+			continue
+		}
+		if item, exists := sh.data[key]; exists {
+			s.touch(item)
+		}
+		touched++
+	}
+	return touched
+}
+
+// Unlink removes keys as Del does, but releases the memory of their sorted
+// sets, which takes a walk over every member, in the background, as Redis
+// frees unlinked values in a background thread. The garbage collector frees
+// the values themselves.
+func (s *Store) Unlink(keys ...string) int {
+	unlock := s.lockKeys(keys...)
+	gen := s.memoryGen.Load()
+	unlinked := 0
+	sortedSets := map[string]*SortedSet{}
+	for _, key := range keys {
+		item, sortedSet := s.detach(s.shardFor(key), key)
+		if item == nil && sortedSet == nil {
+			continue
+		}
+		s.release(key, item, nil)
+		if sortedSet != nil {
+			sortedSets[key] = sortedSet
+		}
+		unlinked++
+		s.propagate("DEL", key)
+		s.notify(notifyGeneric, "del", key)
+	}
+	unlock()
+
+	if len(sortedSets) > 0 {
+		go s.releaseUnlinked(gen, sortedSets)
+	}
+	return unlinked
+}
+
+// releaseUnlinked releases the memory of sorted sets detached by Unlink when
+// memoryGen was gen.
+func (s *Store) releaseUnlinked(gen uint64, sortedSets map[string]*SortedSet) {
+	var freed int64
+	for key, sortedSet := range sortedSets {
+		freed += zsetSize(key, sortedSet)
+	}
+
+	s.releaseMu.Lock()
+	defer s.releaseMu.Unlock()
+	if s.memoryGen.Load() == gen {
+		s.usedMemory.Add(-freed)
+	}
+}
+
+// Rename moves the value at src, with its TTL, to dst, replacing any value
+// there, or with nx only if dst does not exist. It reports whether it moved
+// the value and fails with ErrNoSuchKey if src does not exist.
+func (s *Store) Rename(src, dst string, nx bool) (bool, error) {
+	unlock := s.lockKeys(src, dst)
+	defer unlock()
+
+	if !s.liveKey(s.shardFor(src), src) {
+		return false, ErrNoSuchKey
+	}
+	if src == dst {
+		return !nx, nil
+	}
+	if nx && s.liveKey(s.shardFor(dst), dst) {
+		return false, nil
+	}
+
+	s.rename(src, dst)
+	s.propagate("RENAME", src, dst)
+	s.notify(notifyGeneric, "rename_from", src)
+	s.notify(notifyGeneric, "rename_to", dst)
+	return true, nil
+}
+
+// rename implements Rename for distinct keys once src is known to exist.
+// The caller must hold the locks of both keys.
+func (s *Store) rename(src, dst string) {
+	srcShard, dstShard := s.shardFor(src), s.shardFor(dst)
+	item, sortedSet := srcShard.data[src], srcShard.sortedSets[src]
+	s.del(srcShard, src)
+	s.del(dstShard, dst)
+
+	if item != nil {
+		item.size += int64(len(dst) - len(src))
+		dstShard.data[dst] = item
+		s.accountItem(item, nil)
+		s.stats.countType(item.Type, 1)
+		if item.ExpiresAt != nil {
+			s.setTTL(dstShard, dst, *item.ExpiresAt)
+		}
+		if hash, ok := item.Value.(*Hash); ok && len(hash.expires) > 0 {
+			dstShard.trackHashTTL(dst)
+		}
+	}
+	if sortedSet != nil {
+		dstShard.sortedSets[dst] = sortedSet
+		s.usedMemory.Add(zsetSize(dst, sortedSet))
+		s.stats.countType("zset", 1)
+	}
+	dstShard.signal(dst)
+}
+
+// Copy copies the value at src, with its TTL, to dst in database index,
+// replacing any value there only if replace is set. It reports whether it
+// copied the value.
+func (s *Store) Copy(src, dst string, index int, replace bool) (bool, error) {
+	target, err := s.Select(index)
+	if err != nil {
+		return false, err
+	}
+	if target == s && src == dst {
+		return false, ErrSameDB
+	}
+
+	srcShard, dstShard := s.shardFor(src), target.shardFor(dst)
+	unlock := lockShards(srcShard, dstShard)
+	defer unlock()
+
+	if !s.liveKey(srcShard, src) || !replace && target.liveKey(dstShard, dst) {
+		return false, nil
+	}
+
+	var value interface{}
+	var expiresAt *time.Time
+	if item, exists := srcShard.data[src]; exists {
+		value, expiresAt = item.clone().Value, item.ExpiresAt
+	} else {
+		value = srcShard.sortedSets[src].clone()
+	}
+	if err := target.restore(dstShard, dst, value, expiresAt); err != nil {
+		return false, err
+	}
+	target.notify(notifyGeneric, "copy_to", dst)
+	return true, nil
+}
+
+// RandomKey returns a random key of the database, false if it is empty.
+func (s *Store) RandomKey() (string, bool) {
+	now := time.Now()
+	start := rand.Intn(len(s.shards))
+	for i := range s.shards {
+		sh := s.shards[(start+i)%len(s.shards)]
+		sh.mu.RLock()
+		// Map iteration starts at a random entry
+		for key, item := range sh.data {
+			if item.ExpiresAt == nil || now.Before(*item.ExpiresAt) {
+				sh.mu.RUnlock()
+				return key, true
+			}
+		}
+		for key := range sh.sortedSets {
+			sh.mu.RUnlock()
+			return key, true
+		}
+		sh.mu.RUnlock()
+	}
+	return "", false
+}
+
+// Dump serializes the value at key, of any type, into a payload for
+// Restore, and reports false if the key does not exist. The payload holds
+// the encoded value followed by the format version and a CRC-64 checksum,
+// both little-endian, as in Redis; the TTL is not part of it.
+func (s *Store) Dump(key string) (string, bool, error) {
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	if !s.liveKey(sh, key) {
+		return "", false, nil
+	}
+	var value interface{}
+	if item, exists := sh.data[key]; exists {
+		value = item.Value
+	} else {
+		value = sh.sortedSets[key]
+	}
+
+	encoded, err := marshalValue(value)
+	if err != nil {
+		return "", false, err
+	}
+	payload := binary.LittleEndian.AppendUint16([]byte(encoded), dumpVersion)
+	payload = binary.LittleEndian.AppendUint64(payload, crc64.Checksum(payload, crcTable))
+	return string(payload), true, nil
+}
+
+// RestoreOptions are the options of Restore.
+type RestoreOptions struct {
+	// ExpiresAt is the expiry of the key; zero means none, and a time
+	// already past restores nothing.
+	ExpiresAt time.Time
+	// Replace replaces an existing key rather than fail with ErrBusyKey.
+	Replace bool
+}
+
+// Restore stores the value serialized by Dump in payload at key. It fails
+// with ErrDumpPayload if the payload is corrupt.
+func (s *Store) Restore(key, payload string, opts RestoreOptions) error {
+	value, err := decodeDump(payload)
+	if err != nil {
+		return err
+	}
+
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if !opts.Replace && s.liveKey(sh, key) {
+		return ErrBusyKey
+	}
+	if opts.ExpiresAt.IsZero() {
+		err = s.restore(sh, key, value, nil)
+	} else if time.Now().Before(opts.ExpiresAt) {
+		err = s.restore(sh, key, value, &opts.ExpiresAt)
+	} else {
+		// Redis treats a restored key that has already expired as deleted
+		if s.del(sh, key) {
+			s.propagate("DEL", key)
+			s.notify(notifyGeneric, "del", key)
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	s.notify(notifyGeneric, "restore", key)
+	return nil
+}
+
+// decodeDump checks the version and checksum of a DUMP payload and returns
+// the value it holds.
+func decodeDump(payload string) (interface{}, error) {
+	if len(payload) < 10 {
+		return nil, ErrDumpPayload
+	}
+	body := []byte(payload[:len(payload)-8])
+	if crc64.Checksum(body, crcTable) != binary.LittleEndian.Uint64([]byte(payload[len(body):])) {
+		return nil, ErrDumpPayload
+	}
+	if version := binary.LittleEndian.Uint16(body[len(body)-2:]); version == 0 || version > dumpVersion {
+		return nil, ErrDumpPayload
+	}
+
+	value, err := unmarshalValue(string(body[:len(body)-2]))
+	if err != nil || value == nil {
+		return nil, ErrDumpPayload
+	}
+	return value, nil
+}
+
+// restore stores value, of any type, at key with expiresAt, replacing the
+// key, and logs it as a RESTORE. Sorted sets cannot expire, so expiresAt is
+// ignored for them. The caller must hold sh.mu.
+func (s *Store) restore(sh *shard, key string, value interface{}, expiresAt *time.Time) error {
+	var payload string
+	if s.aof != nil {
+		var err error
+		if payload, err = marshalValue(value); err != nil {
+			return err
+		}
+	}
+
+	sortedSet, isZSet := value.(*SortedSet)
+	size := itemSize(key, value)
+	if isZSet {
+		size = zsetSize(key, sortedSet)
+	}
+	delta := size
+	if prev, exists := sh.data[key]; exists {
+		delta -= prev.size
+	}
+	if prev, exists := sh.sortedSets[key]; exists {
+		delta -= zsetSize(key, prev)
+	}
+	if err := s.reserveMemory(sh, key, delta); err != nil {
+		return err
+	}
+
+	s.del(sh, key)
+	if isZSet {
+		sh.sortedSets[key] = sortedSet
+		s.usedMemory.Add(size)
+		s.stats.countType("zset", 1)
+		expiresAt = nil
+	} else {
+		s.set(sh, key, value, expiresAt)
+		if hash, ok := value.(*Hash); ok && len(hash.expires) > 0 {
+			sh.trackHashTTL(key)
+		}
+	}
+	sh.signal(key)
+
+	if expiresAt != nil {
+		s.propagate("RESTORE", key, payload, "PXAT", formatUnixMilli(*expiresAt))
+	} else {
+		s.propagate("RESTORE", key, payload)
+	}
+	return nil
+}
@@ -0,0 +1,294 @@
+package store
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc64"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/chaitanyayendru/fincache/internal/config"
+)
+
+func TestTypeAndExpireOptions(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	store.Set("s", "v", 0)
+	store.LPush("l", "a")
+	store.ZAdd("z", 1, "m")
+	store.BFAdd("bf", "x")
+	for key, want := range map[string]string{"s": "string", "l": "list", "z": "zset", "bf": "bloom", "missing": "none"} {
+		if typ := store.Type(key); typ != want {
+			t.Errorf("Expected %s to be a %s, got %s", key, want, typ)
+		}
+	}
+
+	hour := time.Now().Add(time.Hour)
+	if set, _ := store.ExpireAt("s", hour, ExpireOptions{XX: true}); set {
+		t.Errorf("Expected XX to skip a key without TTL")
+	}
+	if set, _ := store.ExpireAt("s", hour, ExpireOptions{GT: true}); set {
+		t.Errorf("Expected GT to skip a key without TTL, which never expires")
+	}
+	if set, _ := store.ExpireAt("s", hour, ExpireOptions{NX: true}); !set {
+		t.Errorf("Expected NX to set a TTL on a key without one")
+	}
+	if set, _ := store.ExpireAt("s", hour.Add(time.Hour), ExpireOptions{LT: true}); set {
+		t.Errorf("Expected LT to skip a later expiry")
+	}
+	if set, _ := store.ExpireAt("s", hour.Add(time.Hour), ExpireOptions{GT: true}); !set {
+		t.Errorf("Expected GT to set a later expiry")
+	}
+	if at, exists := store.ExpireTime("s"); !exists || at == nil || at.UnixMilli() != hour.Add(time.Hour).UnixMilli() {
+		t.Errorf("Expected the new expiry, got %v", at)
+	}
+
+	if !store.Persist("s") || store.Persist("s") {
+		t.Errorf("Expected PERSIST to remove the TTL once")
+	}
+	if at, exists := store.ExpireTime("s"); !exists || at != nil {
+		t.Errorf("Expected no expiry, got %v", at)
+	}
+	if set, _ := store.ExpireAt("s", time.Now().Add(-time.Second), ExpireOptions{}); !set || store.Exists("s") {
+		t.Errorf("Expected an expiry in the past to delete the key")
+	}
+	if n := store.Touch("l", "z", "missing"); n != 2 {
+		t.Errorf("Expected TOUCH to count 2 keys, got %d", n)
+	}
+}
+
+func TestSortedSetsCannotExpire(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	store.ZAdd("book", 101.5, "ask")
+	if set, err := store.ExpireAt("book", time.Now().Add(time.Hour), ExpireOptions{}); set || !errors.Is(err, ErrZSetTTL) {
+		t.Errorf("Expected ErrZSetTTL, got %v %v", set, err)
+	}
+	if err := store.Expire("book", time.Hour); !errors.Is(err, ErrZSetTTL) {
+		t.Errorf("Expected ErrZSetTTL, got %v", err)
+	}
+	if set, err := store.ExpireAt("book", time.Now().Add(time.Hour), ExpireOptions{XX: true}); set || err != nil {
+		t.Errorf("Expected XX to skip a sorted set, got %v %v", set, err)
+	}
+
+	if at, exists := store.ExpireTime("book"); !exists || at != nil {
+		t.Errorf("Expected a sorted set without expiry, got %v %v", at, exists)
+	}
+	if ttl, err := store.TTL("book"); ttl != -1 || err != nil {
+		t.Errorf("Expected a TTL of -1, got %v (%v)", ttl, err)
+	}
+	if store.Persist("book") {
+		t.Errorf("Expected PERSIST to find no TTL on a sorted set")
+	}
+
+	if set, err := store.ExpireAt("book", time.Now().Add(-time.Second), ExpireOptions{}); !set || err != nil || store.Type("book") != "none" {
+		t.Errorf("Expected an expiry in the past to delete the sorted set, got %v %v", set, err)
+	}
+}
+
+func TestUnlink(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	store.Set("s", "v", time.Hour)
+	store.HSet("h", "f", "v")
+	for i := 0; i < 1000; i++ {
+		store.ZAdd("book", float64(i), strconv.Itoa(i))
+	}
+
+	if n := store.Unlink("s", "h", "book", "book", "missing"); n != 3 {
+		t.Errorf("Expected 3 keys to be unlinked, got %d", n)
+	}
+	for _, key := range []string{"s", "h", "book"} {
+		if typ := store.Type(key); typ != "none" {
+			t.Errorf("Expected %s to be gone, got a %s", key, typ)
+		}
+	}
+	if store.Stats().TotalKeys != 0 {
+		t.Errorf("Expected no keys, got %d", store.Stats().TotalKeys)
+	}
+
+	// The sorted set is released in the background
+	deadline := time.Now().Add(time.Second)
+	for store.UsedMemory() != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if store.UsedMemory() != 0 {
+		t.Errorf("Expected accounting to return to zero, got %d bytes", store.UsedMemory())
+	}
+}
+
+func TestRenameAndCopy(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	store.Set("a", "1", time.Hour)
+	store.ZAdd("z", 2, "m")
+	store.Set("b", "2", 0)
+
+	if _, err := store.Rename("missing", "x", false); !errors.Is(err, ErrNoSuchKey) {
+		t.Errorf("Expected ErrNoSuchKey, got %v", err)
+	}
+	if renamed, _ := store.Rename("a", "b", true); renamed {
+		t.Errorf("Expected RENAMENX not to replace a key")
+	}
+	if renamed, err := store.Rename("a", "b", false); err != nil || !renamed {
+		t.Fatalf("Expected RENAME to replace a key, got %v", err)
+	}
+	if value, _ := store.Get("b"); value != "1" || store.Exists("a") {
+		t.Errorf("Expected the value to move, got %v", value)
+	}
+	if ttl, _ := store.TTL("b"); ttl <= 0 {
+		t.Errorf("Expected the TTL to move with the value, got %v", ttl)
+	}
+	store.Rename("z", "b", false)
+	if score, _ := store.ZScore("b", "m"); score != 2 || store.Type("b") != "zset" || store.Type("z") != "none" {
+		t.Errorf("Expected the sorted set to replace the string")
+	}
+	if store.DBSize() != 1 {
+		t.Errorf("Expected a single key, got %d", store.DBSize())
+	}
+
+	store.RPush("l", "x")
+	db1 := mustSelect(t, store, 1)
+	if copied, err := store.Copy("l", "l", 1, false); err != nil || !copied {
+		t.Fatalf("Expected COPY to another database, got %v", err)
+	}
+	store.RPush("l", "y")
+	if values, _ := db1.LRange("l", 0, -1); len(values) != 1 {
+		t.Errorf("Expected the copy to be independent, got %v", values)
+	}
+	if copied, _ := store.Copy("l", "b", 0, false); copied {
+		t.Errorf("Expected COPY not to replace a key without REPLACE")
+	}
+	if copied, _ := store.Copy("l", "b", 0, true); !copied || store.Type("b") != "list" {
+		t.Errorf("Expected COPY REPLACE to replace a sorted set")
+	}
+	if _, err := store.Copy("l", "l", 0, false); !errors.Is(err, ErrSameDB) {
+		t.Errorf("Expected ErrSameDB, got %v", err)
+	}
+}
+
+func TestDumpRestore(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	store.Set("s", "v", 0)
+	store.RPush("l", "a", "b")
+	store.HSet("h", "f", "v")
+	store.SAdd("set", "m")
+	store.ZAdd("z", 1.5, "m")
+	store.BFAdd("bf", "x")
+	store.TDigestCreate("td", 0)
+	store.TDigestAdd("td", 1, 2, 3)
+	store.MoneySet("acct", "10.50", 2)
+
+	for _, key := range []string{"s", "l", "h", "set", "z", "bf", "td", "acct"} {
+		payload, exists, err := store.Dump(key)
+		if err != nil || !exists {
+			t.Fatalf("Expected to dump %s: %v", key, err)
+		}
+		if err := store.Restore(key, payload, RestoreOptions{}); !errors.Is(err, ErrBusyKey) {
+			t.Errorf("Expected ErrBusyKey for %s, got %v", key, err)
+		}
+		if err := store.Restore(key+":copy", payload, RestoreOptions{ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+			t.Fatalf("Expected to restore %s: %v", key, err)
+		}
+		if typ := store.Type(key + ":copy"); typ != store.Type(key) {
+			t.Errorf("Expected the restored %s to be a %s, got %s", key, store.Type(key), typ)
+		}
+	}
+	if values, _ := store.LRange("l:copy", 0, -1); len(values) != 2 || values[1] != "b" {
+		t.Errorf("Expected the list to round trip, got %v", values)
+	}
+	if score, _ := store.ZScore("z:copy", "m"); score != 1.5 {
+		t.Errorf("Expected the sorted set to round trip, got %v", score)
+	}
+	if ttl, _ := store.TTL("s:copy"); ttl <= 0 {
+		t.Errorf("Expected the restored key to expire, got %v", ttl)
+	}
+
+	payload, _, _ := store.Dump("s")
+	corrupt := []byte(payload)
+	corrupt[1] ^= 1
+	if err := store.Restore("x", string(corrupt), RestoreOptions{}); !errors.Is(err, ErrDumpPayload) {
+		t.Errorf("Expected a corrupt payload to fail, got %v", err)
+	}
+	if err := store.Restore("s", payload, RestoreOptions{Replace: true, ExpiresAt: time.Now().Add(-time.Second)}); err != nil || store.Exists("s") {
+		t.Errorf("Expected an expired restore to delete the key, got %v", err)
+	}
+}
+
+func TestRestoreRejectsForgedLengths(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	// forge returns a DUMP payload of body with a valid version and checksum
+	forge := func(body ...[]byte) string {
+		var b []byte
+		for _, part := range body {
+			b = append(b, part...)
+		}
+		b = binary.LittleEndian.AppendUint16(b, dumpVersion)
+		return string(binary.LittleEndian.AppendUint64(b, crc64.Checksum(b, crcTable)))
+	}
+	huge := binary.AppendUvarint(nil, 1<<31-1)
+	payloads := map[string]string{
+		"string": forge([]byte{valueString}, huge, []byte("x")),
+		"list":   forge([]byte{valueList}, huge, []byte{0}),
+		"bloom": forge([]byte{valueBloom}, make([]byte, 8), []byte{2, 0, 1},
+			binary.AppendUvarint(nil, 1<<32), []byte{7, 2, 0}),
+		"cuckoo": forge([]byte{valueCuckoo, 4, 20, 1, 1}, binary.AppendUvarint(nil, 1<<26), []byte{0}),
+	}
+
+	for name, payload := range payloads {
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		err := store.Restore(name, payload, RestoreOptions{})
+		runtime.ReadMemStats(&after)
+
+		if !errors.Is(err, ErrDumpPayload) {
+			t.Errorf("Expected a forged %s to fail with ErrDumpPayload, got %v", name, err)
+		}
+		if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+			t.Errorf("Expected a forged %s not to allocate, allocated %d bytes", name, allocated)
+		}
+	}
+}
+
+func TestKeyCommandsPersist(t *testing.T) {
+	cfg := aofConfig(t.TempDir())
+	store := NewStore(cfg)
+	store.Set("a", "1", time.Hour)
+	store.ZAdd("z", 3, "m")
+	if err := store.SaveSnapshot(); err != nil {
+		t.Fatalf("Expected no error when saving snapshot: %v", err)
+	}
+	store.Rename("a", "b", false)
+	store.Persist("b")
+	store.Copy("z", "z2", 1, false)
+	payload, _, _ := store.Dump("z")
+	store.Restore("z3", payload, RestoreOptions{})
+	store.Del("z")
+	store.Close()
+
+	restored := NewStore(cfg)
+	defer restored.Close()
+
+	if value, _ := restored.Get("b"); value != "1" || restored.Exists("a") {
+		t.Errorf("Expected RENAME to be replayed, got %v", value)
+	}
+	if ttl, _ := restored.TTL("b"); ttl != -1 {
+		t.Errorf("Expected PERSIST to be replayed, got %v", ttl)
+	}
+	if score, _ := mustSelect(t, restored, 1).ZScore("z2", "m"); score != 3 {
+		t.Errorf("Expected COPY to another database to be replayed")
+	}
+	if score, _ := restored.ZScore("z3", "m"); score != 3 || restored.Type("z") != "none" {
+		t.Errorf("Expected RESTORE and DEL of a sorted set to be replayed")
+	}
+}
@@ -0,0 +1,221 @@
+package store
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultLedgerJournal is the stream transfers are journaled to when
+	// LedgerTransfer.Journal is empty.
+	DefaultLedgerJournal = "ledger:journal"
+
+	ledgerIdempotencyPrefix     = "ledger:idempotency:"
+	defaultLedgerIdempotencyTTL = 24 * time.Hour
+)
+
+var (
+	ErrInsufficientFunds   = errors.New("INSUFFICIENTFUNDS Source balance is lower than the transfer amount")
+	ErrSameAccount         = errors.New("source and destination accounts must differ")
+	ErrNonPositiveAmount   = errors.New("amount must be positive")
+	ErrScaleMismatch       = errors.New("accounts have different scales")
+	ErrIdempotencyConflict = errors.New("idempotency key was already used for a different transfer")
+)
+
+// LedgerTransfer describes a transfer between two money keys.
+type LedgerTransfer struct {
+	From           string
+	To             string
+	Amount         string
+	IdempotencyKey string // required; a retry with the same key is not applied twice
+	Journal        string // stream the transfer is recorded in, DefaultLedgerJournal if empty
+}
+
+// LedgerReceipt is the outcome of a transfer.
+type LedgerReceipt struct {
+	EntryID     string  // ID of the journal entry
+	FromBalance Decimal // balances right after the transfer
+	ToBalance   Decimal
+	Duplicate   bool // the idempotency key was seen before and nothing was applied
+}
+
+// LedgerTransfer atomically moves t.Amount from the balance at t.From to the
+// one at t.To, which must have the same scale; a missing destination is
+// created. The source may not go below zero. The transfer is journaled as a
+// stream entry and its receipt is kept under the idempotency key for the
+// configured TTL: retrying with the same key returns the original receipt
+// with Duplicate set, while reusing it for a different transfer fails with
+// ErrIdempotencyConflict.
+//
+// Balances, journal and receipt change together under the locks of all four
+// keys, and the log records the transfer as one command, so a crash cannot
+// leave debits and credits out of balance.
+func (s *Store) LedgerTransfer(t LedgerTransfer) (LedgerReceipt, error) {
+	if t.Journal == "" {
+		t.Journal = DefaultLedgerJournal
+	}
+	if t.IdempotencyKey == "" {
+		return LedgerReceipt{}, errors.New("idempotency key is required")
+	}
+
+	unlock := s.lockKeys(t.From, t.To, t.Journal, ledgerIdempotencyPrefix+t.IdempotencyKey)
+	defer unlock()
+
+	now := time.Now()
+	return s.ledgerTransfer(t, "*", now.Add(s.ledgerIdempotencyTTL()), now)
+}
+
+func (s *Store) ledgerIdempotencyTTL() time.Duration {
+	if s.config.LedgerIdempotencyTTL > 0 {
+		return s.config.LedgerIdempotencyTTL
+	}
+	return defaultLedgerIdempotencyTTL
+}
+
+// ledgerTransfer implements LedgerTransfer with the journal entry ID and
+// receipt expiry given, so replay reproduces them. The caller must hold the
+// shard locks of all the keys involved.
+func (s *Store) ledgerTransfer(t LedgerTransfer, entryID string, receiptExpiresAt, now time.Time) (LedgerReceipt, error) {
+	if t.From == t.To {
+		return LedgerReceipt{}, ErrSameAccount
+	}
+
+	receiptKey := ledgerIdempotencyPrefix + t.IdempotencyKey
+	receiptShard := s.shardFor(receiptKey)
+	if receipt, ok, err := s.ledgerReceipt(receiptShard, receiptKey, t); ok || err != nil {
+		return receipt, err
+	}
+
+	fromShard, toShard := s.shardFor(t.From), s.shardFor(t.To)
+	fromBalance, fromItem, err := s.writeMoney(fromShard, t.From)
+	if err != nil {
+		return LedgerReceipt{}, err
+	}
+	toBalance, toItem, err := s.writeMoney(toShard, t.To)
+	if err != nil {
+		return LedgerReceipt{}, err
+	}
+	if toItem == nil {
+		toBalance.scale = fromBalance.scale
+	}
+	if fromBalance.scale != toBalance.scale {
+		return LedgerReceipt{}, ErrScaleMismatch
+	}
+
+	amount, err := ParseDecimal(t.Amount, fromBalance.Scale())
+	if err != nil {
+		return LedgerReceipt{}, err
+	}
+	if amount.units <= 0 {
+		return LedgerReceipt{}, ErrNonPositiveAmount
+	}
+	if fromBalance.Cmp(amount) < 0 {
+		return LedgerReceipt{}, ErrInsufficientFunds
+	}
+	credited, ok := toBalance.add(amount)
+	if !ok {
+		return LedgerReceipt{}, ErrIncrOverflow
+	}
+	debit, _ := amount.neg()
+	fromBalance, _ = fromBalance.add(debit)
+	toBalance = credited
+
+	journalShard := s.shardFor(t.Journal)
+	journalItem, journal, err := s.writeStream(journalShard, t.Journal)
+	if err != nil {
+		return LedgerReceipt{}, err
+	}
+	if journal == nil {
+		journal = newStream()
+	}
+	id, err := journal.nextID(entryID, now)
+	if err != nil {
+		return LedgerReceipt{}, err
+	}
+	entry := StreamEntry{ID: id, Fields: []string{
+		"from", t.From, "to", t.To, "amount", amount.String(),
+		"idempotency_key", t.IdempotencyKey,
+		"from_balance", fromBalance.String(), "to_balance", toBalance.String(),
+	}}
+
+	receipt := LedgerReceipt{EntryID: id.String(), FromBalance: fromBalance, ToBalance: toBalance}
+	record := map[string]interface{}{
+		"from": t.From, "to": t.To, "amount": amount.String(), "journal": t.Journal,
+		"entry": receipt.EntryID, "from_balance": fromBalance.String(), "to_balance": toBalance.String(),
+	}
+
+	// Reserve the growth of every key at once, so the transfer is all or
+	// nothing under maxmemory. Eviction may pick the destination or journal
+	// if they share a shard with the source; give up rather than write to
+	// an item that is gone.
+	growth := streamEntrySize(entry) + itemSize(receiptKey, record)
+	if journalItem == nil {
+		growth += itemSize(t.Journal, journal)
+	}
+	if toItem == nil {
+		growth += itemSize(t.To, toBalance)
+	}
+	if err := s.reserveMemory(fromShard, t.From, growth); err != nil {
+		return LedgerReceipt{}, err
+	}
+	if toItem != nil && toShard.data[t.To] != toItem || journalItem != nil && journalShard.data[t.Journal] != journalItem {
+		return LedgerReceipt{}, ErrOutOfMemory
+	}
+
+	fromItem.Value, fromItem.UpdatedAt = fromBalance, now
+	if toItem == nil {
+		s.set(toShard, t.To, toBalance, nil)
+	} else {
+		toItem.Value, toItem.UpdatedAt = toBalance, now
+	}
+	s.appendEntry(journalShard, t.Journal, journalItem, journal, entry)
+	if now.Before(receiptExpiresAt) {
+		s.set(receiptShard, receiptKey, record, &receiptExpiresAt)
+	}
+
+	s.propagate("LEDGER.TRANSFER", t.From, t.To, amount.String(), t.IdempotencyKey, t.Journal,
+		receipt.EntryID, formatUnixMilli(receiptExpiresAt))
+	s.notify(notifyString, "ledger.transfer", t.From)
+	s.notify(notifyString, "ledger.transfer", t.To)
+	s.notify(notifyStream, "xadd", t.Journal)
+	return receipt, nil
+}
+
+// ledgerReceipt returns the receipt kept for the idempotency key of t and
+// whether there was one. The caller must hold sh.mu.
+func (s *Store) ledgerReceipt(sh *shard, key string, t LedgerTransfer) (LedgerReceipt, bool, error) {
+	item, exists := sh.data[key]
+	if !exists || item.ExpiresAt != nil && time.Now().After(*item.ExpiresAt) {
+		return LedgerReceipt{}, false, nil
+	}
+	record, ok := item.Value.(map[string]interface{})
+	if !ok {
+		return LedgerReceipt{}, false, ErrWrongType
+	}
+	if record["from"] != t.From || record["to"] != t.To || record["journal"] != t.Journal {
+		return LedgerReceipt{}, false, ErrIdempotencyConflict
+	}
+
+	// The amount was recorded at the scale of the accounts; compare at that
+	// scale, so "5" matches "5.00"
+	recorded, _ := record["amount"].(string)
+	_, frac, _ := strings.Cut(recorded, ".")
+	scale := len(frac)
+	original, err := ParseDecimal(recorded, scale)
+	if err != nil {
+		return LedgerReceipt{}, false, ErrIdempotencyConflict
+	}
+	if amount, err := ParseDecimal(t.Amount, scale); err != nil || amount != original {
+		return LedgerReceipt{}, false, ErrIdempotencyConflict
+	}
+
+	receipt := LedgerReceipt{Duplicate: true}
+	receipt.EntryID, _ = record["entry"].(string)
+	fromBalance, _ := record["from_balance"].(string)
+	toBalance, _ := record["to_balance"].(string)
+	receipt.FromBalance, _ = ParseDecimal(fromBalance, scale)
+	receipt.ToBalance, _ = ParseDecimal(toBalance, scale)
+	s.stats.recordLookup(true)
+	return receipt, true, nil
+}
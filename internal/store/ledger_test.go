@@ -0,0 +1,131 @@
+package store
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/chaitanyayendru/fincache/internal/config"
+)
+
+func TestLedgerTransfer(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	store.MoneySet("alice", "100", 2)
+	receipt, err := store.LedgerTransfer(LedgerTransfer{From: "alice", To: "bob", Amount: "30.5", IdempotencyKey: "t1"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if receipt.FromBalance.String() != "69.50" || receipt.ToBalance.String() != "30.50" || receipt.Duplicate {
+		t.Errorf("Unexpected receipt %+v", receipt)
+	}
+	if d, _, _ := store.MoneyGet("bob"); d.String() != "30.50" {
+		t.Errorf("Expected the missing destination to be created with 30.50, got %s", d)
+	}
+
+	entries, _ := store.XRange(DefaultLedgerJournal, "-", "+", 0)
+	if len(entries) != 1 || entries[0].ID.String() != receipt.EntryID {
+		t.Fatalf("Expected one journal entry %s, got %v", receipt.EntryID, entries)
+	}
+	if fields := entries[0].Fields; fields[1] != "alice" || fields[3] != "bob" || fields[5] != "30.50" {
+		t.Errorf("Unexpected journal entry %v", fields)
+	}
+
+	// Retrying returns the original receipt without moving money again
+	retry, err := store.LedgerTransfer(LedgerTransfer{From: "alice", To: "bob", Amount: "30.50", IdempotencyKey: "t1"})
+	if err != nil || !retry.Duplicate || retry.EntryID != receipt.EntryID || retry.FromBalance != receipt.FromBalance {
+		t.Errorf("Expected the original receipt, got %+v (%v)", retry, err)
+	}
+	if d, _, _ := store.MoneyGet("alice"); d.String() != "69.50" {
+		t.Errorf("Expected the retry to leave 69.50, got %s", d)
+	}
+	if _, err := store.LedgerTransfer(LedgerTransfer{From: "alice", To: "bob", Amount: "1", IdempotencyKey: "t1"}); !errors.Is(err, ErrIdempotencyConflict) {
+		t.Errorf("Expected ErrIdempotencyConflict, got %v", err)
+	}
+
+	tests := []struct {
+		transfer LedgerTransfer
+		err      error
+	}{
+		{LedgerTransfer{From: "alice", To: "bob", Amount: "69.51", IdempotencyKey: "t2"}, ErrInsufficientFunds},
+		{LedgerTransfer{From: "alice", To: "alice", Amount: "1", IdempotencyKey: "t3"}, ErrSameAccount},
+		{LedgerTransfer{From: "alice", To: "bob", Amount: "0", IdempotencyKey: "t4"}, ErrNonPositiveAmount},
+		{LedgerTransfer{From: "alice", To: "bob", Amount: "0.001", IdempotencyKey: "t5"}, ErrDecimalPrecision},
+		{LedgerTransfer{From: "alice", To: "euro", Amount: "1", IdempotencyKey: "t6"}, ErrScaleMismatch},
+	}
+	store.MoneySet("euro", "0", 4)
+	for _, tt := range tests {
+		if _, err := store.LedgerTransfer(tt.transfer); !errors.Is(err, tt.err) {
+			t.Errorf("LedgerTransfer(%+v) = %v, want %v", tt.transfer, err, tt.err)
+		}
+	}
+	if n, _ := store.XLen(DefaultLedgerJournal); n != 1 {
+		t.Errorf("Expected failed transfers not to be journaled, got %d entries", n)
+	}
+}
+
+func TestLedgerTransferConserves(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	accounts := []string{"a", "b", "c"}
+	for _, account := range accounts {
+		store.MoneySet(account, "10", 2)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 300; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			store.LedgerTransfer(LedgerTransfer{
+				From:           accounts[i%3],
+				To:             accounts[(i+1)%3],
+				Amount:         "0.75",
+				IdempotencyKey: strconv.Itoa(i),
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	var total int64
+	for _, account := range accounts {
+		d, _, _ := store.MoneyGet(account)
+		if d.Units() < 0 {
+			t.Errorf("Expected %s not to go negative, got %s", account, d)
+		}
+		total += d.Units()
+	}
+	if total != 3000 {
+		t.Errorf("Expected debits to equal credits, total is %d units", total)
+	}
+}
+
+func TestLedgerTransferPersists(t *testing.T) {
+	cfg := aofConfig(t.TempDir())
+	store := NewStore(cfg)
+	store.MoneySet("alice", "5", -1)
+	receipt, err := store.LedgerTransfer(LedgerTransfer{From: "alice", To: "bob", Amount: "2", IdempotencyKey: "k", Journal: "audit"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	store.Close()
+
+	restored := NewStore(cfg)
+	defer restored.Close()
+
+	a, _, _ := restored.MoneyGet("alice")
+	b, _, _ := restored.MoneyGet("bob")
+	if a.String() != "3.00" || b.String() != "2.00" {
+		t.Errorf("Expected balances 3.00 and 2.00 after replay, got %s and %s", a, b)
+	}
+	if entries, _ := restored.XRange("audit", "-", "+", 0); len(entries) != 1 || entries[0].ID.String() != receipt.EntryID {
+		t.Errorf("Expected the journal entry %s after replay, got %v", receipt.EntryID, entries)
+	}
+	retry, err := restored.LedgerTransfer(LedgerTransfer{From: "alice", To: "bob", Amount: "2", IdempotencyKey: "k", Journal: "audit"})
+	if err != nil || !retry.Duplicate {
+		t.Errorf("Expected the idempotency key to survive a restart, got %+v (%v)", retry, err)
+	}
+}
@@ -0,0 +1,129 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+// The LFU policies rank keys by a logarithmic access counter kept in
+// Item.freq and SortedSet.freq, modelled on Redis: the counter saturates at
+// 255, each access increments it with probability
+// 1/((counter-lfuInitVal)*logFactor+1), and it is decremented by one for
+// every LFUDecayTime the key goes unread. New keys start at lfuInitVal so they
+// get a chance to accumulate hits before they are considered for eviction.
+const (
+	lfuInitVal = 5
+	lfuMaxVal  = 255
+
+	defaultLFULogFactor = 10
+	defaultLFUDecayTime = time.Minute
+)
+
+// ErrLFUNotSelected is returned by ObjectFreq when access frequencies are not
+// being tracked.
+var ErrLFUNotSelected = errors.New("An LFU maxmemory policy is not selected, access frequency not tracked")
+
+func isLFUPolicy(policy string) bool {
+	return policy == PolicyAllKeysLFU || policy == PolicyVolatileLFU
+}
+
+// lfuLogIncr increments counter with a probability that shrinks as it grows.
+func lfuLogIncr(counter uint32, logFactor int) uint32 {
+	if counter >= lfuMaxVal {
+		return lfuMaxVal
+	}
+
+	base := float64(counter) - lfuInitVal
+	if base < 0 {
+		base = 0
+	}
+	if rand.Float64() < 1/(base*float64(logFactor)+1) {
+		counter++
+	}
+	return counter
+}
+
+// lfuSeed estimates the counter of an item from its raw access count, e.g.
+// for keys restored from a snapshot. Climbing from lfuInitVal to c takes about
+// logFactor*(c-lfuInitVal)²/2 accesses.
+func lfuSeed(accessCount int64, logFactor int) uint32 {
+	if accessCount <= 0 {
+		return lfuInitVal
+	}
+	counter := lfuInitVal + math.Sqrt(2*float64(accessCount)/float64(logFactor))
+	return uint32(min(counter, lfuMaxVal))
+}
+
+// lfuCounter returns the counter of item after applying the decay for the
+// time since it was last accessed. It does not modify the item.
+func (s *Store) lfuCounter(item *Item, now time.Time) uint32 {
+	return s.lfuDecay(&item.freq, &item.accessedAt, now)
+}
+
+// zsetLFUCounter is lfuCounter for a sorted set.
+func (s *Store) zsetLFUCounter(ss *SortedSet, now time.Time) uint32 {
+	return s.lfuDecay(&ss.freq, &ss.accessedAt, now)
+}
+
+func (s *Store) lfuDecay(freq *uint32, accessedAt *int64, now time.Time) uint32 {
+	counter := atomic.LoadUint32(freq)
+	if s.lfuDecayTime <= 0 {
+		return counter
+	}
+
+	periods := now.Sub(time.Unix(0, atomic.LoadInt64(accessedAt))) / s.lfuDecayTime
+	if periods <= 0 {
+		return counter
+	}
+	if int64(periods) >= int64(counter) {
+		return 0
+	}
+	return counter - uint32(periods)
+}
+
+// touch records a read of item. It runs under the shard read lock, so the
+// counters are updated atomically.
+func (s *Store) touch(item *Item) {
+	s.recordAccess(&item.freq, &item.accessedAt)
+	atomic.AddInt64(&item.AccessCount, 1)
+}
+
+// touchZSet records a read or write of the sorted set ss.
+func (s *Store) touchZSet(ss *SortedSet) {
+	s.recordAccess(&ss.freq, &ss.accessedAt)
+}
+
+func (s *Store) recordAccess(freq *uint32, accessedAt *int64) {
+	now := time.Now()
+
+	atomic.StoreUint32(freq, lfuLogIncr(s.lfuDecay(freq, accessedAt, now), s.lfuLogFactor))
+	atomic.StoreInt64(accessedAt, now.UnixNano())
+}
+
+// ObjectFreq returns the decayed access frequency counter of key, as reported
+// by OBJECT FREQ. It does not count as an access.
+func (s *Store) ObjectFreq(key string) (int, error) {
+	if !isLFUPolicy(s.evictionPolicy) {
+		return 0, ErrLFUNotSelected
+	}
+
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	now := time.Now()
+	if ss, exists := sh.sortedSets[key]; exists {
+		return int(s.zsetLFUCounter(ss, now)), nil
+	}
+
+	item, exists := sh.data[key]
+	if !exists || (item.ExpiresAt != nil && now.After(*item.ExpiresAt)) {
+		return 0, fmt.Errorf("key not found: %s", key)
+	}
+
+	return int(s.lfuCounter(item, now)), nil
+}
@@ -0,0 +1,107 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/chaitanyayendru/fincache/internal/config"
+)
+
+func TestLFULogIncrSaturates(t *testing.T) {
+	counter := uint32(lfuInitVal)
+	for i := 0; i < 1000; i++ {
+		counter = lfuLogIncr(counter, 0)
+	}
+	if counter != lfuMaxVal {
+		t.Errorf("Expected counter to saturate at %d, got %d", lfuMaxVal, counter)
+	}
+
+	counter = lfuInitVal
+	for i := 0; i < 1000; i++ {
+		counter = lfuLogIncr(counter, defaultLFULogFactor)
+	}
+	if counter <= lfuInitVal || counter >= 30 {
+		t.Errorf("Expected logarithmic growth after 1000 hits, got %d", counter)
+	}
+}
+
+func TestLFUDecay(t *testing.T) {
+	store := NewStore(config.StoreConfig{EvictionPolicy: PolicyAllKeysLFU, LFUDecayTime: time.Minute})
+	defer store.Close()
+
+	now := time.Now()
+	item := &Item{accessedAt: now.Add(-3 * time.Minute).UnixNano(), freq: 10}
+	if got := store.lfuCounter(item, now); got != 7 {
+		t.Errorf("Expected counter to decay to 7, got %d", got)
+	}
+
+	item.accessedAt = now.Add(-time.Hour).UnixNano()
+	if got := store.lfuCounter(item, now); got != 0 {
+		t.Errorf("Expected counter to decay to 0, got %d", got)
+	}
+}
+
+func TestObjectFreq(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	store.Set("key", "value", 0)
+	if _, err := store.ObjectFreq("key"); !errors.Is(err, ErrLFUNotSelected) {
+		t.Errorf("Expected ErrLFUNotSelected under LRU, got %v", err)
+	}
+
+	store = NewStore(config.StoreConfig{EvictionPolicy: PolicyAllKeysLFU})
+	defer store.Close()
+
+	store.Set("key", "value", 0)
+	if freq, err := store.ObjectFreq("key"); err != nil || freq != lfuInitVal {
+		t.Errorf("Expected new key to start at %d, got %d (%v)", lfuInitVal, freq, err)
+	}
+	for i := 0; i < 100; i++ {
+		store.Get("key")
+	}
+	if freq, _ := store.ObjectFreq("key"); freq <= lfuInitVal {
+		t.Errorf("Expected reads to raise the counter, got %d", freq)
+	}
+	if _, err := store.ObjectFreq("missing"); err == nil {
+		t.Error("Expected error for missing key")
+	}
+}
+
+func TestAllKeysLFUKeepsHotKeys(t *testing.T) {
+	store := NewStore(config.StoreConfig{
+		MaxMemory:       "4KB",
+		EvictionPolicy:  PolicyAllKeysLFU,
+		EvictionSamples: 10,
+	})
+	defer store.Close()
+
+	store.Set("reference", "value", 0)
+	for i := 0; i < 500; i++ {
+		store.Get("reference")
+	}
+
+	for i := 0; i < 200; i++ {
+		if err := store.Set(fmt.Sprintf("quote%d", i), "value", 0); err != nil {
+			t.Fatalf("Expected eviction instead of error: %v", err)
+		}
+	}
+
+	if !store.Exists("reference") {
+		t.Error("Expected frequently read key to survive eviction")
+	}
+	if store.Stats().Evictions == 0 {
+		t.Error("Expected evictions to be counted")
+	}
+}
+
+func TestSnapshotSeedsLFUCounter(t *testing.T) {
+	if got := lfuSeed(0, defaultLFULogFactor); got != lfuInitVal {
+		t.Errorf("Expected unread key to start at %d, got %d", lfuInitVal, got)
+	}
+	if got := lfuSeed(1_000_000, defaultLFULogFactor); got != lfuMaxVal {
+		t.Errorf("Expected hot key to saturate, got %d", got)
+	}
+}
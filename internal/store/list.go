@@ -0,0 +1,622 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrWrongType is returned by commands run against a key holding a
+	// different data type.
+	ErrWrongType = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+
+	ErrNoSuchKey       = errors.New("no such key")
+	ErrIndexOutOfRange = errors.New("index out of range")
+)
+
+// ListEnd selects the head (left) or tail (right) of a list.
+type ListEnd int
+
+const (
+	ListLeft ListEnd = iota
+	ListRight
+)
+
+func (e ListEnd) String() string {
+	if e == ListLeft {
+		return "LEFT"
+	}
+	return "RIGHT"
+}
+
+// ParseListEnd parses "LEFT" or "RIGHT" as used by LMOVE.
+func ParseListEnd(s string) (ListEnd, bool) {
+	switch {
+	case strings.EqualFold(s, "LEFT"):
+		return ListLeft, true
+	case strings.EqualFold(s, "RIGHT"):
+		return ListRight, true
+	}
+	return ListLeft, false
+}
+
+// List is the value of a list key: a double-ended queue of strings kept in a
+// ring buffer, so pushes and pops at either end and access by index are O(1).
+// It is guarded by the lock of the shard holding the key.
+type List struct {
+	buf  []string
+	head int
+	n    int
+}
+
+func newList() *List {
+	return &List{}
+}
+
+// Len returns the number of elements.
+func (l *List) Len() int {
+	return l.n
+}
+
+func (l *List) at(i int) string {
+	return l.buf[(l.head+i)%len(l.buf)]
+}
+
+func (l *List) setAt(i int, value string) {
+	l.buf[(l.head+i)%len(l.buf)] = value
+}
+
+func (l *List) grow() {
+	if l.n < len(l.buf) {
+		return
+	}
+	buf := make([]string, max(2*len(l.buf), 8))
+	for i := 0; i < l.n; i++ {
+		buf[i] = l.at(i)
+	}
+	l.buf, l.head = buf, 0
+}
+
+func (l *List) push(end ListEnd, value string) {
+	l.grow()
+	if end == ListLeft {
+		l.head = (l.head - 1 + len(l.buf)) % len(l.buf)
+		l.buf[l.head] = value
+	} else {
+		l.buf[(l.head+l.n)%len(l.buf)] = value
+	}
+	l.n++
+}
+
+func (l *List) pop(end ListEnd) string {
+	var i int
+	if end == ListLeft {
+		i = l.head
+		l.head = (l.head + 1) % len(l.buf)
+	} else {
+		i = (l.head + l.n - 1) % len(l.buf)
+	}
+	value := l.buf[i]
+	l.buf[i] = ""
+	l.n--
+	return value
+}
+
+// index converts a Redis index, negative counting from the tail, to a
+// position, reporting false if it is out of range.
+func (l *List) index(index int) (int, bool) {
+	if index < 0 {
+		index += l.n
+	}
+	return index, index >= 0 && index < l.n
+}
+
+// bounds clamps an inclusive Redis range to the list, reporting false if it
+// is empty.
+func (l *List) bounds(start, stop int) (int, int, bool) {
+	if start < 0 {
+		start += l.n
+	}
+	if stop < 0 {
+		stop += l.n
+	}
+	start = max(start, 0)
+	stop = min(stop, l.n-1)
+	return start, stop, start <= stop
+}
+
+func (l *List) slice(start, stop int) []string {
+	values := make([]string, 0, stop-start+1)
+	for i := start; i <= stop; i++ {
+		values = append(values, l.at(i))
+	}
+	return values
+}
+
+// reset replaces the content with values.
+func (l *List) reset(values []string) {
+	l.buf, l.head, l.n = values, 0, len(values)
+}
+
+func (l *List) clone() *List {
+	c := &List{}
+	if l.n > 0 {
+		c.reset(l.slice(0, l.n-1))
+	}
+	return c
+}
+
+func listElemSize(value string) int64 {
+	return entryOverhead + stringOverhead + int64(len(value))
+}
+
+// resize adjusts the accounted size of item after its value changed in place.
+// The caller must hold the item's shard lock.
+func (s *Store) resize(item *Item, delta int64) {
+	item.size += delta
+	s.usedMemory.Add(delta)
+}
+
+// readList returns the list at key for a read, nil if there is none, and
+// records the lookup. The caller must hold sh.mu for reading.
+func (s *Store) readList(sh *shard, key string) (*List, error) {
+	item, exists := sh.data[key]
+	if exists && item.ExpiresAt != nil && time.Now().After(*item.ExpiresAt) {
+		exists = false
+	}
+	if !exists {
+		if _, isZSet := sh.sortedSets[key]; isZSet {
+			return nil, ErrWrongType
+		}
+		s.stats.recordLookup(false)
+		return nil, nil
+	}
+
+	list, ok := item.Value.(*List)
+	if !ok {
+		return nil, ErrWrongType
+	}
+	s.stats.recordLookup(true)
+	s.touch(item)
+	return list, nil
+}
+
+// writeList returns the item holding the list at key for a write, deleting it
+// first if it has expired. It returns a nil item if there is no list. The
+// caller must hold sh.mu.
+func (s *Store) writeList(sh *shard, key string) (*Item, *List, error) {
+	if _, isZSet := sh.sortedSets[key]; isZSet {
+		return nil, nil, ErrWrongType
+	}
+	item, exists := sh.data[key]
+	if !exists {
+		return nil, nil, nil
+	}
+	if item.ExpiresAt != nil && time.Now().After(*item.ExpiresAt) {
+		s.deleteExpired(sh, key)
+		return nil, nil, nil
+	}
+
+	list, ok := item.Value.(*List)
+	if !ok {
+		return nil, nil, ErrWrongType
+	}
+	s.touch(item)
+	return item, list, nil
+}
+
+// afterListWrite deletes the list at key once it is empty, as Redis never
+// keeps empty lists, and otherwise marks it updated. The caller must hold
+// sh.mu.
+func (s *Store) afterListWrite(sh *shard, key string, item *Item, list *List) {
+	if list.Len() == 0 {
+		s.del(sh, key)
+		s.notify(notifyGeneric, "del", key)
+		return
+	}
+	item.UpdatedAt = time.Now()
+}
+
+// LPush inserts values at the head of the list at key, creating it if needed,
+// and returns the new length.
+func (s *Store) LPush(key string, values ...string) (int, error) {
+	return s.push(ListLeft, key, values)
+}
+
+// RPush appends values to the list at key, creating it if needed, and returns
+// the new length.
+func (s *Store) RPush(key string, values ...string) (int, error) {
+	return s.push(ListRight, key, values)
+}
+
+func (s *Store) push(end ListEnd, key string, values []string) (int, error) {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	item, _, err := s.writeList(sh, key)
+	if err != nil {
+		return 0, err
+	}
+
+	var delta int64
+	if item == nil {
+		delta = itemSize(key, newList())
+	}
+	for _, value := range values {
+		delta += listElemSize(value)
+	}
+	if err := s.reserveMemory(sh, key, delta); err != nil {
+		return 0, err
+	}
+
+	n := s.pushList(sh, end, key, values)
+
+	cmd, event := "RPUSH", "rpush"
+	if end == ListLeft {
+		cmd, event = "LPUSH", "lpush"
+	}
+	s.propagate(append([]string{cmd, key}, values...)...)
+	s.notify(notifyList, event, key)
+	return n, nil
+}
+
+// pushList adds values to the list at key, creating it if needed, wakes the
+// callers blocked on it and returns the new length. The caller must hold
+// sh.mu and have checked the key's type.
+func (s *Store) pushList(sh *shard, end ListEnd, key string, values []string) int {
+	item, exists := sh.data[key]
+	if !exists {
+		s.set(sh, key, newList(), nil)
+		item = sh.data[key]
+	}
+
+	list := item.Value.(*List)
+	var delta int64
+	for _, value := range values {
+		list.push(end, value)
+		delta += listElemSize(value)
+	}
+	s.resize(item, delta)
+	item.UpdatedAt = time.Now()
+
+	sh.signal(key)
+	return list.Len()
+}
+
+// LPop removes and returns up to count elements from the head of the list at
+// key. It returns nil if the key does not exist.
+func (s *Store) LPop(key string, count int) ([]string, error) {
+	return s.pop(ListLeft, key, count)
+}
+
+// RPop removes and returns up to count elements from the tail of the list at
+// key. It returns nil if the key does not exist.
+func (s *Store) RPop(key string, count int) ([]string, error) {
+	return s.pop(ListRight, key, count)
+}
+
+func (s *Store) pop(end ListEnd, key string, count int) ([]string, error) {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	return s.popList(sh, end, key, count)
+}
+
+// popList pops up to count elements from the list at key, logging the pop.
+// The caller must hold sh.mu.
+func (s *Store) popList(sh *shard, end ListEnd, key string, count int) ([]string, error) {
+	item, list, err := s.writeList(sh, key)
+	if err != nil || item == nil {
+		return nil, err
+	}
+	if count <= 0 {
+		return []string{}, nil
+	}
+
+	values := make([]string, 0, min(count, list.Len()))
+	var delta int64
+	for len(values) < count && list.Len() > 0 {
+		value := list.pop(end)
+		values = append(values, value)
+		delta -= listElemSize(value)
+	}
+	s.resize(item, delta)
+
+	cmd, event := "RPOP", "rpop"
+	if end == ListLeft {
+		cmd, event = "LPOP", "lpop"
+	}
+	s.propagate(cmd, key, strconv.Itoa(len(values)))
+	s.notify(notifyList, event, key)
+	s.afterListWrite(sh, key, item, list)
+	return values, nil
+}
+
+// LRange returns the elements of the list at key between start and stop,
+// inclusive; negative indexes count from the tail.
+func (s *Store) LRange(key string, start, stop int) ([]string, error) {
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	list, err := s.readList(sh, key)
+	if err != nil || list == nil {
+		return []string{}, err
+	}
+	start, stop, ok := list.bounds(start, stop)
+	if !ok {
+		return []string{}, nil
+	}
+	return list.slice(start, stop), nil
+}
+
+// LLen returns the length of the list at key, 0 if it does not exist.
+func (s *Store) LLen(key string) (int, error) {
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	list, err := s.readList(sh, key)
+	if err != nil || list == nil {
+		return 0, err
+	}
+	return list.Len(), nil
+}
+
+// LIndex returns the element at index of the list at key and whether there is
+// one.
+func (s *Store) LIndex(key string, index int) (string, bool, error) {
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	list, err := s.readList(sh, key)
+	if err != nil || list == nil {
+		return "", false, err
+	}
+	i, ok := list.index(index)
+	if !ok {
+		return "", false, nil
+	}
+	return list.at(i), true, nil
+}
+
+// LSet replaces the element at index of the list at key.
+func (s *Store) LSet(key string, index int, value string) error {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	return s.lset(sh, key, index, value)
+}
+
+// lset, lrem and ltrim implement the list commands of the same name, logging
+// the write. The caller must hold sh.mu.
+func (s *Store) lset(sh *shard, key string, index int, value string) error {
+	item, list, err := s.writeList(sh, key)
+	if err != nil {
+		return err
+	}
+	if item == nil {
+		return ErrNoSuchKey
+	}
+	i, ok := list.index(index)
+	if !ok {
+		return ErrIndexOutOfRange
+	}
+
+	delta := listElemSize(value) - listElemSize(list.at(i))
+	if err := s.reserveMemory(sh, key, delta); err != nil {
+		return err
+	}
+	list.setAt(i, value)
+	s.resize(item, delta)
+	item.UpdatedAt = time.Now()
+
+	s.propagate("LSET", key, strconv.Itoa(index), value)
+	s.notify(notifyList, "lset", key)
+	return nil
+}
+
+// LRem removes elements equal to value from the list at key: the first count
+// from the head if count is positive, the last -count from the tail if it is
+// negative, and all of them if it is 0. It returns how many were removed.
+func (s *Store) LRem(key string, count int, value string) (int, error) {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	return s.lrem(sh, key, count, value)
+}
+
+func (s *Store) lrem(sh *shard, key string, count int, value string) (int, error) {
+	item, list, err := s.writeList(sh, key)
+	if err != nil || item == nil {
+		return 0, err
+	}
+
+	limit := count
+	if limit < 0 {
+		limit = -limit
+	}
+	values := list.slice(0, list.Len()-1)
+	removed := 0
+	remove := func(i int) bool {
+		if values[i] != value || (limit > 0 && removed == limit) {
+			return false
+		}
+		removed++
+		return true
+	}
+
+	kept := make([]string, 0, len(values))
+	if count < 0 {
+		drop := make([]bool, len(values))
+		for i := len(values) - 1; i >= 0; i-- {
+			drop[i] = remove(i)
+		}
+		for i, v := range values {
+			if !drop[i] {
+				kept = append(kept, v)
+			}
+		}
+	} else {
+		for i, v := range values {
+			if !remove(i) {
+				kept = append(kept, v)
+			}
+		}
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+
+	list.reset(kept)
+	s.resize(item, -int64(removed)*listElemSize(value))
+
+	s.propagate("LREM", key, strconv.Itoa(count), value)
+	s.notify(notifyList, "lrem", key)
+	s.afterListWrite(sh, key, item, list)
+	return removed, nil
+}
+
+// LTrim keeps only the elements of the list at key between start and stop,
+// inclusive.
+func (s *Store) LTrim(key string, start, stop int) error {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	return s.ltrim(sh, key, start, stop)
+}
+
+func (s *Store) ltrim(sh *shard, key string, start, stop int) error {
+	item, list, err := s.writeList(sh, key)
+	if err != nil || item == nil {
+		return err
+	}
+
+	var kept []string
+	if first, last, ok := list.bounds(start, stop); ok {
+		kept = list.slice(first, last)
+	}
+
+	var delta int64
+	for i := 0; i < list.Len(); i++ {
+		delta -= listElemSize(list.at(i))
+	}
+	for _, v := range kept {
+		delta += listElemSize(v)
+	}
+	list.reset(kept)
+	s.resize(item, delta)
+
+	s.propagate("LTRIM", key, strconv.Itoa(start), strconv.Itoa(stop))
+	s.notify(notifyList, "ltrim", key)
+	s.afterListWrite(sh, key, item, list)
+	return nil
+}
+
+// LMove atomically pops an element from one end of the list at source and
+// pushes it to one end of the list at destination, returning the element and
+// whether source had one.
+func (s *Store) LMove(source, destination string, from, to ListEnd) (string, bool, error) {
+	unlock := s.lockKeys(source, destination)
+	defer unlock()
+
+	return s.lmove(source, destination, from, to)
+}
+
+// lmove implements LMove. The caller must hold the shard locks of source and
+// destination.
+func (s *Store) lmove(source, destination string, from, to ListEnd) (string, bool, error) {
+	srcShard, dstShard := s.shardFor(source), s.shardFor(destination)
+
+	srcItem, srcList, err := s.writeList(srcShard, source)
+	if err != nil || srcItem == nil {
+		return "", false, err
+	}
+	dstItem, _, err := s.writeList(dstShard, destination)
+	if err != nil {
+		return "", false, err
+	}
+
+	value := srcList.at(0)
+	if from == ListRight {
+		value = srcList.at(srcList.Len() - 1)
+	}
+	if dstItem == nil && source != destination {
+		if err := s.reserveMemory(dstShard, destination, itemSize(destination, newList())); err != nil {
+			return "", false, err
+		}
+		// Making room may have evicted source when both share a shard
+		if srcShard.data[source] != srcItem {
+			return "", false, ErrOutOfMemory
+		}
+	}
+
+	srcList.pop(from)
+	s.resize(srcItem, -listElemSize(value))
+	s.pushList(dstShard, to, destination, []string{value})
+
+	s.propagate("LMOVE", source, destination, from.String(), to.String())
+	if from == ListLeft {
+		s.notify(notifyList, "lpop", source)
+	} else {
+		s.notify(notifyList, "rpop", source)
+	}
+	if to == ListLeft {
+		s.notify(notifyList, "lpush", destination)
+	} else {
+		s.notify(notifyList, "rpush", destination)
+	}
+	s.afterListWrite(srcShard, source, srcItem, srcList)
+	return value, true, nil
+}
+
+// BLPop pops the head of the first non-empty list among keys, waiting up to
+// timeout (0 for ever) for one of them to receive an element. It returns the
+// key and element, or false if the timeout passed.
+func (s *Store) BLPop(ctx context.Context, keys []string, timeout time.Duration) (string, string, bool, error) {
+	return s.bpop(ctx, ListLeft, keys, timeout)
+}
+
+// BRPop is BLPop for the tail of the lists.
+func (s *Store) BRPop(ctx context.Context, keys []string, timeout time.Duration) (string, string, bool, error) {
+	return s.bpop(ctx, ListRight, keys, timeout)
+}
+
+func (s *Store) bpop(ctx context.Context, end ListEnd, keys []string, timeout time.Duration) (string, string, bool, error) {
+	var key, value string
+	ok, err := s.block(ctx, keys, keys, timeout, func() (bool, error) {
+		for _, k := range keys {
+			values, err := s.popList(s.shardFor(k), end, k, 1)
+			if err != nil {
+				return false, err
+			}
+			if len(values) > 0 {
+				key, value = k, values[0]
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	return key, value, ok, err
+}
+
+// BLMove is LMove that waits up to timeout (0 for ever) for source to
+// receive an element.
+func (s *Store) BLMove(ctx context.Context, source, destination string, from, to ListEnd, timeout time.Duration) (string, bool, error) {
+	var value string
+	ok, err := s.block(ctx, []string{source, destination}, []string{source}, timeout, func() (bool, error) {
+		v, moved, err := s.lmove(source, destination, from, to)
+		value = v
+		return moved, err
+	})
+	return value, ok, err
+}
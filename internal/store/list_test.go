@@ -0,0 +1,305 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chaitanyayendru/fincache/internal/config"
+)
+
+func TestListPushPop(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	if n, err := store.RPush("batch", "b", "c"); err != nil || n != 2 {
+		t.Fatalf("Expected length 2, got %d (%v)", n, err)
+	}
+	if n, _ := store.LPush("batch", "a", "z"); n != 4 {
+		t.Fatalf("Expected length 4, got %d", n)
+	}
+	if values, _ := store.LRange("batch", 0, -1); !reflect.DeepEqual(values, []string{"z", "a", "b", "c"}) {
+		t.Errorf("Expected [z a b c], got %v", values)
+	}
+
+	if values, _ := store.LPop("batch", 0); values == nil || len(values) != 0 {
+		t.Errorf("Expected an empty reply for a count of 0, got %#v", values)
+	}
+	if values, _ := store.LPop("batch", 1); !reflect.DeepEqual(values, []string{"z"}) {
+		t.Errorf("Expected [z], got %v", values)
+	}
+	if values, _ := store.RPop("batch", 5); !reflect.DeepEqual(values, []string{"c", "b", "a"}) {
+		t.Errorf("Expected [c b a], got %v", values)
+	}
+	if store.Exists("batch") {
+		t.Error("Expected empty list to be deleted")
+	}
+	if values, _ := store.LPop("batch", 1); values != nil {
+		t.Errorf("Expected nil for a missing list, got %v", values)
+	}
+	if values, _ := store.LPop("batch", 0); values != nil {
+		t.Errorf("Expected nil for a missing list with a count of 0, got %v", values)
+	}
+	if store.UsedMemory() != 0 || store.Stats().KeysByType["list"] != 0 {
+		t.Errorf("Expected accounting to return to zero, got %d bytes", store.UsedMemory())
+	}
+}
+
+func TestListGrowsAcrossWraparound(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	var want []string
+	for i := 0; i < 50; i++ {
+		v := string(rune('A' + i%26))
+		if i%3 == 0 {
+			store.LPush("q", v)
+			want = append([]string{v}, want...)
+		} else {
+			store.RPush("q", v)
+			want = append(want, v)
+		}
+		if i%7 == 0 {
+			store.LPop("q", 1)
+			want = want[1:]
+		}
+	}
+
+	if values, _ := store.LRange("q", 0, -1); !reflect.DeepEqual(values, want) {
+		t.Errorf("Expected %v, got %v", want, values)
+	}
+	if v, ok, _ := store.LIndex("q", -1); !ok || v != want[len(want)-1] {
+		t.Errorf("Expected last element %q, got %q", want[len(want)-1], v)
+	}
+}
+
+func TestListEditing(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	store.RPush("l", "a", "x", "b", "x", "c", "x")
+
+	if n, _ := store.LRem("l", -2, "x"); n != 2 {
+		t.Errorf("Expected 2 removed, got %d", n)
+	}
+	if values, _ := store.LRange("l", 0, -1); !reflect.DeepEqual(values, []string{"a", "x", "b", "c"}) {
+		t.Errorf("Expected [a x b c], got %v", values)
+	}
+
+	if err := store.LSet("l", 1, "y"); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if err := store.LSet("l", 10, "y"); !errors.Is(err, ErrIndexOutOfRange) {
+		t.Errorf("Expected ErrIndexOutOfRange, got %v", err)
+	}
+	if err := store.LSet("missing", 0, "y"); !errors.Is(err, ErrNoSuchKey) {
+		t.Errorf("Expected ErrNoSuchKey, got %v", err)
+	}
+
+	store.LTrim("l", 1, -2)
+	if values, _ := store.LRange("l", 0, -1); !reflect.DeepEqual(values, []string{"y", "b"}) {
+		t.Errorf("Expected [y b], got %v", values)
+	}
+	if n, _ := store.LLen("l"); n != 2 {
+		t.Errorf("Expected length 2, got %d", n)
+	}
+
+	store.LTrim("l", 5, 10)
+	if store.Exists("l") {
+		t.Error("Expected trimming everything to delete the list")
+	}
+}
+
+func TestListWrongType(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	store.Set("s", "value", 0)
+	store.RPush("l", "a")
+	store.ZAdd("z", 1, "a")
+
+	if _, err := store.LPush("s", "a"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType for a string, got %v", err)
+	}
+	if _, err := store.LLen("z"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType for a sorted set, got %v", err)
+	}
+	if _, err := store.Get("l"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType from Get on a list, got %v", err)
+	}
+}
+
+func TestLMove(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	store.RPush("pending", "a", "b")
+	if v, ok, _ := store.LMove("pending", "done", ListLeft, ListRight); !ok || v != "a" {
+		t.Errorf("Expected to move 'a', got %q", v)
+	}
+	store.LMove("pending", "done", ListLeft, ListLeft)
+	if store.Exists("pending") {
+		t.Error("Expected source to be deleted once empty")
+	}
+	if values, _ := store.LRange("done", 0, -1); !reflect.DeepEqual(values, []string{"b", "a"}) {
+		t.Errorf("Expected [b a], got %v", values)
+	}
+
+	// Rotating a list onto itself
+	store.LMove("done", "done", ListLeft, ListRight)
+	if values, _ := store.LRange("done", 0, -1); !reflect.DeepEqual(values, []string{"a", "b"}) {
+		t.Errorf("Expected [a b], got %v", values)
+	}
+}
+
+func TestLMoveWhenMakingRoomEvictsSource(t *testing.T) {
+	store := NewStore(config.StoreConfig{MaxMemory: "1KB", EvictionPolicy: PolicyAllKeysLRU})
+	defer store.Close()
+
+	// Find a destination that shares the shard of the source
+	destination := "dst"
+	for i := 0; store.shardFor(destination) != store.shardFor("src"); i++ {
+		destination = fmt.Sprintf("dst%d", i)
+	}
+
+	value := strings.Repeat("x", 100)
+	for {
+		if _, err := store.RPush("src", value); err != nil {
+			break
+		}
+	}
+
+	if _, _, err := store.LMove("src", destination, ListLeft, ListRight); !errors.Is(err, ErrOutOfMemory) {
+		t.Errorf("Expected ErrOutOfMemory once the source is evicted, got %v", err)
+	}
+	if store.Exists(destination) {
+		t.Errorf("Expected an evicted source not to hand an element to the destination")
+	}
+	if store.UsedMemory() != 0 {
+		t.Errorf("Expected accounting to return to zero, got %d bytes", store.UsedMemory())
+	}
+}
+
+func TestParseListEnd(t *testing.T) {
+	for input, want := range map[string]ListEnd{"LEFT": ListLeft, "left": ListLeft, "lEfT": ListLeft, "Right": ListRight, "rIGHT": ListRight} {
+		if end, ok := ParseListEnd(input); !ok || end != want {
+			t.Errorf("ParseListEnd(%q) = %v, %v; expected %v", input, end, ok, want)
+		}
+	}
+	if _, ok := ParseListEnd("middle"); ok {
+		t.Error("Expected 'middle' to be rejected")
+	}
+}
+
+func TestBLPopWaitsForPush(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	type result struct {
+		key, value string
+		ok         bool
+	}
+	done := make(chan result)
+	go func() {
+		key, value, ok, _ := store.BLPop(context.Background(), []string{"a", "b"}, 5*time.Second)
+		done <- result{key, value, ok}
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	store.RPush("b", "job")
+
+	select {
+	case r := <-done:
+		if !r.ok || r.key != "b" || r.value != "job" {
+			t.Errorf("Expected b/job, got %+v", r)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected BLPOP to be woken by the push")
+	}
+	if store.Exists("b") {
+		t.Error("Expected the popped list to be deleted")
+	}
+}
+
+func TestBlockingPopTimeout(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	start := time.Now()
+	if _, _, ok, err := store.BRPop(context.Background(), []string{"empty"}, 30*time.Millisecond); ok || err != nil {
+		t.Errorf("Expected timeout, got %v (%v)", ok, err)
+	}
+	if time.Since(start) < 30*time.Millisecond {
+		t.Error("Expected BRPOP to wait for the timeout")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, ok, err := store.BLPop(ctx, []string{"empty"}, 0); ok || !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected cancellation, got %v (%v)", ok, err)
+	}
+
+	sh := store.shardFor("empty")
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	if len(sh.waiters) != 0 {
+		t.Errorf("Expected waiters to be removed, got %v", sh.waiters)
+	}
+}
+
+func TestBLMove(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	done := make(chan string)
+	go func() {
+		v, _, _ := store.BLMove(context.Background(), "in", "out", ListRight, ListLeft, 0)
+		done <- v
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	store.LPush("in", "x")
+
+	select {
+	case v := <-done:
+		if v != "x" {
+			t.Errorf("Expected 'x', got %q", v)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected BLMOVE to be woken by the push")
+	}
+	if values, _ := store.LRange("out", 0, -1); !reflect.DeepEqual(values, []string{"x"}) {
+		t.Errorf("Expected [x], got %v", values)
+	}
+}
+
+func TestListPersistence(t *testing.T) {
+	cfg := aofConfig(t.TempDir())
+
+	store := NewStore(cfg)
+	store.RPush("snap", "a", "b")
+	if err := store.SaveSnapshot(); err != nil {
+		t.Fatalf("Expected no error when saving snapshot: %v", err)
+	}
+	store.RPush("log", "1", "2", "3", "4", "x")
+	store.LPop("log", 1)
+	store.LSet("log", 0, "two")
+	store.LRem("log", 0, "x")
+	store.LTrim("log", 0, 1)
+	store.LMove("snap", "log", ListLeft, ListRight)
+	store.Close()
+
+	restored := NewStore(cfg)
+	defer restored.Close()
+
+	if values, _ := restored.LRange("snap", 0, -1); !reflect.DeepEqual(values, []string{"b"}) {
+		t.Errorf("Expected [b], got %v", values)
+	}
+	if values, _ := restored.LRange("log", 0, -1); !reflect.DeepEqual(values, []string{"two", "3", "a"}) {
+		t.Errorf("Expected [two 3 a], got %v", values)
+	}
+}
@@ -0,0 +1,217 @@
+package store
+
+import (
+	"errors"
+	"time"
+)
+
+// lockFencingPrefix namespaces the keys holding the fencing counters of
+// locks. They outlive the leases and never expire, so tokens keep
+// increasing across leases and restarts; only an allkeys eviction policy
+// can evict them, so use a volatile one or noeviction with locks.
+const lockFencingPrefix = "lock:fencing:"
+
+var (
+	ErrNotLockOwner = errors.New("lock is not held by this owner")
+	ErrInvalidLease = errors.New("lease TTL must be positive")
+)
+
+// LockState is the value of a lock key while its lease lasts. It is stored
+// in Item.Value like the other scalars, with the lease as the key's TTL, so
+// expiry releases the lock.
+type LockState struct {
+	Owner      string    `json:"owner"`
+	Token      int64     `json:"token"` // fencing token of the lease
+	AcquiredAt time.Time `json:"acquired_at"`
+}
+
+// LockResult is the outcome of LockAcquire.
+type LockResult struct {
+	Acquired bool
+	Token    int64         // the fencing token if acquired
+	Owner    string        // the current holder if not
+	TTL      time.Duration // what is left of the holder's lease
+}
+
+// LockAcquire takes the lock at key for owner with a lease of ttl, unless
+// anyone, owner included, holds it; a holder extends its lease with
+// LockRenew instead. Each acquisition gets a fencing token greater than all
+// earlier ones for key, which resources guarded by the lock can use to
+// reject writes from a holder whose lease has run out.
+func (s *Store) LockAcquire(key, owner string, ttl time.Duration) (LockResult, error) {
+	if ttl <= 0 {
+		return LockResult{}, ErrInvalidLease
+	}
+	fencingKey := lockFencingPrefix + key
+
+	unlock := s.lockKeys(key, fencingKey)
+	defer unlock()
+
+	sh := s.shardFor(key)
+	state, item, err := s.writeLock(sh, key)
+	if err != nil {
+		return LockResult{}, err
+	}
+	if item != nil {
+		return LockResult{Owner: state.Owner, TTL: leaseLeft(item)}, nil
+	}
+
+	token, err := s.nextFencingToken(s.shardFor(fencingKey), fencingKey)
+	if err != nil {
+		return LockResult{}, err
+	}
+
+	state = LockState{Owner: owner, Token: token, AcquiredAt: time.Now()}
+	if err := s.reserveMemory(sh, key, itemSize(key, state)); err != nil {
+		return LockResult{}, err
+	}
+	expiresAt := state.AcquiredAt.Add(ttl)
+	s.set(sh, key, state, &expiresAt)
+
+	if s.aof != nil {
+		payload, err := marshalValue(state)
+		if err != nil {
+			return LockResult{}, err
+		}
+		s.propagate("SET", key, payload, "PXAT", formatUnixMilli(expiresAt))
+	}
+	s.notify(notifyString, "lock.acquire", key)
+	return LockResult{Acquired: true, Token: token, Owner: owner, TTL: ttl}, nil
+}
+
+// nextFencingToken increments the fencing counter at key and returns it. The
+// caller must hold sh.mu.
+func (s *Store) nextFencingToken(sh *shard, key string) (int64, error) {
+	if _, isZSet := sh.sortedSets[key]; isZSet {
+		return 0, ErrWrongType
+	}
+	var token int64
+	if item, exists := sh.data[key]; exists {
+		n, ok := item.Value.(int64)
+		if !ok {
+			return 0, ErrWrongType
+		}
+		token = n
+	}
+	token++
+
+	delta := itemSize(key, token)
+	if item, exists := sh.data[key]; exists {
+		delta -= item.size
+	}
+	if err := s.reserveMemory(sh, key, delta); err != nil {
+		return 0, err
+	}
+	s.set(sh, key, token, nil)
+
+	if s.aof != nil {
+		payload, err := marshalValue(token)
+		if err != nil {
+			return 0, err
+		}
+		s.propagate("SET", key, payload)
+	}
+	return token, nil
+}
+
+// LockRenew extends the lease of the lock at key to ttl from now, if owner
+// holds it. It fails with ErrNotLockOwner otherwise, including when the
+// lease has already run out.
+func (s *Store) LockRenew(key, owner string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return ErrInvalidLease
+	}
+
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	state, item, err := s.writeLock(sh, key)
+	if err != nil {
+		return err
+	}
+	if item == nil || state.Owner != owner {
+		return ErrNotLockOwner
+	}
+
+	expiresAt := time.Now().Add(ttl)
+	s.expireAt(sh, key, expiresAt)
+	s.propagate("PEXPIREAT", key, formatUnixMilli(expiresAt))
+	s.notify(notifyString, "lock.renew", key)
+	return nil
+}
+
+// LockRelease releases the lock at key if owner holds it, and fails with
+// ErrNotLockOwner otherwise.
+func (s *Store) LockRelease(key, owner string) error {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	state, item, err := s.writeLock(sh, key)
+	if err != nil {
+		return err
+	}
+	if item == nil || state.Owner != owner {
+		return ErrNotLockOwner
+	}
+
+	s.del(sh, key)
+	s.propagate("DEL", key)
+	s.notify(notifyString, "lock.release", key)
+	return nil
+}
+
+// LockInfo returns the state of the lock at key and what is left of its
+// lease, and whether it is held.
+func (s *Store) LockInfo(key string) (LockState, time.Duration, bool, error) {
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	item, exists := sh.data[key]
+	if !exists || item.ExpiresAt != nil && time.Now().After(*item.ExpiresAt) {
+		s.stats.recordLookup(false)
+		return LockState{}, 0, false, nil
+	}
+	state, ok := item.Value.(LockState)
+	if !ok {
+		return LockState{}, 0, false, ErrWrongType
+	}
+	s.stats.recordLookup(true)
+	s.touch(item)
+	return state, leaseLeft(item), true, nil
+}
+
+// leaseLeft returns what is left of the lease of a lock item, -1 if its TTL
+// was removed.
+func leaseLeft(item *Item) time.Duration {
+	if item.ExpiresAt == nil {
+		return -1
+	}
+	return time.Until(*item.ExpiresAt)
+}
+
+// writeLock returns the lock at key for a write along with its item,
+// deleting the key first if its lease has run out. It returns a nil item if
+// the lock is free. The caller must hold sh.mu.
+func (s *Store) writeLock(sh *shard, key string) (LockState, *Item, error) {
+	if _, isZSet := sh.sortedSets[key]; isZSet {
+		return LockState{}, nil, ErrWrongType
+	}
+	item, exists := sh.data[key]
+	if !exists {
+		return LockState{}, nil, nil
+	}
+	if item.ExpiresAt != nil && time.Now().After(*item.ExpiresAt) {
+		s.deleteExpired(sh, key)
+		return LockState{}, nil, nil
+	}
+
+	state, ok := item.Value.(LockState)
+	if !ok {
+		return LockState{}, nil, ErrWrongType
+	}
+	s.touch(item)
+	return state, item, nil
+}
@@ -0,0 +1,83 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/chaitanyayendru/fincache/internal/config"
+)
+
+func TestLockLifecycle(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	first, err := store.LockAcquire("eod", "pod-a", time.Minute)
+	if err != nil || !first.Acquired || first.Token != 1 {
+		t.Fatalf("Expected to acquire with token 1, got %+v (%v)", first, err)
+	}
+	held, _ := store.LockAcquire("eod", "pod-b", time.Minute)
+	if held.Acquired || held.Owner != "pod-a" || held.TTL <= 0 {
+		t.Errorf("Expected the lock to be held by pod-a, got %+v", held)
+	}
+	if again, _ := store.LockAcquire("eod", "pod-a", time.Minute); again.Acquired {
+		t.Errorf("Expected the holder not to acquire twice, got %+v", again)
+	}
+
+	if err := store.LockRenew("eod", "pod-b", time.Hour); !errors.Is(err, ErrNotLockOwner) {
+		t.Errorf("Expected ErrNotLockOwner when renewing, got %v", err)
+	}
+	if err := store.LockRenew("eod", "pod-a", time.Hour); err != nil {
+		t.Errorf("Expected no error when renewing, got %v", err)
+	}
+	if _, ttl, _, _ := store.LockInfo("eod"); ttl <= time.Minute {
+		t.Errorf("Expected the lease to be renewed to an hour, got %v", ttl)
+	}
+
+	if err := store.LockRelease("eod", "pod-b"); !errors.Is(err, ErrNotLockOwner) {
+		t.Errorf("Expected ErrNotLockOwner when releasing, got %v", err)
+	}
+	if err := store.LockRelease("eod", "pod-a"); err != nil {
+		t.Errorf("Expected no error when releasing, got %v", err)
+	}
+	second, _ := store.LockAcquire("eod", "pod-b", time.Minute)
+	if !second.Acquired || second.Token != 2 {
+		t.Errorf("Expected pod-b to acquire with token 2, got %+v", second)
+	}
+}
+
+func TestLockLeaseExpires(t *testing.T) {
+	store := NewStore(config.StoreConfig{TTLEnabled: true, ActiveExpireHz: 50})
+	defer store.Close()
+
+	first, _ := store.LockAcquire("eod", "pod-a", 50*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+
+	if err := store.LockRenew("eod", "pod-a", time.Minute); !errors.Is(err, ErrNotLockOwner) {
+		t.Errorf("Expected an expired lease not to be renewable, got %v", err)
+	}
+	second, _ := store.LockAcquire("eod", "pod-b", time.Minute)
+	if !second.Acquired || second.Token <= first.Token {
+		t.Errorf("Expected a greater fencing token after expiry, got %+v after %d", second, first.Token)
+	}
+}
+
+func TestLockTokensPersist(t *testing.T) {
+	cfg := aofConfig(t.TempDir())
+	store := NewStore(cfg)
+	store.LockAcquire("eod", "pod-a", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	store.LockAcquire("eod", "pod-b", time.Hour)
+	store.Close()
+
+	restored := NewStore(cfg)
+	defer restored.Close()
+
+	if state, _, held, _ := restored.LockInfo("eod"); !held || state.Owner != "pod-b" || state.Token != 2 {
+		t.Errorf("Expected pod-b to hold the lock with token 2 after replay, got %+v", state)
+	}
+	restored.LockRelease("eod", "pod-b")
+	if result, _ := restored.LockAcquire("eod", "pod-c", time.Hour); result.Token != 3 {
+		t.Errorf("Expected tokens to keep increasing after a restart, got %d", result.Token)
+	}
+}
@@ -0,0 +1,346 @@
+package store
+
+import (
+	"errors"
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+// Eviction policies, named after their Redis counterparts.
+const (
+	PolicyNoEviction  = "noeviction"
+	PolicyAllKeysLRU  = "allkeys-lru"
+	PolicyAllKeysLFU  = "allkeys-lfu"
+	PolicyVolatileLRU = "volatile-lru"
+	PolicyVolatileLFU = "volatile-lfu"
+	PolicyVolatileTTL = "volatile-ttl"
+)
+
+// ErrOutOfMemory is returned by writes that would push the store past
+// StoreConfig.MaxMemory when nothing can be evicted.
+var ErrOutOfMemory = errors.New("OOM command not allowed when used memory > 'maxmemory'")
+
+// Rough per-allocation overheads used by the memory estimates below. They do
+// not have to be exact, only proportional to what the Go runtime really uses.
+const (
+	itemOverhead   = 128 // Item struct, map entries in data and ttl, key header
+	stringOverhead = 16
+	sliceOverhead  = 24
+	mapOverhead    = 48
+	entryOverhead  = 16
+	zsetOverhead   = 96  // SortedSet struct and its two maps
+	zmemberSize    = 112 // SortedSetMember plus entries in members and scores
+
+	idempotencyOverhead = 96 // IdempotencyRecord and its string headers
+)
+
+const defaultEvictionSamples = 5
+
+// normalizeEvictionPolicy maps the short names accepted by earlier configs to
+// their full form.
+func normalizeEvictionPolicy(policy string) (string, bool) {
+	switch policy {
+	case "", "lru":
+		return PolicyAllKeysLRU, true
+	case "lfu":
+		return PolicyAllKeysLFU, true
+	case PolicyNoEviction, PolicyAllKeysLRU, PolicyAllKeysLFU, PolicyVolatileLRU, PolicyVolatileLFU, PolicyVolatileTTL:
+		return policy, true
+	default:
+		return PolicyNoEviction, false
+	}
+}
+
+// itemSize estimates the memory held by key and its value.
+func itemSize(key string, value interface{}) int64 {
+	return itemOverhead + int64(len(key)) + valueSize(value)
+}
+
+func valueSize(value interface{}) int64 {
+	switch v := value.(type) {
+	case nil:
+		return 0
+	case string:
+		return stringOverhead + int64(len(v))
+	case bool:
+		return 1
+	case int, int32, int64, float32, float64:
+		return 8
+	case Decimal:
+		return 16
+	case IdempotencyRecord:
+		return idempotencyOverhead + int64(len(v.State)+len(v.Token)+len(v.Fingerprint)+len(v.Body))
+	case LockState:
+		return stringOverhead + int64(len(v.Owner)) + 32
+	case []interface{}:
+		size := int64(sliceOverhead)
+		for _, elem := range v {
+			size += entryOverhead + valueSize(elem)
+		}
+		return size
+	case map[string]interface{}:
+		size := int64(mapOverhead)
+		for k, elem := range v {
+			size += entryOverhead + stringOverhead + int64(len(k)) + valueSize(elem)
+		}
+		return size
+	case *List:
+		size := int64(sliceOverhead)
+		for i := 0; i < v.Len(); i++ {
+			size += listElemSize(v.at(i))
+		}
+		return size
+	case *Hash:
+		size := int64(mapOverhead)
+		for field, value := range v.fields {
+			size += hashFieldSize(field, value)
+		}
+		return size + int64(len(v.expires))*hashTTLSize
+	case *Set:
+		return v.size()
+	case *RateLimiter:
+		return v.size()
+	case *TimeSeries:
+		return v.size()
+	case *BloomFilter:
+		return v.size()
+	case *CuckooFilter:
+		return v.size()
+	case *CountMinSketch:
+		return v.size()
+	case *TopK:
+		return v.size()
+	case *TDigest:
+		return v.size()
+	case *Stream:
+		return v.size()
+	default:
+		return stringOverhead
+	}
+}
+
+func zmemberCost(member string) int64 {
+	return zmemberSize + int64(len(member))
+}
+
+// zgrowth returns how much adding member to the sorted set at key would grow
+// the keyspace. The caller must hold sh.mu.
+func (s *Store) zgrowth(sh *shard, key, member string) int64 {
+	sortedSet, exists := sh.sortedSets[key]
+	if !exists {
+		return zsetOverhead + int64(len(key)) + zmemberCost(member)
+	}
+	if _, exists := sortedSet.ZScore(key, member); exists {
+		return 0
+	}
+	return zmemberCost(member)
+}
+
+// UsedMemory returns the estimated number of bytes held by the keyspace.
+func (s *Store) UsedMemory() int64 {
+	return s.usedMemory.Load()
+}
+
+// MaxMemory returns the configured memory limit in bytes, 0 meaning none.
+func (s *Store) MaxMemory() int64 {
+	return s.maxMemory
+}
+
+// EvictionPolicy returns the active eviction policy.
+func (s *Store) EvictionPolicy() string {
+	return s.evictionPolicy
+}
+
+// reserveMemory makes room for a write that grows the keyspace by delta bytes,
+// evicting keys according to the policy. The key being written is never
+// picked. The caller must hold sh.mu for the shard of key.
+func (s *Store) reserveMemory(sh *shard, key string, delta int64) error {
+	if s.maxMemory <= 0 || delta <= 0 {
+		return nil
+	}
+
+	for s.usedMemory.Load()+delta > s.maxMemory {
+		if !s.evictOne(sh, key) {
+			return ErrOutOfMemory
+		}
+	}
+	return nil
+}
+
+// evictionCandidate is the best key to evict found so far by sampling.
+type evictionCandidate struct {
+	sh    *shard
+	key   string
+	score float64 // lower scores are evicted first
+}
+
+// evictOne samples keys across the shards of every database, starting from a
+// random one, evicts the best candidate under the policy and reports whether
+// it found one. Memory is shared by all databases, so the victim may live in
+// a different database than the write that needs the room. held is
+// the shard the caller has locked; other shards are only sampled if their
+// lock is free, so two writers that evict at the same time cannot deadlock.
+func (s *Store) evictOne(held *shard, exclude string) bool {
+	if s.evictionPolicy == PolicyNoEviction {
+		return false
+	}
+
+	samples := s.config.EvictionSamples
+	if samples <= 0 {
+		samples = defaultEvictionSamples
+	}
+
+	var (
+		best   *evictionCandidate
+		locked []*shard
+		now    = time.Now()
+		start  = rand.Intn(len(s.allShards))
+	)
+	for i := 0; i < len(s.allShards) && samples > 0; i++ {
+		sh := s.allShards[(start+i)%len(s.allShards)]
+		if sh != held {
+			if !sh.mu.TryLock() {
+				continue
+			}
+			locked = append(locked, sh)
+		}
+		samples -= s.sampleEviction(sh, exclude, samples, now, &best)
+	}
+
+	if best != nil {
+		db := s.dbs[best.sh.db]
+		db.del(best.sh, best.key)
+		db.propagate("DEL", best.key)
+		db.stats.evictions.Add(1)
+		db.notify(notifyEvicted, "evicted", best.key)
+	}
+
+	for _, sh := range locked {
+		sh.mu.Unlock()
+	}
+	return best != nil
+}
+
+// sampleEviction considers up to n keys of sh for eviction, replacing *best
+// with any better candidate, and returns how many keys it looked at. Go
+// randomises map iteration order, so ranging over the first few entries is a
+// cheap random sample. Under the allkeys policies sorted sets are candidates
+// too; which of the two maps is sampled first is picked at random, weighted
+// by their sizes. The caller must hold sh.mu.
+func (s *Store) sampleEviction(sh *shard, exclude string, n int, now time.Time, best **evictionCandidate) int {
+	sampled := 0
+	consider := func(key string, score float64) {
+		if key == exclude {
+			return
+		}
+		sampled++
+
+		if *best == nil || score < (*best).score {
+			*best = &evictionCandidate{sh: sh, key: key, score: score}
+		}
+	}
+
+	itemScore := func(item *Item) float64 {
+		switch s.evictionPolicy {
+		case PolicyAllKeysLRU, PolicyVolatileLRU:
+			return float64(atomic.LoadInt64(&item.accessedAt))
+		case PolicyAllKeysLFU, PolicyVolatileLFU:
+			return float64(s.lfuCounter(item, now))
+		default:
+			return float64(item.ExpiresAt.UnixNano())
+		}
+	}
+
+	sampleItems := func() {
+		for key, item := range sh.data {
+			if sampled >= n {
+				break
+			}
+			consider(key, itemScore(item))
+		}
+	}
+	sampleZSets := func() {
+		for key, ss := range sh.sortedSets {
+			if sampled >= n {
+				break
+			}
+			if s.evictionPolicy == PolicyAllKeysLRU {
+				consider(key, float64(atomic.LoadInt64(&ss.accessedAt)))
+			} else {
+				consider(key, float64(s.zsetLFUCounter(ss, now)))
+			}
+		}
+	}
+
+	switch s.evictionPolicy {
+	case PolicyAllKeysLRU, PolicyAllKeysLFU:
+		total := len(sh.data) + len(sh.sortedSets)
+		if total > 0 && rand.Intn(total) < len(sh.sortedSets) {
+			sampleZSets()
+			sampleItems()
+		} else {
+			sampleItems()
+			sampleZSets()
+		}
+	case PolicyVolatileLRU, PolicyVolatileLFU, PolicyVolatileTTL:
+		for key := range sh.ttl {
+			if sampled >= n {
+				break
+			}
+			if item, exists := sh.data[key]; exists && item.ExpiresAt != nil {
+				consider(key, itemScore(item))
+			}
+		}
+	}
+
+	return sampled
+}
+
+// accountItem records the memory of an item that was just stored, replacing
+// prev if there was one. The caller must hold the item's shard lock.
+func (s *Store) accountItem(item, prev *Item) {
+	if prev != nil {
+		s.usedMemory.Add(-prev.size)
+	}
+	s.usedMemory.Add(item.size)
+}
+
+// recomputeMemory recalculates item sizes and the total from scratch, e.g.
+// after a snapshot has replaced the keyspace. The caller must hold every
+// shard lock of every database.
+func (s *Store) recomputeMemory() {
+	var total int64
+	for _, sh := range s.allShards {
+		for key, item := range sh.data {
+			item.size = itemSize(key, item.Value)
+		}
+		total += shardMemory(sh)
+	}
+	s.releaseMu.Lock()
+	s.memoryGen.Add(1)
+	s.usedMemory.Store(total)
+	s.releaseMu.Unlock()
+}
+
+// shardMemory returns the memory accounted to the keys of sh. The caller must
+// hold sh.mu.
+func shardMemory(sh *shard) int64 {
+	var total int64
+	for _, item := range sh.data {
+		total += item.size
+	}
+	for key, ss := range sh.sortedSets {
+		total += zsetSize(key, ss)
+	}
+	return total
+}
+
+// zsetSize returns the memory accounted to the sorted set ss at key.
+func zsetSize(key string, ss *SortedSet) int64 {
+	size := zsetOverhead + int64(len(key))
+	for _, m := range ss.ZRangeWithScores(key, 0, -1) {
+		size += zmemberCost(m.Member)
+	}
+	return size
+}
@@ -0,0 +1,139 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/chaitanyayendru/fincache/internal/config"
+)
+
+func TestParseSize(t *testing.T) {
+	cases := map[string]int64{
+		"":      0,
+		"1024":  1024,
+		"512MB": 512 << 20,
+		"1GB":   1 << 30,
+		"1gb":   1 << 30,
+		"64k":   64 << 10,
+		"1.5KB": 1536,
+	}
+	for input, want := range cases {
+		got, err := config.ParseSize(input)
+		if err != nil || got != want {
+			t.Errorf("ParseSize(%q) = %d, %v; expected %d", input, got, err, want)
+		}
+	}
+
+	if _, err := config.ParseSize("lots"); err == nil {
+		t.Error("Expected error for invalid size")
+	}
+}
+
+func TestMemoryAccounting(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	store.Set("a", "value", 0)
+	store.ZAdd("book", 1, "bid")
+	used := store.Stats().MemoryUsage
+	if used <= 0 {
+		t.Fatalf("Expected positive memory usage, got %d", used)
+	}
+
+	store.Set("a", "value", 0)
+	store.ZAdd("book", 2, "bid")
+	if got := store.UsedMemory(); got != used {
+		t.Errorf("Expected overwrites to keep usage at %d, got %d", used, got)
+	}
+
+	store.Delete("a")
+	store.ZRem("book", "bid")
+	if got := store.UsedMemory(); got != zsetOverhead+int64(len("book")) {
+		t.Errorf("Expected only the empty sorted set to remain, got %d", got)
+	}
+
+	store.Flush()
+	if got := store.UsedMemory(); got != 0 {
+		t.Errorf("Expected 0 after flush, got %d", got)
+	}
+}
+
+func TestNoEvictionRejectsWrites(t *testing.T) {
+	store := NewStore(config.StoreConfig{MaxMemory: "1KB", EvictionPolicy: PolicyNoEviction})
+	defer store.Close()
+
+	var err error
+	for i := 0; i < 100 && err == nil; i++ {
+		err = store.Set(fmt.Sprintf("key%d", i), "value", 0)
+	}
+	if !errors.Is(err, ErrOutOfMemory) {
+		t.Fatalf("Expected ErrOutOfMemory, got %v", err)
+	}
+	if store.UsedMemory() > store.MaxMemory() {
+		t.Errorf("Expected usage %d to stay under %d", store.UsedMemory(), store.MaxMemory())
+	}
+}
+
+func TestAllKeysLRUEvicts(t *testing.T) {
+	store := NewStore(config.StoreConfig{MaxMemory: "2KB", EvictionPolicy: "lru"})
+	defer store.Close()
+
+	for i := 0; i < 100; i++ {
+		if err := store.Set(fmt.Sprintf("key%d", i), "value", 0); err != nil {
+			t.Fatalf("Expected eviction instead of error: %v", err)
+		}
+	}
+
+	stats := store.Stats()
+	if stats.Evictions == 0 {
+		t.Error("Expected evictions to be counted")
+	}
+	if stats.MemoryUsage > store.MaxMemory() {
+		t.Errorf("Expected usage %d to stay under %d", stats.MemoryUsage, store.MaxMemory())
+	}
+	if !store.Exists("key99") {
+		t.Error("Expected the key just written to survive")
+	}
+}
+
+func TestAllKeysPoliciesEvictSortedSets(t *testing.T) {
+	for _, policy := range []string{PolicyAllKeysLRU, PolicyAllKeysLFU} {
+		store := NewStore(config.StoreConfig{MaxMemory: "4KB", EvictionPolicy: policy})
+
+		for i := 0; i < 100; i++ {
+			store.ZAdd(fmt.Sprintf("book%d", i), float64(i), "bid")
+		}
+
+		if store.Stats().Evictions == 0 {
+			t.Errorf("%s: expected sorted sets to be evicted", policy)
+		}
+		if store.UsedMemory() > store.MaxMemory() {
+			t.Errorf("%s: expected usage %d to stay under %d", policy, store.UsedMemory(), store.MaxMemory())
+		}
+		if store.ZCard("book99") != 1 {
+			t.Errorf("%s: expected the sorted set just written to survive", policy)
+		}
+		store.Close()
+	}
+}
+
+func TestVolatilePoliciesOnlyEvictKeysWithTTL(t *testing.T) {
+	for _, policy := range []string{PolicyVolatileLRU, PolicyVolatileTTL} {
+		store := NewStore(config.StoreConfig{MaxMemory: "2KB", EvictionPolicy: policy})
+
+		store.Set("persistent", "value", 0)
+		var err error
+		for i := 0; i < 100 && err == nil; i++ {
+			err = store.Set(fmt.Sprintf("key%d", i), "value", time.Duration(i+1)*time.Minute)
+		}
+		if err != nil {
+			t.Errorf("%s: expected volatile keys to be evicted, got %v", policy, err)
+		}
+		if !store.Exists("persistent") {
+			t.Errorf("%s: expected key without TTL to survive", policy)
+		}
+		store.Close()
+	}
+}
@@ -0,0 +1,301 @@
+package store
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultMoneyScale = 2
+	// MaxDecimalScale is the most decimal places a Decimal can have; 10^18
+	// is the largest power of ten that fits in an int64.
+	MaxDecimalScale = 18
+)
+
+var (
+	ErrInvalidDecimal   = errors.New("value is not a valid decimal or out of range")
+	ErrDecimalPrecision = errors.New("value has more decimal places than the scale of the key")
+	ErrInvalidScale     = errors.New("scale must be between 0 and 18")
+	ErrBelowFloor       = errors.New("balance would go below the floor")
+)
+
+var pow10 = func() (p [MaxDecimalScale + 1]int64) {
+	p[0] = 1
+	for i := 1; i < len(p); i++ {
+		p[i] = p[i-1] * 10
+	}
+	return p
+}()
+
+// Decimal is an exact fixed-point number: an integer count of units of
+// 10^-scale, e.g. 12345 at scale 2 is 123.45. It is the value type of money
+// keys, stored in Item.Value like the other scalars but, unlike float64,
+// never rounds. Arithmetic fails rather than overflow.
+type Decimal struct {
+	units int64
+	scale uint8
+}
+
+// NewDecimal returns units*10^-scale.
+func NewDecimal(units int64, scale int) (Decimal, error) {
+	if scale < 0 || scale > MaxDecimalScale {
+		return Decimal{}, ErrInvalidScale
+	}
+	return Decimal{units: units, scale: uint8(scale)}, nil
+}
+
+// ParseDecimal parses a plain decimal such as "-12.5" at the given scale. It
+// rejects exponents and more decimal places than scale rather than round.
+func ParseDecimal(s string, scale int) (Decimal, error) {
+	if scale < 0 || scale > MaxDecimalScale {
+		return Decimal{}, ErrInvalidScale
+	}
+
+	digits, negative := s, false
+	if len(digits) > 0 && (digits[0] == '-' || digits[0] == '+') {
+		negative, digits = digits[0] == '-', digits[1:]
+	}
+	whole, frac, _ := strings.Cut(digits, ".")
+	if whole == "" && frac == "" || strings.Trim(whole+frac, "0123456789") != "" {
+		return Decimal{}, ErrInvalidDecimal
+	}
+	// Trailing zeros past the scale lose nothing
+	if trimmed := strings.TrimRight(frac, "0"); len(frac) > scale {
+		if len(trimmed) > scale {
+			return Decimal{}, ErrDecimalPrecision
+		}
+		frac = frac[:scale]
+	}
+	frac += strings.Repeat("0", scale-len(frac))
+
+	// Accumulate as a negative number, whose range includes math.MinInt64
+	var units int64
+	for _, c := range whole + frac {
+		if units < (math.MinInt64+int64(c-'0'))/10 {
+			return Decimal{}, ErrInvalidDecimal
+		}
+		units = units*10 - int64(c-'0')
+	}
+	if !negative {
+		if units == math.MinInt64 {
+			return Decimal{}, ErrInvalidDecimal
+		}
+		units = -units
+	}
+	return Decimal{units: units, scale: uint8(scale)}, nil
+}
+
+// Units returns the value in units of 10^-Scale.
+func (d Decimal) Units() int64 {
+	return d.units
+}
+
+// Scale returns the number of decimal places.
+func (d Decimal) Scale() int {
+	return int(d.scale)
+}
+
+func (d Decimal) String() string {
+	if d.scale == 0 {
+		return strconv.FormatInt(d.units, 10)
+	}
+
+	var abs uint64
+	sign := ""
+	if d.units < 0 {
+		abs, sign = uint64(-(d.units+1))+1, "-"
+	} else {
+		abs = uint64(d.units)
+	}
+	p := uint64(pow10[d.scale])
+	frac := strconv.FormatUint(abs%p, 10)
+	return sign + strconv.FormatUint(abs/p, 10) + "." + strings.Repeat("0", int(d.scale)-len(frac)) + frac
+}
+
+// MarshalJSON encodes the decimal as a JSON string, so clients do not read
+// it back as a float.
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(d.String())), nil
+}
+
+// Cmp compares d with other, which must have the same scale, returning -1, 0
+// or 1.
+func (d Decimal) Cmp(other Decimal) int {
+	switch {
+	case d.units < other.units:
+		return -1
+	case d.units > other.units:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// add returns d+other, which must have the same scale, reporting false on
+// overflow.
+func (d Decimal) add(other Decimal) (Decimal, bool) {
+	result := d.units + other.units
+	if other.units > 0 && result < d.units || other.units < 0 && result > d.units {
+		return Decimal{}, false
+	}
+	return Decimal{units: result, scale: d.scale}, true
+}
+
+// neg returns -d, reporting false for the one value that has no negation.
+func (d Decimal) neg() (Decimal, bool) {
+	if d.units == math.MinInt64 {
+		return Decimal{}, false
+	}
+	return Decimal{units: -d.units, scale: d.scale}, true
+}
+
+// MoneyScale returns the scale of money keys created without one.
+func (s *Store) MoneyScale() int {
+	return s.moneyScale
+}
+
+// MoneySet stores amount at key as a Decimal with the given scale, or the
+// configured default if scale is negative, replacing any value and TTL the
+// key had.
+func (s *Store) MoneySet(key, amount string, scale int) (Decimal, error) {
+	if scale < 0 {
+		scale = s.moneyScale
+	}
+	d, err := ParseDecimal(amount, scale)
+	if err != nil {
+		return Decimal{}, err
+	}
+	return d, s.Set(key, d, 0)
+}
+
+// MoneyGet returns the balance at key and whether it exists.
+func (s *Store) MoneyGet(key string) (Decimal, bool, error) {
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	item, exists := sh.data[key]
+	if !exists || item.ExpiresAt != nil && time.Now().After(*item.ExpiresAt) {
+		s.stats.recordLookup(false)
+		return Decimal{}, false, nil
+	}
+	d, ok := item.Value.(Decimal)
+	if !ok {
+		return Decimal{}, false, ErrWrongType
+	}
+	s.stats.recordLookup(true)
+	s.touch(item)
+	return d, true, nil
+}
+
+// MoneyAdd atomically adds amount, which may be negative, to the balance at
+// key and returns the new balance. A missing key starts at zero with the
+// default scale. If floor is set, a change that lowers the balance is
+// refused with ErrBelowFloor when the result would be below it.
+func (s *Store) MoneyAdd(key, amount, floor string) (Decimal, error) {
+	return s.moneyAdd(key, amount, floor, false)
+}
+
+// MoneySub is MoneyAdd with amount subtracted.
+func (s *Store) MoneySub(key, amount, floor string) (Decimal, error) {
+	return s.moneyAdd(key, amount, floor, true)
+}
+
+func (s *Store) moneyAdd(key, amount, floor string, subtract bool) (Decimal, error) {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	balance, item, err := s.writeMoney(sh, key)
+	if err != nil {
+		return Decimal{}, err
+	}
+	delta, err := ParseDecimal(amount, balance.Scale())
+	if err != nil {
+		return Decimal{}, err
+	}
+	if subtract {
+		var ok bool
+		if delta, ok = delta.neg(); !ok {
+			return Decimal{}, ErrIncrOverflow
+		}
+	}
+
+	result, ok := balance.add(delta)
+	if !ok {
+		return Decimal{}, ErrIncrOverflow
+	}
+	if floor != "" && delta.units < 0 {
+		f, err := ParseDecimal(floor, balance.Scale())
+		if err != nil {
+			return Decimal{}, err
+		}
+		if result.Cmp(f) < 0 {
+			return Decimal{}, ErrBelowFloor
+		}
+	}
+
+	event := "money.add"
+	if subtract {
+		event = "money.sub"
+	}
+	return result, s.storeMoney(sh, key, item, result, event)
+}
+
+// writeMoney returns the balance at key for a write along with its item,
+// deleting the key first if it has expired. A missing key reads as zero at
+// the default scale with a nil item. The caller must hold sh.mu.
+func (s *Store) writeMoney(sh *shard, key string) (Decimal, *Item, error) {
+	zero := Decimal{scale: uint8(s.moneyScale)}
+	if _, isZSet := sh.sortedSets[key]; isZSet {
+		return Decimal{}, nil, ErrWrongType
+	}
+	item, exists := sh.data[key]
+	if !exists {
+		return zero, nil, nil
+	}
+	if item.ExpiresAt != nil && time.Now().After(*item.ExpiresAt) {
+		s.deleteExpired(sh, key)
+		return zero, nil, nil
+	}
+
+	d, ok := item.Value.(Decimal)
+	if !ok {
+		return Decimal{}, nil, ErrWrongType
+	}
+	s.touch(item)
+	return d, item, nil
+}
+
+// storeMoney writes balance to key, updating item in place to keep its TTL
+// or creating the key if item is nil, and logs the result as a SET. The
+// caller must hold sh.mu.
+func (s *Store) storeMoney(sh *shard, key string, item *Item, balance Decimal, event string) error {
+	if item == nil {
+		if err := s.reserveMemory(sh, key, itemSize(key, balance)); err != nil {
+			return err
+		}
+		s.set(sh, key, balance, nil)
+		item = sh.data[key]
+	} else {
+		item.Value = balance
+		item.UpdatedAt = time.Now()
+	}
+
+	if s.aof != nil {
+		payload, err := marshalValue(balance)
+		if err != nil {
+			return err
+		}
+		if item.ExpiresAt != nil {
+			s.propagate("SET", key, payload, "PXAT", formatUnixMilli(*item.ExpiresAt))
+		} else {
+			s.propagate("SET", key, payload)
+		}
+	}
+	s.notify(notifyString, event, key)
+	return nil
+}
@@ -0,0 +1,134 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/chaitanyayendru/fincache/internal/config"
+)
+
+func TestParseDecimal(t *testing.T) {
+	tests := []struct {
+		in    string
+		scale int
+		want  string
+		err   error
+	}{
+		{"12.34", 2, "12.34", nil},
+		{"-0.5", 2, "-0.50", nil},
+		{"+7", 2, "7.00", nil},
+		{".25", 2, "0.25", nil},
+		{"1.2300", 2, "1.23", nil},
+		{"1.005", 2, "", ErrDecimalPrecision},
+		{"1e3", 2, "", ErrInvalidDecimal},
+		{"", 2, "", ErrInvalidDecimal},
+		{"1.2.3", 2, "", ErrInvalidDecimal},
+		{"9223372036854775807", 0, "9223372036854775807", nil},
+		{"-9223372036854775808", 0, "-9223372036854775808", nil},
+		{"9223372036854775808", 0, "", ErrInvalidDecimal},
+		{"92233720368547758.08", 2, "", ErrInvalidDecimal},
+		{"0.000000000000000001", 18, "0.000000000000000001", nil},
+	}
+	for _, tt := range tests {
+		d, err := ParseDecimal(tt.in, tt.scale)
+		if !errors.Is(err, tt.err) || err == nil && d.String() != tt.want {
+			t.Errorf("ParseDecimal(%q, %d) = %s, %v; want %s, %v", tt.in, tt.scale, d, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestMoneyArithmetic(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	// 0.1 + 0.2 is exact, unlike with float64
+	store.MoneyAdd("wallet", "0.10", "")
+	if d, err := store.MoneyAdd("wallet", "0.2", ""); err != nil || d.String() != "0.30" {
+		t.Errorf("Expected 0.30, got %s (%v)", d, err)
+	}
+	if d, _ := store.MoneySub("wallet", "1.00", ""); d.String() != "-0.70" {
+		t.Errorf("Expected -0.70, got %s", d)
+	}
+	if _, err := store.MoneyAdd("wallet", "0.001", ""); !errors.Is(err, ErrDecimalPrecision) {
+		t.Errorf("Expected ErrDecimalPrecision, got %v", err)
+	}
+
+	// The floor only stops changes that lower the balance
+	store.MoneySet("account", "100", 2)
+	if _, err := store.MoneySub("account", "100.01", "0"); !errors.Is(err, ErrBelowFloor) {
+		t.Errorf("Expected ErrBelowFloor, got %v", err)
+	}
+	if d, _, _ := store.MoneyGet("account"); d.String() != "100.00" {
+		t.Errorf("Expected a refused debit to leave 100.00, got %s", d)
+	}
+	if d, err := store.MoneySub("account", "150", "-50"); err != nil || d.String() != "-50.00" {
+		t.Errorf("Expected an overdraft down to the floor, got %s (%v)", d, err)
+	}
+	if d, err := store.MoneyAdd("account", "1", "0"); err != nil || d.String() != "-49.00" {
+		t.Errorf("Expected a credit below the floor to be allowed, got %s (%v)", d, err)
+	}
+
+	// Keys keep their own scale
+	store.MoneySet("sats", "0.00000001", 8)
+	if d, _ := store.MoneyAdd("sats", "0.00000002", ""); d.String() != "0.00000003" {
+		t.Errorf("Expected 0.00000003, got %s", d)
+	}
+
+	store.MoneySet("big", "9223372036854775807", 0)
+	if _, err := store.MoneyAdd("big", "1", ""); !errors.Is(err, ErrIncrOverflow) {
+		t.Errorf("Expected ErrIncrOverflow, got %v", err)
+	}
+
+	store.Set("plain", "x", 0)
+	if _, err := store.MoneyAdd("plain", "1", ""); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType, got %v", err)
+	}
+}
+
+func TestMoneyKeepsTTLAndPersists(t *testing.T) {
+	cfg := aofConfig(t.TempDir())
+	cfg.MoneyScale = 4
+
+	store := NewStore(cfg)
+	store.MoneySet("snap", "1.5", -1)
+	if err := store.SaveSnapshot(); err != nil {
+		t.Fatalf("Expected no error when saving snapshot: %v", err)
+	}
+	store.MoneyAdd("log", "10.0001", "")
+	store.Expire("log", time.Hour)
+	store.MoneySub("log", "0.0002", "")
+	if ttl, _ := store.TTL("log"); ttl <= 0 {
+		t.Errorf("Expected MONEY.SUB to keep the TTL, got %v", ttl)
+	}
+	store.Close()
+
+	restored := NewStore(cfg)
+	defer restored.Close()
+
+	if d, _, _ := restored.MoneyGet("snap"); d.String() != "1.5000" {
+		t.Errorf("Expected 1.5000 from the snapshot, got %s", d)
+	}
+	d, _, _ := restored.MoneyGet("log")
+	if d.String() != "9.9999" || d.Scale() != 4 {
+		t.Errorf("Expected 9.9999 at scale 4, got %s", d)
+	}
+	if ttl, _ := restored.TTL("log"); ttl <= 0 {
+		t.Errorf("Expected the TTL to be replayed, got %v", ttl)
+	}
+	if raw, _ := json.Marshal(d); string(raw) != `"9.9999"` {
+		t.Errorf("Expected decimals to marshal as JSON strings, got %s", raw)
+	}
+	if v, _ := restored.Get("log"); v != d {
+		t.Errorf("Expected GET to return the Decimal, got %#v", v)
+	}
+}
+
+func TestDecimalString(t *testing.T) {
+	d, _ := NewDecimal(math.MinInt64, 2)
+	if d.String() != "-92233720368547758.08" {
+		t.Errorf("Unexpected formatting of the smallest decimal: %s", d)
+	}
+}
@@ -0,0 +1,143 @@
+package store
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Keyspace notifications follow Redis: every change to a key can be published
+// on "__keyspace@<db>__:<key>" with the event name as payload, and on
+// "__keyevent@<db>__:<event>" with the key as payload. Which of them are sent
+// is chosen with a notify-keyspace-events style flag string.
+const (
+	notifyKeyspace = 1 << iota // K
+	notifyKeyevent             // E
+	notifyGeneric              // g: del, expire, persist, rename_from, rename_to, copy_to, restore, move_from, move_to
+	notifyString               // $: set, money.add, money.sub, ledger.transfer, idem.reserve, idem.complete, idem.release, rl.config, rl.acquire, lock.acquire, lock.renew, lock.release, setbit, incrby, incrbyfloat, append, setrange
+	notifyList                 // l: lpush, rpush, lpop, rpop, lset, lrem, ltrim
+	notifyHash                 // h: hset, hdel, hincrby, hincrbyfloat, hexpire, hexpired
+	notifySet                  // s: sadd, srem, spop, sunionstore, sinterstore, sdiffstore
+	notifyStream               // t: xadd, xtrim, xgroup-create, xgroup-setid, xgroup-destroy, xgroup-createconsumer, xgroup-delconsumer
+	notifyZSet                 // z: zadd, zincr, zrem
+	notifyExpired              // x: a key expired
+	notifyEvicted              // e: a key was evicted for maxmemory
+	notifyModule               // d: ts.create, ts.add, ts.createrule, ts.deleterule, bf.reserve, bf.add, cf.reserve, cf.add, cf.del, cms.init, cms.incrby, cms.merge, topk.reserve, topk.add, topk.merge, tdigest.create, tdigest.add, tdigest.merge
+
+	notifyAll = notifyGeneric | notifyString | notifyList | notifyHash | notifySet | notifyStream | notifyZSet | notifyExpired | notifyEvicted | notifyModule
+)
+
+// Publisher delivers keyspace notifications, e.g. protocol.PubSubManager.
+// Publish is called with shard locks held, so it must not block on slow
+// subscribers; protocol.PubSubManager only queues the message.
+type Publisher interface {
+	Publish(channel, message string) int
+}
+
+// parseNotifyFlags parses a notify-keyspace-events flag string such as "KEA"
+// or "Kx". Events are only sent if K or E is set as well as a class.
+func parseNotifyFlags(flags string) (int, error) {
+	parsed := 0
+	for _, c := range flags {
+		switch c {
+		case 'K':
+			parsed |= notifyKeyspace
+		case 'E':
+			parsed |= notifyKeyevent
+		case 'g':
+			parsed |= notifyGeneric
+		case '$':
+			parsed |= notifyString
+		case 'l':
+			parsed |= notifyList
+		case 'h':
+			parsed |= notifyHash
+		case 's':
+			parsed |= notifySet
+		case 't':
+			parsed |= notifyStream
+		case 'z':
+			parsed |= notifyZSet
+		case 'x':
+			parsed |= notifyExpired
+		case 'e':
+			parsed |= notifyEvicted
+		case 'd':
+			parsed |= notifyModule
+		case 'A':
+			parsed |= notifyAll
+		default:
+			return 0, fmt.Errorf("invalid keyspace event flag %q", c)
+		}
+	}
+	return parsed, nil
+}
+
+// formatNotifyFlags is the inverse of parseNotifyFlags.
+func formatNotifyFlags(flags int) string {
+	var b strings.Builder
+	if flags&notifyAll == notifyAll {
+		b.WriteByte('A')
+	} else {
+		for _, f := range []struct {
+			flag int
+			c    byte
+		}{{notifyGeneric, 'g'}, {notifyString, '$'}, {notifyList, 'l'}, {notifyHash, 'h'}, {notifySet, 's'}, {notifyStream, 't'}, {notifyZSet, 'z'}, {notifyExpired, 'x'}, {notifyEvicted, 'e'}, {notifyModule, 'd'}} {
+			if flags&f.flag != 0 {
+				b.WriteByte(f.c)
+			}
+		}
+	}
+	if flags&notifyKeyspace != 0 {
+		b.WriteByte('K')
+	}
+	if flags&notifyKeyevent != 0 {
+		b.WriteByte('E')
+	}
+	return b.String()
+}
+
+// SetPublisher sets where keyspace notifications are published. Nothing is
+// published until it is called.
+func (s *Store) SetPublisher(p Publisher) {
+	s.publisher.Store(&p)
+}
+
+// NotifyKeyspaceEvents returns the enabled notification classes as a flag
+// string.
+func (s *Store) NotifyKeyspaceEvents() string {
+	return formatNotifyFlags(int(s.notifyFlags.Load()))
+}
+
+// SetNotifyKeyspaceEvents changes the enabled notification classes at
+// runtime, like CONFIG SET notify-keyspace-events.
+func (s *Store) SetNotifyKeyspaceEvents(flags string) error {
+	parsed, err := parseNotifyFlags(flags)
+	if err != nil {
+		return err
+	}
+	s.notifyFlags.Store(int32(parsed))
+	return nil
+}
+
+// notify publishes event for key if its class is enabled. Callers notify
+// while still holding the shard lock, like propagate, so subscribers see the
+// events of a key in the order the writes were applied.
+func (s *Store) notify(class int, event, key string) {
+	flags := int(s.notifyFlags.Load())
+	if flags&class == 0 || flags&(notifyKeyspace|notifyKeyevent) == 0 {
+		return
+	}
+	p := s.publisher.Load()
+	if p == nil {
+		return
+	}
+
+	db := strconv.Itoa(s.db)
+	if flags&notifyKeyspace != 0 {
+		(*p).Publish("__keyspace@"+db+"__:"+key, event)
+	}
+	if flags&notifyKeyevent != 0 {
+		(*p).Publish("__keyevent@"+db+"__:"+event, key)
+	}
+}
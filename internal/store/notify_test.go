@@ -0,0 +1,149 @@
+package store
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chaitanyayendru/fincache/internal/config"
+)
+
+type recordingPublisher struct {
+	mu       sync.Mutex
+	messages []string // "channel payload"
+}
+
+func (p *recordingPublisher) Publish(channel, message string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.messages = append(p.messages, channel+" "+message)
+	return 1
+}
+
+func (p *recordingPublisher) take() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	messages := p.messages
+	p.messages = nil
+	return messages
+}
+
+func expectMessages(t *testing.T, p *recordingPublisher, want ...string) {
+	t.Helper()
+	got := p.take()
+	if len(got) != len(want) {
+		t.Fatalf("Expected messages %q, got %q", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Expected message %q, got %q", want[i], got[i])
+		}
+	}
+}
+
+func TestParseNotifyFlags(t *testing.T) {
+	flags, err := parseNotifyFlags("KEA")
+	if err != nil || flags != notifyKeyspace|notifyKeyevent|notifyAll {
+		t.Errorf("Expected every flag, got %b (%v)", flags, err)
+	}
+	if formatNotifyFlags(flags) != "AKE" {
+		t.Errorf("Expected 'AKE', got %q", formatNotifyFlags(flags))
+	}
+	if _, err := parseNotifyFlags("Kq"); err == nil {
+		t.Error("Expected error for unknown flag")
+	}
+}
+
+func TestKeyspaceNotifications(t *testing.T) {
+	store := NewStore(config.StoreConfig{NotifyKeyspaceEvents: "KEA"})
+	defer store.Close()
+
+	p := &recordingPublisher{}
+	store.SetPublisher(p)
+
+	store.Set("price", "1.10", 0)
+	expectMessages(t, p, "__keyspace@0__:price set", "__keyevent@0__:set price")
+
+	store.Expire("price", time.Hour)
+	expectMessages(t, p, "__keyspace@0__:price expire", "__keyevent@0__:expire price")
+
+	store.Del("price", "missing")
+	expectMessages(t, p, "__keyspace@0__:price del", "__keyevent@0__:del price")
+
+	store.ZAdd("book", 1, "bid")
+	store.ZIncrBy("book", 1, "bid")
+	expectMessages(t, p,
+		"__keyspace@0__:book zadd", "__keyevent@0__:zadd book",
+		"__keyspace@0__:book zincr", "__keyevent@0__:zincr book")
+
+	db2, _ := store.Select(2)
+	db2.Set("limit", "5", 0)
+	expectMessages(t, p, "__keyspace@2__:limit set", "__keyevent@2__:set limit")
+}
+
+func TestKeyspaceNotificationClasses(t *testing.T) {
+	store := NewStore(config.StoreConfig{NotifyKeyspaceEvents: "Ex"})
+	defer store.Close()
+
+	p := &recordingPublisher{}
+	store.SetPublisher(p)
+
+	store.Set("quote", "1", 10*time.Millisecond)
+	expectMessages(t, p)
+
+	time.Sleep(20 * time.Millisecond)
+	store.Get("quote")
+	expectMessages(t, p, "__keyevent@0__:expired quote")
+
+	if err := store.SetNotifyKeyspaceEvents(""); err != nil {
+		t.Fatal(err)
+	}
+	store.Set("quote", "1", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	store.Get("quote")
+	expectMessages(t, p)
+}
+
+func TestEvictionNotification(t *testing.T) {
+	store := NewStore(config.StoreConfig{
+		MaxMemory:            "2KB",
+		EvictionPolicy:       PolicyAllKeysLRU,
+		NotifyKeyspaceEvents: "Ee",
+	})
+	defer store.Close()
+
+	p := &recordingPublisher{}
+	store.SetPublisher(p)
+
+	for i := 0; i < 20; i++ {
+		store.Set(string(rune('a'+i)), "value", 0)
+	}
+	if len(p.take()) == 0 {
+		t.Error("Expected evicted events once the limit was reached")
+	}
+}
+
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"*", "anything", true},
+		{"__keyspace@0__:*", "__keyspace@0__:price/eur", true},
+		{"__keyspace@*__:price", "__keyspace@12__:price", true},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-b]llo", "hbllo", true},
+		{"h\\*llo", "h*llo", true},
+		{"h\\*llo", "hello", false},
+		{"price", "prices", false},
+		{"h[ae", "ha", false},
+	}
+	for _, tt := range tests {
+		if got := MatchPattern(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("MatchPattern(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,351 @@
+package store
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNoRateLimit      = errors.New("no rate limit is configured for this key")
+	ErrInvalidRateLimit = errors.New("rate limit and period must be positive")
+	ErrCostExceedsLimit = errors.New("cost exceeds the rate limit")
+)
+
+// RateLimitMode selects the algorithm of a rate limiter.
+type RateLimitMode int
+
+const (
+	// RateLimitTokenBucket allows bursts of up to Limit and refills Limit
+	// tokens per Period, continuously.
+	RateLimitTokenBucket RateLimitMode = iota
+	// RateLimitSlidingWindow allows a total cost of at most Limit within any
+	// Period, keeping a log of the acquisitions.
+	RateLimitSlidingWindow
+)
+
+func (m RateLimitMode) String() string {
+	if m == RateLimitTokenBucket {
+		return "BUCKET"
+	}
+	return "WINDOW"
+}
+
+// ParseRateLimitMode parses "BUCKET" or "WINDOW" as used by RL.CONFIG.
+func ParseRateLimitMode(s string) (RateLimitMode, bool) {
+	switch strings.ToUpper(s) {
+	case "BUCKET":
+		return RateLimitTokenBucket, true
+	case "WINDOW":
+		return RateLimitSlidingWindow, true
+	}
+	return RateLimitTokenBucket, false
+}
+
+// RateLimitConfig configures a rate limiter: at most Limit per Period.
+type RateLimitConfig struct {
+	Mode   RateLimitMode
+	Limit  int64
+	Period time.Duration
+}
+
+// RateLimitResult is the outcome of RateLimitAcquire.
+type RateLimitResult struct {
+	Allowed    bool
+	Remaining  int64         // what can still be acquired right away
+	RetryAfter time.Duration // when the cost would be allowed, 0 if it was
+	ResetAfter time.Duration // when the limiter will be back to its full limit
+}
+
+// rateLimitEntry is one acquisition in the log of a sliding window.
+type rateLimitEntry struct {
+	at   time.Time
+	cost int64
+}
+
+// RateLimiter is the value of a rate limit key. It is guarded by the lock of
+// the shard holding the key and advances with the times passed to it, which
+// are whole milliseconds so that replaying the log reproduces it exactly.
+type RateLimiter struct {
+	config RateLimitConfig
+
+	tokens float64   // token bucket: tokens left
+	last   time.Time // token bucket: when tokens was last refilled
+
+	log  []rateLimitEntry // sliding window: acquisitions, oldest first
+	used int64            // sliding window: total cost in log
+}
+
+// newRateLimiter returns a limiter with its full limit available.
+func newRateLimiter(cfg RateLimitConfig) *RateLimiter {
+	return &RateLimiter{config: cfg, tokens: float64(cfg.Limit), last: time.UnixMilli(0)}
+}
+
+// NewRateLimiter returns a limiter that is not stored under a key, e.g. to
+// keep limits in process. It is not safe for concurrent use.
+func NewRateLimiter(cfg RateLimitConfig) *RateLimiter {
+	return newRateLimiter(cfg)
+}
+
+// Acquire is RateLimitAcquire for a limiter returned by NewRateLimiter.
+func (rl *RateLimiter) Acquire(cost int64, now time.Time) RateLimitResult {
+	result, _ := rl.acquire(cost, now)
+	return result
+}
+
+// Config returns the configuration of the limiter.
+func (rl *RateLimiter) Config() RateLimitConfig {
+	return rl.config
+}
+
+// advance brings the limiter to now, refilling the bucket or dropping the
+// entries that left the window, and returns by how much its estimated size
+// shrank.
+func (rl *RateLimiter) advance(now time.Time) int64 {
+	if rl.config.Mode == RateLimitTokenBucket {
+		if now.After(rl.last) {
+			refill := float64(now.Sub(rl.last)) / float64(rl.config.Period) * float64(rl.config.Limit)
+			rl.tokens = math.Min(float64(rl.config.Limit), rl.tokens+refill)
+			rl.last = now
+		}
+		return 0
+	}
+
+	start := now.Add(-rl.config.Period)
+	n := 0
+	for n < len(rl.log) && !rl.log[n].at.After(start) {
+		rl.used -= rl.log[n].cost
+		n++
+	}
+	rl.log = rl.log[n:]
+	return -int64(n) * rateLimitEntrySize
+}
+
+// remaining returns what can be acquired at once.
+func (rl *RateLimiter) remaining() int64 {
+	if rl.config.Mode == RateLimitTokenBucket {
+		return int64(rl.tokens)
+	}
+	return rl.config.Limit - rl.used
+}
+
+// wait returns how long until cost can be acquired, 0 if it can be now. The
+// limiter must have been advanced to now.
+func (rl *RateLimiter) wait(cost int64, now time.Time) time.Duration {
+	if rl.config.Mode == RateLimitTokenBucket {
+		missing := float64(cost) - rl.tokens
+		if missing <= 0 {
+			return 0
+		}
+		return time.Duration(math.Ceil(missing / float64(rl.config.Limit) * float64(rl.config.Period)))
+	}
+
+	excess := rl.used + cost - rl.config.Limit
+	for _, entry := range rl.log {
+		if excess <= 0 {
+			break
+		}
+		excess -= entry.cost
+		if excess <= 0 {
+			return entry.at.Add(rl.config.Period).Sub(now)
+		}
+	}
+	return 0
+}
+
+// resetAfter returns how long until the limiter is back to its full limit.
+// The limiter must have been advanced to now.
+func (rl *RateLimiter) resetAfter(now time.Time) time.Duration {
+	if rl.config.Mode == RateLimitTokenBucket {
+		return rl.wait(rl.config.Limit, now)
+	}
+	if len(rl.log) == 0 {
+		return 0
+	}
+	return rl.log[len(rl.log)-1].at.Add(rl.config.Period).Sub(now)
+}
+
+// acquire takes cost from the limiter if it allows it at now, returning the
+// result and by how much the estimated size of the limiter changed.
+func (rl *RateLimiter) acquire(cost int64, now time.Time) (RateLimitResult, int64) {
+	delta := rl.advance(now)
+	retry := rl.wait(cost, now)
+	if retry == 0 && cost > 0 {
+		if rl.config.Mode == RateLimitTokenBucket {
+			rl.tokens -= float64(cost)
+		} else {
+			rl.log = append(rl.log, rateLimitEntry{at: now, cost: cost})
+			rl.used += cost
+			delta += rateLimitEntrySize
+		}
+	}
+	return RateLimitResult{
+		Allowed:    retry == 0,
+		Remaining:  rl.remaining(),
+		RetryAfter: retry,
+		ResetAfter: rl.resetAfter(now),
+	}, delta
+}
+
+func (rl *RateLimiter) size() int64 {
+	return rateLimiterOverhead + int64(len(rl.log))*rateLimitEntrySize
+}
+
+func (rl *RateLimiter) clone() *RateLimiter {
+	c := *rl
+	c.log = append([]rateLimitEntry(nil), rl.log...)
+	return &c
+}
+
+// Memory estimates for rate limiters.
+const (
+	rateLimiterOverhead = 96 // RateLimiter struct and its log slice
+	rateLimitEntrySize  = 32 // rateLimitEntry
+)
+
+// writeRateLimiter returns the item holding the rate limiter at key for a
+// write, deleting it first if it has expired. It returns a nil item if there
+// is no limiter. The caller must hold sh.mu.
+func (s *Store) writeRateLimiter(sh *shard, key string) (*Item, *RateLimiter, error) {
+	if _, isZSet := sh.sortedSets[key]; isZSet {
+		return nil, nil, ErrWrongType
+	}
+	item, exists := sh.data[key]
+	if !exists {
+		return nil, nil, nil
+	}
+	if item.ExpiresAt != nil && time.Now().After(*item.ExpiresAt) {
+		s.deleteExpired(sh, key)
+		return nil, nil, nil
+	}
+
+	rl, ok := item.Value.(*RateLimiter)
+	if !ok {
+		return nil, nil, ErrWrongType
+	}
+	s.touch(item)
+	return item, rl, nil
+}
+
+func validRateLimit(cfg RateLimitConfig) bool {
+	return cfg.Limit > 0 && cfg.Period >= time.Millisecond &&
+		(cfg.Mode == RateLimitTokenBucket || cfg.Mode == RateLimitSlidingWindow)
+}
+
+// RateLimitConfigure stores a rate limiter with cfg at key, replacing and
+// resetting any limiter there. It does not expire.
+func (s *Store) RateLimitConfigure(key string, cfg RateLimitConfig) error {
+	if !validRateLimit(cfg) {
+		return ErrInvalidRateLimit
+	}
+	cfg.Period = cfg.Period.Truncate(time.Millisecond)
+
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	return s.rateLimitConfigure(sh, key, cfg)
+}
+
+// rateLimitConfigure implements RateLimitConfigure. The caller must hold
+// sh.mu.
+func (s *Store) rateLimitConfigure(sh *shard, key string, cfg RateLimitConfig) error {
+	item, _, err := s.writeRateLimiter(sh, key)
+	if err != nil {
+		return err
+	}
+
+	rl := newRateLimiter(cfg)
+	delta := itemSize(key, rl)
+	if item != nil {
+		delta -= item.size
+	}
+	if err := s.reserveMemory(sh, key, delta); err != nil {
+		return err
+	}
+	s.set(sh, key, rl, nil)
+
+	s.propagate("RL.CONFIG", key, cfg.Mode.String(), strconv.FormatInt(cfg.Limit, 10), strconv.FormatInt(cfg.Period.Milliseconds(), 10))
+	s.notify(notifyString, "rl.config", key)
+	return nil
+}
+
+// RateLimitAcquire atomically takes cost from the rate limiter at key if it
+// allows it. A key without a limiter uses cfg if given, creating a limiter
+// that expires once it has been idle for a period, as it is then back to
+// its initial state; this suits per-client limiters. Without cfg it fails
+// with ErrNoRateLimit. A cost above the limit can never be allowed and fails
+// with ErrCostExceedsLimit.
+func (s *Store) RateLimitAcquire(key string, cost int64, cfg *RateLimitConfig) (RateLimitResult, error) {
+	if cost < 0 {
+		return RateLimitResult{}, errors.New("cost must not be negative")
+	}
+	if cfg != nil {
+		if !validRateLimit(*cfg) {
+			return RateLimitResult{}, ErrInvalidRateLimit
+		}
+		c := *cfg
+		c.Period = c.Period.Truncate(time.Millisecond)
+		cfg = &c
+	}
+
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	return s.rateLimitAcquire(sh, key, cost, cfg, time.UnixMilli(time.Now().UnixMilli()))
+}
+
+// rateLimitAcquire implements RateLimitAcquire at the given time. The caller
+// must hold sh.mu.
+func (s *Store) rateLimitAcquire(sh *shard, key string, cost int64, cfg *RateLimitConfig, now time.Time) (RateLimitResult, error) {
+	item, rl, err := s.writeRateLimiter(sh, key)
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+	if item == nil {
+		if cfg == nil {
+			return RateLimitResult{}, ErrNoRateLimit
+		}
+		rl = newRateLimiter(*cfg)
+	}
+	if cost > rl.config.Limit {
+		return RateLimitResult{}, ErrCostExceedsLimit
+	}
+
+	// Work on a copy, so a denied request or an out of memory error leaves
+	// the limiter as it was. Only changes that take something are stored.
+	next := rl.clone()
+	result, delta := next.acquire(cost, now)
+	if !result.Allowed || cost == 0 {
+		return result, nil
+	}
+	if item == nil {
+		delta = itemSize(key, next)
+	}
+	if err := s.reserveMemory(sh, key, delta); err != nil {
+		return RateLimitResult{}, err
+	}
+
+	if item == nil {
+		expiresAt := now.Add(next.config.Period)
+		s.set(sh, key, next, &expiresAt)
+	} else {
+		item.Value = next
+		item.UpdatedAt = time.Now()
+		s.resize(item, delta)
+		if item.ExpiresAt != nil {
+			s.expireAt(sh, key, now.Add(next.config.Period))
+		}
+	}
+
+	args := []string{"RL.ACQUIRE", key, strconv.FormatInt(cost, 10), strconv.FormatInt(now.UnixMilli(), 10)}
+	if item == nil {
+		args = append(args, cfg.Mode.String(), strconv.FormatInt(cfg.Limit, 10), strconv.FormatInt(cfg.Period.Milliseconds(), 10))
+	}
+	s.propagate(args...)
+	s.notify(notifyString, "rl.acquire", key)
+	return result, nil
+}
@@ -0,0 +1,110 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/chaitanyayendru/fincache/internal/config"
+)
+
+func TestTokenBucket(t *testing.T) {
+	rl := newRateLimiter(RateLimitConfig{Mode: RateLimitTokenBucket, Limit: 10, Period: time.Second})
+	now := time.UnixMilli(1_000_000)
+
+	// The bucket starts full and allows a burst up to the limit
+	if result, _ := rl.acquire(10, now); !result.Allowed || result.Remaining != 0 {
+		t.Fatalf("Expected a full burst to be allowed, got %+v", result)
+	}
+	result, _ := rl.acquire(3, now)
+	if result.Allowed || result.RetryAfter != 300*time.Millisecond {
+		t.Errorf("Expected to wait 300ms for 3 tokens, got %+v", result)
+	}
+	if result, _ := rl.acquire(3, now.Add(300*time.Millisecond)); !result.Allowed || result.Remaining != 0 {
+		t.Errorf("Expected 3 tokens after 300ms, got %+v", result)
+	}
+	if result, _ := rl.acquire(0, now.Add(time.Hour)); result.Remaining != 10 || result.ResetAfter != 0 {
+		t.Errorf("Expected the bucket to refill only up to its limit, got %+v", result)
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	rl := newRateLimiter(RateLimitConfig{Mode: RateLimitSlidingWindow, Limit: 5, Period: time.Second})
+	start := time.UnixMilli(1_000_000)
+
+	rl.acquire(2, start)
+	rl.acquire(3, start.Add(400*time.Millisecond))
+	result, _ := rl.acquire(1, start.Add(500*time.Millisecond))
+	if result.Allowed || result.RetryAfter != 500*time.Millisecond {
+		t.Errorf("Expected to wait until the first entry leaves the window, got %+v", result)
+	}
+	result, _ = rl.acquire(3, start.Add(500*time.Millisecond))
+	if result.Allowed || result.RetryAfter != 900*time.Millisecond {
+		t.Errorf("Expected to wait until both entries leave the window, got %+v", result)
+	}
+	if result, _ := rl.acquire(2, start.Add(time.Second)); !result.Allowed || result.Remaining != 0 {
+		t.Errorf("Expected the first entry to have left the window, got %+v", result)
+	}
+	if len(rl.log) != 2 {
+		t.Errorf("Expected expired entries to be dropped, log has %d", len(rl.log))
+	}
+}
+
+func TestRateLimitAcquire(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	if _, err := store.RateLimitAcquire("api", 1, nil); !errors.Is(err, ErrNoRateLimit) {
+		t.Errorf("Expected ErrNoRateLimit, got %v", err)
+	}
+	if err := store.RateLimitConfigure("api", RateLimitConfig{Mode: RateLimitSlidingWindow, Limit: 2, Period: time.Minute}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	store.RateLimitAcquire("api", 1, nil)
+	store.RateLimitAcquire("api", 1, nil)
+	if result, _ := store.RateLimitAcquire("api", 1, nil); result.Allowed || result.RetryAfter <= 0 {
+		t.Errorf("Expected the third request to be denied, got %+v", result)
+	}
+	if _, err := store.RateLimitAcquire("api", 3, nil); !errors.Is(err, ErrCostExceedsLimit) {
+		t.Errorf("Expected ErrCostExceedsLimit, got %v", err)
+	}
+	if ttl, _ := store.TTL("api"); ttl != -1 {
+		t.Errorf("Expected a configured limiter not to expire, got %v", ttl)
+	}
+
+	// Limiters created on the fly expire once idle for a period
+	cfg := &RateLimitConfig{Mode: RateLimitTokenBucket, Limit: 5, Period: time.Minute}
+	if result, _ := store.RateLimitAcquire("client:1", 2, cfg); !result.Allowed || result.Remaining != 3 {
+		t.Errorf("Expected 3 remaining, got %+v", result)
+	}
+	if ttl, _ := store.TTL("client:1"); ttl <= 0 || ttl > time.Minute {
+		t.Errorf("Expected the limiter to expire within a period, got %v", ttl)
+	}
+	store.Set("string", "x", 0)
+	if _, err := store.RateLimitAcquire("string", 1, cfg); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType, got %v", err)
+	}
+}
+
+func TestRateLimitPersists(t *testing.T) {
+	cfg := aofConfig(t.TempDir())
+	store := NewStore(cfg)
+	store.RateLimitConfigure("window", RateLimitConfig{Mode: RateLimitSlidingWindow, Limit: 3, Period: time.Hour})
+	store.RateLimitAcquire("window", 2, nil)
+	if err := store.SaveSnapshot(); err != nil {
+		t.Fatalf("Expected no error when saving snapshot: %v", err)
+	}
+	bucket := &RateLimitConfig{Mode: RateLimitTokenBucket, Limit: 10, Period: time.Hour}
+	store.RateLimitAcquire("bucket", 4, bucket)
+	store.Close()
+
+	restored := NewStore(cfg)
+	defer restored.Close()
+
+	if result, _ := restored.RateLimitAcquire("window", 0, nil); result.Remaining != 1 {
+		t.Errorf("Expected 1 remaining in the window after replay, got %+v", result)
+	}
+	if result, _ := restored.RateLimitAcquire("bucket", 0, nil); result.Remaining != 6 {
+		t.Errorf("Expected 6 tokens after replay, got %+v", result)
+	}
+}
@@ -0,0 +1,81 @@
+package store
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// defaultScanCount is how many members a scan looks at per call when the
+// caller gives no count, as in Redis.
+const defaultScanCount = 10
+
+// scanPosition returns where member comes in the order SSCAN and HSCAN visit
+// members in, from 1 to 1<<62. Unlike an index into a sorted copy it does not
+// shift as other members come and go, so a member that is present for a
+// whole scan is always returned.
+func scanPosition(member string) int {
+	h, _ := filterHash(member)
+	return int(h>>2) + 1
+}
+
+// scanPage returns the page of a scan resuming at cursor over the members
+// each visits: the count members with the lowest positions from cursor on,
+// in position order, and the cursor of the next page, 0 once the scan is
+// complete. Members that share the position of the last one come in the
+// same page, so a page may have more than count members. It takes two
+// passes and keeps count positions, rather than sorting every member.
+func scanPage(cursor, count int, each func(visit func(member string))) ([]string, int) {
+	if count <= 0 {
+		count = defaultScanCount
+	}
+
+	// The count lowest positions from cursor on; the largest is the last of
+	// the page
+	lowest := &positionHeap{}
+	each(func(member string) {
+		pos := scanPosition(member)
+		if pos < cursor {
+			return
+		}
+		if lowest.Len() < count {
+			heap.Push(lowest, pos)
+		} else if pos < (*lowest)[0] {
+			(*lowest)[0] = pos
+			heap.Fix(lowest, 0)
+		}
+	})
+	if lowest.Len() == 0 {
+		return []string{}, 0
+	}
+	last := (*lowest)[0]
+
+	var page []string
+	more := false
+	each(func(member string) {
+		if pos := scanPosition(member); pos > last {
+			more = true
+		} else if pos >= cursor {
+			page = append(page, member)
+		}
+	})
+	sort.Slice(page, func(i, j int) bool { return scanPosition(page[i]) < scanPosition(page[j]) })
+
+	if !more {
+		return page, 0
+	}
+	return page, last + 1
+}
+
+// positionHeap is a max-heap of scan positions.
+type positionHeap []int
+
+func (h positionHeap) Len() int            { return len(h) }
+func (h positionHeap) Less(i, j int) bool  { return h[i] > h[j] }
+func (h positionHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *positionHeap) Push(x interface{}) { *h = append(*h, x.(int)) }
+func (h *positionHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
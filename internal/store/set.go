@@ -0,0 +1,638 @@
+package store
+
+import (
+	"math/rand"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const defaultSetMaxIntsetEntries = 512
+
+// Set is the value of a set key. Like in Redis, a set whose members are all
+// integers is kept as a sorted slice of int64 (an intset) until it grows past
+// StoreConfig.SetMaxIntsetEntries, which takes a fraction of the memory of a
+// map; it converts to a map of strings on the first non-integer member or
+// when it grows too large, and never converts back. It is guarded by the lock
+// of the shard holding the key.
+type Set struct {
+	ints    []int64             // intset encoding, used while members is nil
+	members map[string]struct{} // hashtable encoding
+}
+
+func newSet() *Set {
+	return &Set{}
+}
+
+// parseSetInt reports whether member is an integer in canonical form, i.e.
+// one that formats back to the same string.
+func parseSetInt(member string) (int64, bool) {
+	if len(member) == 0 || len(member) > 20 {
+		return 0, false
+	}
+	v, err := strconv.ParseInt(member, 10, 64)
+	return v, err == nil && strconv.FormatInt(v, 10) == member
+}
+
+// Encoding returns "intset" or "hashtable".
+func (st *Set) Encoding() string {
+	if st.members == nil {
+		return "intset"
+	}
+	return "hashtable"
+}
+
+// Len returns the number of members.
+func (st *Set) Len() int {
+	if st.members == nil {
+		return len(st.ints)
+	}
+	return len(st.members)
+}
+
+func (st *Set) searchInt(v int64) (int, bool) {
+	i := sort.Search(len(st.ints), func(i int) bool { return st.ints[i] >= v })
+	return i, i < len(st.ints) && st.ints[i] == v
+}
+
+func (st *Set) has(member string) bool {
+	if st.members != nil {
+		_, exists := st.members[member]
+		return exists
+	}
+	v, ok := parseSetInt(member)
+	if !ok {
+		return false
+	}
+	_, exists := st.searchInt(v)
+	return exists
+}
+
+// add inserts member, converting the encoding if needed, and returns whether
+// it was added and by how much the estimated size changed.
+func (st *Set) add(member string, maxIntsetEntries int) (bool, int64) {
+	if st.members == nil {
+		if v, ok := parseSetInt(member); ok && len(st.ints) < maxIntsetEntries {
+			i, exists := st.searchInt(v)
+			if exists {
+				return false, 0
+			}
+			st.ints = append(st.ints, 0)
+			copy(st.ints[i+1:], st.ints[i:])
+			st.ints[i] = v
+			return true, 8
+		}
+		if st.has(member) {
+			return false, 0
+		}
+
+		before := st.size()
+		st.toHashtable()
+		st.members[member] = struct{}{}
+		return true, st.size() - before
+	}
+
+	if _, exists := st.members[member]; exists {
+		return false, 0
+	}
+	st.members[member] = struct{}{}
+	return true, setMemberSize(member)
+}
+
+func (st *Set) toHashtable() {
+	st.members = make(map[string]struct{}, len(st.ints)+1)
+	for _, v := range st.ints {
+		st.members[strconv.FormatInt(v, 10)] = struct{}{}
+	}
+	st.ints = nil
+}
+
+// remove deletes member and returns whether it existed and by how much the
+// estimated size changed.
+func (st *Set) remove(member string) (bool, int64) {
+	if st.members != nil {
+		if _, exists := st.members[member]; !exists {
+			return false, 0
+		}
+		delete(st.members, member)
+		return true, -setMemberSize(member)
+	}
+
+	v, ok := parseSetInt(member)
+	if !ok {
+		return false, 0
+	}
+	i, exists := st.searchInt(v)
+	if !exists {
+		return false, 0
+	}
+	st.ints = append(st.ints[:i], st.ints[i+1:]...)
+	return true, -8
+}
+
+// list returns the members; intsets come out in ascending order.
+func (st *Set) list() []string {
+	members := make([]string, 0, st.Len())
+	if st.members == nil {
+		for _, v := range st.ints {
+			members = append(members, strconv.FormatInt(v, 10))
+		}
+		return members
+	}
+	for member := range st.members {
+		members = append(members, member)
+	}
+	return members
+}
+
+// each calls fn with every member.
+func (st *Set) each(fn func(member string)) {
+	if st.members == nil {
+		for _, v := range st.ints {
+			fn(strconv.FormatInt(v, 10))
+		}
+		return
+	}
+	for member := range st.members {
+		fn(member)
+	}
+}
+
+// random returns a random member of a non-empty set.
+func (st *Set) random() string {
+	if st.members == nil {
+		return strconv.FormatInt(st.ints[rand.Intn(len(st.ints))], 10)
+	}
+	// Map iteration starts at a random position
+	for member := range st.members {
+		return member
+	}
+	return ""
+}
+
+func (st *Set) size() int64 {
+	if st.members == nil {
+		return sliceOverhead + 8*int64(len(st.ints))
+	}
+	size := int64(mapOverhead)
+	for member := range st.members {
+		size += setMemberSize(member)
+	}
+	return size
+}
+
+func (st *Set) clone() *Set {
+	c := &Set{}
+	if st.members == nil {
+		c.ints = append([]int64(nil), st.ints...)
+		return c
+	}
+	c.members = make(map[string]struct{}, len(st.members))
+	for member := range st.members {
+		c.members[member] = struct{}{}
+	}
+	return c
+}
+
+func setMemberSize(member string) int64 {
+	return entryOverhead + stringOverhead + int64(len(member))
+}
+
+// readSet returns the set at key for a read, nil if there is none, and
+// records the lookup. The caller must hold sh.mu for reading.
+func (s *Store) readSet(sh *shard, key string) (*Set, error) {
+	item, exists := sh.data[key]
+	if exists && item.ExpiresAt != nil && time.Now().After(*item.ExpiresAt) {
+		exists = false
+	}
+	if !exists {
+		if _, isZSet := sh.sortedSets[key]; isZSet {
+			return nil, ErrWrongType
+		}
+		s.stats.recordLookup(false)
+		return nil, nil
+	}
+
+	set, ok := item.Value.(*Set)
+	if !ok {
+		return nil, ErrWrongType
+	}
+	s.stats.recordLookup(true)
+	s.touch(item)
+	return set, nil
+}
+
+// writeSet returns the item holding the set at key for a write, deleting it
+// first if it has expired. It returns a nil item if there is no set. The
+// caller must hold sh.mu.
+func (s *Store) writeSet(sh *shard, key string) (*Item, *Set, error) {
+	if _, isZSet := sh.sortedSets[key]; isZSet {
+		return nil, nil, ErrWrongType
+	}
+	item, exists := sh.data[key]
+	if !exists {
+		return nil, nil, nil
+	}
+	if item.ExpiresAt != nil && time.Now().After(*item.ExpiresAt) {
+		s.deleteExpired(sh, key)
+		return nil, nil, nil
+	}
+
+	set, ok := item.Value.(*Set)
+	if !ok {
+		return nil, nil, ErrWrongType
+	}
+	s.touch(item)
+	return item, set, nil
+}
+
+// afterSetWrite deletes the set at key once it is empty, as Redis never keeps
+// empty sets, and otherwise marks it updated. The caller must hold sh.mu.
+func (s *Store) afterSetWrite(sh *shard, key string, item *Item, set *Set) {
+	if set.Len() == 0 {
+		s.del(sh, key)
+		s.notify(notifyGeneric, "del", key)
+		return
+	}
+	item.UpdatedAt = time.Now()
+}
+
+// SAdd adds members to the set at key, creating it if needed, and returns how
+// many were not already members.
+func (s *Store) SAdd(key string, members ...string) (int, error) {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	return s.sadd(sh, key, members)
+}
+
+// sadd implements SAdd. The caller must hold sh.mu.
+func (s *Store) sadd(sh *shard, key string, members []string) (int, error) {
+	item, _, err := s.writeSet(sh, key)
+	if err != nil {
+		return 0, err
+	}
+
+	var delta int64
+	if item == nil {
+		delta = itemSize(key, newSet())
+	}
+	for _, member := range members {
+		delta += setMemberSize(member)
+	}
+	if err := s.reserveMemory(sh, key, delta); err != nil {
+		return 0, err
+	}
+
+	if item == nil {
+		s.set(sh, key, newSet(), nil)
+		item = sh.data[key]
+	}
+	set := item.Value.(*Set)
+
+	added := 0
+	delta = 0
+	for _, member := range members {
+		ok, d := set.add(member, s.setMaxIntsetEntries)
+		if ok {
+			added++
+		}
+		delta += d
+	}
+	s.resize(item, delta)
+	item.UpdatedAt = time.Now()
+
+	if added > 0 {
+		s.propagate(append([]string{"SADD", key}, members...)...)
+		s.notify(notifySet, "sadd", key)
+	}
+	return added, nil
+}
+
+// SRem removes members from the set at key and returns how many existed.
+func (s *Store) SRem(key string, members ...string) (int, error) {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	return s.srem(sh, key, members)
+}
+
+// srem implements SRem. The caller must hold sh.mu.
+func (s *Store) srem(sh *shard, key string, members []string) (int, error) {
+	item, set, err := s.writeSet(sh, key)
+	if err != nil || item == nil {
+		return 0, err
+	}
+
+	var removed []string
+	var delta int64
+	for _, member := range members {
+		if ok, d := set.remove(member); ok {
+			removed = append(removed, member)
+			delta += d
+		}
+	}
+	if len(removed) == 0 {
+		return 0, nil
+	}
+	s.resize(item, delta)
+
+	s.propagate(append([]string{"SREM", key}, removed...)...)
+	s.notify(notifySet, "srem", key)
+	s.afterSetWrite(sh, key, item, set)
+	return len(removed), nil
+}
+
+// SIsMember reports whether member belongs to the set at key.
+func (s *Store) SIsMember(key, member string) (bool, error) {
+	results, err := s.SMIsMember(key, member)
+	if err != nil {
+		return false, err
+	}
+	return results[0], nil
+}
+
+// SMIsMember reports for each of members whether it belongs to the set at
+// key.
+func (s *Store) SMIsMember(key string, members ...string) ([]bool, error) {
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	results := make([]bool, len(members))
+	set, err := s.readSet(sh, key)
+	if err != nil || set == nil {
+		return results, err
+	}
+	for i, member := range members {
+		results[i] = set.has(member)
+	}
+	return results, nil
+}
+
+// SMembers returns the members of the set at key.
+func (s *Store) SMembers(key string) ([]string, error) {
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	set, err := s.readSet(sh, key)
+	if err != nil || set == nil {
+		return []string{}, err
+	}
+	return set.list(), nil
+}
+
+// SCard returns the number of members of the set at key.
+func (s *Store) SCard(key string) (int, error) {
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	set, err := s.readSet(sh, key)
+	if err != nil || set == nil {
+		return 0, err
+	}
+	return set.Len(), nil
+}
+
+// SPop removes and returns up to count random members of the set at key.
+func (s *Store) SPop(key string, count int) ([]string, error) {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	item, set, err := s.writeSet(sh, key)
+	if err != nil || item == nil {
+		return nil, err
+	}
+
+	var popped []string
+	var delta int64
+	for len(popped) < count && set.Len() > 0 {
+		member := set.random()
+		_, d := set.remove(member)
+		popped = append(popped, member)
+		delta += d
+	}
+	if len(popped) == 0 {
+		return popped, nil
+	}
+	s.resize(item, delta)
+
+	// Log the members that were picked, so replay does not depend on chance
+	s.propagate(append([]string{"SREM", key}, popped...)...)
+	s.notify(notifySet, "spop", key)
+	s.afterSetWrite(sh, key, item, set)
+	return popped, nil
+}
+
+// SRandMember returns random members of the set at key without removing
+// them: up to count distinct members if count is positive, or exactly -count
+// members that may repeat if it is negative.
+func (s *Store) SRandMember(key string, count int) ([]string, error) {
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	set, err := s.readSet(sh, key)
+	if err != nil || set == nil || count == 0 {
+		return []string{}, err
+	}
+
+	members := set.list()
+	if count < 0 {
+		picked := make([]string, -count)
+		for i := range picked {
+			picked[i] = members[rand.Intn(len(members))]
+		}
+		return picked, nil
+	}
+
+	rand.Shuffle(len(members), func(i, j int) { members[i], members[j] = members[j], members[i] })
+	return members[:min(count, len(members))], nil
+}
+
+// SScan iterates the members of the set at key starting at cursor; it looks
+// at about count members per call, returns those matching pattern (empty for
+// all) and the cursor to continue from, 0 once the scan is complete. Members
+// present for the whole scan are returned once, as in Redis.
+func (s *Store) SScan(key string, cursor int, pattern string, count int) (int, []string, error) {
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	set, err := s.readSet(sh, key)
+	if err != nil || set == nil {
+		return 0, []string{}, err
+	}
+
+	members, next := scanPage(cursor, count, set.each)
+	page := []string{}
+	for _, member := range members {
+		if pattern == "" || MatchPattern(pattern, member) {
+			page = append(page, member)
+		}
+	}
+	return next, page, nil
+}
+
+// Set algebra operations.
+const (
+	setUnion = iota
+	setInter
+	setDiff
+)
+
+// SUnion returns the members of the union of the sets at keys.
+func (s *Store) SUnion(keys ...string) ([]string, error) {
+	return s.setAlgebra(setUnion, "", keys)
+}
+
+// SInter returns the members of the intersection of the sets at keys.
+func (s *Store) SInter(keys ...string) ([]string, error) {
+	return s.setAlgebra(setInter, "", keys)
+}
+
+// SDiff returns the members of the first set that are in none of the others.
+func (s *Store) SDiff(keys ...string) ([]string, error) {
+	return s.setAlgebra(setDiff, "", keys)
+}
+
+// SUnionStore stores the union of the sets at keys in destination, replacing
+// it, and returns its size.
+func (s *Store) SUnionStore(destination string, keys ...string) (int, error) {
+	members, err := s.setAlgebra(setUnion, destination, keys)
+	return len(members), err
+}
+
+// SInterStore stores the intersection of the sets at keys in destination,
+// replacing it, and returns its size.
+func (s *Store) SInterStore(destination string, keys ...string) (int, error) {
+	members, err := s.setAlgebra(setInter, destination, keys)
+	return len(members), err
+}
+
+// SDiffStore stores the difference of the sets at keys in destination,
+// replacing it, and returns its size.
+func (s *Store) SDiffStore(destination string, keys ...string) (int, error) {
+	members, err := s.setAlgebra(setDiff, destination, keys)
+	return len(members), err
+}
+
+// setAlgebra computes op over the sets at keys under their shard locks and,
+// if destination is set, stores the result there atomically.
+func (s *Store) setAlgebra(op int, destination string, keys []string) ([]string, error) {
+	locked := keys
+	if destination != "" {
+		locked = append([]string{destination}, keys...)
+	}
+	unlock := s.lockKeys(locked...)
+	defer unlock()
+
+	sets := make([]*Set, len(keys))
+	for i, key := range keys {
+		set, err := s.readSet(s.shardFor(key), key)
+		if err != nil {
+			return nil, err
+		}
+		sets[i] = set
+	}
+
+	result := make(map[string]struct{})
+	switch op {
+	case setUnion:
+		for _, set := range sets {
+			if set != nil {
+				for _, member := range set.list() {
+					result[member] = struct{}{}
+				}
+			}
+		}
+	case setInter:
+		// Start from the smallest set; a missing key empties the result
+		smallest := -1
+		for i, set := range sets {
+			if set == nil {
+				smallest = -1
+				break
+			}
+			if smallest < 0 || set.Len() < sets[smallest].Len() {
+				smallest = i
+			}
+		}
+		if smallest >= 0 {
+		members:
+			for _, member := range sets[smallest].list() {
+				for i, set := range sets {
+					if i != smallest && !set.has(member) {
+						continue members
+					}
+				}
+				result[member] = struct{}{}
+			}
+		}
+	case setDiff:
+		if sets[0] != nil {
+		diff:
+			for _, member := range sets[0].list() {
+				for _, set := range sets[1:] {
+					if set != nil && set.has(member) {
+						continue diff
+					}
+				}
+				result[member] = struct{}{}
+			}
+		}
+	}
+
+	members := make([]string, 0, len(result))
+	for member := range result {
+		members = append(members, member)
+	}
+	if destination == "" {
+		return members, nil
+	}
+
+	if err := s.storeSet(s.shardFor(destination), destination, members); err != nil {
+		return nil, err
+	}
+	event := [...]string{"sunionstore", "sinterstore", "sdiffstore"}[op]
+	s.notify(notifySet, event, destination)
+	return members, nil
+}
+
+// storeSet replaces key with a set of members, or deletes it if there are
+// none. The write is logged as DEL and SADD, which replays the same result
+// whatever the sources held. The caller must hold sh.mu.
+func (s *Store) storeSet(sh *shard, key string, members []string) error {
+	if _, isZSet := sh.sortedSets[key]; isZSet {
+		return ErrWrongType
+	}
+
+	set := newSet()
+	for _, member := range members {
+		set.add(member, s.setMaxIntsetEntries)
+	}
+
+	var delta int64
+	if len(members) > 0 {
+		delta = itemSize(key, set)
+	}
+	if prev, exists := sh.data[key]; exists {
+		delta -= prev.size
+	}
+	if err := s.reserveMemory(sh, key, delta); err != nil {
+		return err
+	}
+
+	s.del(sh, key)
+	s.propagate("DEL", key)
+	if len(members) > 0 {
+		s.set(sh, key, set, nil)
+		s.propagate(append([]string{"SADD", key}, members...)...)
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package store
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/chaitanyayendru/fincache/internal/config"
+)
+
+// sortedMembers sorts the members returned by a set read, for comparisons.
+func sortedMembers(members []string, err error) []string {
+	sort.Strings(members)
+	return members
+}
+
+func TestSetBasics(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	if added, err := store.SAdd("blocked", "card-1", "card-2", "card-1"); err != nil || added != 2 {
+		t.Fatalf("Expected 2 members added, got %d (%v)", added, err)
+	}
+	if added, _ := store.SAdd("blocked", "card-2", "card-3"); added != 1 {
+		t.Errorf("Expected 1 member added, got %d", added)
+	}
+	if n, _ := store.SCard("blocked"); n != 3 {
+		t.Errorf("Expected 3 members, got %d", n)
+	}
+	if ok, _ := store.SIsMember("blocked", "card-3"); !ok {
+		t.Error("Expected card-3 to be a member")
+	}
+	if results, _ := store.SMIsMember("blocked", "card-1", "card-9"); !reflect.DeepEqual(results, []bool{true, false}) {
+		t.Errorf("Expected [true false], got %v", results)
+	}
+
+	if n, _ := store.SRem("blocked", "card-1", "card-9"); n != 1 {
+		t.Errorf("Expected 1 member removed, got %d", n)
+	}
+	if got := sortedMembers(store.SMembers("blocked")); !reflect.DeepEqual(got, []string{"card-2", "card-3"}) {
+		t.Errorf("Unexpected members %v", got)
+	}
+
+	popped, _ := store.SPop("blocked", 5)
+	if len(popped) != 2 || store.Exists("blocked") {
+		t.Errorf("Expected SPOP to empty and delete the set, got %v", popped)
+	}
+	if store.UsedMemory() != 0 || store.Stats().KeysByType["set"] != 0 {
+		t.Errorf("Expected accounting to return to zero, got %d bytes", store.UsedMemory())
+	}
+
+	store.Set("plain", "value", 0)
+	if _, err := store.SAdd("plain", "x"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected ErrWrongType, got %v", err)
+	}
+}
+
+func TestSetIntsetEncoding(t *testing.T) {
+	store := NewStore(config.StoreConfig{SetMaxIntsetEntries: 4})
+	defer store.Close()
+
+	encoding := func() string {
+		sh := store.shardFor("ids")
+		sh.mu.RLock()
+		defer sh.mu.RUnlock()
+		return sh.data["ids"].Value.(*Set).Encoding()
+	}
+
+	store.SAdd("ids", "3", "1", "2")
+	if e := encoding(); e != "intset" {
+		t.Errorf("Expected intset for small integer sets, got %s", e)
+	}
+	if got, _ := store.SMembers("ids"); !reflect.DeepEqual(got, []string{"1", "2", "3"}) {
+		t.Errorf("Expected sorted intset members, got %v", got)
+	}
+	// Non-canonical integers are not intset members
+	if ok, _ := store.SIsMember("ids", "01"); ok {
+		t.Error("Expected '01' not to match 1")
+	}
+
+	store.SAdd("ids", "4", "5")
+	if e := encoding(); e != "hashtable" {
+		t.Errorf("Expected conversion past the entry limit, got %s", e)
+	}
+	store.SAdd("other", "1", "x")
+	if ok, _ := store.SIsMember("other", "1"); !ok {
+		t.Error("Expected members to survive conversion")
+	}
+
+	size := store.UsedMemory()
+	store.Del("ids", "other")
+	if store.UsedMemory() != 0 || size == 0 {
+		t.Errorf("Expected accounting to return to zero, got %d bytes", store.UsedMemory())
+	}
+}
+
+func TestSetAlgebra(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	store.SAdd("a", "1", "2", "3", "x")
+	store.SAdd("b", "2", "3", "4")
+	store.SAdd("c", "3", "x")
+
+	if got := sortedMembers(store.SUnion("a", "b", "missing")); !reflect.DeepEqual(got, []string{"1", "2", "3", "4", "x"}) {
+		t.Errorf("Unexpected union %v", got)
+	}
+	if got := sortedMembers(store.SInter("a", "b", "c")); !reflect.DeepEqual(got, []string{"3"}) {
+		t.Errorf("Unexpected intersection %v", got)
+	}
+	if got, _ := store.SInter("a", "missing"); len(got) != 0 {
+		t.Errorf("Expected an empty intersection with a missing key, got %v", got)
+	}
+	if got := sortedMembers(store.SDiff("a", "b", "c")); !reflect.DeepEqual(got, []string{"1"}) {
+		t.Errorf("Unexpected difference %v", got)
+	}
+
+	if n, _ := store.SInterStore("a", "a", "b"); n != 2 {
+		t.Errorf("Expected 2 members stored, got %d", n)
+	}
+	if got := sortedMembers(store.SMembers("a")); !reflect.DeepEqual(got, []string{"2", "3"}) {
+		t.Errorf("Expected the destination to be replaced, got %v", got)
+	}
+	if n, _ := store.SDiffStore("a", "c", "c"); n != 0 || store.Exists("a") {
+		t.Errorf("Expected an empty result to delete the destination, got %d", n)
+	}
+}
+
+func TestSRandMemberAndSScan(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	for i := 0; i < 25; i++ {
+		store.SAdd("ids", strconv.Itoa(i))
+	}
+
+	if got, _ := store.SRandMember("ids", 10); len(got) != 10 {
+		t.Errorf("Expected 10 distinct members, got %v", got)
+	}
+	if got, _ := store.SRandMember("ids", 100); len(got) != 25 {
+		t.Errorf("Expected a positive count to be capped at the set size, got %d", len(got))
+	}
+	if got, _ := store.SRandMember("ids", -40); len(got) != 40 {
+		t.Errorf("Expected a negative count to allow repeats, got %d", len(got))
+	}
+
+	var seen []string
+	cursor := 0
+	for {
+		next, page, err := store.SScan("ids", cursor, "1*", 7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen = append(seen, page...)
+		if cursor = next; cursor == 0 {
+			break
+		}
+	}
+	sort.Strings(seen)
+	want := []string{"1", "10", "11", "12", "13", "14", "15", "16", "17", "18", "19"}
+	if !reflect.DeepEqual(seen, want) {
+		t.Errorf("Expected %v, got %v", want, seen)
+	}
+}
+
+func TestSScanSurvivesRemovals(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	for _, encoding := range []string{"ints", "strings"} {
+		key := "blacklist:" + encoding
+		for i := 1; i <= 20; i++ {
+			member := strconv.Itoa(i)
+			if encoding == "strings" {
+				member = "card" + member
+			}
+			store.SAdd(key, member)
+		}
+
+		seen := map[string]bool{}
+		cursor := 0
+		for {
+			next, page, err := store.SScan(key, cursor, "", 5)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, member := range page {
+				seen[member] = true
+				// Removing members already returned must not skip others
+				store.SRem(key, member)
+			}
+			if cursor = next; cursor == 0 {
+				break
+			}
+		}
+		if len(seen) != 20 {
+			t.Errorf("Expected all 20 %s members, got %d", encoding, len(seen))
+		}
+	}
+}
+
+func TestSetPersistence(t *testing.T) {
+	cfg := aofConfig(t.TempDir())
+
+	store := NewStore(cfg)
+	store.SAdd("snap", "1", "2", "card")
+	if err := store.SaveSnapshot(); err != nil {
+		t.Fatalf("Expected no error when saving snapshot: %v", err)
+	}
+	store.SAdd("log", "a", "b", "c", "d")
+	store.SRem("log", "a")
+	store.SPop("log", 1)
+	store.SAdd("other", "c", "z")
+	store.SUnionStore("dest", "log", "other")
+	want := sortedMembers(store.SMembers("log"))
+	union := sortedMembers(store.SMembers("dest"))
+	store.Close()
+
+	restored := NewStore(cfg)
+	defer restored.Close()
+
+	if got := sortedMembers(restored.SMembers("snap")); !reflect.DeepEqual(got, []string{"1", "2", "card"}) {
+		t.Errorf("Unexpected snapshotted set %v", got)
+	}
+	if got := sortedMembers(restored.SMembers("log")); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected replayed SPOP to remove the same member, want %v got %v", want, got)
+	}
+	if got := sortedMembers(restored.SMembers("dest")); !reflect.DeepEqual(got, union) {
+		t.Errorf("Expected SUNIONSTORE to be replayed, want %v got %v", union, got)
+	}
+}
@@ -0,0 +1,139 @@
+package store
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const defaultShards = 16
+
+// shard is one hash partition of the keyspace. Every key lives in exactly one
+// shard, chosen by shardFor, and the shard lock guards its maps along with
+// the mutable fields of its items. Item fields that reads update (the access
+// time and counters) are only changed with atomics, so Get needs no more than
+// the read lock.
+type shard struct {
+	id int // position in core.allShards, which is also the lock order
+	db int // index of the database the shard belongs to
+
+	mu         sync.RWMutex
+	data       map[string]*Item
+	ttl        map[string]time.Time
+	sortedSets map[string]*SortedSet
+
+	// hashTTL holds the keys of hashes with field TTLs, for active expiry.
+	hashTTL map[string]struct{}
+
+	// waiters holds the callers blocked on a key, see blocking.go. It is not
+	// part of the keyspace and stays with the shard when data is swapped.
+	waiters map[string][]chan struct{}
+}
+
+func newShard() *shard {
+	return &shard{
+		data:       make(map[string]*Item),
+		ttl:        make(map[string]time.Time),
+		sortedSets: make(map[string]*SortedSet),
+	}
+}
+
+func newShards(n int) []*shard {
+	if n <= 0 {
+		n = defaultShards
+	}
+	shards := make([]*shard, n)
+	for i := range shards {
+		shards[i] = newShard()
+	}
+	return shards
+}
+
+// shardIndex hashes key with 32-bit FNV-1a.
+func (s *Store) shardIndex(key string) int {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return int(h % uint32(len(s.shards)))
+}
+
+func (s *Store) shardFor(key string) *shard {
+	return s.shards[s.shardIndex(key)]
+}
+
+// lockKeys write-locks the shards of s holding keys and returns a function
+// that unlocks them.
+func (s *Store) lockKeys(keys ...string) (unlock func()) {
+	shards := make([]*shard, 0, len(keys))
+	for _, key := range keys {
+		shards = append(shards, s.shardFor(key))
+	}
+	return lockShards(shards...)
+}
+
+// lockShards write-locks shards, which may belong to different databases, and
+// returns a function that unlocks them. Shards are always locked in id order,
+// so multi-key operations cannot deadlock with each other or with the
+// lockAll family.
+func lockShards(shards ...*shard) (unlock func()) {
+	sorted := make([]*shard, 0, len(shards))
+	seen := make(map[*shard]bool, len(shards))
+	for _, sh := range shards {
+		if !seen[sh] {
+			seen[sh] = true
+			sorted = append(sorted, sh)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].id < sorted[j].id })
+
+	for _, sh := range sorted {
+		sh.mu.Lock()
+	}
+	return func() {
+		for i := len(sorted) - 1; i >= 0; i-- {
+			sorted[i].mu.Unlock()
+		}
+	}
+}
+
+// lockAll and rlockAll lock every shard of the database in id order, for
+// operations on the whole database such as Flush.
+func (s *Store) lockAll() {
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+	}
+}
+
+func (s *Store) unlockAll() {
+	for i := len(s.shards) - 1; i >= 0; i-- {
+		s.shards[i].mu.Unlock()
+	}
+}
+
+// lockAllDBs and rlockAllDBs lock every shard of every database, for
+// FLUSHALL and snapshots.
+func (c *core) lockAllDBs() {
+	for _, sh := range c.allShards {
+		sh.mu.Lock()
+	}
+}
+
+func (c *core) unlockAllDBs() {
+	for i := len(c.allShards) - 1; i >= 0; i-- {
+		c.allShards[i].mu.Unlock()
+	}
+}
+
+func (c *core) rlockAllDBs() {
+	for _, sh := range c.allShards {
+		sh.mu.RLock()
+	}
+}
+
+func (c *core) runlockAllDBs() {
+	for i := len(c.allShards) - 1; i >= 0; i-- {
+		c.allShards[i].mu.RUnlock()
+	}
+}
@@ -0,0 +1,87 @@
+package store
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chaitanyayendru/fincache/internal/config"
+)
+
+func TestKeysSpreadAcrossShards(t *testing.T) {
+	store := NewStore(config.StoreConfig{Shards: 8})
+	defer store.Close()
+
+	for i := 0; i < 1000; i++ {
+		store.Set(fmt.Sprintf("key%d", i), "value", 0)
+	}
+
+	for i, sh := range store.shards {
+		if n := len(sh.data); n < 50 {
+			t.Errorf("Expected shard %d to hold a fair share of 1000 keys, got %d", i, n)
+		}
+	}
+	if n := len(store.Keys("*")); n != 1000 {
+		t.Errorf("Expected 1000 keys, got %d", n)
+	}
+}
+
+func TestDelMultipleKeys(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	store.Set("a", "value", 0)
+	store.Set("b", "value", 0)
+
+	if n := store.Del("a", "b", "missing", "a"); n != 2 {
+		t.Errorf("Expected 2 keys deleted, got %d", n)
+	}
+	if store.Exists("a") || store.Exists("b") {
+		t.Error("Expected keys to be deleted")
+	}
+}
+
+// Run with -race: readers, writers, multi-key deletes and flushes on the same
+// keys must not race.
+func TestConcurrentAccess(t *testing.T) {
+	store := NewStore(config.StoreConfig{MaxMemory: "64KB", EvictionPolicy: PolicyAllKeysLFU})
+	defer store.Close()
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				key := fmt.Sprintf("key%d", i%50)
+				switch (w + i) % 6 {
+				case 0:
+					store.Set(key, i, time.Minute)
+				case 1:
+					store.Get(key)
+				case 2:
+					store.Del(key, fmt.Sprintf("key%d", (i+1)%50))
+				case 3:
+					store.ZIncrBy("book", 1, key)
+				case 4:
+					store.Expire(key, time.Millisecond)
+				case 5:
+					if i%100 == 0 {
+						store.Flush()
+					}
+					store.Exists(key)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	var keys int64
+	for _, sh := range store.shards {
+		keys += int64(len(sh.data) + len(sh.sortedSets))
+	}
+	if n := store.Stats().TotalKeys; n != keys {
+		t.Errorf("Expected key counters to match the shards, got %d and %d", n, keys)
+	}
+}
@@ -0,0 +1,431 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc64"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Snapshot file layout:
+//
+//	magic "FINCACHE" | version (uvarint) | records... | opEOF | CRC-64 (8 bytes, big endian)
+//
+// The checksum covers every byte before it. Each record starts with an
+// opcode; aux records carry metadata as string pairs and unknown aux keys are
+// ignored so newer writers stay readable by older readers. Key records belong
+// to the database named by the last select record, database 0 before the
+// first one; version 1 files have no select records.
+const (
+	snapshotMagic   = "FINCACHE"
+	snapshotVersion = 2
+
+	opAux       byte = 0xFA
+	opSelectDB  byte = 0xFE
+	opItem      byte = 0x01
+	opSortedSet byte = 0x02
+	opEOF       byte = 0xFF
+)
+
+var (
+	crcTable = crc64.MakeTable(crc64.ECMA)
+
+	errSnapshotPathUnset = errors.New("snapshot path is not configured")
+)
+
+// snapshotData is the decoded content of a snapshot file.
+type snapshotData struct {
+	epoch uint64
+	dbs   map[int]*snapshotDB
+}
+
+// snapshotDB is the content of one database in a snapshot.
+type snapshotDB struct {
+	items      map[string]*Item
+	sortedSets map[string]*SortedSet
+}
+
+// db returns the content of database index, creating it if needed.
+func (d *snapshotData) db(index int) *snapshotDB {
+	if d.dbs == nil {
+		d.dbs = make(map[int]*snapshotDB)
+	}
+	db, exists := d.dbs[index]
+	if !exists {
+		db = &snapshotDB{
+			items:      make(map[string]*Item),
+			sortedSets: make(map[string]*SortedSet),
+		}
+		d.dbs[index] = db
+	}
+	return db
+}
+
+// keys returns the number of keys in the snapshot.
+func (d *snapshotData) keys() int {
+	n := 0
+	for _, db := range d.dbs {
+		n += len(db.items) + len(db.sortedSets)
+	}
+	return n
+}
+
+func (s *Store) snapshotWorker() {
+	interval := s.config.SnapshotInterval
+	if interval <= 0 {
+		interval = 5 * time.Minute
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.SaveSnapshot(); err != nil {
+				s.logger.Error("Failed to save snapshot", zap.Error(err))
+			}
+		}
+	}
+}
+
+// SaveSnapshot writes the whole keyspace to StoreConfig.SnapshotPath. The file
+// is written to a temporary file in the same directory and renamed into place,
+// so readers only ever observe a complete snapshot. When the append-only log
+// is enabled a new log segment is started at the same point, and the older
+// segments are removed once the snapshot is durable.
+func (s *Store) SaveSnapshot() error {
+	path := s.config.SnapshotPath
+	if path == "" {
+		return errSnapshotPathUnset
+	}
+
+	s.snapshotMu.Lock()
+	defer s.snapshotMu.Unlock()
+
+	start := time.Now()
+
+	// Holding every shard lock stops writers, so the copy is a consistent
+	// point in time and the log can be rotated at exactly that point.
+	s.rlockAllDBs()
+	s.epoch++
+	data := &snapshotData{epoch: s.epoch}
+	for _, sh := range s.allShards {
+		if len(sh.data) == 0 && len(sh.sortedSets) == 0 {
+			continue
+		}
+		db := data.db(sh.db)
+		for k, v := range sh.data {
+			db.items[k] = v.clone()
+		}
+		for k, v := range sh.sortedSets {
+			db.sortedSets[k] = v.clone()
+		}
+	}
+	if s.aof != nil {
+		if err := s.aof.rotate(data.epoch); err != nil {
+			s.runlockAllDBs()
+			return err
+		}
+	}
+	s.runlockAllDBs()
+
+	size, err := writeSnapshotFile(path, data)
+	if err != nil {
+		return err
+	}
+
+	s.baseSize.Store(size)
+	if s.aof != nil {
+		s.aof.removeBefore(data.epoch)
+	}
+
+	s.logger.Info("Snapshot saved",
+		zap.String("path", path),
+		zap.Int("keys", data.keys()),
+		zap.Duration("duration", time.Since(start)))
+
+	return nil
+}
+
+// LoadSnapshot replaces the keyspace with the content of
+// StoreConfig.SnapshotPath. Keys that expired while the process was down are
+// dropped, as are databases beyond StoreConfig.Databases.
+func (s *Store) LoadSnapshot() error {
+	path := s.config.SnapshotPath
+	if path == "" {
+		return errSnapshotPathUnset
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read snapshot: %w", err)
+	}
+
+	data, err := decodeSnapshot(raw)
+	if err != nil {
+		return fmt.Errorf("failed to load snapshot %s: %w", path, err)
+	}
+
+	now := time.Now()
+	shards := make([][]*shard, len(s.dbs))
+	for i, db := range s.dbs {
+		shards[i] = newShards(len(db.shards))
+	}
+	for index, content := range data.dbs {
+		if index < 0 || index >= len(s.dbs) {
+			s.logger.Warn("Dropping database beyond the configured count",
+				zap.Int("db", index),
+				zap.Int("keys", len(content.items)+len(content.sortedSets)))
+			continue
+		}
+
+		for key, item := range content.items {
+			if item.ExpiresAt != nil && now.After(*item.ExpiresAt) {
+				continue
+			}
+
+			item.freq = lfuSeed(item.AccessCount, s.lfuLogFactor)
+			item.accessedAt = item.UpdatedAt.UnixNano()
+
+			sh := shards[index][s.shardIndex(key)]
+			sh.data[key] = item
+			if item.ExpiresAt != nil {
+				sh.ttl[key] = *item.ExpiresAt
+			}
+			if hash, ok := item.Value.(*Hash); ok && len(hash.expires) > 0 {
+				sh.trackHashTTL(key)
+			}
+		}
+		for key, ss := range content.sortedSets {
+			shards[index][s.shardIndex(key)].sortedSets[key] = ss
+		}
+	}
+
+	s.lockAllDBs()
+	for i, db := range s.dbs {
+		for j, sh := range db.shards {
+			sh.data, sh.ttl, sh.sortedSets = shards[i][j].data, shards[i][j].ttl, shards[i][j].sortedSets
+			sh.hashTTL = shards[i][j].hashTTL
+		}
+		db.recountKeys()
+	}
+	s.epoch = data.epoch
+	s.recomputeMemory()
+	s.unlockAllDBs()
+
+	s.baseSize.Store(int64(len(raw)))
+
+	s.logger.Info("Snapshot loaded",
+		zap.String("path", path),
+		zap.Int("keys", int(s.Stats().TotalKeys)))
+
+	return nil
+}
+
+// writeSnapshotFile atomically replaces path with the encoded snapshot and
+// returns its size.
+func writeSnapshotFile(path string, data *snapshotData) (int64, error) {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return 0, fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create snapshot file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	bw := bufio.NewWriter(tmp)
+	if err := encodeSnapshot(bw, data); err != nil {
+		tmp.Close()
+		return 0, fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+	if err := bw.Flush(); err != nil {
+		tmp.Close()
+		return 0, fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return 0, fmt.Errorf("failed to sync snapshot: %w", err)
+	}
+	info, err := tmp.Stat()
+	if err != nil {
+		tmp.Close()
+		return 0, fmt.Errorf("failed to stat snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, fmt.Errorf("failed to close snapshot: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return 0, fmt.Errorf("failed to rename snapshot: %w", err)
+	}
+
+	return info.Size(), syncDir(dir)
+}
+
+// syncDir makes a rename durable by syncing the containing directory.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	// Some platforms do not support fsync on directories; the rename itself
+	// has already happened, so this is best effort.
+	d.Sync()
+	return nil
+}
+
+func encodeSnapshot(w io.Writer, data *snapshotData) error {
+	hash := crc64.New(crcTable)
+	enc := newEncoder(io.MultiWriter(w, hash))
+
+	enc.write([]byte(snapshotMagic))
+	enc.writeUvarint(snapshotVersion)
+
+	enc.writeByte(opAux)
+	enc.writeString("ctime")
+	enc.writeString(strconv.FormatInt(time.Now().Unix(), 10))
+
+	enc.writeByte(opAux)
+	enc.writeString("epoch")
+	enc.writeString(strconv.FormatUint(data.epoch, 10))
+
+	indexes := make([]int, 0, len(data.dbs))
+	for index := range data.dbs {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	for _, index := range indexes {
+		db := data.dbs[index]
+
+		enc.writeByte(opSelectDB)
+		enc.writeUvarint(uint64(index))
+
+		for key, item := range db.items {
+			enc.writeByte(opItem)
+			enc.writeString(key)
+			encodeItem(enc, item)
+		}
+
+		for key, ss := range db.sortedSets {
+			enc.writeByte(opSortedSet)
+			enc.writeString(key)
+			members := ss.ZRangeWithScores(key, 0, -1)
+			enc.writeUvarint(uint64(len(members)))
+			for _, m := range members {
+				enc.writeString(m.Member)
+				enc.writeFloat64(m.Score)
+			}
+		}
+	}
+
+	enc.writeByte(opEOF)
+	if enc.err != nil {
+		return enc.err
+	}
+
+	var sum [8]byte
+	binary.BigEndian.PutUint64(sum[:], hash.Sum64())
+	_, err := w.Write(sum[:])
+	return err
+}
+
+func decodeSnapshot(raw []byte) (*snapshotData, error) {
+	if len(raw) < len(snapshotMagic)+8 || string(raw[:len(snapshotMagic)]) != snapshotMagic {
+		return nil, errors.New("not a snapshot file")
+	}
+
+	body, sum := raw[:len(raw)-8], binary.BigEndian.Uint64(raw[len(raw)-8:])
+	if crc64.Checksum(body, crcTable) != sum {
+		return nil, errors.New("checksum mismatch")
+	}
+
+	dec := newDecoder(bytes.NewReader(body[len(snapshotMagic):]))
+	if version := dec.readUvarint(); dec.err == nil && (version == 0 || version > snapshotVersion) {
+		return nil, fmt.Errorf("unsupported snapshot version %d", version)
+	}
+
+	data := &snapshotData{}
+	db := data.db(0)
+
+	for dec.err == nil {
+		op := dec.readByte()
+		if dec.err != nil {
+			break
+		}
+
+		switch op {
+		case opEOF:
+			return data, nil
+		case opAux:
+			key, value := dec.readString(), dec.readString()
+			if key == "epoch" {
+				data.epoch, _ = strconv.ParseUint(value, 10, 64)
+			}
+		case opSelectDB:
+			db = data.db(int(dec.readUvarint()))
+		case opItem:
+			key := dec.readString()
+			db.items[key] = decodeItem(dec)
+		case opSortedSet:
+			key := dec.readString()
+			ss := NewSortedSet()
+			n := dec.readLen()
+			for i := 0; i < n && dec.err == nil; i++ {
+				member := dec.readString()
+				ss.ZAdd(key, dec.readFloat64(), member)
+			}
+			db.sortedSets[key] = ss
+		default:
+			return nil, fmt.Errorf("unknown record opcode 0x%02x", op)
+		}
+	}
+
+	return nil, dec.err
+}
+
+func encodeItem(enc *encoder, item *Item) {
+	enc.writeString(item.Type)
+	enc.writeTime(item.CreatedAt)
+	enc.writeTime(item.UpdatedAt)
+	if item.ExpiresAt != nil {
+		enc.writeByte(1)
+		enc.writeTime(*item.ExpiresAt)
+	} else {
+		enc.writeByte(0)
+	}
+	enc.writeVarint(item.AccessCount)
+	enc.writeValue(item.Value)
+}
+
+func decodeItem(dec *decoder) *Item {
+	item := &Item{
+		Type:      dec.readString(),
+		CreatedAt: dec.readTime(),
+		UpdatedAt: dec.readTime(),
+	}
+	if dec.readByte() == 1 {
+		expiresAt := dec.readTime()
+		item.ExpiresAt = &expiresAt
+	}
+	item.AccessCount = dec.readVarint()
+	item.Value = dec.readValue()
+	return item
+}
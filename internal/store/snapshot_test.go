@@ -0,0 +1,114 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/chaitanyayendru/fincache/internal/config"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.rdb")
+	cfg := config.StoreConfig{SnapshotPath: path}
+
+	store := NewStore(cfg)
+	store.Set("string", "value", 0)
+	store.Set("int", 42, 0)
+	store.Set("float", 1.25, 0)
+	store.Set("object", map[string]interface{}{"balance": 10.5, "tags": []interface{}{"a", true}}, 0)
+	store.Set("volatile", "soon", time.Hour)
+	store.ZAdd("book", 101.5, "bid-1")
+	store.ZAdd("book", -102.0, "ask-1")
+	store.Get("string")
+
+	if err := store.SaveSnapshot(); err != nil {
+		t.Fatalf("Expected no error when saving snapshot: %v", err)
+	}
+	store.Close()
+
+	restored := NewStore(cfg)
+	defer restored.Close()
+
+	if v, err := restored.Get("string"); err != nil || v != "value" {
+		t.Errorf("Expected 'value', got %v (%v)", v, err)
+	}
+	if v, _ := restored.Get("int"); v != 42 {
+		t.Errorf("Expected int 42, got %#v", v)
+	}
+	if v, _ := restored.Get("float"); v != 1.25 {
+		t.Errorf("Expected 1.25, got %#v", v)
+	}
+	obj, _ := restored.Get("object")
+	if m, ok := obj.(map[string]interface{}); !ok || m["balance"] != 10.5 {
+		t.Errorf("Expected object to be restored, got %#v", obj)
+	}
+	if ttl, _ := restored.TTL("volatile"); ttl <= 0 || ttl > time.Hour {
+		t.Errorf("Expected TTL to be restored, got %v", ttl)
+	}
+	if score, ok := restored.ZScore("book", "bid-1"); !ok || score != 101.5 {
+		t.Errorf("Expected sorted set score 101.5, got %v", score)
+	}
+
+	// One access before the snapshot plus the Get above
+	sh := restored.shardFor("string")
+	sh.mu.RLock()
+	item := sh.data["string"]
+	sh.mu.RUnlock()
+	if item.AccessCount != 2 || item.Type != "string" || item.CreatedAt.IsZero() {
+		t.Errorf("Expected item metadata to be restored, got %+v", item)
+	}
+}
+
+func TestSnapshotDropsExpiredKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.rdb")
+	cfg := config.StoreConfig{SnapshotPath: path}
+
+	store := NewStore(cfg)
+	store.Set("short", "value", 50*time.Millisecond)
+	store.Set("long", "value", 0)
+	if err := store.SaveSnapshot(); err != nil {
+		t.Fatalf("Expected no error when saving snapshot: %v", err)
+	}
+	store.Close()
+
+	time.Sleep(100 * time.Millisecond)
+
+	restored := NewStore(cfg)
+	defer restored.Close()
+
+	if restored.Exists("short") {
+		t.Error("Expected expired key to be dropped on load")
+	}
+	if !restored.Exists("long") {
+		t.Error("Expected persistent key to be loaded")
+	}
+}
+
+func TestSnapshotRejectsCorruption(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.rdb")
+	store := NewStore(config.StoreConfig{SnapshotPath: path})
+	defer store.Close()
+
+	store.Set("key", "value", 0)
+	if err := store.SaveSnapshot(); err != nil {
+		t.Fatalf("Expected no error when saving snapshot: %v", err)
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw[len(raw)/2] ^= 0xFF
+	if err := os.WriteFile(path, raw, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.LoadSnapshot(); err == nil {
+		t.Error("Expected error when loading a corrupt snapshot")
+	}
+	if !store.Exists("key") {
+		t.Error("Expected keyspace to be untouched after a failed load")
+	}
+}
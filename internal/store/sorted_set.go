@@ -3,12 +3,16 @@ package store
 import (
 	"sort"
 	"sync"
+	"time"
 )
 
 type SortedSet struct {
 	mu      sync.RWMutex
 	members map[string]*SortedSetMember
 	scores  map[float64]map[string]bool // score -> set of members
+
+	freq       uint32 // logarithmic access counter, see lfu.go
+	accessedAt int64  // last read or write in Unix nanoseconds, for LRU and LFU decay
 }
 
 type SortedSetMember struct {
@@ -18,15 +22,33 @@ type SortedSetMember struct {
 
 func NewSortedSet() *SortedSet {
 	return &SortedSet{
-		members: make(map[string]*SortedSetMember),
-		scores:  make(map[float64]map[string]bool),
+		members:    make(map[string]*SortedSetMember),
+		scores:     make(map[float64]map[string]bool),
+		freq:       lfuInitVal,
+		accessedAt: time.Now().UnixNano(),
 	}
 }
 
+func (ss *SortedSet) clone() *SortedSet {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+
+	c := NewSortedSet()
+	for member, m := range ss.members {
+		c.zadd(m.Score, member)
+	}
+	return c
+}
+
 func (ss *SortedSet) ZAdd(key string, score float64, member string) int {
 	ss.mu.Lock()
 	defer ss.mu.Unlock()
 
+	return ss.zadd(score, member)
+}
+
+// zadd is ZAdd without locking; the caller must hold ss.mu.
+func (ss *SortedSet) zadd(score float64, member string) int {
 	added := 0
 
 	// Check if member already exists
@@ -61,6 +83,11 @@ func (ss *SortedSet) ZRem(key string, members ...string) int {
 	ss.mu.Lock()
 	defer ss.mu.Unlock()
 
+	return ss.zrem(members...)
+}
+
+// zrem is ZRem without locking; the caller must hold ss.mu.
+func (ss *SortedSet) zrem(members ...string) int {
 	removed := 0
 
 	for _, member := range members {
@@ -200,7 +227,7 @@ func (ss *SortedSet) ZIncrBy(key string, increment float64, member string) float
 		newScore = increment
 	}
 
-	ss.ZAdd(key, newScore, member)
+	ss.zadd(newScore, member)
 	return newScore
 }
 
@@ -213,7 +240,7 @@ func (ss *SortedSet) ZRemRangeByRank(key string, start, stop int) int {
 
 	removed := 0
 	for i := start; i <= stop && i < len(allMembers); i++ {
-		if ss.ZRem(key, allMembers[i].Member) > 0 {
+		if ss.zrem(allMembers[i].Member) > 0 {
 			removed++
 		}
 	}
@@ -237,7 +264,7 @@ func (ss *SortedSet) ZRemRangeByScore(key string, min, max float64) int {
 	}
 
 	for _, member := range toRemove {
-		if ss.ZRem(key, member) > 0 {
+		if ss.zrem(member) > 0 {
 			removed++
 		}
 	}
@@ -0,0 +1,161 @@
+package store
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// keyTypes lists the values of Item.Type, plus "zset" for sorted sets, in the
+// order they are reported.
+var keyTypes = []string{"string", "integer", "float", "boolean", "array", "object", "decimal", "idempotency", "lock", "unknown", "list", "hash", "set", "stream", "ratelimit", "timeseries", "bloom", "cuckoo", "cms", "topk", "tdigest", "zset"}
+
+// KeyTypes returns the key types reported in StoreStats.KeysByType.
+func (s *Store) KeyTypes() []string {
+	return append([]string(nil), keyTypes...)
+}
+
+// keyspaceStats holds the counters of one database behind Stats and DBStats.
+// They are updated with
+// atomics so readers never need a shard lock; writers that change the
+// keyspace update them while holding the shard lock, which keeps them
+// consistent with the maps.
+type keyspaceStats struct {
+	hits        atomic.Int64
+	misses      atomic.Int64
+	expiredKeys atomic.Int64
+	evictions   atomic.Int64
+
+	typeCounts map[string]*atomic.Int64 // fixed set of keys, see keyTypes
+
+	// volatileKeys and ttlSum (sum of expiry times in Unix milliseconds)
+	// track the ttl map so the average TTL is available in O(1).
+	volatileKeys atomic.Int64
+	ttlSum       atomic.Int64
+}
+
+func newKeyspaceStats() *keyspaceStats {
+	ks := &keyspaceStats{typeCounts: make(map[string]*atomic.Int64, len(keyTypes))}
+	for _, typ := range keyTypes {
+		ks.typeCounts[typ] = new(atomic.Int64)
+	}
+	return ks
+}
+
+func (ks *keyspaceStats) recordLookup(hit bool) {
+	if hit {
+		ks.hits.Add(1)
+	} else {
+		ks.misses.Add(1)
+	}
+}
+
+func (ks *keyspaceStats) countType(typ string, delta int64) {
+	if counter, ok := ks.typeCounts[typ]; ok {
+		counter.Add(delta)
+	}
+}
+
+// resetKeyspace zeroes the counters that describe the current keyspace, but
+// not the hit, miss, expiry and eviction totals.
+func (ks *keyspaceStats) resetKeyspace() {
+	for _, counter := range ks.typeCounts {
+		counter.Store(0)
+	}
+	ks.volatileKeys.Store(0)
+	ks.ttlSum.Store(0)
+}
+
+// swapKeyspace exchanges the keyspace counters with other, for SWAPDB. The
+// caller must hold the shard locks of both databases.
+func (ks *keyspaceStats) swapKeyspace(other *keyspaceStats) {
+	for typ, counter := range ks.typeCounts {
+		o := other.typeCounts[typ]
+		n := counter.Load()
+		counter.Store(o.Load())
+		o.Store(n)
+	}
+
+	n := ks.volatileKeys.Load()
+	ks.volatileKeys.Store(other.volatileKeys.Load())
+	other.volatileKeys.Store(n)
+
+	n = ks.ttlSum.Load()
+	ks.ttlSum.Store(other.ttlSum.Load())
+	other.ttlSum.Store(n)
+}
+
+// setTTL records the expiry of key in the ttl map and the TTL counters. The
+// caller must hold sh.mu.
+func (s *Store) setTTL(sh *shard, key string, expiresAt time.Time) {
+	if prev, exists := sh.ttl[key]; exists {
+		s.stats.ttlSum.Add(-prev.UnixMilli())
+	} else {
+		s.stats.volatileKeys.Add(1)
+	}
+	sh.ttl[key] = expiresAt
+	s.stats.ttlSum.Add(expiresAt.UnixMilli())
+}
+
+// clearTTL removes key from the ttl map. The caller must hold sh.mu.
+func (s *Store) clearTTL(sh *shard, key string) {
+	if prev, exists := sh.ttl[key]; exists {
+		s.stats.ttlSum.Add(-prev.UnixMilli())
+		s.stats.volatileKeys.Add(-1)
+		delete(sh.ttl, key)
+	}
+}
+
+// recountKeys rebuilds the keyspace counters of the database from scratch,
+// e.g. after a snapshot has replaced the keyspace. The caller must hold every
+// shard lock of s.
+func (s *Store) recountKeys() {
+	s.stats.resetKeyspace()
+	for _, sh := range s.shards {
+		for _, item := range sh.data {
+			s.stats.countType(item.Type, 1)
+		}
+		s.stats.countType("zset", int64(len(sh.sortedSets)))
+		for _, expiresAt := range sh.ttl {
+			s.stats.volatileKeys.Add(1)
+			s.stats.ttlSum.Add(expiresAt.UnixMilli())
+		}
+	}
+}
+
+// Stats returns a view of the keyspace of every database and the counters of
+// the instance without taking any shard lock.
+func (s *Store) Stats() *StoreStats {
+	stats := &StoreStats{
+		MemoryUsage: s.usedMemory.Load(),
+		MaxMemory:   s.maxMemory,
+		KeysByType:  make(map[string]int64, len(keyTypes)),
+	}
+
+	var ttlSum int64
+	for _, db := range s.dbs {
+		stats.KeyspaceHits += db.stats.hits.Load()
+		stats.KeyspaceMisses += db.stats.misses.Load()
+		stats.Evictions += db.stats.evictions.Load()
+		stats.ExpiredKeys += db.stats.expiredKeys.Load()
+		stats.ExpiringKeys += db.stats.volatileKeys.Load()
+		ttlSum += db.stats.ttlSum.Load()
+
+		for _, typ := range keyTypes {
+			n := db.stats.typeCounts[typ].Load()
+			stats.KeysByType[typ] += n
+			stats.TotalKeys += n
+		}
+	}
+
+	if lookups := stats.KeyspaceHits + stats.KeyspaceMisses; lookups > 0 {
+		stats.HitRate = float64(stats.KeyspaceHits) / float64(lookups)
+		stats.MissRate = float64(stats.KeyspaceMisses) / float64(lookups)
+	}
+
+	if stats.ExpiringKeys > 0 {
+		avg := ttlSum/stats.ExpiringKeys - time.Now().UnixMilli()
+		stats.AvgTTL = max(avg, 0)
+	}
+
+	return stats
+}
@@ -0,0 +1,94 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chaitanyayendru/fincache/internal/config"
+)
+
+func TestStatsHitsAndMisses(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	store.Set("key", "value", 0)
+	store.Get("key")
+	store.Get("key")
+	store.Get("key")
+	store.Get("missing")
+	store.ZScore("book", "bid")
+
+	stats := store.Stats()
+	if stats.KeyspaceHits != 3 || stats.KeyspaceMisses != 2 {
+		t.Errorf("Expected 3 hits and 2 misses, got %d and %d", stats.KeyspaceHits, stats.KeyspaceMisses)
+	}
+	if stats.HitRate != 0.6 || stats.MissRate != 0.4 {
+		t.Errorf("Expected rates 0.6/0.4, got %v/%v", stats.HitRate, stats.MissRate)
+	}
+}
+
+func TestStatsKeysByType(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	store.Set("a", "value", 0)
+	store.Set("b", 42, 0)
+	store.Set("c", 1.5, time.Hour)
+	store.ZAdd("book", 1, "bid")
+	store.Set("a", 7, 0)
+	store.Delete("b")
+
+	stats := store.Stats()
+	if stats.TotalKeys != 3 {
+		t.Errorf("Expected 3 keys, got %d", stats.TotalKeys)
+	}
+	want := map[string]int64{"string": 0, "integer": 1, "float": 1, "zset": 1}
+	for typ, n := range want {
+		if stats.KeysByType[typ] != n {
+			t.Errorf("Expected %d %s keys, got %d", n, typ, stats.KeysByType[typ])
+		}
+	}
+	if stats.ExpiringKeys != 1 {
+		t.Errorf("Expected 1 expiring key, got %d", stats.ExpiringKeys)
+	}
+	if stats.AvgTTL <= 0 || stats.AvgTTL > time.Hour.Milliseconds() {
+		t.Errorf("Expected average TTL of about an hour, got %dms", stats.AvgTTL)
+	}
+
+	store.Flush()
+	if stats := store.Stats(); stats.TotalKeys != 0 || stats.ExpiringKeys != 0 {
+		t.Errorf("Expected empty keyspace after flush, got %+v", stats)
+	}
+}
+
+func TestStatsExpiredKeysOnlyCountsDeletions(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	store.Set("short", "value", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	if n := store.Stats().ExpiredKeys; n != 0 {
+		t.Errorf("Expected expired but undeleted keys not to be counted, got %d", n)
+	}
+}
+
+func TestStatsSurviveSnapshotLoad(t *testing.T) {
+	cfg := config.StoreConfig{SnapshotPath: t.TempDir() + "/snapshot.rdb"}
+
+	store := NewStore(cfg)
+	store.Set("a", "value", time.Hour)
+	store.ZAdd("book", 1, "bid")
+	if err := store.SaveSnapshot(); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	restored := NewStore(cfg)
+	defer restored.Close()
+
+	stats := restored.Stats()
+	if stats.TotalKeys != 2 || stats.KeysByType["zset"] != 1 || stats.ExpiringKeys != 1 {
+		t.Errorf("Expected counters to be rebuilt on load, got %+v", stats)
+	}
+}
@@ -3,22 +3,67 @@ package store
 import (
 	"context"
 	"fmt"
+	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/chaitanyayendru/fincache/internal/config"
 	"go.uber.org/zap"
 )
 
+// Store is one logical database. All databases of an instance share a core
+// (configuration, persistence, memory accounting) and differ only in their
+// shards and key counters; NewStore returns database 0 and Select the others.
 type Store struct {
-	mu         sync.RWMutex
-	data       map[string]*Item
-	ttl        map[string]time.Time
-	sortedSets map[string]*SortedSet
-	config     config.StoreConfig
-	logger     *zap.Logger
-	ctx        context.Context
-	cancel     context.CancelFunc
+	*core
+	db     int
+	shards []*shard
+	stats  *keyspaceStats
+}
+
+// core is the state shared by every database of an instance.
+type core struct {
+	dbs       []*Store
+	allShards []*shard // the shards of every database, ordered by id
+	config    config.StoreConfig
+	logger    *zap.Logger
+	ctx       context.Context
+	cancel    context.CancelFunc
+
+	// snapshotMu serialises snapshot writers (the periodic worker, explicit
+	// SaveSnapshot calls and the final save on Close).
+	snapshotMu sync.Mutex
+
+	// epoch is bumped by every snapshot and names the append-only log
+	// segment that holds the writes made since; baseSize is the size of the
+	// last snapshot and drives automatic log rewrites.
+	aof      *appendOnlyLog
+	epoch    uint64
+	baseSize atomic.Int64
+
+	maxMemory      int64
+	evictionPolicy string
+	lfuLogFactor   int
+	lfuDecayTime   time.Duration
+	usedMemory     atomic.Int64
+	// releaseMu orders the background releases of Unlink against
+	// recomputeMemory, which bumps memoryGen; a release from before the
+	// recompute is dropped, as the new total already leaves it out.
+	releaseMu sync.Mutex
+	memoryGen atomic.Uint64
+
+	setMaxIntsetEntries int
+	moneyScale          int
+
+	// notifyFlags holds the enabled keyspace notification classes, see
+	// notify.go.
+	publisher   atomic.Pointer[Publisher]
+	notifyFlags atomic.Int32
+
+	// expireCursor is the next shard for active expiry to visit; only the
+	// expiry loop uses it.
+	expireCursor int
 }
 
 type Item struct {
@@ -28,36 +73,162 @@ type Item struct {
 	UpdatedAt   time.Time   `json:"updated_at"`
 	ExpiresAt   *time.Time  `json:"expires_at,omitempty"`
 	AccessCount int64       `json:"access_count"`
+
+	size       int64  // estimated memory footprint, see itemSize
+	freq       uint32 // logarithmic access counter, see lfu.go
+	accessedAt int64  // last read or write in Unix nanoseconds, for LRU and LFU decay
+}
+
+// clone copies item, reading the fields that Get updates concurrently with
+// atomics. Values that are modified in place, like lists, are copied too.
+func (item *Item) clone() *Item {
+	value := item.Value
+	switch v := value.(type) {
+	case *List:
+		value = v.clone()
+	case *Hash:
+		value = v.clone()
+	case *Set:
+		value = v.clone()
+	case *Stream:
+		value = v.clone()
+	case *RateLimiter:
+		value = v.clone()
+	case *TimeSeries:
+		value = v.clone()
+	case *BloomFilter:
+		value = v.clone()
+	case *CuckooFilter:
+		value = v.clone()
+	case *CountMinSketch:
+		value = v.clone()
+	case *TopK:
+		value = v.clone()
+	case *TDigest:
+		value = v.clone()
+	}
+
+	return &Item{
+		Value:       value,
+		Type:        item.Type,
+		CreatedAt:   item.CreatedAt,
+		UpdatedAt:   item.UpdatedAt,
+		ExpiresAt:   item.ExpiresAt,
+		AccessCount: atomic.LoadInt64(&item.AccessCount),
+		size:        item.size,
+		freq:        atomic.LoadUint32(&item.freq),
+		accessedAt:  atomic.LoadInt64(&item.accessedAt),
+	}
 }
 
 type StoreStats struct {
-	TotalKeys   int64   `json:"total_keys"`
-	MemoryUsage int64   `json:"memory_usage"`
-	HitRate     float64 `json:"hit_rate"`
-	MissRate    float64 `json:"miss_rate"`
-	Evictions   int64   `json:"evictions"`
-	ExpiredKeys int64   `json:"expired_keys"`
+	TotalKeys      int64            `json:"total_keys"`
+	MemoryUsage    int64            `json:"memory_usage"`
+	MaxMemory      int64            `json:"max_memory"`
+	KeyspaceHits   int64            `json:"keyspace_hits"`
+	KeyspaceMisses int64            `json:"keyspace_misses"`
+	HitRate        float64          `json:"hit_rate"`
+	MissRate       float64          `json:"miss_rate"`
+	Evictions      int64            `json:"evictions"`
+	ExpiredKeys    int64            `json:"expired_keys"`  // deleted after expiring
+	ExpiringKeys   int64            `json:"expiring_keys"` // keys with a TTL
+	AvgTTL         int64            `json:"avg_ttl_ms"`
+	KeysByType     map[string]int64 `json:"keys_by_type"`
 }
 
 func NewStore(cfg config.StoreConfig) *Store {
 	ctx, cancel := context.WithCancel(context.Background())
 
-	store := &Store{
-		data:       make(map[string]*Item),
-		ttl:        make(map[string]time.Time),
-		sortedSets: make(map[string]*SortedSet),
-		config:     cfg,
-		ctx:        ctx,
-		cancel:     cancel,
+	c := &core{
+		config: cfg,
+		logger: zap.L(),
+		ctx:    ctx,
+		cancel: cancel,
 	}
 
-	// Start TTL cleanup goroutine if enabled
+	databases := cfg.Databases
+	if databases <= 0 {
+		databases = defaultDatabases
+	}
+	for i := 0; i < databases; i++ {
+		db := &Store{
+			core:   c,
+			db:     i,
+			shards: newShards(cfg.Shards),
+			stats:  newKeyspaceStats(),
+		}
+		for _, sh := range db.shards {
+			sh.id, sh.db = len(c.allShards), i
+			c.allShards = append(c.allShards, sh)
+		}
+		c.dbs = append(c.dbs, db)
+	}
+	store := c.dbs[0]
+
+	maxMemory, err := config.ParseSize(cfg.MaxMemory)
+	if err != nil {
+		store.logger.Error("Invalid max memory, running without a limit", zap.Error(err))
+	}
+	store.maxMemory = maxMemory
+
+	policy, ok := normalizeEvictionPolicy(cfg.EvictionPolicy)
+	if !ok {
+		store.logger.Error("Unknown eviction policy, falling back to noeviction",
+			zap.String("policy", cfg.EvictionPolicy))
+	}
+	store.evictionPolicy = policy
+
+	store.setMaxIntsetEntries = cfg.SetMaxIntsetEntries
+	if store.setMaxIntsetEntries <= 0 {
+		store.setMaxIntsetEntries = defaultSetMaxIntsetEntries
+	}
+
+	store.moneyScale = cfg.MoneyScale
+	if store.moneyScale <= 0 || store.moneyScale > MaxDecimalScale {
+		store.moneyScale = defaultMoneyScale
+	}
+
+	store.lfuLogFactor = cfg.LFULogFactor
+	if store.lfuLogFactor <= 0 {
+		store.lfuLogFactor = defaultLFULogFactor
+	}
+	store.lfuDecayTime = cfg.LFUDecayTime
+	if store.lfuDecayTime == 0 {
+		store.lfuDecayTime = defaultLFUDecayTime
+	}
+
+	if err := store.SetNotifyKeyspaceEvents(cfg.NotifyKeyspaceEvents); err != nil {
+		store.logger.Error("Invalid keyspace notification flags, notifications are disabled", zap.Error(err))
+	}
+
+	// Restore the previous keyspace if a snapshot exists
+	if cfg.SnapshotPath != "" {
+		if _, err := os.Stat(cfg.SnapshotPath); err == nil {
+			if err := store.LoadSnapshot(); err != nil {
+				store.logger.Error("Failed to load snapshot", zap.Error(err))
+			}
+		}
+	}
+
+	// Replay the writes made after that snapshot and keep logging new ones
+	if cfg.AOFEnabled {
+		if err := store.openAOF(); err != nil {
+			store.logger.Error("Failed to open append-only log", zap.Error(err))
+		} else {
+			if cfg.SnapshotPath == "" {
+				store.logger.Warn("Append-only log rewrites need a snapshot path and are disabled")
+			}
+			go store.aofWorker()
+		}
+	}
+
+	// Start active expiry if enabled
 	if cfg.TTLEnabled {
-		go store.cleanupExpiredKeys()
+		go store.activeExpireLoop()
 	}
 
 	// Start snapshot goroutine if enabled
-	if cfg.SnapshotEnabled {
+	if cfg.SnapshotEnabled && cfg.SnapshotPath != "" {
 		go store.snapshotWorker()
 	}
 
@@ -65,16 +236,66 @@ func NewStore(cfg config.StoreConfig) *Store {
 }
 
 func (s *Store) Set(key string, value interface{}, ttl time.Duration) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	var payload string
+	if s.aof != nil {
+		var err error
+		if payload, err = marshalValue(value); err != nil {
+			return err
+		}
+	}
 
-	now := time.Now()
-	var expiresAt *time.Time
+	size := itemSize(key, value)
 
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	delta := size
+	if prev, exists := sh.data[key]; exists {
+		delta -= prev.size
+	}
+	if prev, exists := sh.sortedSets[key]; exists {
+		delta -= zsetSize(key, prev)
+	}
+	if err := s.reserveMemory(sh, key, delta); err != nil {
+		return err
+	}
+
+	var expiresAt *time.Time
 	if ttl > 0 {
-		exp := now.Add(ttl)
+		exp := time.Now().Add(ttl)
 		expiresAt = &exp
-		s.ttl[key] = exp
+	}
+
+	s.set(sh, key, value, expiresAt)
+
+	if expiresAt != nil {
+		s.propagate("SET", key, payload, "PXAT", formatUnixMilli(*expiresAt))
+	} else {
+		s.propagate("SET", key, payload)
+	}
+	s.notify(notifyString, "set", key)
+	if expiresAt != nil {
+		s.notify(notifyGeneric, "expire", key)
+	}
+	return nil
+}
+
+// set stores value under key, replacing any previous item or sorted set. The
+// caller must hold sh.mu.
+func (s *Store) set(sh *shard, key string, value interface{}, expiresAt *time.Time) {
+	now := time.Now()
+
+	if sortedSet, exists := sh.sortedSets[key]; exists {
+		s.usedMemory.Add(-zsetSize(key, sortedSet))
+		s.stats.countType("zset", -1)
+		delete(sh.sortedSets, key)
+	}
+
+	if expiresAt != nil {
+		s.setTTL(sh, key, *expiresAt)
+	} else {
+		s.clearTTL(sh, key)
 	}
 
 	item := &Item{
@@ -84,90 +305,173 @@ func (s *Store) Set(key string, value interface{}, ttl time.Duration) error {
 		UpdatedAt:   now,
 		ExpiresAt:   expiresAt,
 		AccessCount: 0,
+		size:        itemSize(key, value),
+		freq:        lfuInitVal,
+		accessedAt:  now.UnixNano(),
 	}
 
-	s.data[key] = item
-	return nil
+	// Overwriting a key keeps its access frequency
+	prev := sh.data[key]
+	if prev != nil {
+		item.freq = s.lfuCounter(prev, now)
+		s.stats.countType(prev.Type, -1)
+	}
+	s.stats.countType(item.Type, 1)
+
+	s.accountItem(item, prev)
+	sh.data[key] = item
 }
 
 func (s *Store) Get(key string) (interface{}, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	sh := s.shardFor(key)
+	sh.mu.RLock()
 
-	item, exists := s.data[key]
+	item, exists := sh.data[key]
 	if !exists {
+		sh.mu.RUnlock()
+		s.stats.recordLookup(false)
 		return nil, fmt.Errorf("key not found: %s", key)
 	}
 
 	// Check if expired
 	if item.ExpiresAt != nil && time.Now().After(*item.ExpiresAt) {
+		sh.mu.RUnlock()
+		s.stats.recordLookup(false)
+		s.expireIfNeeded(key)
 		return nil, fmt.Errorf("key expired: %s", key)
 	}
 
+	switch item.Value.(type) {
+	case *List, *Hash, *Set, *Stream, *RateLimiter, *TimeSeries, *BloomFilter, *CuckooFilter, *CountMinSketch, *TopK, *TDigest:
+		sh.mu.RUnlock()
+		return nil, ErrWrongType
+	}
+
+	s.stats.recordLookup(true)
+
 	// Update access count and timestamp
-	item.AccessCount++
-	item.UpdatedAt = time.Now()
+	s.touch(item)
+	value := item.Value
+	sh.mu.RUnlock()
 
-	return item.Value, nil
+	return value, nil
 }
 
 func (s *Store) Delete(key string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
 
-	if _, exists := s.data[key]; !exists {
+	if !s.del(sh, key) {
 		return fmt.Errorf("key not found: %s", key)
 	}
 
-	delete(s.data, key)
-	delete(s.ttl, key)
+	s.propagate("DEL", key)
+	s.notify(notifyGeneric, "del", key)
 	return nil
 }
 
-func (s *Store) Exists(key string) bool {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+// Del removes keys atomically and returns how many of them existed.
+func (s *Store) Del(keys ...string) int {
+	unlock := s.lockKeys(keys...)
+	defer unlock()
 
-	item, exists := s.data[key]
-	if !exists {
-		return false
+	deleted := 0
+	for _, key := range keys {
+		if s.del(s.shardFor(key), key) {
+			s.propagate("DEL", key)
+			s.notify(notifyGeneric, "del", key)
+			deleted++
+		}
 	}
+	return deleted
+}
 
-	// Check if expired
-	if item.ExpiresAt != nil && time.Now().After(*item.ExpiresAt) {
+// del removes key, including a sorted set, and reports whether it existed.
+// The caller must hold sh.mu.
+func (s *Store) del(sh *shard, key string) bool {
+	item, sortedSet := s.detach(sh, key)
+	s.release(key, item, sortedSet)
+	return item != nil || sortedSet != nil
+}
+
+// detach removes key from the keyspace as del does and returns its value,
+// leaving release to the caller, which may do it after unlocking sh. The
+// caller must hold sh.mu.
+func (s *Store) detach(sh *shard, key string) (*Item, *SortedSet) {
+	sortedSet, exists := sh.sortedSets[key]
+	if exists {
+		s.stats.countType("zset", -1)
+		delete(sh.sortedSets, key)
+	}
+
+	item, exists := sh.data[key]
+	if exists {
+		s.stats.countType(item.Type, -1)
+		delete(sh.data, key)
+		s.clearTTL(sh, key)
+	}
+	return item, sortedSet
+}
+
+// release returns the memory of the detached value of key. Sizing a sorted
+// set walks its members, which no longer needs the shard lock.
+func (s *Store) release(key string, item *Item, sortedSet *SortedSet) {
+	if item != nil {
+		s.usedMemory.Add(-item.size)
+	}
+	if sortedSet != nil {
+		s.usedMemory.Add(-zsetSize(key, sortedSet))
+	}
+}
+
+func (s *Store) Exists(key string) bool {
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	item, exists := sh.data[key]
+	expired := exists && item.ExpiresAt != nil && time.Now().After(*item.ExpiresAt)
+	sh.mu.RUnlock()
+
+	if expired {
+		s.expireIfNeeded(key)
 		return false
 	}
 
-	return true
+	return exists
 }
 
 func (s *Store) Keys(pattern string) []string {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
 	var keys []string
 	now := time.Now()
 
-	for key, item := range s.data {
-		// Check if expired
-		if item.ExpiresAt != nil && now.After(*item.ExpiresAt) {
-			continue
-		}
+	for _, sh := range s.shards {
+		sh.mu.RLock()
+		for key, item := range sh.data {
+			// Check if expired
+			if item.ExpiresAt != nil && now.After(*item.ExpiresAt) {
+				continue
+			}
 
-		// Simple pattern matching (can be enhanced with regex)
-		if pattern == "*" || key == pattern {
-			keys = append(keys, key)
+			// Simple pattern matching (can be enhanced with regex)
+			if pattern == "*" || key == pattern {
+				keys = append(keys, key)
+			}
 		}
+		sh.mu.RUnlock()
 	}
 
 	return keys
 }
 
 func (s *Store) TTL(key string) (time.Duration, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
 
-	item, exists := s.data[key]
+	if _, exists := sh.sortedSets[key]; exists {
+		return -1, nil // Sorted sets cannot expire
+	}
+	item, exists := sh.data[key]
 	if !exists {
 		return -2, fmt.Errorf("key not found: %s", key)
 	}
@@ -185,244 +489,263 @@ func (s *Store) TTL(key string) (time.Duration, error) {
 }
 
 func (s *Store) Expire(key string, ttl time.Duration) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
 
-	item, exists := s.data[key]
-	if !exists {
-		return fmt.Errorf("key not found: %s", key)
+	if _, exists := sh.sortedSets[key]; exists {
+		return ErrZSetTTL
 	}
-
 	expiresAt := time.Now().Add(ttl)
-	item.ExpiresAt = &expiresAt
-	item.UpdatedAt = time.Now()
-	s.ttl[key] = expiresAt
+	if !s.expireAt(sh, key, expiresAt) {
+		return fmt.Errorf("key not found: %s", key)
+	}
 
+	s.propagate("PEXPIREAT", key, formatUnixMilli(expiresAt))
+	s.notify(notifyGeneric, "expire", key)
 	return nil
 }
 
-func (s *Store) Stats() *StoreStats {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	stats := &StoreStats{
-		TotalKeys: int64(len(s.data)),
-	}
-
-	// Calculate memory usage (rough estimation)
-	for _, item := range s.data {
-		if item.ExpiresAt != nil && time.Now().After(*item.ExpiresAt) {
-			stats.ExpiredKeys++
-		}
+// expireAt sets the absolute expiry of key and reports whether it exists. The
+// caller must hold sh.mu.
+func (s *Store) expireAt(sh *shard, key string, expiresAt time.Time) bool {
+	item, exists := sh.data[key]
+	if !exists {
+		return false
 	}
 
-	return stats
+	item.ExpiresAt = &expiresAt
+	item.UpdatedAt = time.Now()
+	s.setTTL(sh, key, expiresAt)
+	return true
 }
 
 func (s *Store) Flush() error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	s.lockAll()
+	defer s.unlockAll()
 
-	s.data = make(map[string]*Item)
-	s.ttl = make(map[string]time.Time)
+	s.flush()
+	s.propagate("FLUSHDB")
 	return nil
 }
 
-func (s *Store) cleanupExpiredKeys() {
-	ticker := time.NewTicker(1 * time.Minute)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-s.ctx.Done():
-			return
-		case <-ticker.C:
-			s.mu.Lock()
-			now := time.Now()
-			var expiredKeys []string
+// flush empties the database. The caller must hold every shard lock of s.
+func (s *Store) flush() {
+	var freed int64
+	for _, sh := range s.shards {
+		freed += shardMemory(sh)
+		sh.data = make(map[string]*Item)
+		sh.ttl = make(map[string]time.Time)
+		sh.sortedSets = make(map[string]*SortedSet)
+		sh.hashTTL = nil
+	}
+	s.usedMemory.Add(-freed)
+	s.stats.resetKeyspace()
+}
 
-			for key, item := range s.data {
-				if item.ExpiresAt != nil && now.After(*item.ExpiresAt) {
-					expiredKeys = append(expiredKeys, key)
-				}
-			}
+// Sorted Set Methods
+// Sorted set writes have no error to report an OOM with, so they evict what
+// they can to stay under MaxMemory but are never refused.
+func (s *Store) ZAdd(key string, score float64, member string) int {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
 
-			for _, key := range expiredKeys {
-				delete(s.data, key)
-				delete(s.ttl, key)
-			}
-			s.mu.Unlock()
+	s.reserveMemory(sh, key, s.zgrowth(sh, key, member))
+	added := s.zadd(sh, key, score, member)
+	s.propagate("ZADD", key, formatFloat(score), member)
+	s.notify(notifyZSet, "zadd", key)
+	return added
+}
 
-			if len(expiredKeys) > 0 {
-				s.logger.Info("Cleaned up expired keys",
-					zap.Int("count", len(expiredKeys)))
-			}
-		}
+// zset returns the sorted set at key, creating it if needed. The caller must
+// hold sh.mu.
+func (s *Store) zset(sh *shard, key string) *SortedSet {
+	if _, exists := sh.sortedSets[key]; !exists {
+		sh.sortedSets[key] = NewSortedSet()
+		s.usedMemory.Add(zsetOverhead + int64(len(key)))
+		s.stats.countType("zset", 1)
 	}
+	s.touchZSet(sh.sortedSets[key])
+	return sh.sortedSets[key]
 }
 
-func (s *Store) snapshotWorker() {
-	ticker := time.NewTicker(s.config.SnapshotInterval)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-s.ctx.Done():
-			return
-		case <-ticker.C:
-			if err := s.SaveSnapshot(); err != nil {
-				s.logger.Error("Failed to save snapshot", zap.Error(err))
-			}
-		}
+// lookupZSet returns the sorted set at key for a read and records the lookup
+// as a keyspace hit or miss. The caller must hold sh.mu.
+func (s *Store) lookupZSet(sh *shard, key string) (*SortedSet, bool) {
+	sortedSet, exists := sh.sortedSets[key]
+	s.stats.recordLookup(exists)
+	if exists {
+		s.touchZSet(sortedSet)
 	}
+	return sortedSet, exists
 }
 
-func (s *Store) SaveSnapshot() error {
-	s.mu.RLock()
-	data := make(map[string]*Item)
-	for k, v := range s.data {
-		data[k] = v
+// zadd, zincrby and zrem apply sorted set writes and keep the memory
+// accounting up to date. The caller must hold sh.mu.
+func (s *Store) zadd(sh *shard, key string, score float64, member string) int {
+	added := s.zset(sh, key).ZAdd(key, score, member)
+	if added > 0 {
+		s.usedMemory.Add(zmemberCost(member))
 	}
-	s.mu.RUnlock()
-
-	// Save to file (implement file I/O)
-	return nil
+	return added
 }
 
-func (s *Store) LoadSnapshot() error {
-	// Load from file (implement file I/O)
-	return nil
+func (s *Store) zincrby(sh *shard, key string, increment float64, member string) float64 {
+	sortedSet := s.zset(sh, key)
+	if _, exists := sortedSet.ZScore(key, member); !exists {
+		s.usedMemory.Add(zmemberCost(member))
+	}
+	return sortedSet.ZIncrBy(key, increment, member)
 }
 
-// Sorted Set Methods
-func (s *Store) ZAdd(key string, score float64, member string) int {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	if _, exists := s.sortedSets[key]; !exists {
-		s.sortedSets[key] = NewSortedSet()
+func (s *Store) zrem(sh *shard, key string, members ...string) int {
+	sortedSet, exists := sh.sortedSets[key]
+	if !exists {
+		return 0
 	}
 
-	return s.sortedSets[key].ZAdd(key, score, member)
+	removed := 0
+	for _, member := range members {
+		if sortedSet.ZRem(key, member) > 0 {
+			s.usedMemory.Add(-zmemberCost(member))
+			removed++
+		}
+	}
+	return removed
 }
 
 func (s *Store) ZRem(key string, members ...string) int {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
 
-	if sortedSet, exists := s.sortedSets[key]; exists {
-		return sortedSet.ZRem(key, members...)
+	removed := s.zrem(sh, key, members...)
+	if removed > 0 {
+		s.propagate(append([]string{"ZREM", key}, members...)...)
+		s.notify(notifyZSet, "zrem", key)
 	}
-	return 0
+	return removed
 }
 
 func (s *Store) ZScore(key string, member string) (float64, bool) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
 
-	if sortedSet, exists := s.sortedSets[key]; exists {
+	if sortedSet, exists := s.lookupZSet(sh, key); exists {
 		return sortedSet.ZScore(key, member)
 	}
 	return 0, false
 }
 
 func (s *Store) ZRank(key string, member string) int {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
 
-	if sortedSet, exists := s.sortedSets[key]; exists {
+	if sortedSet, exists := s.lookupZSet(sh, key); exists {
 		return sortedSet.ZRank(key, member)
 	}
 	return -1
 }
 
 func (s *Store) ZRevRank(key string, member string) int {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
 
-	if sortedSet, exists := s.sortedSets[key]; exists {
+	if sortedSet, exists := s.lookupZSet(sh, key); exists {
 		return sortedSet.ZRevRank(key, member)
 	}
 	return -1
 }
 
 func (s *Store) ZRange(key string, start, stop int) []string {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
 
-	if sortedSet, exists := s.sortedSets[key]; exists {
+	if sortedSet, exists := s.lookupZSet(sh, key); exists {
 		return sortedSet.ZRange(key, start, stop)
 	}
 	return []string{}
 }
 
 func (s *Store) ZRevRange(key string, start, stop int) []string {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
 
-	if sortedSet, exists := s.sortedSets[key]; exists {
+	if sortedSet, exists := s.lookupZSet(sh, key); exists {
 		return sortedSet.ZRevRange(key, start, stop)
 	}
 	return []string{}
 }
 
 func (s *Store) ZCard(key string) int {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
 
-	if sortedSet, exists := s.sortedSets[key]; exists {
+	if sortedSet, exists := s.lookupZSet(sh, key); exists {
 		return sortedSet.ZCard(key)
 	}
 	return 0
 }
 
 func (s *Store) ZIncrBy(key string, increment float64, member string) float64 {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
 
-	if _, exists := s.sortedSets[key]; !exists {
-		s.sortedSets[key] = NewSortedSet()
-	}
-
-	return s.sortedSets[key].ZIncrBy(key, increment, member)
+	s.reserveMemory(sh, key, s.zgrowth(sh, key, member))
+	score := s.zincrby(sh, key, increment, member)
+	s.propagate("ZINCRBY", key, formatFloat(increment), member)
+	s.notify(notifyZSet, "zincr", key)
+	return score
 }
 
 // Order Book specific methods
 func (s *Store) GetOrderBook(key string, depth int) ([]*SortedSetMember, []*SortedSetMember) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
 
-	if sortedSet, exists := s.sortedSets[key]; exists {
+	if sortedSet, exists := s.lookupZSet(sh, key); exists {
 		return sortedSet.GetOrderBook(depth)
 	}
 	return []*SortedSetMember{}, []*SortedSetMember{}
 }
 
 func (s *Store) GetBestBid(key string) (*SortedSetMember, bool) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
 
-	if sortedSet, exists := s.sortedSets[key]; exists {
+	if sortedSet, exists := s.lookupZSet(sh, key); exists {
 		return sortedSet.GetBestBid()
 	}
 	return nil, false
 }
 
 func (s *Store) GetBestAsk(key string) (*SortedSetMember, bool) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
 
-	if sortedSet, exists := s.sortedSets[key]; exists {
+	if sortedSet, exists := s.lookupZSet(sh, key); exists {
 		return sortedSet.GetBestAsk()
 	}
 	return nil, false
 }
 
 func (s *Store) GetSpread(key string) (float64, bool) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
 
-	if sortedSet, exists := s.sortedSets[key]; exists {
+	if sortedSet, exists := s.lookupZSet(sh, key); exists {
 		return sortedSet.GetSpread()
 	}
 	return 0, false
@@ -430,7 +753,18 @@ func (s *Store) GetSpread(key string) (float64, bool) {
 
 func (s *Store) Close() error {
 	s.cancel()
-	return nil
+
+	var err error
+	if s.config.SnapshotEnabled && s.config.SnapshotPath != "" {
+		err = s.SaveSnapshot()
+	}
+
+	if s.aof != nil {
+		if closeErr := s.aof.close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
 }
 
 func getType(value interface{}) string {
@@ -447,6 +781,34 @@ func getType(value interface{}) string {
 		return "array"
 	case map[string]interface{}:
 		return "object"
+	case *List:
+		return "list"
+	case *Hash:
+		return "hash"
+	case *Set:
+		return "set"
+	case Decimal:
+		return "decimal"
+	case IdempotencyRecord:
+		return "idempotency"
+	case LockState:
+		return "lock"
+	case *Stream:
+		return "stream"
+	case *RateLimiter:
+		return "ratelimit"
+	case *TimeSeries:
+		return "timeseries"
+	case *BloomFilter:
+		return "bloom"
+	case *CuckooFilter:
+		return "cuckoo"
+	case *CountMinSketch:
+		return "cms"
+	case *TopK:
+		return "topk"
+	case *TDigest:
+		return "tdigest"
 	default:
 		return "unknown"
 	}
@@ -171,8 +171,8 @@ func TestTTL(t *testing.T) {
 		t.Errorf("Expected no error when getting TTL: %v", err)
 	}
 
-	if ttl <= 0 || ttl > 60 {
-		t.Errorf("Expected TTL between 0 and 60, got %v", ttl)
+	if ttl <= 0 || ttl > 60*time.Second {
+		t.Errorf("Expected TTL between 0 and 60s, got %v", ttl)
 	}
 }
 
@@ -198,8 +198,8 @@ func TestExpire(t *testing.T) {
 		t.Errorf("Expected no error when getting TTL: %v", err)
 	}
 
-	if ttl <= 0 || ttl > 60 {
-		t.Errorf("Expected TTL between 0 and 60, got %v", ttl)
+	if ttl <= 0 || ttl > 60*time.Second {
+		t.Errorf("Expected TTL between 0 and 60s, got %v", ttl)
 	}
 }
 
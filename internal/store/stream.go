@@ -0,0 +1,625 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidStreamID  = errors.New("Invalid stream ID specified as stream command argument")
+	ErrStreamIDTooSmall = errors.New("The ID specified in XADD is equal or smaller than the target stream top item")
+	ErrStreamIDZero     = errors.New("The ID specified in XADD must be greater than 0-0")
+)
+
+// StreamID identifies a stream entry: the millisecond it was added at and a
+// sequence number for entries added within the same millisecond.
+type StreamID struct {
+	Ms  uint64
+	Seq uint64
+}
+
+var maxStreamID = StreamID{math.MaxUint64, math.MaxUint64}
+
+func (id StreamID) String() string {
+	return strconv.FormatUint(id.Ms, 10) + "-" + strconv.FormatUint(id.Seq, 10)
+}
+
+// Less reports whether id sorts before other.
+func (id StreamID) Less(other StreamID) bool {
+	return id.Ms < other.Ms || id.Ms == other.Ms && id.Seq < other.Seq
+}
+
+// next returns the smallest ID after id, reporting false if id is the last
+// possible one.
+func (id StreamID) next() (StreamID, bool) {
+	switch {
+	case id.Seq < math.MaxUint64:
+		return StreamID{id.Ms, id.Seq + 1}, true
+	case id.Ms < math.MaxUint64:
+		return StreamID{id.Ms + 1, 0}, true
+	default:
+		return id, false
+	}
+}
+
+// prev returns the largest ID before id, reporting false if id is 0-0.
+func (id StreamID) prev() (StreamID, bool) {
+	switch {
+	case id.Seq > 0:
+		return StreamID{id.Ms, id.Seq - 1}, true
+	case id.Ms > 0:
+		return StreamID{id.Ms - 1, math.MaxUint64}, true
+	default:
+		return id, false
+	}
+}
+
+// parseStreamID parses "ms-seq" or a bare "ms", in which case the sequence
+// number is missingSeq.
+func parseStreamID(s string, missingSeq uint64) (StreamID, error) {
+	msPart, seqPart, hasSeq := strings.Cut(s, "-")
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return StreamID{}, ErrInvalidStreamID
+	}
+	if !hasSeq {
+		return StreamID{ms, missingSeq}, nil
+	}
+	seq, err := strconv.ParseUint(seqPart, 10, 64)
+	if err != nil {
+		return StreamID{}, ErrInvalidStreamID
+	}
+	return StreamID{ms, seq}, nil
+}
+
+// parseRangeBound parses an XRANGE style bound: "-" and "+" for the ends of
+// the stream, an ID, or an ID prefixed with "(" to exclude it. A bare ms
+// covers the whole millisecond.
+func parseRangeBound(s string, end bool) (StreamID, error) {
+	switch s {
+	case "-":
+		return StreamID{}, nil
+	case "+":
+		return maxStreamID, nil
+	}
+
+	exclusive := strings.HasPrefix(s, "(")
+	missingSeq := uint64(0)
+	if end {
+		missingSeq = math.MaxUint64
+	}
+	id, err := parseStreamID(strings.TrimPrefix(s, "("), missingSeq)
+	if err != nil || !exclusive {
+		return id, err
+	}
+
+	var ok bool
+	if end {
+		id, ok = id.prev()
+	} else {
+		id, ok = id.next()
+	}
+	if !ok {
+		return StreamID{}, ErrInvalidStreamID
+	}
+	return id, nil
+}
+
+// StreamEntry is one entry of a stream. Fields holds field/value pairs; it
+// is nil for pending entries that have since been trimmed from the stream.
+type StreamEntry struct {
+	ID     StreamID
+	Fields []string
+}
+
+// Stream is the value of a stream key: an append-only log of entries with
+// increasing IDs, trimmed from the front, and the consumer groups reading
+// it. Unlike the other container types an empty stream is kept, so that its
+// last ID and groups survive. It is guarded by the lock of the shard holding
+// the key.
+type Stream struct {
+	entries      []StreamEntry
+	lastID       StreamID
+	entriesAdded uint64
+	groups       map[string]*consumerGroup
+}
+
+func newStream() *Stream {
+	return &Stream{groups: make(map[string]*consumerGroup)}
+}
+
+// Len returns the number of entries.
+func (st *Stream) Len() int {
+	return len(st.entries)
+}
+
+// search returns the index of the first entry with an ID not below id.
+func (st *Stream) search(id StreamID) int {
+	return sort.Search(len(st.entries), func(i int) bool { return !st.entries[i].ID.Less(id) })
+}
+
+// lookup returns the entry with id, if it is still in the stream.
+func (st *Stream) lookup(id StreamID) (StreamEntry, bool) {
+	i := st.search(id)
+	if i < len(st.entries) && st.entries[i].ID == id {
+		return st.entries[i], true
+	}
+	return StreamEntry{}, false
+}
+
+// nextID resolves the ID given to XADD: "*" for an automatic one, "ms-*"
+// for an automatic sequence number, or an explicit ID above the last one.
+func (st *Stream) nextID(spec string, now time.Time) (StreamID, error) {
+	if spec == "*" {
+		ms := uint64(now.UnixMilli())
+		if ms > st.lastID.Ms {
+			return StreamID{ms, 0}, nil
+		}
+		id, ok := st.lastID.next()
+		if !ok {
+			return StreamID{}, ErrStreamIDTooSmall
+		}
+		return id, nil
+	}
+
+	if msPart, ok := strings.CutSuffix(spec, "-*"); ok {
+		ms, err := strconv.ParseUint(msPart, 10, 64)
+		if err != nil {
+			return StreamID{}, ErrInvalidStreamID
+		}
+		switch {
+		case ms > st.lastID.Ms:
+			return StreamID{ms, 0}, nil
+		case ms == st.lastID.Ms && st.lastID.Seq < math.MaxUint64:
+			return StreamID{ms, st.lastID.Seq + 1}, nil
+		default:
+			return StreamID{}, ErrStreamIDTooSmall
+		}
+	}
+
+	id, err := parseStreamID(spec, 0)
+	if err != nil {
+		return StreamID{}, err
+	}
+	if id == (StreamID{}) {
+		return StreamID{}, ErrStreamIDZero
+	}
+	if !st.lastID.Less(id) {
+		return StreamID{}, ErrStreamIDTooSmall
+	}
+	return id, nil
+}
+
+// trim removes entries from the front so that at most maxLen remain, or, if
+// minID is set, those with smaller IDs. It returns how many were removed and
+// by how much the estimated size shrank.
+func (st *Stream) trim(trim StreamTrim, minID StreamID) (int, int64) {
+	n := 0
+	if trim.MinID != "" {
+		n = st.search(minID)
+	} else if trim.MaxLen >= 0 && len(st.entries) > trim.MaxLen {
+		n = len(st.entries) - trim.MaxLen
+	}
+
+	var delta int64
+	for i := 0; i < n; i++ {
+		delta -= streamEntrySize(st.entries[i])
+		st.entries[i] = StreamEntry{}
+	}
+	st.entries = st.entries[n:]
+	return n, delta
+}
+
+// rangeEntries returns up to count entries (all if count <= 0) between
+// start and end inclusive, in reverse order if rev is set.
+func (st *Stream) rangeEntries(start, end StreamID, count int, rev bool) []StreamEntry {
+	entries := []StreamEntry{}
+	if end.Less(start) {
+		return entries
+	}
+
+	lo, hi := st.search(start), st.search(end)
+	if hi < len(st.entries) && st.entries[hi].ID == end {
+		hi++
+	}
+	if count <= 0 || count > hi-lo {
+		count = hi - lo
+	}
+	for i := 0; i < count; i++ {
+		if rev {
+			entries = append(entries, st.entries[hi-1-i])
+		} else {
+			entries = append(entries, st.entries[lo+i])
+		}
+	}
+	return entries
+}
+
+func (st *Stream) size() int64 {
+	size := int64(streamOverhead)
+	for _, entry := range st.entries {
+		size += streamEntrySize(entry)
+	}
+	for name, group := range st.groups {
+		size += groupSize(name) + int64(len(group.pending))*pendingEntrySize
+		for consumer := range group.consumers {
+			size += consumerSize(consumer)
+		}
+	}
+	return size
+}
+
+func (st *Stream) clone() *Stream {
+	c := &Stream{
+		entries:      append([]StreamEntry(nil), st.entries...),
+		lastID:       st.lastID,
+		entriesAdded: st.entriesAdded,
+		groups:       make(map[string]*consumerGroup, len(st.groups)),
+	}
+	for name, group := range st.groups {
+		c.groups[name] = group.clone()
+	}
+	return c
+}
+
+// Memory estimates for stream entries and consumer group bookkeeping.
+const (
+	streamOverhead   = 96 // Stream struct, entry slice and group map
+	pendingEntrySize = 80 // PendingEntry and its map entry
+)
+
+func streamEntrySize(entry StreamEntry) int64 {
+	size := int64(entryOverhead + 16 + sliceOverhead)
+	for _, field := range entry.Fields {
+		size += stringOverhead + int64(len(field))
+	}
+	return size
+}
+
+// readStream returns the stream at key for a read, nil if there is none, and
+// records the lookup. The caller must hold sh.mu for reading.
+func (s *Store) readStream(sh *shard, key string) (*Stream, error) {
+	item, exists := sh.data[key]
+	if exists && item.ExpiresAt != nil && time.Now().After(*item.ExpiresAt) {
+		exists = false
+	}
+	if !exists {
+		if _, isZSet := sh.sortedSets[key]; isZSet {
+			return nil, ErrWrongType
+		}
+		s.stats.recordLookup(false)
+		return nil, nil
+	}
+
+	stream, ok := item.Value.(*Stream)
+	if !ok {
+		return nil, ErrWrongType
+	}
+	s.stats.recordLookup(true)
+	s.touch(item)
+	return stream, nil
+}
+
+// writeStream returns the item holding the stream at key for a write,
+// deleting it first if it has expired. It returns a nil item if there is no
+// stream. The caller must hold sh.mu.
+func (s *Store) writeStream(sh *shard, key string) (*Item, *Stream, error) {
+	if _, isZSet := sh.sortedSets[key]; isZSet {
+		return nil, nil, ErrWrongType
+	}
+	item, exists := sh.data[key]
+	if !exists {
+		return nil, nil, nil
+	}
+	if item.ExpiresAt != nil && time.Now().After(*item.ExpiresAt) {
+		s.deleteExpired(sh, key)
+		return nil, nil, nil
+	}
+
+	stream, ok := item.Value.(*Stream)
+	if !ok {
+		return nil, nil, ErrWrongType
+	}
+	s.touch(item)
+	return item, stream, nil
+}
+
+// StreamTrim limits the length of a stream, like the MAXLEN and MINID
+// arguments of XADD and XTRIM. Trimming is always exact; "~" is accepted by
+// the protocol but makes no difference.
+type StreamTrim struct {
+	MaxLen int    // keep at most this many entries
+	MinID  string // if set, remove entries below this ID instead
+}
+
+// XAddOptions holds the optional arguments of XAdd.
+type XAddOptions struct {
+	NoMkStream bool        // do not create a missing stream
+	Trim       *StreamTrim // trim the stream after adding
+}
+
+// XAdd appends an entry with fields, a list of field/value pairs, to the
+// stream at key and returns its ID. id is "*" for an automatic ID, "ms-*"
+// for an automatic sequence number or an explicit ID above the last one. It
+// returns "" if the stream does not exist and opts.NoMkStream is set.
+func (s *Store) XAdd(key, id string, fields []string, opts XAddOptions) (string, error) {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	return s.xadd(sh, key, id, fields, opts)
+}
+
+// xadd implements XAdd. The caller must hold sh.mu.
+func (s *Store) xadd(sh *shard, key, idSpec string, fields []string, opts XAddOptions) (string, error) {
+	if len(fields) == 0 || len(fields)%2 != 0 {
+		return "", errors.New("wrong number of arguments for 'xadd' command")
+	}
+	var minID StreamID
+	if opts.Trim != nil && opts.Trim.MinID != "" {
+		var err error
+		if minID, err = parseStreamID(opts.Trim.MinID, 0); err != nil {
+			return "", err
+		}
+	}
+
+	item, stream, err := s.writeStream(sh, key)
+	if err != nil {
+		return "", err
+	}
+	if item == nil && opts.NoMkStream {
+		return "", nil
+	}
+
+	current := stream
+	if current == nil {
+		current = newStream()
+	}
+	id, err := current.nextID(idSpec, time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	entry := StreamEntry{ID: id, Fields: append([]string(nil), fields...)}
+	delta := streamEntrySize(entry)
+	if item == nil {
+		delta += itemSize(key, current)
+	}
+	if err := s.reserveMemory(sh, key, delta); err != nil {
+		return "", err
+	}
+
+	item, stream = s.appendEntry(sh, key, item, current, entry)
+
+	s.propagate(append([]string{"XADD", key, id.String()}, fields...)...)
+	s.notify(notifyStream, "xadd", key)
+	if opts.Trim != nil {
+		s.xtrimStream(key, item, stream, *opts.Trim, minID)
+	}
+	return id.String(), nil
+}
+
+// appendEntry appends entry, whose ID was resolved by stream.nextID, to
+// stream and wakes blocked readers. If item is nil the stream is stored at
+// key first. Memory must have been reserved. The caller must hold sh.mu.
+func (s *Store) appendEntry(sh *shard, key string, item *Item, stream *Stream, entry StreamEntry) (*Item, *Stream) {
+	if item == nil {
+		s.set(sh, key, stream, nil)
+		item = sh.data[key]
+	}
+	stream.entries = append(stream.entries, entry)
+	stream.lastID = entry.ID
+	stream.entriesAdded++
+	s.resize(item, streamEntrySize(entry))
+	item.UpdatedAt = time.Now()
+	sh.signal(key)
+	return item, stream
+}
+
+// XTrim trims the stream at key and returns how many entries it removed.
+func (s *Store) XTrim(key string, trim StreamTrim) (int, error) {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	return s.xtrim(sh, key, trim)
+}
+
+// xtrim implements XTrim. The caller must hold sh.mu.
+func (s *Store) xtrim(sh *shard, key string, trim StreamTrim) (int, error) {
+	var minID StreamID
+	if trim.MinID != "" {
+		var err error
+		if minID, err = parseStreamID(trim.MinID, 0); err != nil {
+			return 0, err
+		}
+	}
+
+	item, stream, err := s.writeStream(sh, key)
+	if err != nil || item == nil {
+		return 0, err
+	}
+	return s.xtrimStream(key, item, stream, trim, minID), nil
+}
+
+// xtrimStream trims stream and logs the result as an exact MAXLEN, which
+// replays the same way whatever trim was asked for. The caller must hold
+// the shard lock of key.
+func (s *Store) xtrimStream(key string, item *Item, stream *Stream, trim StreamTrim, minID StreamID) int {
+	n, delta := stream.trim(trim, minID)
+	if n == 0 {
+		return 0
+	}
+	s.resize(item, delta)
+
+	s.propagate("XTRIM", key, "MAXLEN", strconv.Itoa(stream.Len()))
+	s.notify(notifyStream, "xtrim", key)
+	return n
+}
+
+// XLen returns the number of entries in the stream at key.
+func (s *Store) XLen(key string) (int, error) {
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	stream, err := s.readStream(sh, key)
+	if err != nil || stream == nil {
+		return 0, err
+	}
+	return stream.Len(), nil
+}
+
+// XRange returns up to count entries (all if count <= 0) of the stream at
+// key with IDs between start and end, which may be "-", "+", IDs, or IDs
+// prefixed with "(" to exclude them.
+func (s *Store) XRange(key, start, end string, count int) ([]StreamEntry, error) {
+	return s.xrange(key, start, end, count, false)
+}
+
+// XRevRange is XRange in reverse order, from end down to start.
+func (s *Store) XRevRange(key, end, start string, count int) ([]StreamEntry, error) {
+	return s.xrange(key, start, end, count, true)
+}
+
+func (s *Store) xrange(key, start, end string, count int, rev bool) ([]StreamEntry, error) {
+	from, err := parseRangeBound(start, false)
+	if err != nil {
+		return nil, err
+	}
+	to, err := parseRangeBound(end, true)
+	if err != nil {
+		return nil, err
+	}
+
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	stream, err := s.readStream(sh, key)
+	if err != nil || stream == nil {
+		return []StreamEntry{}, err
+	}
+	return stream.rangeEntries(from, to, count, rev), nil
+}
+
+// StreamResult holds the entries read from one stream by XRead or
+// XReadGroup.
+type StreamResult struct {
+	Key     string
+	Entries []StreamEntry
+}
+
+// XReadOptions holds the optional arguments of XRead and XReadGroup.
+type XReadOptions struct {
+	Count   int           // entries per stream, 0 for no limit
+	Block   bool          // wait for entries if there are none
+	Timeout time.Duration // how long to block, 0 for ever
+	NoAck   bool          // XReadGroup only: do not add entries to the PEL
+}
+
+// XRead returns the entries of the streams at keys with IDs above the
+// matching ids; "$" stands for the last ID of the stream when the call is
+// made. Only streams with new entries are included. With opts.Block it waits
+// until one of the streams receives an entry, and returns nil if the timeout
+// passes first.
+func (s *Store) XRead(ctx context.Context, keys, ids []string, opts XReadOptions) ([]StreamResult, error) {
+	if len(keys) != len(ids) {
+		return nil, errors.New("unbalanced XREAD list of streams: for each stream key an ID must be specified")
+	}
+
+	var after []StreamID
+	var results []StreamResult
+	try := func() (bool, error) {
+		if after == nil {
+			// Resolve the IDs once, so "$" means the last ID before blocking
+			after = make([]StreamID, len(ids))
+			for i, id := range ids {
+				if id != "$" {
+					var err error
+					if after[i], err = parseStreamID(id, 0); err != nil {
+						return false, err
+					}
+					continue
+				}
+				stream, err := s.readStream(s.shardFor(keys[i]), keys[i])
+				if err != nil {
+					return false, err
+				}
+				if stream != nil {
+					after[i] = stream.lastID
+				}
+			}
+		}
+
+		for i, key := range keys {
+			stream, err := s.readStream(s.shardFor(key), key)
+			if err != nil {
+				return false, err
+			}
+			if stream == nil {
+				continue
+			}
+			start, ok := after[i].next()
+			if !ok {
+				continue
+			}
+			if entries := stream.rangeEntries(start, maxStreamID, opts.Count, false); len(entries) > 0 {
+				results = append(results, StreamResult{Key: key, Entries: entries})
+			}
+		}
+		return len(results) > 0, nil
+	}
+
+	if !opts.Block {
+		unlock := s.lockKeys(keys...)
+		defer unlock()
+		_, err := try()
+		return results, err
+	}
+	_, err := s.block(ctx, keys, keys, opts.Timeout, try)
+	return results, err
+}
+
+// StreamInfo describes a stream, as returned by XInfoStream.
+type StreamInfo struct {
+	Length          int
+	LastGeneratedID string
+	EntriesAdded    uint64
+	Groups          int
+	FirstEntry      *StreamEntry
+	LastEntry       *StreamEntry
+}
+
+// XInfoStream describes the stream at key. It returns ErrNoSuchKey if there
+// is none.
+func (s *Store) XInfoStream(key string) (StreamInfo, error) {
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	stream, err := s.readStream(sh, key)
+	if err != nil {
+		return StreamInfo{}, err
+	}
+	if stream == nil {
+		return StreamInfo{}, ErrNoSuchKey
+	}
+
+	info := StreamInfo{
+		Length:          stream.Len(),
+		LastGeneratedID: stream.lastID.String(),
+		EntriesAdded:    stream.entriesAdded,
+		Groups:          len(stream.groups),
+	}
+	if stream.Len() > 0 {
+		first, last := stream.entries[0], stream.entries[stream.Len()-1]
+		info.FirstEntry, info.LastEntry = &first, &last
+	}
+	return info, nil
+}
@@ -0,0 +1,845 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrNoGroup   = errors.New("NOGROUP No such key or consumer group")
+	ErrBusyGroup = errors.New("BUSYGROUP Consumer Group name already exists")
+)
+
+// consumerGroup tracks how far a group has read a stream and which entries
+// it delivered but has not had acknowledged yet, its pending entries list
+// (PEL).
+type consumerGroup struct {
+	lastDelivered StreamID
+	pending       map[StreamID]*PendingEntry
+	consumers     map[string]*streamConsumer
+}
+
+// streamConsumer is a member of a consumer group.
+type streamConsumer struct {
+	seenAt   time.Time // last read or claim attempt
+	activeAt time.Time // last successful read or claim, zero if none
+	pending  int
+}
+
+// PendingEntry is an entry delivered to a consumer and not acknowledged yet.
+type PendingEntry struct {
+	ID          StreamID
+	Consumer    string
+	DeliveredAt time.Time
+	Deliveries  int
+}
+
+func newConsumerGroup(lastDelivered StreamID) *consumerGroup {
+	return &consumerGroup{
+		lastDelivered: lastDelivered,
+		pending:       make(map[StreamID]*PendingEntry),
+		consumers:     make(map[string]*streamConsumer),
+	}
+}
+
+func groupSize(name string) int64 {
+	return 2*mapOverhead + entryOverhead + stringOverhead + int64(len(name)) + 32
+}
+
+func consumerSize(name string) int64 {
+	return entryOverhead + stringOverhead + int64(len(name)) + 56
+}
+
+// consumer returns the consumer called name, creating it if needed, and
+// marks it seen. It reports whether it was created.
+func (g *consumerGroup) consumer(name string, now time.Time) (*streamConsumer, bool) {
+	c, exists := g.consumers[name]
+	if !exists {
+		c = &streamConsumer{}
+		g.consumers[name] = c
+	}
+	c.seenAt = now
+	return c, !exists
+}
+
+// assign makes consumer the owner of the pending entry id, creating it if
+// needed, and returns it along with the change in estimated size.
+func (g *consumerGroup) assign(id StreamID, consumer string) (*PendingEntry, int64) {
+	pe, exists := g.pending[id]
+	if exists {
+		g.consumers[pe.Consumer].pending--
+		pe.Consumer = consumer
+		g.consumers[consumer].pending++
+		return pe, 0
+	}
+
+	pe = &PendingEntry{ID: id, Consumer: consumer}
+	g.pending[id] = pe
+	g.consumers[consumer].pending++
+	return pe, pendingEntrySize
+}
+
+// ack removes id from the PEL and reports whether it was pending.
+func (g *consumerGroup) ack(id StreamID) bool {
+	pe, exists := g.pending[id]
+	if !exists {
+		return false
+	}
+	g.consumers[pe.Consumer].pending--
+	delete(g.pending, id)
+	return true
+}
+
+// sortedPending returns the PEL in ID order.
+func (g *consumerGroup) sortedPending() []*PendingEntry {
+	pending := make([]*PendingEntry, 0, len(g.pending))
+	for _, pe := range g.pending {
+		pending = append(pending, pe)
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].ID.Less(pending[j].ID) })
+	return pending
+}
+
+func (g *consumerGroup) clone() *consumerGroup {
+	c := newConsumerGroup(g.lastDelivered)
+	for id, pe := range g.pending {
+		copied := *pe
+		c.pending[id] = &copied
+	}
+	for name, consumer := range g.consumers {
+		copied := *consumer
+		c.consumers[name] = &copied
+	}
+	return c
+}
+
+// writeGroup returns the item, stream and group for a write to a consumer
+// group, or ErrNoGroup if either the stream or the group is missing. The
+// caller must hold sh.mu.
+func (s *Store) writeGroup(sh *shard, key, group string) (*Item, *Stream, *consumerGroup, error) {
+	item, stream, err := s.writeStream(sh, key)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if item == nil || stream.groups[group] == nil {
+		return nil, nil, nil, ErrNoGroup
+	}
+	return item, stream, stream.groups[group], nil
+}
+
+// readGroup is writeGroup for reads. The caller must hold sh.mu for reading.
+func (s *Store) readGroup(sh *shard, key, group string) (*Stream, *consumerGroup, error) {
+	stream, err := s.readStream(sh, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if stream == nil || stream.groups[group] == nil {
+		return nil, nil, ErrNoGroup
+	}
+	return stream, stream.groups[group], nil
+}
+
+// groupStartID resolves the ID a group starts reading after: "$" for the
+// last entry of the stream, or an explicit ID.
+func groupStartID(stream *Stream, id string) (StreamID, error) {
+	if id == "$" {
+		if stream == nil {
+			return StreamID{}, nil
+		}
+		return stream.lastID, nil
+	}
+	return parseStreamID(id, 0)
+}
+
+// XGroupCreate creates a consumer group on the stream at key that delivers
+// the entries after id, "$" meaning the current last one. The stream is
+// created if it is missing and mkStream is set; otherwise ErrNoSuchKey is
+// returned.
+func (s *Store) XGroupCreate(key, group, id string, mkStream bool) error {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	return s.xgroupCreate(sh, key, group, id, mkStream)
+}
+
+// xgroupCreate implements XGroupCreate. The caller must hold sh.mu.
+func (s *Store) xgroupCreate(sh *shard, key, group, id string, mkStream bool) error {
+	item, stream, err := s.writeStream(sh, key)
+	if err != nil {
+		return err
+	}
+	if item == nil && !mkStream {
+		return ErrNoSuchKey
+	}
+	start, err := groupStartID(stream, id)
+	if err != nil {
+		return err
+	}
+	if stream != nil && stream.groups[group] != nil {
+		return ErrBusyGroup
+	}
+
+	delta := groupSize(group)
+	if item == nil {
+		delta += itemSize(key, newStream())
+	}
+	if err := s.reserveMemory(sh, key, delta); err != nil {
+		return err
+	}
+
+	args := []string{"XGROUP", "CREATE", key, group, start.String()}
+	if item == nil {
+		s.set(sh, key, newStream(), nil)
+		item, stream = sh.data[key], sh.data[key].Value.(*Stream)
+		args = append(args, "MKSTREAM")
+	}
+	stream.groups[group] = newConsumerGroup(start)
+	s.resize(item, groupSize(group))
+
+	s.propagate(args...)
+	s.notify(notifyStream, "xgroup-create", key)
+	return nil
+}
+
+// XGroupSetID moves the last delivered ID of group, "$" meaning the last
+// entry of the stream.
+func (s *Store) XGroupSetID(key, group, id string) error {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	return s.xgroupSetID(sh, key, group, id)
+}
+
+// xgroupSetID implements XGroupSetID. The caller must hold sh.mu.
+func (s *Store) xgroupSetID(sh *shard, key, group, id string) error {
+	_, stream, g, err := s.writeGroup(sh, key, group)
+	if err != nil {
+		return err
+	}
+	start, err := groupStartID(stream, id)
+	if err != nil {
+		return err
+	}
+	g.lastDelivered = start
+
+	s.propagate("XGROUP", "SETID", key, group, start.String())
+	s.notify(notifyStream, "xgroup-setid", key)
+	return nil
+}
+
+// XGroupDestroy deletes group and its PEL, reporting whether it existed.
+// Callers blocked in XReadGroup on it are woken up and get ErrNoGroup.
+func (s *Store) XGroupDestroy(key, group string) (bool, error) {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	return s.xgroupDestroy(sh, key, group)
+}
+
+// xgroupDestroy implements XGroupDestroy. The caller must hold sh.mu.
+func (s *Store) xgroupDestroy(sh *shard, key, group string) (bool, error) {
+	item, stream, g, err := s.writeGroup(sh, key, group)
+	if errors.Is(err, ErrNoGroup) {
+		if item, _, err = s.writeStream(sh, key); err == nil && item == nil {
+			err = ErrNoSuchKey
+		}
+		return false, err
+	}
+	if err != nil {
+		return false, err
+	}
+
+	delta := groupSize(group) + int64(len(g.pending))*pendingEntrySize
+	for name := range g.consumers {
+		delta += consumerSize(name)
+	}
+	delete(stream.groups, group)
+	s.resize(item, -delta)
+
+	s.propagate("XGROUP", "DESTROY", key, group)
+	s.notify(notifyStream, "xgroup-destroy", key)
+	sh.signal(key)
+	return true, nil
+}
+
+// XGroupCreateConsumer adds consumer to group, reporting whether it was new.
+func (s *Store) XGroupCreateConsumer(key, group, consumer string) (bool, error) {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	return s.xgroupCreateConsumer(sh, key, group, consumer)
+}
+
+// xgroupCreateConsumer implements XGroupCreateConsumer. The caller must hold
+// sh.mu.
+func (s *Store) xgroupCreateConsumer(sh *shard, key, group, consumer string) (bool, error) {
+	item, _, g, err := s.writeGroup(sh, key, group)
+	if err != nil {
+		return false, err
+	}
+	if _, exists := g.consumers[consumer]; exists {
+		return false, nil
+	}
+	if err := s.reserveMemory(sh, key, consumerSize(consumer)); err != nil {
+		return false, err
+	}
+	s.createConsumer(key, group, item, g, consumer, time.Now())
+	return true, nil
+}
+
+// createConsumer adds consumer to g if it is missing, logs it and returns
+// it marked as seen at now. The caller must hold the shard lock of key.
+func (s *Store) createConsumer(key, group string, item *Item, g *consumerGroup, consumer string, now time.Time) *streamConsumer {
+	c, created := g.consumer(consumer, now)
+	if created {
+		s.resize(item, consumerSize(consumer))
+		s.propagate("XGROUP", "CREATECONSUMER", key, group, consumer)
+		s.notify(notifyStream, "xgroup-createconsumer", key)
+	}
+	return c
+}
+
+// XGroupDelConsumer removes consumer from group along with its pending
+// entries and returns how many entries it had pending.
+func (s *Store) XGroupDelConsumer(key, group, consumer string) (int, error) {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	return s.xgroupDelConsumer(sh, key, group, consumer)
+}
+
+// xgroupDelConsumer implements XGroupDelConsumer. The caller must hold
+// sh.mu.
+func (s *Store) xgroupDelConsumer(sh *shard, key, group, consumer string) (int, error) {
+	item, _, g, err := s.writeGroup(sh, key, group)
+	if err != nil {
+		return 0, err
+	}
+	c, exists := g.consumers[consumer]
+	if !exists {
+		return 0, nil
+	}
+
+	pending := c.pending
+	for id, pe := range g.pending {
+		if pe.Consumer == consumer {
+			delete(g.pending, id)
+		}
+	}
+	delete(g.consumers, consumer)
+	s.resize(item, -consumerSize(consumer)-int64(pending)*pendingEntrySize)
+
+	s.propagate("XGROUP", "DELCONSUMER", key, group, consumer)
+	s.notify(notifyStream, "xgroup-delconsumer", key)
+	return pending, nil
+}
+
+// XReadGroup reads the streams at keys as consumer of group. An ID of ">"
+// delivers entries no consumer of the group has seen and adds them to the
+// PEL unless opts.NoAck is set; any other ID re-delivers the consumer's own
+// pending entries above it. With opts.Block and only ">" IDs it waits for
+// new entries, returning nil if the timeout passes first.
+func (s *Store) XReadGroup(ctx context.Context, group, consumer string, keys, ids []string, opts XReadOptions) ([]StreamResult, error) {
+	if len(keys) != len(ids) {
+		return nil, errors.New("unbalanced XREADGROUP list of streams: for each stream key an ID must be specified")
+	}
+
+	history := make([]bool, len(ids))
+	after := make([]StreamID, len(ids))
+	block := opts.Block
+	for i, id := range ids {
+		if id == ">" {
+			continue
+		}
+		var err error
+		if after[i], err = parseStreamID(id, 0); err != nil {
+			return nil, err
+		}
+		history[i], block = true, false
+	}
+
+	var results []StreamResult
+	try := func() (bool, error) {
+		results = results[:0]
+		now := time.Now()
+		served := false
+		for i, key := range keys {
+			entries, err := s.readGroupStream(s.shardFor(key), key, group, consumer, history[i], after[i], opts, now)
+			if err != nil {
+				return false, err
+			}
+			if history[i] || len(entries) > 0 {
+				results = append(results, StreamResult{Key: key, Entries: entries})
+				served = true
+			}
+		}
+		return served, nil
+	}
+
+	if !block {
+		unlock := s.lockKeys(keys...)
+		defer unlock()
+		_, err := try()
+		return results, err
+	}
+	ok, err := s.block(ctx, keys, keys, opts.Timeout, try)
+	if !ok {
+		return nil, err
+	}
+	return results, err
+}
+
+// readGroupStream serves one stream of XReadGroup. The caller must hold
+// sh.mu.
+func (s *Store) readGroupStream(sh *shard, key, group, consumer string, history bool, after StreamID, opts XReadOptions, now time.Time) ([]StreamEntry, error) {
+	item, stream, g, err := s.writeGroup(sh, key, group)
+	if err != nil {
+		return nil, err
+	}
+	if _, exists := g.consumers[consumer]; !exists {
+		if err := s.reserveMemory(sh, key, consumerSize(consumer)); err != nil {
+			return nil, err
+		}
+	}
+	c := s.createConsumer(key, group, item, g, consumer, now)
+
+	if history {
+		return s.redeliver(key, group, item, stream, g, consumer, after, opts.Count, now), nil
+	}
+
+	start, ok := g.lastDelivered.next()
+	if !ok {
+		return []StreamEntry{}, nil
+	}
+	entries := stream.rangeEntries(start, maxStreamID, opts.Count, false)
+	if len(entries) == 0 {
+		return entries, nil
+	}
+	if !opts.NoAck {
+		if err := s.reserveMemory(sh, key, int64(len(entries))*pendingEntrySize); err != nil {
+			return nil, err
+		}
+	}
+
+	c.activeAt = now
+	g.lastDelivered = entries[len(entries)-1].ID
+	if opts.NoAck {
+		s.propagate("XGROUP", "SETID", key, group, g.lastDelivered.String())
+		return entries, nil
+	}
+
+	var delta int64
+	args := []string{"XCLAIM", key, group, consumer, "0"}
+	for _, entry := range entries {
+		pe, d := g.assign(entry.ID, consumer)
+		pe.DeliveredAt, pe.Deliveries = now, 1
+		delta += d
+		args = append(args, entry.ID.String())
+	}
+	s.resize(item, delta)
+
+	// Logged the way Redis replicates it, as a forced claim of what was read
+	s.propagate(append(args, "TIME", strconv.FormatInt(now.UnixMilli(), 10),
+		"RETRYCOUNT", "1", "FORCE", "JUSTID", "LASTID", g.lastDelivered.String())...)
+	return entries, nil
+}
+
+// redeliver returns the pending entries of consumer above after, counting
+// a new delivery of each. Entries trimmed from the stream are returned with
+// nil fields. The caller must hold the shard lock of key.
+func (s *Store) redeliver(key, group string, item *Item, stream *Stream, g *consumerGroup, consumer string, after StreamID, count int, now time.Time) []StreamEntry {
+	entries := []StreamEntry{}
+	for _, pe := range g.sortedPending() {
+		if count > 0 && len(entries) == count {
+			break
+		}
+		if pe.Consumer != consumer || !after.Less(pe.ID) {
+			continue
+		}
+
+		pe.DeliveredAt = now
+		pe.Deliveries++
+		entry, exists := stream.lookup(pe.ID)
+		if !exists {
+			// Not logged: replaying a claim of a trimmed entry would drop it
+			entry = StreamEntry{ID: pe.ID}
+		} else {
+			s.propagateClaim(key, group, pe, nil)
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) > 0 {
+		g.consumers[consumer].activeAt = now
+	}
+	return entries
+}
+
+// propagateClaim logs the state of a pending entry as a forced XCLAIM, so it
+// replays the same whatever the PEL held.
+func (s *Store) propagateClaim(key, group string, pe *PendingEntry, lastID *StreamID) {
+	args := []string{"XCLAIM", key, group, pe.Consumer, "0", pe.ID.String(),
+		"TIME", strconv.FormatInt(pe.DeliveredAt.UnixMilli(), 10),
+		"RETRYCOUNT", strconv.Itoa(pe.Deliveries), "FORCE", "JUSTID"}
+	if lastID != nil {
+		args = append(args, "LASTID", lastID.String())
+	}
+	s.propagate(args...)
+}
+
+// XAck acknowledges ids for group, removing them from its PEL, and returns
+// how many were pending.
+func (s *Store) XAck(key, group string, ids ...string) (int, error) {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	return s.xack(sh, key, group, ids)
+}
+
+// xack implements XAck. The caller must hold sh.mu.
+func (s *Store) xack(sh *shard, key, group string, ids []string) (int, error) {
+	parsed := make([]StreamID, len(ids))
+	for i, id := range ids {
+		var err error
+		if parsed[i], err = parseStreamID(id, 0); err != nil {
+			return 0, err
+		}
+	}
+
+	item, _, g, err := s.writeGroup(sh, key, group)
+	if errors.Is(err, ErrNoGroup) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var acked []string
+	for _, id := range parsed {
+		if g.ack(id) {
+			acked = append(acked, id.String())
+		}
+	}
+	if len(acked) == 0 {
+		return 0, nil
+	}
+	s.resize(item, -int64(len(acked))*pendingEntrySize)
+
+	s.propagate(append([]string{"XACK", key, group}, acked...)...)
+	return len(acked), nil
+}
+
+// PendingSummary is the short form of XPENDING: how many entries a group
+// has pending, the lowest and highest of their IDs and how many each
+// consumer has.
+type PendingSummary struct {
+	Count     int
+	Lowest    string
+	Highest   string
+	Consumers map[string]int
+}
+
+// XPending summarises the PEL of group.
+func (s *Store) XPending(key, group string) (PendingSummary, error) {
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	_, g, err := s.readGroup(sh, key, group)
+	if err != nil {
+		return PendingSummary{}, err
+	}
+
+	summary := PendingSummary{Count: len(g.pending), Consumers: make(map[string]int)}
+	if len(g.pending) > 0 {
+		pending := g.sortedPending()
+		summary.Lowest = pending[0].ID.String()
+		summary.Highest = pending[len(pending)-1].ID.String()
+	}
+	for name, c := range g.consumers {
+		if c.pending > 0 {
+			summary.Consumers[name] = c.pending
+		}
+	}
+	return summary, nil
+}
+
+// XPendingRange returns up to count entries of the PEL of group with IDs
+// between start and end, optionally only those of consumer ("" for all) and
+// those idle for at least minIdle.
+func (s *Store) XPendingRange(key, group, start, end string, count int, consumer string, minIdle time.Duration) ([]PendingEntry, error) {
+	from, err := parseRangeBound(start, false)
+	if err != nil {
+		return nil, err
+	}
+	to, err := parseRangeBound(end, true)
+	if err != nil {
+		return nil, err
+	}
+
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	_, g, err := s.readGroup(sh, key, group)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	entries := []PendingEntry{}
+	for _, pe := range g.sortedPending() {
+		if len(entries) == count {
+			break
+		}
+		if pe.ID.Less(from) || to.Less(pe.ID) {
+			continue
+		}
+		if consumer != "" && pe.Consumer != consumer || now.Sub(pe.DeliveredAt) < minIdle {
+			continue
+		}
+		entries = append(entries, *pe)
+	}
+	return entries, nil
+}
+
+// XClaimOptions holds the optional arguments of XClaim.
+type XClaimOptions struct {
+	DeliveredAt time.Time // delivery time to record instead of now
+	RetryCount  int       // delivery count to record, if positive
+	Force       bool      // claim entries that are not pending yet
+	JustID      bool      // do not count a delivery and return no fields
+	LastID      string    // raise the group's last delivered ID to this
+}
+
+// XClaim transfers the pending entries ids of group that have been idle for
+// at least minIdle to consumer and returns them. Entries trimmed from the
+// stream are dropped from the PEL instead. With opts.JustID the returned
+// entries have no fields.
+func (s *Store) XClaim(key, group, consumer string, minIdle time.Duration, ids []string, opts XClaimOptions) ([]StreamEntry, error) {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	return s.xclaim(sh, key, group, consumer, minIdle, ids, opts)
+}
+
+// xclaim implements XClaim. The caller must hold sh.mu.
+func (s *Store) xclaim(sh *shard, key, group, consumer string, minIdle time.Duration, ids []string, opts XClaimOptions) ([]StreamEntry, error) {
+	parsed := make([]StreamID, len(ids))
+	for i, id := range ids {
+		var err error
+		if parsed[i], err = parseStreamID(id, 0); err != nil {
+			return nil, err
+		}
+	}
+	var lastID *StreamID
+	if opts.LastID != "" {
+		id, err := parseStreamID(opts.LastID, 0)
+		if err != nil {
+			return nil, err
+		}
+		lastID = &id
+	}
+
+	item, stream, g, err := s.writeGroup(sh, key, group)
+	if err != nil {
+		return nil, err
+	}
+	growth := consumerSize(consumer)
+	if opts.Force {
+		growth += int64(len(ids)) * pendingEntrySize
+	}
+	if err := s.reserveMemory(sh, key, growth); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	c := s.createConsumer(key, group, item, g, consumer, now)
+	if lastID != nil && g.lastDelivered.Less(*lastID) {
+		g.lastDelivered = *lastID
+	}
+
+	claimed := []StreamEntry{}
+	for _, id := range parsed {
+		entry, ok := s.claimOne(key, group, item, stream, g, consumer, id, minIdle, opts, now)
+		if ok {
+			claimed = append(claimed, entry)
+		}
+	}
+	if len(claimed) > 0 {
+		c.activeAt = now
+	}
+	return claimed, nil
+}
+
+// claimOne transfers the pending entry id to consumer if it qualifies, and
+// logs what it did. The caller must hold the shard lock of key.
+func (s *Store) claimOne(key, group string, item *Item, stream *Stream, g *consumerGroup, consumer string, id StreamID, minIdle time.Duration, opts XClaimOptions, now time.Time) (StreamEntry, bool) {
+	entry, inStream := stream.lookup(id)
+	pe, pending := g.pending[id]
+	switch {
+	case !pending && (!opts.Force || !inStream):
+		return StreamEntry{}, false
+	case pending && !inStream:
+		g.ack(id)
+		s.resize(item, -pendingEntrySize)
+		s.propagate("XACK", key, group, id.String())
+		return StreamEntry{}, false
+	case pending && now.Sub(pe.DeliveredAt) < minIdle:
+		return StreamEntry{}, false
+	}
+
+	pe, delta := g.assign(id, consumer)
+	s.resize(item, delta)
+	pe.DeliveredAt = now
+	if !opts.DeliveredAt.IsZero() {
+		pe.DeliveredAt = opts.DeliveredAt
+	}
+	switch {
+	case opts.RetryCount > 0:
+		pe.Deliveries = opts.RetryCount
+	case !opts.JustID:
+		pe.Deliveries++
+	}
+	s.propagateClaim(key, group, pe, &g.lastDelivered)
+
+	if opts.JustID {
+		entry.Fields = nil
+	}
+	return entry, true
+}
+
+// XAutoClaim scans the PEL of group from start for entries idle for at
+// least minIdle and claims up to count of them for consumer, like XClaim.
+// It returns the ID to continue the scan from ("0-0" once it is complete),
+// the claimed entries, and the IDs it dropped from the PEL because they were
+// trimmed from the stream.
+func (s *Store) XAutoClaim(key, group, consumer string, minIdle time.Duration, start string, count int, justID bool) (string, []StreamEntry, []string, error) {
+	from, err := parseRangeBound(start, false)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if count <= 0 {
+		count = 100
+	}
+
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	item, stream, g, err := s.writeGroup(sh, key, group)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if err := s.reserveMemory(sh, key, consumerSize(consumer)); err != nil {
+		return "", nil, nil, err
+	}
+
+	now := time.Now()
+	c := s.createConsumer(key, group, item, g, consumer, now)
+
+	claimed, deleted := []StreamEntry{}, []string{}
+	next := StreamID{}
+	// Like Redis, look at no more than ten times count entries per call
+	attempts := count * 10
+	for _, pe := range g.sortedPending() {
+		if pe.ID.Less(from) {
+			continue
+		}
+		if len(claimed) == count || attempts == 0 {
+			next = pe.ID
+			break
+		}
+		attempts--
+
+		if _, inStream := stream.lookup(pe.ID); !inStream {
+			deleted = append(deleted, pe.ID.String())
+		}
+		entry, ok := s.claimOne(key, group, item, stream, g, consumer, pe.ID, minIdle, XClaimOptions{JustID: justID}, now)
+		if ok {
+			claimed = append(claimed, entry)
+		}
+	}
+	if len(claimed) > 0 {
+		c.activeAt = now
+	}
+	return next.String(), claimed, deleted, nil
+}
+
+// StreamGroupInfo describes a consumer group, as returned by XInfoGroups.
+type StreamGroupInfo struct {
+	Name            string
+	Consumers       int
+	Pending         int
+	LastDeliveredID string
+}
+
+// XInfoGroups describes the consumer groups of the stream at key, sorted by
+// name. It returns ErrNoSuchKey if there is no stream.
+func (s *Store) XInfoGroups(key string) ([]StreamGroupInfo, error) {
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	stream, err := s.readStream(sh, key)
+	if err != nil {
+		return nil, err
+	}
+	if stream == nil {
+		return nil, ErrNoSuchKey
+	}
+
+	groups := make([]StreamGroupInfo, 0, len(stream.groups))
+	for name, g := range stream.groups {
+		groups = append(groups, StreamGroupInfo{
+			Name:            name,
+			Consumers:       len(g.consumers),
+			Pending:         len(g.pending),
+			LastDeliveredID: g.lastDelivered.String(),
+		})
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return groups, nil
+}
+
+// StreamConsumerInfo describes a consumer, as returned by XInfoConsumers.
+// Inactive is -1 if the consumer never read or claimed anything.
+type StreamConsumerInfo struct {
+	Name     string
+	Pending  int
+	Idle     time.Duration
+	Inactive time.Duration
+}
+
+// XInfoConsumers describes the consumers of group, sorted by name.
+func (s *Store) XInfoConsumers(key, group string) ([]StreamConsumerInfo, error) {
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	_, g, err := s.readGroup(sh, key, group)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	consumers := make([]StreamConsumerInfo, 0, len(g.consumers))
+	for name, c := range g.consumers {
+		info := StreamConsumerInfo{Name: name, Pending: c.pending, Idle: now.Sub(c.seenAt), Inactive: -1}
+		if !c.activeAt.IsZero() {
+			info.Inactive = now.Sub(c.activeAt)
+		}
+		consumers = append(consumers, info)
+	}
+	sort.Slice(consumers, func(i, j int) bool { return consumers[i].Name < consumers[j].Name })
+	return consumers, nil
+}
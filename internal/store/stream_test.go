@@ -0,0 +1,303 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/chaitanyayendru/fincache/internal/config"
+)
+
+func entryIDs(entries []StreamEntry) []string {
+	ids := make([]string, len(entries))
+	for i, entry := range entries {
+		ids[i] = entry.ID.String()
+	}
+	return ids
+}
+
+func TestStreamAddAndRange(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	for _, id := range []string{"1-1", "1-2", "2-*", "5"} {
+		if _, err := store.XAdd("ticks", id, []string{"price", "101.5"}, XAddOptions{}); err != nil {
+			t.Fatalf("Expected XADD %s to succeed: %v", id, err)
+		}
+	}
+	if _, err := store.XAdd("ticks", "5-0", []string{"price", "1"}, XAddOptions{}); !errors.Is(err, ErrStreamIDTooSmall) {
+		t.Errorf("Expected ErrStreamIDTooSmall, got %v", err)
+	}
+	if _, err := store.XAdd("other", "0-0", []string{"price", "1"}, XAddOptions{}); !errors.Is(err, ErrStreamIDZero) {
+		t.Errorf("Expected ErrStreamIDZero, got %v", err)
+	}
+	auto, _ := store.XAdd("ticks", "*", []string{"price", "102"}, XAddOptions{})
+	if id, err := parseStreamID(auto, 0); err != nil || !(StreamID{5, 0}).Less(id) {
+		t.Errorf("Expected an automatic ID above 5-0, got %s", auto)
+	}
+
+	entries, _ := store.XRange("ticks", "-", "+", 0)
+	if !reflect.DeepEqual(entryIDs(entries)[:4], []string{"1-1", "1-2", "2-0", "5-0"}) {
+		t.Errorf("Unexpected range %v", entryIDs(entries))
+	}
+	if entries[0].Fields[1] != "101.5" {
+		t.Errorf("Expected fields to be kept, got %v", entries[0].Fields)
+	}
+	if entries, _ := store.XRange("ticks", "1", "2", 0); !reflect.DeepEqual(entryIDs(entries), []string{"1-1", "1-2", "2-0"}) {
+		t.Errorf("Expected a bare ms to cover the millisecond, got %v", entryIDs(entries))
+	}
+	if entries, _ := store.XRange("ticks", "(1-1", "+", 2); !reflect.DeepEqual(entryIDs(entries), []string{"1-2", "2-0"}) {
+		t.Errorf("Expected an exclusive start and a count, got %v", entryIDs(entries))
+	}
+	if entries, _ := store.XRevRange("ticks", "5", "-", 2); !reflect.DeepEqual(entryIDs(entries), []string{"5-0", "2-0"}) {
+		t.Errorf("Unexpected reverse range %v", entryIDs(entries))
+	}
+
+	if id, _ := store.XAdd("missing", "*", []string{"a", "b"}, XAddOptions{NoMkStream: true}); id != "" || store.Exists("missing") {
+		t.Error("Expected NOMKSTREAM not to create the stream")
+	}
+}
+
+func TestStreamTrim(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	for i := 1; i <= 10; i++ {
+		store.XAdd("log", "*", []string{"n", "x"}, XAddOptions{Trim: &StreamTrim{MaxLen: 3}})
+	}
+	if n, _ := store.XLen("log"); n != 3 {
+		t.Errorf("Expected MAXLEN to keep 3 entries, got %d", n)
+	}
+
+	store.XAdd("ids", "1-0", []string{"a", "b"}, XAddOptions{})
+	store.XAdd("ids", "2-0", []string{"a", "b"}, XAddOptions{})
+	store.XAdd("ids", "3-0", []string{"a", "b"}, XAddOptions{})
+	if n, _ := store.XTrim("ids", StreamTrim{MinID: "2-0"}); n != 1 {
+		t.Errorf("Expected MINID to remove 1 entry, got %d", n)
+	}
+
+	// Streams are kept when empty, with their last ID
+	store.XTrim("ids", StreamTrim{MaxLen: 0})
+	if info, err := store.XInfoStream("ids"); err != nil || info.Length != 0 || info.LastGeneratedID != "3-0" {
+		t.Errorf("Expected an empty stream with last ID 3-0, got %+v (%v)", info, err)
+	}
+
+	store.Del("log", "ids")
+	if store.UsedMemory() != 0 || store.Stats().KeysByType["stream"] != 0 {
+		t.Errorf("Expected accounting to return to zero, got %d bytes", store.UsedMemory())
+	}
+}
+
+func TestXReadBlocks(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	store.XAdd("a", "1-0", []string{"k", "v"}, XAddOptions{})
+	results, _ := store.XRead(context.Background(), []string{"a", "b"}, []string{"0", "0"}, XReadOptions{})
+	if len(results) != 1 || results[0].Key != "a" || len(results[0].Entries) != 1 {
+		t.Errorf("Expected one entry from a, got %+v", results)
+	}
+
+	done := make(chan []StreamResult)
+	go func() {
+		results, _ := store.XRead(context.Background(), []string{"a", "b"}, []string{"$", "$"}, XReadOptions{Block: true, Timeout: 5 * time.Second})
+		done <- results
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	store.XAdd("b", "7-0", []string{"k", "v"}, XAddOptions{})
+
+	select {
+	case results := <-done:
+		if len(results) != 1 || results[0].Key != "b" || results[0].Entries[0].ID.String() != "7-0" {
+			t.Errorf("Expected the new entry of b, got %+v", results)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected XREAD to be woken by XADD")
+	}
+
+	results, err := store.XRead(context.Background(), []string{"a"}, []string{"$"}, XReadOptions{Block: true, Timeout: 20 * time.Millisecond})
+	if results != nil || err != nil {
+		t.Errorf("Expected a timeout, got %+v (%v)", results, err)
+	}
+}
+
+func TestConsumerGroups(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	if err := store.XGroupCreate("orders", "billing", "$", false); !errors.Is(err, ErrNoSuchKey) {
+		t.Errorf("Expected ErrNoSuchKey without MKSTREAM, got %v", err)
+	}
+	if err := store.XGroupCreate("orders", "billing", "$", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.XGroupCreate("orders", "billing", "$", false); !errors.Is(err, ErrBusyGroup) {
+		t.Errorf("Expected ErrBusyGroup, got %v", err)
+	}
+	for _, id := range []string{"1-0", "2-0", "3-0"} {
+		store.XAdd("orders", id, []string{"amount", "10"}, XAddOptions{})
+	}
+
+	ctx := context.Background()
+	results, _ := store.XReadGroup(ctx, "billing", "alice", []string{"orders"}, []string{">"}, XReadOptions{Count: 2})
+	if len(results) != 1 || !reflect.DeepEqual(entryIDs(results[0].Entries), []string{"1-0", "2-0"}) {
+		t.Fatalf("Expected alice to get 1-0 and 2-0, got %+v", results)
+	}
+	results, _ = store.XReadGroup(ctx, "billing", "bob", []string{"orders"}, []string{">"}, XReadOptions{})
+	if !reflect.DeepEqual(entryIDs(results[0].Entries), []string{"3-0"}) {
+		t.Errorf("Expected bob to get 3-0, got %+v", results)
+	}
+	if results, _ := store.XReadGroup(ctx, "billing", "bob", []string{"orders"}, []string{">"}, XReadOptions{}); results != nil {
+		t.Errorf("Expected nothing new, got %+v", results)
+	}
+
+	// Reading history re-delivers the consumer's own pending entries
+	results, _ = store.XReadGroup(ctx, "billing", "alice", []string{"orders"}, []string{"0"}, XReadOptions{})
+	if !reflect.DeepEqual(entryIDs(results[0].Entries), []string{"1-0", "2-0"}) {
+		t.Errorf("Expected alice's history, got %+v", results)
+	}
+
+	summary, _ := store.XPending("orders", "billing")
+	if summary.Count != 3 || summary.Lowest != "1-0" || summary.Highest != "3-0" ||
+		!reflect.DeepEqual(summary.Consumers, map[string]int{"alice": 2, "bob": 1}) {
+		t.Errorf("Unexpected pending summary %+v", summary)
+	}
+	pending, _ := store.XPendingRange("orders", "billing", "-", "+", 10, "alice", 0)
+	if len(pending) != 2 || pending[0].Deliveries != 2 {
+		t.Errorf("Expected 2 entries delivered twice, got %+v", pending)
+	}
+
+	if n, _ := store.XAck("orders", "billing", "1-0", "9-0"); n != 1 {
+		t.Errorf("Expected 1 entry acknowledged, got %d", n)
+	}
+
+	// bob takes over alice's remaining entry
+	time.Sleep(10 * time.Millisecond)
+	if claimed, _ := store.XClaim("orders", "billing", "bob", time.Hour, []string{"2-0"}, XClaimOptions{}); len(claimed) != 0 {
+		t.Errorf("Expected entries below min-idle to stay put, got %+v", claimed)
+	}
+	claimed, _ := store.XClaim("orders", "billing", "bob", 5*time.Millisecond, []string{"2-0"}, XClaimOptions{})
+	if len(claimed) != 1 || claimed[0].Fields[0] != "amount" {
+		t.Errorf("Expected bob to claim 2-0, got %+v", claimed)
+	}
+	if pending, _ := store.XPendingRange("orders", "billing", "-", "+", 10, "", 0); pending[0].Consumer != "bob" || pending[0].Deliveries != 3 {
+		t.Errorf("Expected 2-0 to belong to bob with 3 deliveries, got %+v", pending)
+	}
+
+	consumers, _ := store.XInfoConsumers("orders", "billing")
+	if len(consumers) != 2 || consumers[0].Name != "alice" || consumers[0].Pending != 0 || consumers[1].Pending != 2 {
+		t.Errorf("Unexpected consumers %+v", consumers)
+	}
+	groups, _ := store.XInfoGroups("orders")
+	if len(groups) != 1 || groups[0].LastDeliveredID != "3-0" || groups[0].Pending != 2 {
+		t.Errorf("Unexpected groups %+v", groups)
+	}
+
+	if n, _ := store.XGroupDelConsumer("orders", "billing", "bob"); n != 2 {
+		t.Errorf("Expected bob to have 2 pending, got %d", n)
+	}
+	if ok, _ := store.XGroupDestroy("orders", "billing"); !ok {
+		t.Error("Expected the group to be destroyed")
+	}
+	if _, err := store.XReadGroup(ctx, "billing", "alice", []string{"orders"}, []string{">"}, XReadOptions{}); !errors.Is(err, ErrNoGroup) {
+		t.Errorf("Expected ErrNoGroup, got %v", err)
+	}
+}
+
+func TestXAutoClaim(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	store.XGroupCreate("jobs", "workers", "0", true)
+	for _, id := range []string{"1-0", "2-0", "3-0", "4-0"} {
+		store.XAdd("jobs", id, []string{"job", id}, XAddOptions{})
+	}
+	store.XReadGroup(context.Background(), "workers", "crashed", []string{"jobs"}, []string{">"}, XReadOptions{})
+	store.XTrim("jobs", StreamTrim{MinID: "2-0"})
+
+	next, claimed, deleted, err := store.XAutoClaim("jobs", "workers", "rescuer", 0, "0", 2, false)
+	if err != nil || next != "4-0" || !reflect.DeepEqual(entryIDs(claimed), []string{"2-0", "3-0"}) || !reflect.DeepEqual(deleted, []string{"1-0"}) {
+		t.Errorf("Unexpected first page %s %v %v (%v)", next, entryIDs(claimed), deleted, err)
+	}
+	next, claimed, _, _ = store.XAutoClaim("jobs", "workers", "rescuer", 0, next, 2, true)
+	if next != "0-0" || len(claimed) != 1 || claimed[0].Fields != nil {
+		t.Errorf("Expected the last entry with JUSTID, got %s %+v", next, claimed)
+	}
+	if summary, _ := store.XPending("jobs", "workers"); summary.Count != 3 || summary.Consumers["rescuer"] != 3 {
+		t.Errorf("Unexpected pending summary %+v", summary)
+	}
+}
+
+func TestXReadGroupBlocks(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	store.XGroupCreate("events", "g", "$", true)
+	done := make(chan error)
+	go func() {
+		_, err := store.XReadGroup(context.Background(), "g", "c", []string{"events"}, []string{">"}, XReadOptions{Block: true})
+		done <- err
+	}()
+
+	// Destroying the group wakes the reader with an error
+	time.Sleep(20 * time.Millisecond)
+	store.XGroupDestroy("events", "g")
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrNoGroup) {
+			t.Errorf("Expected ErrNoGroup, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected XREADGROUP to be woken by XGROUP DESTROY")
+	}
+}
+
+func TestStreamPersistence(t *testing.T) {
+	cfg := aofConfig(t.TempDir())
+
+	store := NewStore(cfg)
+	store.XAdd("snap", "1-0", []string{"a", "1"}, XAddOptions{})
+	store.XGroupCreate("snap", "g", "0", false)
+	store.XReadGroup(context.Background(), "g", "c1", []string{"snap"}, []string{">"}, XReadOptions{})
+	if err := store.SaveSnapshot(); err != nil {
+		t.Fatalf("Expected no error when saving snapshot: %v", err)
+	}
+
+	ctx := context.Background()
+	store.XGroupCreate("log", "g", "$", true)
+	for _, id := range []string{"1-0", "2-0", "3-0"} {
+		store.XAdd("log", id, []string{"n", id}, XAddOptions{})
+	}
+	store.XReadGroup(ctx, "g", "c1", []string{"log"}, []string{">"}, XReadOptions{})
+	store.XReadGroup(ctx, "g", "c1", []string{"log"}, []string{"0"}, XReadOptions{Count: 1})
+	store.XAck("log", "g", "2-0")
+	store.XClaim("log", "g", "c2", 0, []string{"3-0"}, XClaimOptions{})
+	store.XAdd("log", "4-0", []string{"n", "4"}, XAddOptions{Trim: &StreamTrim{MaxLen: 2}})
+	want, _ := store.XPendingRange("log", "g", "-", "+", 10, "", 0)
+	store.Close()
+
+	restored := NewStore(cfg)
+	defer restored.Close()
+
+	if summary, _ := restored.XPending("snap", "g"); summary.Count != 1 || summary.Consumers["c1"] != 1 {
+		t.Errorf("Expected the snapshot to keep the PEL, got %+v", summary)
+	}
+	if entries, _ := restored.XRange("log", "-", "+", 0); !reflect.DeepEqual(entryIDs(entries), []string{"3-0", "4-0"}) {
+		t.Errorf("Expected replayed entries [3-0 4-0], got %v", entryIDs(entries))
+	}
+	got, _ := restored.XPendingRange("log", "g", "-", "+", 10, "", 0)
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d pending entries, got %+v", len(want), got)
+	}
+	for i := range want {
+		if got[i].ID != want[i].ID || got[i].Consumer != want[i].Consumer || got[i].Deliveries != want[i].Deliveries {
+			t.Errorf("Expected pending entry %+v, got %+v", want[i], got[i])
+		}
+	}
+	if groups, _ := restored.XInfoGroups("log"); groups[0].LastDeliveredID != "3-0" || groups[0].Consumers != 2 {
+		t.Errorf("Unexpected replayed group %+v", groups)
+	}
+}
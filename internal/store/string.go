@@ -0,0 +1,454 @@
+package store
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxStringLength caps strings grown by APPEND and SETRANGE at 512MB, as in
+// Redis.
+const maxStringLength = 512 << 20
+
+var (
+	ErrNotInteger    = errors.New("value is not an integer or out of range")
+	ErrNotFloat      = errors.New("value is not a valid float")
+	ErrStringTooLong = errors.New("string exceeds maximum allowed size (512MB)")
+	ErrOffset        = errors.New("offset is out of range")
+)
+
+// parseInteger parses a string value as a 64-bit integer. Like Redis it
+// only accepts the canonical form, so "+1", "01" and " 1" are not integers.
+func parseInteger(str string) (int64, error) {
+	n, err := strconv.ParseInt(str, 10, 64)
+	if err != nil || strconv.FormatInt(n, 10) != str {
+		return 0, ErrNotInteger
+	}
+	return n, nil
+}
+
+// putString stores value at key with expiresAt, replacing any value the key
+// had, and logs it as a SET. The caller must hold sh.mu.
+func (s *Store) putString(sh *shard, key, value string, expiresAt *time.Time) error {
+	delta := itemSize(key, value)
+	if prev, exists := sh.data[key]; exists {
+		delta -= prev.size
+	}
+	if prev, exists := sh.sortedSets[key]; exists {
+		delta -= zsetSize(key, prev)
+	}
+	if err := s.reserveMemory(sh, key, delta); err != nil {
+		return err
+	}
+	s.set(sh, key, value, expiresAt)
+
+	s.propagateSet(key, value, expiresAt)
+	s.notify(notifyString, "set", key)
+	if expiresAt != nil {
+		s.notify(notifyGeneric, "expire", key)
+	}
+	return nil
+}
+
+// propagateSet logs the string value of key as a SET, with its expiry if it
+// has one.
+func (s *Store) propagateSet(key, value string, expiresAt *time.Time) {
+	if s.aof == nil {
+		return
+	}
+	payload, err := marshalValue(value)
+	if err != nil {
+		return // strings always encode
+	}
+	if expiresAt != nil {
+		s.propagate("SET", key, payload, "PXAT", formatUnixMilli(*expiresAt))
+	} else {
+		s.propagate("SET", key, payload)
+	}
+}
+
+// SetOptions are the options of SetString.
+type SetOptions struct {
+	// ExpiresAt is the expiry of the key; zero means none.
+	ExpiresAt time.Time
+	// KeepTTL keeps the expiry the key already had, if any.
+	KeepTTL bool
+	NX      bool // only set the key if it does not exist
+	XX      bool // only set the key if it exists
+	// Get returns the string the key held, failing with ErrWrongType if it
+	// holds another type.
+	Get bool
+}
+
+// SetString stores the string value at key as SET does, replacing a value of
+// any type. It reports whether the value was written, which NX and XX may
+// prevent, and with Get returns the previous string, nil if there was none.
+func (s *Store) SetString(key, value string, opts SetOptions) (*string, bool, error) {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	var old *string
+	if opts.Get {
+		item, str, err := s.writeString(sh, key)
+		if err != nil {
+			return nil, false, err
+		}
+		if item != nil {
+			old = &str
+		}
+	}
+
+	exists := s.liveKey(sh, key)
+	if opts.NX && exists || opts.XX && !exists {
+		return old, false, nil
+	}
+
+	var expiresAt *time.Time
+	if !opts.ExpiresAt.IsZero() {
+		expiresAt = &opts.ExpiresAt
+	} else if item, isItem := sh.data[key]; opts.KeepTTL && exists && isItem {
+		expiresAt = item.ExpiresAt
+	}
+	if err := s.putString(sh, key, value, expiresAt); err != nil {
+		return nil, false, err
+	}
+	return old, true, nil
+}
+
+// IncrBy adds increment to the integer stored as a string at key, which is
+// created as 0 if missing, keeping its TTL, and returns the new value. It
+// fails with ErrNotInteger if the string is not an integer and with
+// ErrIncrOverflow if the result does not fit in 64 bits.
+func (s *Store) IncrBy(key string, increment int64) (int64, error) {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	return s.incrBy(sh, key, increment)
+}
+
+// incrBy implements IncrBy. The caller must hold sh.mu.
+func (s *Store) incrBy(sh *shard, key string, increment int64) (int64, error) {
+	item, str, err := s.writeString(sh, key)
+	if err != nil {
+		return 0, err
+	}
+
+	var current int64
+	if item != nil {
+		if current, err = parseInteger(str); err != nil {
+			return 0, err
+		}
+	}
+	if (increment > 0 && current > math.MaxInt64-increment) || (increment < 0 && current < math.MinInt64-increment) {
+		return 0, ErrIncrOverflow
+	}
+	result := current + increment
+	if err := s.storeString(sh, key, item, strconv.FormatInt(result, 10)); err != nil {
+		return 0, err
+	}
+
+	s.propagate("INCRBY", key, strconv.FormatInt(increment, 10))
+	s.notify(notifyString, "incrby", key)
+	return result, nil
+}
+
+// IncrByFloat adds increment to the number stored as a string at key, which
+// is created as 0 if missing, keeping its TTL, and returns the new value. It
+// fails with ErrNotFloat if the string is not a number and with
+// ErrIncrOverflow if the result is not finite.
+func (s *Store) IncrByFloat(key string, increment float64) (float64, error) {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	item, str, err := s.writeString(sh, key)
+	if err != nil {
+		return 0, err
+	}
+
+	var current float64
+	if item != nil {
+		current, err = strconv.ParseFloat(str, 64)
+		if err != nil || math.IsNaN(current) || math.IsInf(current, 0) {
+			return 0, ErrNotFloat
+		}
+	}
+	if sum := current + increment; math.IsNaN(sum) || math.IsInf(sum, 0) {
+		return 0, ErrIncrOverflow
+	}
+
+	value, result := addFloats(current, increment)
+	if math.IsInf(result, 0) {
+		return 0, ErrIncrOverflow
+	}
+	if err := s.storeString(sh, key, item, value); err != nil {
+		return 0, err
+	}
+
+	// Floating point results are logged as the value written, as Redis does,
+	// so replay cannot drift.
+	s.propagateSet(key, value, sh.data[key].ExpiresAt)
+	s.notify(notifyString, "incrbyfloat", key)
+	return result, nil
+}
+
+// addFloats adds increment to current as Redis does: in the 64-bit mantissa
+// of a C long double, starting from the shortest decimal form of both, and
+// formatted with 17 decimals without trailing zeros. It returns the formatted
+// sum and its value. The extra precision keeps 0.1 + 0.2 at "0.3" rather
+// than "0.30000000000000004".
+func addFloats(current, increment float64) (string, float64) {
+	sum, _, _ := big.ParseFloat(formatFloat(current), 10, 64, big.ToNearestEven)
+	inc, _, _ := big.ParseFloat(formatFloat(increment), 10, 64, big.ToNearestEven)
+	sum.Add(sum, inc)
+
+	value := strings.TrimSuffix(strings.TrimRight(sum.Text('f', 17), "0"), ".")
+	result, _ := strconv.ParseFloat(value, 64)
+	return value, result
+}
+
+// Append appends value to the string at key, creating it if missing, and
+// returns its new length.
+func (s *Store) Append(key, value string) (int, error) {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	return s.append(sh, key, value)
+}
+
+// append implements Append. The caller must hold sh.mu.
+func (s *Store) append(sh *shard, key, value string) (int, error) {
+	item, str, err := s.writeString(sh, key)
+	if err != nil {
+		return 0, err
+	}
+	if len(str)+len(value) > maxStringLength {
+		return 0, ErrStringTooLong
+	}
+
+	str += value
+	if err := s.storeString(sh, key, item, str); err != nil {
+		return 0, err
+	}
+
+	s.propagate("APPEND", key, value)
+	s.notify(notifyString, "append", key)
+	return len(str), nil
+}
+
+// StrLen returns the length of the string at key, 0 if it is missing.
+func (s *Store) StrLen(key string) (int, error) {
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	str, _, err := s.readString(sh, key)
+	return len(str), err
+}
+
+// GetRange returns the bytes of the string at key from start to end
+// inclusive. Negative indexes count from the end, and the range is clamped
+// to the string, so a missing key or an empty range gives "".
+func (s *Store) GetRange(key string, start, end int64) (string, error) {
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	str, _, err := s.readString(sh, key)
+	if err != nil {
+		return "", err
+	}
+
+	n := int64(len(str))
+	if start < 0 && end < 0 && start > end {
+		return "", nil
+	}
+	if start < 0 {
+		start = max(n+start, 0)
+	}
+	if end < 0 {
+		end = max(n+end, 0)
+	}
+	end = min(end, n-1)
+	if start > end || n == 0 {
+		return "", nil
+	}
+	return str[start : end+1], nil
+}
+
+// SetRange overwrites the string at key with value from offset on, padding
+// it with zero bytes if it is shorter, and returns its new length. An empty
+// value leaves the key untouched.
+func (s *Store) SetRange(key string, offset int64, value string) (int, error) {
+	if offset < 0 {
+		return 0, ErrOffset
+	}
+
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	return s.setRange(sh, key, offset, value)
+}
+
+// setRange implements SetRange. The caller must hold sh.mu.
+func (s *Store) setRange(sh *shard, key string, offset int64, value string) (int, error) {
+	item, str, err := s.writeString(sh, key)
+	if err != nil {
+		return 0, err
+	}
+	if value == "" {
+		return len(str), nil
+	}
+	if offset > maxStringLength-int64(len(value)) {
+		return 0, ErrStringTooLong
+	}
+
+	b := make([]byte, max(int64(len(str)), offset+int64(len(value))))
+	copy(b, str)
+	copy(b[offset:], value)
+	if err := s.storeString(sh, key, item, string(b)); err != nil {
+		return 0, err
+	}
+
+	s.propagate("SETRANGE", key, strconv.FormatInt(offset, 10), value)
+	s.notify(notifyString, "setrange", key)
+	return len(b), nil
+}
+
+// MGet returns the string at each of keys, nil for keys that are missing or
+// hold another type.
+func (s *Store) MGet(keys ...string) []*string {
+	unlock := s.lockKeys(keys...)
+	defer unlock()
+
+	values := make([]*string, len(keys))
+	for i, key := range keys {
+		str, exists, err := s.readString(s.shardFor(key), key)
+		if err == nil && exists {
+			values[i] = &str
+		}
+	}
+	return values
+}
+
+// MSet stores each key and value of keyValues, replacing values of any type
+// and clearing their TTLs. Keys set before an error are kept.
+func (s *Store) MSet(keyValues ...string) error {
+	if len(keyValues)%2 != 0 {
+		return errors.New("each key needs a value")
+	}
+
+	unlock := s.lockKeys(evenArgs(keyValues)...)
+	defer unlock()
+
+	return s.mset(keyValues)
+}
+
+// MSetNX stores each key and value of keyValues as MSet does, unless any of
+// the keys exists, and reports whether it stored them.
+func (s *Store) MSetNX(keyValues ...string) (bool, error) {
+	if len(keyValues)%2 != 0 {
+		return false, errors.New("each key needs a value")
+	}
+
+	keys := evenArgs(keyValues)
+	unlock := s.lockKeys(keys...)
+	defer unlock()
+
+	for _, key := range keys {
+		if s.liveKey(s.shardFor(key), key) {
+			return false, nil
+		}
+	}
+	return true, s.mset(keyValues)
+}
+
+// mset implements MSet. The caller must hold the locks of every key.
+func (s *Store) mset(keyValues []string) error {
+	for i := 0; i < len(keyValues); i += 2 {
+		key := keyValues[i]
+		if err := s.putString(s.shardFor(key), key, keyValues[i+1], nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// evenArgs returns the keys of alternating keys and values.
+func evenArgs(keyValues []string) []string {
+	keys := make([]string, 0, len(keyValues)/2)
+	for i := 0; i < len(keyValues); i += 2 {
+		keys = append(keys, keyValues[i])
+	}
+	return keys
+}
+
+// GetSet stores value at key, clearing its TTL, and returns the string it
+// held, nil if there was none. It fails with ErrWrongType, writing nothing,
+// if the key holds another type.
+func (s *Store) GetSet(key, value string) (*string, error) {
+	old, _, err := s.SetString(key, value, SetOptions{Get: true})
+	return old, err
+}
+
+// GetDel deletes the string at key and returns it, nil if there was none.
+func (s *Store) GetDel(key string) (*string, error) {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	item, str, err := s.writeString(sh, key)
+	if err != nil || item == nil {
+		return nil, err
+	}
+	s.del(sh, key)
+
+	s.propagate("DEL", key)
+	s.notify(notifyGeneric, "del", key)
+	return &str, nil
+}
+
+// GetExOptions change the TTL of the key read by GetEx; the zero value
+// leaves it alone.
+type GetExOptions struct {
+	// ExpiresAt is the new expiry of the key; a time already past deletes
+	// it.
+	ExpiresAt time.Time
+	// Persist removes the TTL of the key.
+	Persist bool
+}
+
+// GetEx returns the string at key, nil if there is none, and changes its TTL
+// according to opts.
+func (s *Store) GetEx(key string, opts GetExOptions) (*string, error) {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	item, str, err := s.writeString(sh, key)
+	if err != nil || item == nil {
+		return nil, err
+	}
+
+	switch {
+	case !opts.ExpiresAt.IsZero() && !time.Now().Before(opts.ExpiresAt):
+		s.del(sh, key)
+		s.propagate("DEL", key)
+		s.notify(notifyGeneric, "del", key)
+	case !opts.ExpiresAt.IsZero():
+		s.expireAt(sh, key, opts.ExpiresAt)
+		s.propagate("PEXPIREAT", key, formatUnixMilli(opts.ExpiresAt))
+		s.notify(notifyGeneric, "expire", key)
+	case opts.Persist && s.persist(sh, key):
+		s.propagate("PERSIST", key)
+		s.notify(notifyGeneric, "persist", key)
+	}
+	return &str, nil
+}
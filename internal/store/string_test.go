@@ -0,0 +1,253 @@
+package store
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/chaitanyayendru/fincache/internal/config"
+)
+
+func TestSetStringOptions(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	if _, written, _ := store.SetString("k", "a", SetOptions{XX: true}); written {
+		t.Errorf("Expected XX not to create a key")
+	}
+	if _, written, _ := store.SetString("k", "a", SetOptions{NX: true}); !written {
+		t.Errorf("Expected NX to create a missing key")
+	}
+	old, written, _ := store.SetString("k", "b", SetOptions{NX: true, Get: true})
+	if written || old == nil || *old != "a" {
+		t.Errorf("Expected NX to keep the key and GET to return it, got %v %v", old, written)
+	}
+
+	store.SetString("k", "c", SetOptions{ExpiresAt: time.Now().Add(time.Hour)})
+	store.SetString("k", "d", SetOptions{KeepTTL: true})
+	if ttl, _ := store.TTL("k"); ttl <= 0 {
+		t.Errorf("Expected KEEPTTL to keep the TTL, got %v", ttl)
+	}
+	store.SetString("k", "e", SetOptions{})
+	if ttl, _ := store.TTL("k"); ttl != -1 {
+		t.Errorf("Expected SET to clear the TTL, got %v", ttl)
+	}
+
+	store.HSet("h", "f", "v")
+	if _, _, err := store.SetString("h", "x", SetOptions{Get: true}); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Expected GET on a hash to fail with ErrWrongType, got %v", err)
+	}
+	if _, written, _ := store.SetString("h", "x", SetOptions{}); !written {
+		t.Errorf("Expected SET to replace a hash")
+	}
+}
+
+func TestSetReplacesSortedSet(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	store.ZAdd("book", 101.5, "ask")
+	if _, written, _ := store.SetString("book", "closed", SetOptions{}); !written {
+		t.Fatalf("Expected SET to replace a sorted set")
+	}
+	if typ := store.Type("book"); typ != "string" {
+		t.Errorf("Expected a string, got %s", typ)
+	}
+	if _, exists := store.ZScore("book", "ask"); exists {
+		t.Errorf("Expected the sorted set to be gone")
+	}
+
+	store.ZAdd("quotes", 1, "bid")
+	store.Set("quotes", "stale", 0)
+	if typ := store.Type("quotes"); typ != "string" {
+		t.Errorf("Expected a string, got %s", typ)
+	}
+
+	store.Del("book", "quotes")
+	if store.UsedMemory() != 0 || store.Stats().KeysByType["zset"] != 0 {
+		t.Errorf("Expected accounting to return to zero, got %d bytes", store.UsedMemory())
+	}
+}
+
+func TestIncrBy(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	if n, err := store.IncrBy("n", 5); err != nil || n != 5 {
+		t.Fatalf("Expected a missing key to count from 0, got %d, %v", n, err)
+	}
+	if n, _ := store.IncrBy("n", -7); n != -2 {
+		t.Errorf("Expected -2, got %d", n)
+	}
+
+	for _, value := range []string{"abc", "01", "+1", " 1", "1.5", "9223372036854775808"} {
+		store.Set("s", value, 0)
+		if _, err := store.IncrBy("s", 1); !errors.Is(err, ErrNotInteger) {
+			t.Errorf("Expected %q not to be an integer, got %v", value, err)
+		}
+	}
+
+	store.Set("max", "9223372036854775807", 0)
+	if _, err := store.IncrBy("max", 1); !errors.Is(err, ErrIncrOverflow) {
+		t.Errorf("Expected overflow, got %v", err)
+	}
+	store.Set("min", "-9223372036854775808", 0)
+	if _, err := store.IncrBy("min", -1); !errors.Is(err, ErrIncrOverflow) {
+		t.Errorf("Expected overflow, got %v", err)
+	}
+
+	store.Set("f", "10.5", 0)
+	if v, err := store.IncrByFloat("f", 0.1); err != nil || v != 10.6 {
+		t.Errorf("Expected 10.6, got %v, %v", v, err)
+	}
+	if _, err := store.IncrByFloat("f", math.MaxFloat64); err != nil {
+		t.Errorf("Expected a finite sum, got %v", err)
+	}
+	if _, err := store.IncrByFloat("f", math.MaxFloat64); !errors.Is(err, ErrIncrOverflow) {
+		t.Errorf("Expected an infinite sum to fail, got %v", err)
+	}
+
+	// Sums are formatted as Redis does, not with the float64 rounding error
+	for _, c := range []struct {
+		start      string
+		increments []float64
+		want       string
+	}{
+		{"0", []float64{0.1, 0.2}, "0.3"},
+		{"10.50", []float64{0.1}, "10.6"},
+		{"5.0e3", []float64{2.0e2}, "5200"},
+		{"0.1", []float64{-0.1}, "0"},
+		{"1", []float64{-1.25}, "-0.25"},
+	} {
+		store.Set("sum", c.start, 0)
+		for _, inc := range c.increments {
+			store.IncrByFloat("sum", inc)
+		}
+		if v, _ := store.Get("sum"); v != c.want {
+			t.Errorf("Expected %s plus %v to be %q, got %q", c.start, c.increments, c.want, v)
+		}
+	}
+
+	store.Set("f", "nan", 0)
+	if _, err := store.IncrByFloat("f", 1); !errors.Is(err, ErrNotFloat) {
+		t.Errorf("Expected nan not to be a float, got %v", err)
+	}
+}
+
+func TestStringRanges(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	if n, _ := store.Append("s", "This is"); n != 7 {
+		t.Errorf("Expected APPEND to create the key, got length %d", n)
+	}
+	store.Append("s", " a string")
+	tests := []struct {
+		start, end int64
+		want       string
+	}{
+		{0, 3, "This"},
+		{-3, -1, "ing"},
+		{0, -1, "This is a string"},
+		{10, 100, "string"},
+		{5, 3, ""},
+		{-1, -5, ""},
+	}
+	for _, tt := range tests {
+		if got, _ := store.GetRange("s", tt.start, tt.end); got != tt.want {
+			t.Errorf("Expected GETRANGE %d %d to be %q, got %q", tt.start, tt.end, tt.want, got)
+		}
+	}
+
+	store.Set("k", "Hello World", 0)
+	if n, _ := store.SetRange("k", 6, "Redis"); n != 11 {
+		t.Errorf("Expected length 11, got %d", n)
+	}
+	store.SetRange("pad", 3, "x")
+	if value, _ := store.Get("pad"); value != "\x00\x00\x00x" {
+		t.Errorf("Expected zero padding, got %q", value)
+	}
+	if n, _ := store.StrLen("pad"); n != 4 {
+		t.Errorf("Expected STRLEN 4, got %d", n)
+	}
+	if _, err := store.SetRange("k", maxStringLength, "x"); !errors.Is(err, ErrStringTooLong) {
+		t.Errorf("Expected SETRANGE past 512MB to fail, got %v", err)
+	}
+	if n, _ := store.SetRange("missing", 5, ""); n != 0 || store.Exists("missing") {
+		t.Errorf("Expected an empty SETRANGE not to create the key")
+	}
+}
+
+func TestMSetAndGetEx(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	store.MSet("a", "1", "b", "2")
+	store.HSet("h", "f", "v")
+	values := store.MGet("a", "b", "h", "missing")
+	if values[0] == nil || *values[0] != "1" || values[1] == nil || *values[1] != "2" || values[2] != nil || values[3] != nil {
+		t.Errorf("Expected MGET to skip missing keys and other types, got %v", values)
+	}
+	if ok, _ := store.MSetNX("c", "3", "a", "x"); ok {
+		t.Errorf("Expected MSETNX to fail if any key exists")
+	}
+	if store.Exists("c") {
+		t.Errorf("Expected MSETNX to set no key")
+	}
+
+	old, _ := store.GetSet("a", "10")
+	if old == nil || *old != "1" {
+		t.Errorf("Expected GETSET to return the old value, got %v", old)
+	}
+	if value, _ := store.GetDel("a"); value == nil || *value != "10" || store.Exists("a") {
+		t.Errorf("Expected GETDEL to return and delete the value")
+	}
+
+	store.GetEx("b", GetExOptions{ExpiresAt: time.Now().Add(time.Hour)})
+	if ttl, _ := store.TTL("b"); ttl <= 0 {
+		t.Errorf("Expected GETEX to set a TTL, got %v", ttl)
+	}
+	store.GetEx("b", GetExOptions{Persist: true})
+	if ttl, _ := store.TTL("b"); ttl != -1 {
+		t.Errorf("Expected GETEX PERSIST to clear the TTL, got %v", ttl)
+	}
+	if value, _ := store.GetEx("b", GetExOptions{ExpiresAt: time.Now().Add(-time.Second)}); value == nil || store.Exists("b") {
+		t.Errorf("Expected GETEX with a past time to return and delete the value")
+	}
+}
+
+func TestStringsPersist(t *testing.T) {
+	cfg := aofConfig(t.TempDir())
+	store := NewStore(cfg)
+	store.IncrBy("n", 40)
+	if err := store.SaveSnapshot(); err != nil {
+		t.Fatalf("Expected no error when saving snapshot: %v", err)
+	}
+	store.IncrBy("n", 2)
+	store.IncrByFloat("f", 0.25)
+	store.Append("s", "Hello")
+	store.SetRange("s", 5, " World")
+	store.MSet("a", "1", "b", "2")
+	store.GetDel("a")
+	store.SetString("t", "v", SetOptions{ExpiresAt: time.Now().Add(time.Hour)})
+	store.GetEx("b", GetExOptions{ExpiresAt: time.Now().Add(time.Hour)})
+	store.Close()
+
+	restored := NewStore(cfg)
+	defer restored.Close()
+
+	for key, want := range map[string]string{"n": "42", "f": "0.25", "s": "Hello World", "b": "2", "t": "v"} {
+		if value, _ := restored.Get(key); value != want {
+			t.Errorf("Expected %s to be %q after replay, got %v", key, want, value)
+		}
+	}
+	if restored.Exists("a") {
+		t.Errorf("Expected GETDEL to be replayed")
+	}
+	for _, key := range []string{"b", "t"} {
+		if ttl, _ := restored.TTL(key); ttl <= 0 {
+			t.Errorf("Expected %s to keep its TTL after replay, got %v", key, ttl)
+		}
+	}
+}
@@ -0,0 +1,514 @@
+package store
+
+import (
+	"cmp"
+	"errors"
+	"math"
+	"slices"
+	"time"
+)
+
+// defaultTDigestCompression is the compression of digests created without
+// one, as in RedisBloom.
+const defaultTDigestCompression = 100
+
+var (
+	ErrInvalidTDigest = errors.New("compression must be between 1 and 10000")
+	ErrInvalidValue   = errors.New("value must be a finite number")
+	ErrInvalidRank    = errors.New("quantiles must be between 0 and 1")
+)
+
+// centroid is a cluster of values of a t-digest: their mean and how many
+// they are.
+type centroid struct {
+	mean   float64
+	weight float64
+}
+
+// TDigest is the value of a t-digest key: a sketch of the distribution of
+// the values added to it, as centroids sorted by mean. Centroids are small
+// near the tails and large around the median, bounded by the k1 scale
+// function, so extreme quantiles such as p99 stay accurate while the digest
+// holds at most about compression centroids. Like lists it is modified in
+// place under the lock of the shard holding it.
+type TDigest struct {
+	compression float64
+	centroids   []centroid
+	count       float64 // total weight
+	min         float64
+	max         float64
+}
+
+func newTDigest(compression float64) *TDigest {
+	return &TDigest{compression: compression, min: math.Inf(1), max: math.Inf(-1)}
+}
+
+// scale is the k1 scale function, mapping a quantile to the index of the
+// centroid that covers it.
+func (td *TDigest) scale(q float64) float64 {
+	return td.compression / (2 * math.Pi) * math.Asin(2*q-1)
+}
+
+// limit returns the largest quantile a centroid starting at quantile q may
+// reach, one unit of scale further.
+func (td *TDigest) limit(q float64) float64 {
+	arg := (td.scale(q) + 1) * 2 * math.Pi / td.compression
+	if arg >= math.Pi/2 {
+		return 1
+	}
+	return (math.Sin(arg) + 1) / 2
+}
+
+// merge folds centroids into the digest, merging neighbours as long as
+// their combined weight fits under the scale function. The result depends
+// only on the digest and centroids, so replaying adds rebuilds the same
+// digest.
+func (td *TDigest) merge(centroids []centroid) {
+	all := append(slices.Clone(td.centroids), centroids...)
+	if len(all) == 0 {
+		return
+	}
+	slices.SortStableFunc(all, func(a, b centroid) int { return cmp.Compare(a.mean, b.mean) })
+
+	var total float64
+	for _, c := range all {
+		total += c.weight
+	}
+
+	merged := []centroid{all[0]}
+	var before float64 // weight of the centroids before the last one
+	limit := td.limit(0) * total
+	for _, c := range all[1:] {
+		last := &merged[len(merged)-1]
+		if before+last.weight+c.weight <= limit {
+			last.weight += c.weight
+			last.mean += (c.mean - last.mean) * c.weight / last.weight
+			continue
+		}
+		before += last.weight
+		limit = td.limit(before/total) * total
+		merged = append(merged, c)
+	}
+	td.centroids = merged
+	td.count = total
+}
+
+func (td *TDigest) add(values []float64) {
+	centroids := make([]centroid, len(values))
+	for i, v := range values {
+		centroids[i] = centroid{mean: v, weight: 1}
+		td.min = min(td.min, v)
+		td.max = max(td.max, v)
+	}
+	td.merge(centroids)
+}
+
+// quantile returns the value below which a fraction q of the values lie,
+// interpolating between the means of neighbouring centroids, or NaN if the
+// digest is empty.
+func (td *TDigest) quantile(q float64) float64 {
+	n := len(td.centroids)
+	switch {
+	case n == 0:
+		return math.NaN()
+	case q <= 0:
+		return td.min
+	case q >= 1:
+		return td.max
+	case n == 1:
+		return td.centroids[0].mean
+	}
+
+	index := q * td.count
+	first, last := td.centroids[0], td.centroids[n-1]
+	if index < first.weight/2 {
+		return td.min + (first.mean-td.min)*index/(first.weight/2)
+	}
+	if index > td.count-last.weight/2 {
+		return last.mean + (td.max-last.mean)*(index-(td.count-last.weight/2))/(last.weight/2)
+	}
+
+	before := first.weight / 2
+	for i := 0; i < n-1; i++ {
+		c, next := td.centroids[i], td.centroids[i+1]
+		span := (c.weight + next.weight) / 2
+		if before+span >= index {
+			return c.mean + (next.mean-c.mean)*(index-before)/span
+		}
+		before += span
+	}
+	return last.mean
+}
+
+// cdf returns the fraction of the values at or below x, counting values
+// equal to x by half, or NaN if the digest is empty.
+func (td *TDigest) cdf(x float64) float64 {
+	n := len(td.centroids)
+	switch {
+	case n == 0:
+		return math.NaN()
+	case x < td.min:
+		return 0
+	case x > td.max:
+		return 1
+	case td.min == td.max:
+		return 0.5
+	}
+
+	first, last := td.centroids[0], td.centroids[n-1]
+	if x < first.mean {
+		return (x - td.min) / (first.mean - td.min) * first.weight / 2 / td.count
+	}
+	if x > last.mean {
+		return (td.count - last.weight/2 + (x-last.mean)/(td.max-last.mean)*last.weight/2) / td.count
+	}
+
+	var before float64
+	for i, c := range td.centroids {
+		if x == c.mean {
+			// Centroids sharing the mean share the rank
+			equal := c.weight
+			for _, other := range td.centroids[i+1:] {
+				if other.mean != x {
+					break
+				}
+				equal += other.weight
+			}
+			return (before + equal/2) / td.count
+		}
+		next := td.centroids[i+1]
+		if x < next.mean {
+			span := (c.weight + next.weight) / 2
+			return (before + c.weight/2 + (x-c.mean)/(next.mean-c.mean)*span) / td.count
+		}
+		before += c.weight
+	}
+	return 1
+}
+
+// trimmedMean returns the mean of the values between the quantiles low and
+// high, taking the part of each centroid inside them, or NaN if there is
+// none.
+func (td *TDigest) trimmedMean(low, high float64) float64 {
+	from, to := low*td.count, high*td.count
+	var before, sum, weight float64
+	for _, c := range td.centroids {
+		inside := min(before+c.weight, to) - max(before, from)
+		if inside > 0 {
+			sum += c.mean * inside
+			weight += inside
+		}
+		before += c.weight
+	}
+	if weight == 0 {
+		return math.NaN()
+	}
+	return sum / weight
+}
+
+func (td *TDigest) size() int64 {
+	return tdigestOverhead + int64(len(td.centroids))*16
+}
+
+func (td *TDigest) clone() *TDigest {
+	c := *td
+	c.centroids = slices.Clone(td.centroids)
+	return &c
+}
+
+// Memory estimate of the TDigest struct and its centroid slice.
+const tdigestOverhead = 64
+
+// TDigestInfo describes a t-digest.
+type TDigestInfo struct {
+	Compression float64
+	Centroids   int
+	Count       float64 // number of values added
+	Min         float64 // NaN if the digest is empty
+	Max         float64
+}
+
+// readTDigest returns the t-digest at key for a read, or nil if there is
+// none. The caller must hold sh.mu.
+func (s *Store) readTDigest(sh *shard, key string) (*TDigest, error) {
+	item, exists := sh.data[key]
+	if exists && item.ExpiresAt != nil && time.Now().After(*item.ExpiresAt) {
+		exists = false
+	}
+	if !exists {
+		if _, isZSet := sh.sortedSets[key]; isZSet {
+			return nil, ErrWrongType
+		}
+		s.stats.recordLookup(false)
+		return nil, nil
+	}
+
+	td, ok := item.Value.(*TDigest)
+	if !ok {
+		return nil, ErrWrongType
+	}
+	s.stats.recordLookup(true)
+	s.touch(item)
+	return td, nil
+}
+
+// writeTDigest returns the item holding the t-digest at key for a write,
+// deleting it first if it has expired. It returns a nil item if there is no
+// digest. The caller must hold sh.mu.
+func (s *Store) writeTDigest(sh *shard, key string) (*Item, *TDigest, error) {
+	if _, isZSet := sh.sortedSets[key]; isZSet {
+		return nil, nil, ErrWrongType
+	}
+	item, exists := sh.data[key]
+	if !exists {
+		return nil, nil, nil
+	}
+	if item.ExpiresAt != nil && time.Now().After(*item.ExpiresAt) {
+		s.deleteExpired(sh, key)
+		return nil, nil, nil
+	}
+
+	td, ok := item.Value.(*TDigest)
+	if !ok {
+		return nil, nil, ErrWrongType
+	}
+	s.touch(item)
+	return item, td, nil
+}
+
+// validCompression applies the default to a zero compression.
+func validCompression(compression float64) (float64, error) {
+	if compression == 0 {
+		return defaultTDigestCompression, nil
+	}
+	if !(compression >= 1 && compression <= 10000) {
+		return 0, ErrInvalidTDigest
+	}
+	return compression, nil
+}
+
+// TDigestCreate creates an empty t-digest at key; a compression of 0 uses
+// the default. It fails with ErrSketchExists if the key holds a value of
+// any type.
+func (s *Store) TDigestCreate(key string, compression float64) error {
+	compression, err := validCompression(compression)
+	if err != nil {
+		return err
+	}
+
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if item, _, err := s.writeTDigest(sh, key); err != nil || item != nil {
+		return ErrSketchExists
+	}
+	return s.tdigestCreate(sh, key, compression)
+}
+
+// tdigestCreate stores a new digest with compression at key. The caller
+// must hold sh.mu.
+func (s *Store) tdigestCreate(sh *shard, key string, compression float64) error {
+	td := newTDigest(compression)
+	if err := s.reserveMemory(sh, key, itemSize(key, td)); err != nil {
+		return err
+	}
+	s.set(sh, key, td, nil)
+
+	s.propagate("TDIGEST.CREATE", key, formatFloat(compression))
+	s.notify(notifyModule, "tdigest.create", key)
+	return nil
+}
+
+// TDigestAdd adds values to the t-digest at key. It fails with
+// ErrNoSuchKey if there is no digest.
+func (s *Store) TDigestAdd(key string, values ...float64) error {
+	for _, v := range values {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return ErrInvalidValue
+		}
+	}
+
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	return s.tdigestAdd(sh, key, values)
+}
+
+// tdigestAdd implements TDigestAdd. The caller must hold sh.mu.
+func (s *Store) tdigestAdd(sh *shard, key string, values []float64) error {
+	item, td, err := s.writeTDigest(sh, key)
+	if err != nil {
+		return err
+	}
+	if item == nil {
+		return ErrNoSuchKey
+	}
+	if len(values) == 0 {
+		return nil
+	}
+
+	if err := s.reserveMemory(sh, key, int64(len(values))*16); err != nil {
+		return err
+	}
+	before := td.size()
+	td.add(values)
+	s.resize(item, td.size()-before)
+	item.UpdatedAt = time.Now()
+
+	args := []string{"TDIGEST.ADD", key}
+	for _, v := range values {
+		args = append(args, formatFloat(v))
+	}
+	s.propagate(args...)
+	s.notify(notifyModule, "tdigest.add", key)
+	return nil
+}
+
+// withTDigest calls fn with the t-digest at key under a read lock. It fails
+// with ErrNoSuchKey if there is no digest.
+func (s *Store) withTDigest(key string, fn func(td *TDigest)) error {
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	td, err := s.readTDigest(sh, key)
+	if err != nil {
+		return err
+	}
+	if td == nil {
+		return ErrNoSuchKey
+	}
+	fn(td)
+	return nil
+}
+
+// TDigestQuantile returns the estimated value at each of quantiles in the
+// t-digest at key, e.g. 0.99 for p99; NaN if the digest is empty.
+func (s *Store) TDigestQuantile(key string, quantiles ...float64) ([]float64, error) {
+	for _, q := range quantiles {
+		if !(q >= 0 && q <= 1) {
+			return nil, ErrInvalidRank
+		}
+	}
+
+	values := make([]float64, len(quantiles))
+	err := s.withTDigest(key, func(td *TDigest) {
+		for i, q := range quantiles {
+			values[i] = td.quantile(q)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// TDigestCDF returns the estimated fraction of the values at or below each
+// of values in the t-digest at key; NaN if the digest is empty.
+func (s *Store) TDigestCDF(key string, values ...float64) ([]float64, error) {
+	fractions := make([]float64, len(values))
+	err := s.withTDigest(key, func(td *TDigest) {
+		for i, v := range values {
+			fractions[i] = td.cdf(v)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fractions, nil
+}
+
+// TDigestTrimmedMean returns the estimated mean of the values between the
+// quantiles low and high in the t-digest at key, leaving outliers out; NaN
+// if the digest is empty.
+func (s *Store) TDigestTrimmedMean(key string, low, high float64) (float64, error) {
+	if !(low >= 0 && low < high && high <= 1) {
+		return 0, ErrInvalidRank
+	}
+
+	var mean float64
+	err := s.withTDigest(key, func(td *TDigest) {
+		mean = td.trimmedMean(low, high)
+	})
+	return mean, err
+}
+
+// TDigestInfo describes the t-digest at key; its Min and Max are the
+// smallest and largest values added.
+func (s *Store) TDigestInfo(key string) (TDigestInfo, error) {
+	var info TDigestInfo
+	err := s.withTDigest(key, func(td *TDigest) {
+		info = TDigestInfo{Compression: td.compression, Centroids: len(td.centroids), Count: td.count, Min: td.min, Max: td.max}
+		if td.count == 0 {
+			info.Min, info.Max = math.NaN(), math.NaN()
+		}
+	})
+	return info, err
+}
+
+// TDigestMergeOptions configures TDigestMerge.
+type TDigestMergeOptions struct {
+	// Compression of the result; 0 keeps that of dest, or takes the
+	// largest of the sources if dest is new or overridden.
+	Compression float64
+	// Override replaces dest rather than merging it with the sources.
+	Override bool
+}
+
+// TDigestMerge merges the t-digests at sources into dest, e.g. to get the
+// percentiles of a day from the digests of its hours, creating dest if it
+// does not exist. All sources must exist.
+func (s *Store) TDigestMerge(dest string, sources []string, opts TDigestMergeOptions) error {
+	if len(sources) == 0 {
+		return errors.New("at least one source is required")
+	}
+	if opts.Compression != 0 {
+		if _, err := validCompression(opts.Compression); err != nil {
+			return err
+		}
+	}
+
+	unlock := s.lockKeys(append([]string{dest}, sources...)...)
+	defer unlock()
+
+	sh := s.shardFor(dest)
+	item, target, err := s.writeTDigest(sh, dest)
+	if err != nil {
+		return err
+	}
+
+	digests := make([]*TDigest, 0, len(sources)+1)
+	compression := opts.Compression
+	for _, key := range sources {
+		_, td, err := s.writeTDigest(s.shardFor(key), key)
+		if err != nil {
+			return err
+		}
+		if td == nil {
+			return ErrNoSuchKey
+		}
+		digests = append(digests, td)
+		if opts.Compression == 0 {
+			compression = max(compression, td.compression)
+		}
+	}
+	if target != nil && !opts.Override {
+		digests = append(digests, target)
+		if opts.Compression == 0 {
+			compression = target.compression
+		}
+	}
+
+	merged := newTDigest(compression)
+	var centroids []centroid
+	for _, td := range digests {
+		centroids = append(centroids, td.centroids...)
+		merged.min = min(merged.min, td.min)
+		merged.max = max(merged.max, td.max)
+	}
+	merged.merge(centroids)
+
+	return s.storeMerged(sh, dest, item, merged, "tdigest.merge")
+}
@@ -0,0 +1,149 @@
+package store
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/chaitanyayendru/fincache/internal/config"
+)
+
+// shuffled returns 1 to n in a fixed scrambled order.
+func shuffled(n int) []float64 {
+	values := make([]float64, n)
+	for i := range values {
+		values[i] = float64((i*7919)%n + 1)
+	}
+	return values
+}
+
+func TestTDigest(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	if err := store.TDigestCreate("amounts", 0); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := store.TDigestCreate("amounts", 0); !errors.Is(err, ErrSketchExists) {
+		t.Errorf("Expected ErrSketchExists, got %v", err)
+	}
+	if q, _ := store.TDigestQuantile("amounts", 0.5); !math.IsNaN(q[0]) {
+		t.Errorf("Expected NaN for an empty digest, got %v", q)
+	}
+
+	values := shuffled(10000)
+	for i := 0; i < len(values); i += 100 {
+		if err := store.TDigestAdd("amounts", values[i:i+100]...); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	quantiles, _ := store.TDigestQuantile("amounts", 0, 0.5, 0.99, 0.999, 1)
+	for i, want := range []float64{1, 5000, 9900, 9990, 10000} {
+		if math.Abs(quantiles[i]-want) > want*0.005 {
+			t.Errorf("Expected quantile %d near %v, got %v", i, want, quantiles[i])
+		}
+	}
+	cdf, _ := store.TDigestCDF("amounts", 0, 2500, 9950, 20000)
+	for i, want := range []float64{0, 0.25, 0.995, 1} {
+		if math.Abs(cdf[i]-want) > 0.005 {
+			t.Errorf("Expected cdf %d near %v, got %v", i, want, cdf[i])
+		}
+	}
+	if mean, _ := store.TDigestTrimmedMean("amounts", 0.1, 0.9); math.Abs(mean-5000.5) > 25 {
+		t.Errorf("Expected a trimmed mean near 5000.5, got %v", mean)
+	}
+
+	info, _ := store.TDigestInfo("amounts")
+	if info.Count != 10000 || info.Min != 1 || info.Max != 10000 || info.Centroids > 2*defaultTDigestCompression {
+		t.Errorf("Expected 10000 values in few centroids, got %+v", info)
+	}
+
+	if err := store.TDigestAdd("amounts", math.NaN()); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("Expected ErrInvalidValue, got %v", err)
+	}
+	if _, err := store.TDigestQuantile("amounts", 1.5); !errors.Is(err, ErrInvalidRank) {
+		t.Errorf("Expected ErrInvalidRank, got %v", err)
+	}
+	if err := store.TDigestAdd("missing", 1); !errors.Is(err, ErrNoSuchKey) {
+		t.Errorf("Expected ErrNoSuchKey, got %v", err)
+	}
+}
+
+func TestTDigestSmall(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	// Few values stay exact
+	store.TDigestCreate("latency", 100)
+	store.TDigestAdd("latency", 10, 20, 30, 40, 50)
+	if quantiles, _ := store.TDigestQuantile("latency", 0.5, 0.1); !slices.Equal(quantiles, []float64{30, 10}) {
+		t.Errorf("Expected the exact median, got %v", quantiles)
+	}
+	if cdf, _ := store.TDigestCDF("latency", 30, 35); !slices.Equal(cdf, []float64{0.5, 0.6}) {
+		t.Errorf("Expected exact ranks, got %v", cdf)
+	}
+	if mean, _ := store.TDigestTrimmedMean("latency", 0.2, 0.8); mean != 30 {
+		t.Errorf("Expected the mean of 20, 30 and 40, got %v", mean)
+	}
+}
+
+func TestTDigestMerge(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	store.TDigestCreate("lat:1", 50)
+	store.TDigestCreate("lat:2", 200)
+	values := shuffled(2000)
+	store.TDigestAdd("lat:1", values[:1000]...)
+	store.TDigestAdd("lat:2", values[1000:]...)
+
+	if err := store.TDigestMerge("lat:day", []string{"lat:1", "lat:2"}, TDigestMergeOptions{}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	info, _ := store.TDigestInfo("lat:day")
+	if info.Count != 2000 || info.Compression != 200 || info.Min != 1 || info.Max != 2000 {
+		t.Errorf("Expected both digests with the larger compression, got %+v", info)
+	}
+	if q, _ := store.TDigestQuantile("lat:day", 0.5); math.Abs(q[0]-1000) > 20 {
+		t.Errorf("Expected a median near 1000, got %v", q)
+	}
+
+	// Without OVERRIDE the destination is merged too
+	store.TDigestMerge("lat:day", []string{"lat:1"}, TDigestMergeOptions{})
+	if info, _ := store.TDigestInfo("lat:day"); info.Count != 3000 {
+		t.Errorf("Expected 3000 values, got %v", info.Count)
+	}
+	store.TDigestMerge("lat:day", []string{"lat:1"}, TDigestMergeOptions{Override: true, Compression: 100})
+	if info, _ := store.TDigestInfo("lat:day"); info.Count != 1000 || info.Compression != 100 {
+		t.Errorf("Expected OVERRIDE to replace the destination, got %+v", info)
+	}
+
+	if err := store.TDigestMerge("lat:day", []string{"missing"}, TDigestMergeOptions{}); !errors.Is(err, ErrNoSuchKey) {
+		t.Errorf("Expected ErrNoSuchKey, got %v", err)
+	}
+}
+
+func TestTDigestPersists(t *testing.T) {
+	cfg := aofConfig(t.TempDir())
+	store := NewStore(cfg)
+	store.TDigestCreate("amounts", 50)
+	store.TDigestAdd("amounts", shuffled(500)...)
+	if err := store.SaveSnapshot(); err != nil {
+		t.Fatalf("Expected no error when saving snapshot: %v", err)
+	}
+	store.TDigestAdd("amounts", 0.1, 1e9, 42.5)
+	store.TDigestMerge("amounts:copy", []string{"amounts"}, TDigestMergeOptions{})
+	want, _ := store.TDigestQuantile("amounts", 0, 0.25, 0.5, 0.99, 1)
+	store.Close()
+
+	restored := NewStore(cfg)
+	defer restored.Close()
+
+	for _, key := range []string{"amounts", "amounts:copy"} {
+		if got, err := restored.TDigestQuantile(key, 0, 0.25, 0.5, 0.99, 1); err != nil || !slices.Equal(got, want) {
+			t.Errorf("Expected %v for %s after replay, got %v, %v", want, key, got, err)
+		}
+	}
+}
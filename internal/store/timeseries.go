@@ -0,0 +1,890 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrTSKeyExists        = errors.New("TSDB: key already exists")
+	ErrTSDuplicate        = errors.New("TSDB: duplicate sample blocked by the duplicate policy")
+	ErrTSTooOld           = errors.New("TSDB: timestamp is older than the retention window")
+	ErrTSInvalidTimestamp = errors.New("TSDB: invalid timestamp")
+	ErrTSInvalidValue     = errors.New("TSDB: invalid value")
+	ErrTSInvalidBucket    = errors.New("TSDB: bucket duration must be at least a millisecond")
+	ErrTSRuleExists       = errors.New("TSDB: the destination key already has a source rule")
+	ErrTSRuleNotFound     = errors.New("TSDB: compaction rule does not exist")
+	ErrTSInvalidRule      = errors.New("TSDB: compaction rules cannot be chained or point to their source")
+	ErrTSInvalidFilter    = errors.New("TSDB: filters need at least one label=value matcher")
+)
+
+// DuplicatePolicy decides what adding a sample at a timestamp that already
+// has one does.
+type DuplicatePolicy int
+
+const (
+	// DuplicateDefault is the zero value: the policy of the series when
+	// adding, DuplicateBlock when creating.
+	DuplicateDefault DuplicatePolicy = iota
+	DuplicateBlock                   // fail with ErrTSDuplicate
+	DuplicateFirst                   // keep the old value
+	DuplicateLast                    // keep the new value
+	DuplicateMin                     // keep the lower value
+	DuplicateMax                     // keep the higher value
+	DuplicateSum                     // add the new value to the old one
+)
+
+var duplicatePolicyNames = []string{"", "BLOCK", "FIRST", "LAST", "MIN", "MAX", "SUM"}
+
+func (p DuplicatePolicy) String() string {
+	if p <= DuplicateDefault || int(p) >= len(duplicatePolicyNames) {
+		return "BLOCK"
+	}
+	return duplicatePolicyNames[p]
+}
+
+// ParseDuplicatePolicy parses a policy name such as "BLOCK" or "LAST".
+func ParseDuplicatePolicy(s string) (DuplicatePolicy, bool) {
+	i := slices.Index(duplicatePolicyNames, strings.ToUpper(s))
+	if i <= 0 {
+		return DuplicateDefault, false
+	}
+	return DuplicatePolicy(i), true
+}
+
+// resolve returns the value to keep when a sample of value next is added over
+// one of value old.
+func (p DuplicatePolicy) resolve(old, next float64) (float64, error) {
+	switch p {
+	case DuplicateFirst:
+		return old, nil
+	case DuplicateLast:
+		return next, nil
+	case DuplicateMin:
+		return math.Min(old, next), nil
+	case DuplicateMax:
+		return math.Max(old, next), nil
+	case DuplicateSum:
+		return old + next, nil
+	default:
+		return 0, ErrTSDuplicate
+	}
+}
+
+// Aggregation reduces the samples of a bucket to one value.
+type Aggregation int
+
+const (
+	AggregationAvg Aggregation = iota
+	AggregationMin
+	AggregationMax
+	AggregationFirst
+	AggregationLast
+	AggregationSum
+	AggregationCount
+)
+
+var aggregationNames = []string{"avg", "min", "max", "first", "last", "sum", "count"}
+
+func (a Aggregation) String() string {
+	if a < 0 || int(a) >= len(aggregationNames) {
+		return "avg"
+	}
+	return aggregationNames[a]
+}
+
+// ParseAggregation parses an aggregation name such as "avg" or "max".
+func ParseAggregation(s string) (Aggregation, bool) {
+	i := slices.Index(aggregationNames, strings.ToLower(s))
+	if i < 0 {
+		return AggregationAvg, false
+	}
+	return Aggregation(i), true
+}
+
+// apply reduces samples, which must not be empty.
+func (a Aggregation) apply(samples []Sample) float64 {
+	switch a {
+	case AggregationFirst:
+		return samples[0].Value
+	case AggregationLast:
+		return samples[len(samples)-1].Value
+	case AggregationCount:
+		return float64(len(samples))
+	}
+
+	result := samples[0].Value
+	for _, sample := range samples[1:] {
+		switch a {
+		case AggregationMin:
+			result = math.Min(result, sample.Value)
+		case AggregationMax:
+			result = math.Max(result, sample.Value)
+		default:
+			result += sample.Value
+		}
+	}
+	if a == AggregationAvg {
+		result /= float64(len(samples))
+	}
+	return result
+}
+
+// Sample is a value of a time series at a timestamp in Unix milliseconds.
+type Sample struct {
+	Timestamp int64
+	Value     float64
+}
+
+// CompactionRule downsamples every sample added to a series into another
+// series, one sample per bucket aggregating the source samples in it.
+type CompactionRule struct {
+	Dest        string
+	Aggregation Aggregation
+	Bucket      time.Duration
+}
+
+// TimeSeries is the value of a time series key: samples ordered by
+// timestamp, at most one per millisecond. Like lists it is modified in place
+// under the lock of the shard holding it.
+type TimeSeries struct {
+	samples   []Sample
+	retention int64 // in milliseconds, 0 keeps every sample
+	policy    DuplicatePolicy
+	labels    map[string]string
+	source    string // the series compacted into this one, if any
+	rules     []CompactionRule
+}
+
+// TSOptions configures a new time series.
+type TSOptions struct {
+	// Retention is how far samples are kept behind the newest one; 0 keeps
+	// them all. Samples older than that are rejected with ErrTSTooOld.
+	Retention       time.Duration
+	DuplicatePolicy DuplicatePolicy
+	Labels          map[string]string
+}
+
+// TSAddOptions holds the optional arguments of TSAdd.
+type TSAddOptions struct {
+	TSOptions // used if the add creates the series
+	// OnDuplicate overrides the duplicate policy of the series for this add.
+	OnDuplicate DuplicatePolicy
+}
+
+func newTimeSeries(opts TSOptions) *TimeSeries {
+	ts := &TimeSeries{
+		retention: opts.Retention.Milliseconds(),
+		policy:    opts.DuplicatePolicy,
+		labels:    make(map[string]string, len(opts.Labels)),
+	}
+	if ts.policy == DuplicateDefault {
+		ts.policy = DuplicateBlock
+	}
+	for label, value := range opts.Labels {
+		ts.labels[label] = value
+	}
+	return ts
+}
+
+// search returns the index of the sample at timestamp t, or where it would
+// be inserted, and whether there is one.
+func (ts *TimeSeries) search(t int64) (int, bool) {
+	i := sort.Search(len(ts.samples), func(i int) bool { return ts.samples[i].Timestamp >= t })
+	return i, i < len(ts.samples) && ts.samples[i].Timestamp == t
+}
+
+// tooOld reports whether timestamp t is behind the retention window.
+func (ts *TimeSeries) tooOld(t int64) bool {
+	return ts.retention > 0 && len(ts.samples) > 0 && t < ts.samples[len(ts.samples)-1].Timestamp-ts.retention
+}
+
+// put stores sample at index i as returned by search, drops the samples that
+// left the retention window and returns how much the estimated size grew.
+func (ts *TimeSeries) put(i int, found bool, sample Sample) int64 {
+	if found {
+		ts.samples[i] = sample
+		return 0
+	}
+	ts.samples = slices.Insert(ts.samples, i, sample)
+
+	delta := int64(tsSampleSize)
+	if ts.retention > 0 {
+		start := ts.samples[len(ts.samples)-1].Timestamp - ts.retention
+		n, _ := ts.search(start)
+		ts.samples = ts.samples[n:]
+		delta -= int64(n) * tsSampleSize
+	}
+	return delta
+}
+
+// between returns the samples from from to to inclusive. The slice aliases
+// the series.
+func (ts *TimeSeries) between(from, to int64) []Sample {
+	i, _ := ts.search(from)
+	j := i
+	for j < len(ts.samples) && ts.samples[j].Timestamp <= to {
+		j++
+	}
+	return ts.samples[i:j]
+}
+
+// hasRule reports whether the series has a rule compacting into dest.
+func (ts *TimeSeries) hasRule(dest string) bool {
+	return slices.ContainsFunc(ts.rules, func(r CompactionRule) bool { return r.Dest == dest })
+}
+
+func (ts *TimeSeries) size() int64 {
+	size := int64(timeSeriesOverhead) + int64(len(ts.samples))*tsSampleSize + int64(len(ts.source))
+	for label, value := range ts.labels {
+		size += tsLabelSize + int64(len(label)+len(value))
+	}
+	for _, rule := range ts.rules {
+		size += tsRuleSize + int64(len(rule.Dest))
+	}
+	return size
+}
+
+func (ts *TimeSeries) clone() *TimeSeries {
+	c := *ts
+	c.samples = slices.Clone(ts.samples)
+	c.labels = make(map[string]string, len(ts.labels))
+	for label, value := range ts.labels {
+		c.labels[label] = value
+	}
+	c.rules = slices.Clone(ts.rules)
+	return &c
+}
+
+// Memory estimates for time series.
+const (
+	timeSeriesOverhead = 128 // TimeSeries struct, its slices and label map
+	tsSampleSize       = 16  // Sample
+	tsLabelSize        = 2*stringOverhead + entryOverhead
+	tsRuleSize         = 48 // CompactionRule
+)
+
+// readSeries returns the time series at key for a read, or nil if there is
+// none. The caller must hold sh.mu.
+func (s *Store) readSeries(sh *shard, key string) (*TimeSeries, error) {
+	item, exists := sh.data[key]
+	if exists && item.ExpiresAt != nil && time.Now().After(*item.ExpiresAt) {
+		exists = false
+	}
+	if !exists {
+		if _, isZSet := sh.sortedSets[key]; isZSet {
+			return nil, ErrWrongType
+		}
+		s.stats.recordLookup(false)
+		return nil, nil
+	}
+
+	series, ok := item.Value.(*TimeSeries)
+	if !ok {
+		return nil, ErrWrongType
+	}
+	s.stats.recordLookup(true)
+	s.touch(item)
+	return series, nil
+}
+
+// writeSeries returns the item holding the time series at key for a write,
+// deleting it first if it has expired. It returns a nil item if there is no
+// series. The caller must hold sh.mu.
+func (s *Store) writeSeries(sh *shard, key string) (*Item, *TimeSeries, error) {
+	if _, isZSet := sh.sortedSets[key]; isZSet {
+		return nil, nil, ErrWrongType
+	}
+	item, exists := sh.data[key]
+	if !exists {
+		return nil, nil, nil
+	}
+	if item.ExpiresAt != nil && time.Now().After(*item.ExpiresAt) {
+		s.deleteExpired(sh, key)
+		return nil, nil, nil
+	}
+
+	series, ok := item.Value.(*TimeSeries)
+	if !ok {
+		return nil, nil, ErrWrongType
+	}
+	s.touch(item)
+	return item, series, nil
+}
+
+// TSCreate creates an empty time series at key. It fails with
+// ErrTSKeyExists if the key holds a value of any type.
+func (s *Store) TSCreate(key string, opts TSOptions) error {
+	if opts.Retention < 0 {
+		return errors.New("TSDB: retention must not be negative")
+	}
+
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if item, _, err := s.writeSeries(sh, key); err != nil || item != nil {
+		return ErrTSKeyExists
+	}
+	return s.tsCreate(sh, key, newTimeSeries(opts))
+}
+
+// tsCreate stores series, which must not have rules, at key. The caller must
+// hold sh.mu.
+func (s *Store) tsCreate(sh *shard, key string, series *TimeSeries) error {
+	if err := s.reserveMemory(sh, key, itemSize(key, series)); err != nil {
+		return err
+	}
+	s.set(sh, key, series, nil)
+
+	args := []string{"TS.CREATE", key, strconv.FormatInt(series.retention, 10), series.policy.String()}
+	labels := make([]string, 0, len(series.labels))
+	for label := range series.labels {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	for _, label := range labels {
+		args = append(args, label, series.labels[label])
+	}
+	s.propagate(args...)
+	s.notify(notifyModule, "ts.create", key)
+	return nil
+}
+
+// TSAdd adds a sample at timestamp t, in Unix milliseconds, to the series at
+// key, creating the series with opts if it does not exist, and returns t. A
+// sample already at t is resolved by the duplicate policy. Compaction rules
+// of the series recompute the bucket of t in their destination, which is
+// therefore up to date but may change until the bucket is over. Values must
+// be finite, as a NaN or infinity would poison every aggregate over them.
+func (s *Store) TSAdd(key string, t int64, value float64, opts TSAddOptions) (int64, error) {
+	if t < 0 {
+		return 0, ErrTSInvalidTimestamp
+	}
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, ErrTSInvalidValue
+	}
+	if opts.Retention < 0 {
+		return 0, errors.New("TSDB: retention must not be negative")
+	}
+	err := s.withRules(key, func() error {
+		return s.tsAdd(key, t, value, opts, true)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return t, nil
+}
+
+// TSInput is one sample of TSMAdd.
+type TSInput struct {
+	Key       string
+	Timestamp int64
+	Value     float64
+}
+
+// TSMAdd adds samples to existing series, each one like TSAdd, and returns
+// the error of each; a missing series fails with ErrNoSuchKey. The adds are
+// not atomic as a whole.
+func (s *Store) TSMAdd(samples []TSInput) []error {
+	errs := make([]error, len(samples))
+	for i, sample := range samples {
+		if sample.Timestamp < 0 {
+			errs[i] = ErrTSInvalidTimestamp
+			continue
+		}
+		if math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) {
+			errs[i] = ErrTSInvalidValue
+			continue
+		}
+		errs[i] = s.withRules(sample.Key, func() error {
+			return s.tsAdd(sample.Key, sample.Timestamp, sample.Value, TSAddOptions{}, false)
+		})
+	}
+	return errs
+}
+
+// withRules runs fn with the shards of key and of the destinations of its
+// compaction rules locked. The destinations are read first and locked along
+// with key, retrying if a rule changed in between.
+func (s *Store) withRules(key string, fn func() error) error {
+	for {
+		dests := s.ruleDests(key)
+		unlock := s.lockKeys(append([]string{key}, dests...)...)
+		if slices.Equal(dests, s.ruleDestsLocked(key)) {
+			defer unlock()
+			return fn()
+		}
+		unlock()
+	}
+}
+
+// ruleDests returns the destinations of the compaction rules of the series
+// at key, if it is one.
+func (s *Store) ruleDests(key string) []string {
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	return s.ruleDestsLocked(key)
+}
+
+// ruleDestsLocked is ruleDests for callers holding the shard lock of key.
+func (s *Store) ruleDestsLocked(key string) []string {
+	item, exists := s.shardFor(key).data[key]
+	if !exists {
+		return nil
+	}
+	series, ok := item.Value.(*TimeSeries)
+	if !ok {
+		return nil
+	}
+	dests := make([]string, len(series.rules))
+	for i, rule := range series.rules {
+		dests[i] = rule.Dest
+	}
+	return dests
+}
+
+// tsAdd implements TSAdd and TSMAdd. The caller must hold the shard locks of
+// key and of its rule destinations.
+func (s *Store) tsAdd(key string, t int64, value float64, opts TSAddOptions, create bool) error {
+	sh := s.shardFor(key)
+	item, series, err := s.writeSeries(sh, key)
+	if err != nil {
+		return err
+	}
+	if item == nil {
+		if !create {
+			return ErrNoSuchKey
+		}
+		series = newTimeSeries(opts.TSOptions)
+		series.put(0, false, Sample{t, value})
+		if err := s.tsCreate(sh, key, series); err != nil {
+			return err
+		}
+	} else {
+		if series.tooOld(t) {
+			return ErrTSTooOld
+		}
+		policy := opts.OnDuplicate
+		if policy == DuplicateDefault {
+			policy = series.policy
+		}
+		i, found := series.search(t)
+		if found {
+			if value, err = policy.resolve(series.samples[i].Value, value); err != nil {
+				return err
+			}
+		} else if err := s.reserveMemory(sh, key, tsSampleSize); err != nil {
+			return err
+		}
+		s.resize(item, series.put(i, found, Sample{t, value}))
+		item.UpdatedAt = time.Now()
+	}
+
+	// The resolved value is logged, so replaying it with DuplicateLast
+	// reproduces the sample whatever the policy
+	s.propagate("TS.ADD", key, strconv.FormatInt(t, 10), formatFloat(value))
+	s.notify(notifyModule, "ts.add", key)
+
+	for _, rule := range series.rules {
+		s.compact(series, rule, t)
+	}
+	return nil
+}
+
+// compact recomputes the bucket of rule holding timestamp t from the samples
+// of series and stores it in the destination of the rule. Compaction is best
+// effort: a destination that was deleted or now holds another type, or that
+// has no room, is skipped. It is not logged, as replaying the source sample
+// redoes it. The caller must hold the shard lock of the destination.
+func (s *Store) compact(series *TimeSeries, rule CompactionRule, t int64) {
+	bucket := rule.Bucket.Milliseconds()
+	start := t - t%bucket
+	samples := series.between(start, start+bucket-1)
+	if len(samples) == 0 {
+		return
+	}
+
+	sh := s.shardFor(rule.Dest)
+	item, dest, err := s.writeSeries(sh, rule.Dest)
+	if err != nil || item == nil || dest.tooOld(start) {
+		return
+	}
+	i, found := dest.search(start)
+	if !found && s.reserveMemory(sh, rule.Dest, tsSampleSize) != nil {
+		return
+	}
+	s.resize(item, dest.put(i, found, Sample{start, rule.Aggregation.apply(samples)}))
+	item.UpdatedAt = time.Now()
+	s.notify(notifyModule, "ts.add", rule.Dest)
+}
+
+// TSGet returns the newest sample of the series at key, and whether it has
+// one. It fails with ErrNoSuchKey if there is no series.
+func (s *Store) TSGet(key string) (Sample, bool, error) {
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	series, err := s.readSeries(sh, key)
+	if err != nil {
+		return Sample{}, false, err
+	}
+	if series == nil {
+		return Sample{}, false, ErrNoSuchKey
+	}
+	if len(series.samples) == 0 {
+		return Sample{}, false, nil
+	}
+	return series.samples[len(series.samples)-1], true, nil
+}
+
+// TSRangeOptions holds the optional arguments of TSRange and TSMRange.
+type TSRangeOptions struct {
+	// Bucket, if set, aggregates the samples into buckets of that duration
+	// aligned to the epoch, each reported at its start.
+	Bucket      time.Duration
+	Aggregation Aggregation
+	Count       int  // at most that many samples, 0 for all
+	Reverse     bool // newest first
+}
+
+func (opts TSRangeOptions) validate() error {
+	if opts.Bucket != 0 && opts.Bucket < time.Millisecond {
+		return ErrTSInvalidBucket
+	}
+	return nil
+}
+
+// TSRange returns the samples of the series at key from from to to
+// inclusive, in Unix milliseconds. It fails with ErrNoSuchKey if there is no
+// series.
+func (s *Store) TSRange(key string, from, to int64, opts TSRangeOptions) ([]Sample, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	series, err := s.readSeries(sh, key)
+	if err != nil {
+		return nil, err
+	}
+	if series == nil {
+		return nil, ErrNoSuchKey
+	}
+	return series.rangeSamples(from, to, opts), nil
+}
+
+// rangeSamples implements TSRange on a series, returning a new slice.
+func (ts *TimeSeries) rangeSamples(from, to int64, opts TSRangeOptions) []Sample {
+	samples := ts.between(from, to)
+	if bucket := opts.Bucket.Milliseconds(); bucket > 0 {
+		var buckets []Sample
+		for len(samples) > 0 {
+			start := samples[0].Timestamp - samples[0].Timestamp%bucket
+			n := sort.Search(len(samples), func(i int) bool { return samples[i].Timestamp >= start+bucket })
+			buckets = append(buckets, Sample{start, opts.Aggregation.apply(samples[:n])})
+			samples = samples[n:]
+		}
+		samples = buckets
+	} else {
+		samples = slices.Clone(samples)
+	}
+
+	if opts.Reverse {
+		slices.Reverse(samples)
+	}
+	if opts.Count > 0 && len(samples) > opts.Count {
+		samples = samples[:opts.Count]
+	}
+	return samples
+}
+
+// labelMatcher is a parsed TS.MRANGE filter.
+type labelMatcher struct {
+	label  string
+	values []string // empty matches a series without the label, or with it if negated
+	negate bool
+}
+
+// parseLabelMatcher parses a filter: "label=value", "label!=value",
+// "label=(a,b)" and "label!=(a,b)" for a list of values, and "label=" or
+// "label!=" for a series without or with the label.
+func parseLabelMatcher(filter string) (labelMatcher, error) {
+	var m labelMatcher
+	label, value, found := strings.Cut(filter, "!=")
+	if found {
+		m.negate = true
+	} else if label, value, found = strings.Cut(filter, "="); !found {
+		return m, fmt.Errorf("TSDB: invalid filter %q", filter)
+	}
+	if label == "" {
+		return m, fmt.Errorf("TSDB: invalid filter %q", filter)
+	}
+	m.label = label
+
+	if strings.HasPrefix(value, "(") && strings.HasSuffix(value, ")") {
+		m.values = strings.Split(value[1:len(value)-1], ",")
+	} else if value != "" {
+		m.values = []string{value}
+	}
+	return m, nil
+}
+
+func (m labelMatcher) match(labels map[string]string) bool {
+	value, exists := labels[m.label]
+	if len(m.values) == 0 {
+		return exists == m.negate
+	}
+	return (exists && slices.Contains(m.values, value)) != m.negate
+}
+
+func matchLabels(matchers []labelMatcher, labels map[string]string) bool {
+	for _, m := range matchers {
+		if !m.match(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// TSRangeResult is the range of one series returned by TSMRange.
+type TSRangeResult struct {
+	Key     string
+	Labels  map[string]string
+	Samples []Sample
+}
+
+// TSMRange returns the range of every series whose labels match all of
+// filters, ordered by key; see parseLabelMatcher for their syntax. At least
+// one filter must be a label=value matcher, so the result is bounded.
+func (s *Store) TSMRange(from, to int64, filters []string, opts TSRangeOptions) ([]TSRangeResult, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	matchers := make([]labelMatcher, 0, len(filters))
+	bounded := false
+	for _, filter := range filters {
+		m, err := parseLabelMatcher(filter)
+		if err != nil {
+			return nil, err
+		}
+		bounded = bounded || !m.negate && len(m.values) > 0
+		matchers = append(matchers, m)
+	}
+	if !bounded {
+		return nil, ErrTSInvalidFilter
+	}
+
+	var results []TSRangeResult
+	now := time.Now()
+	for _, sh := range s.shards {
+		sh.mu.RLock()
+		for key, item := range sh.data {
+			if item.ExpiresAt != nil && now.After(*item.ExpiresAt) {
+				continue
+			}
+			series, ok := item.Value.(*TimeSeries)
+			if !ok || !matchLabels(matchers, series.labels) {
+				continue
+			}
+			labels := make(map[string]string, len(series.labels))
+			for label, value := range series.labels {
+				labels[label] = value
+			}
+			results = append(results, TSRangeResult{Key: key, Labels: labels, Samples: series.rangeSamples(from, to, opts)})
+		}
+		sh.mu.RUnlock()
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Key < results[j].Key })
+	return results, nil
+}
+
+// TSCreateRule adds a rule compacting every sample added to src from now on
+// into dest. Both must be time series, and rules cannot be chained: dest
+// must have no rules and no other source, and src must not be a destination.
+func (s *Store) TSCreateRule(src, dest string, aggregation Aggregation, bucket time.Duration) error {
+	if bucket < time.Millisecond {
+		return ErrTSInvalidBucket
+	}
+	if src == dest {
+		return ErrTSInvalidRule
+	}
+
+	rule := CompactionRule{Dest: dest, Aggregation: aggregation, Bucket: bucket.Truncate(time.Millisecond)}
+
+	// The sources recorded in src and dest are checked as well, as they are
+	// not cleared when the series compacting into them is deleted
+	for {
+		srcSource, destSource := s.sourceOf(src), s.sourceOf(dest)
+		keys := []string{src, dest}
+		for _, key := range []string{srcSource, destSource} {
+			if key != "" {
+				keys = append(keys, key)
+			}
+		}
+		unlock := s.lockKeys(keys...)
+		if s.sourceOfLocked(src) == srcSource && s.sourceOfLocked(dest) == destSource {
+			defer unlock()
+			return s.tsCreateRule(src, dest, rule)
+		}
+		unlock()
+	}
+}
+
+// sourceOf returns the series recorded as compacting into the series at key,
+// if any.
+func (s *Store) sourceOf(key string) string {
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	return s.sourceOfLocked(key)
+}
+
+// sourceOfLocked is sourceOf for callers holding the shard lock of key.
+func (s *Store) sourceOfLocked(key string) string {
+	if item, exists := s.shardFor(key).data[key]; exists {
+		if series, ok := item.Value.(*TimeSeries); ok {
+			return series.source
+		}
+	}
+	return ""
+}
+
+// compactsInto reports whether the series at src has a rule compacting into
+// dest. The caller must hold the shard lock of src.
+func (s *Store) compactsInto(src, dest string) bool {
+	item, exists := s.shardFor(src).data[src]
+	if !exists || item.ExpiresAt != nil && time.Now().After(*item.ExpiresAt) {
+		return false
+	}
+	series, ok := item.Value.(*TimeSeries)
+	return ok && series.hasRule(dest)
+}
+
+// tsCreateRule implements TSCreateRule. The caller must hold the shard locks
+// of src, dest and their recorded sources.
+func (s *Store) tsCreateRule(src, dest string, rule CompactionRule) error {
+	srcSh, destSh := s.shardFor(src), s.shardFor(dest)
+	srcItem, source, err := s.writeSeries(srcSh, src)
+	if err != nil {
+		return err
+	}
+	destItem, target, err := s.writeSeries(destSh, dest)
+	if err != nil {
+		return err
+	}
+	if srcItem == nil || destItem == nil {
+		return ErrNoSuchKey
+	}
+	if target.source != "" && s.compactsInto(target.source, dest) {
+		return ErrTSRuleExists
+	}
+	if len(target.rules) > 0 || source.source != "" && s.compactsInto(source.source, src) {
+		return ErrTSInvalidRule
+	}
+
+	if err := s.reserveMemory(srcSh, src, tsRuleSize+int64(len(dest))); err != nil {
+		return err
+	}
+	source.rules = append(source.rules, rule)
+	s.resize(srcItem, tsRuleSize+int64(len(dest)))
+	s.resize(destItem, int64(len(src)-len(target.source)))
+	target.source = src
+
+	s.propagate("TS.CREATERULE", src, dest, rule.Aggregation.String(), strconv.FormatInt(rule.Bucket.Milliseconds(), 10))
+	s.notify(notifyModule, "ts.createrule", src)
+	return nil
+}
+
+// TSDeleteRule removes the rule compacting src into dest.
+func (s *Store) TSDeleteRule(src, dest string) error {
+	unlock := s.lockKeys(src, dest)
+	defer unlock()
+
+	return s.tsDeleteRule(src, dest)
+}
+
+// tsDeleteRule implements TSDeleteRule. The caller must hold the shard locks
+// of src and dest.
+func (s *Store) tsDeleteRule(src, dest string) error {
+	srcItem, source, err := s.writeSeries(s.shardFor(src), src)
+	if err != nil {
+		return err
+	}
+	if srcItem == nil {
+		return ErrNoSuchKey
+	}
+	i := slices.IndexFunc(source.rules, func(r CompactionRule) bool { return r.Dest == dest })
+	if i < 0 {
+		return ErrTSRuleNotFound
+	}
+	source.rules = slices.Delete(source.rules, i, i+1)
+	s.resize(srcItem, -tsRuleSize-int64(len(dest)))
+
+	if destItem, target, err := s.writeSeries(s.shardFor(dest), dest); err == nil && destItem != nil && target.source == src {
+		target.source = ""
+		s.resize(destItem, -int64(len(src)))
+	}
+
+	s.propagate("TS.DELETERULE", src, dest)
+	s.notify(notifyModule, "ts.deleterule", src)
+	return nil
+}
+
+// TSInfo describes a time series.
+type TSInfo struct {
+	TotalSamples    int
+	FirstTimestamp  int64
+	LastTimestamp   int64
+	Retention       time.Duration
+	DuplicatePolicy DuplicatePolicy
+	Labels          map[string]string
+	Source          string // the series compacted into this one, if any
+	Rules           []CompactionRule
+	MemoryUsage     int64
+}
+
+// TSInfo returns information about the series at key. It fails with
+// ErrNoSuchKey if there is no series.
+func (s *Store) TSInfo(key string) (TSInfo, error) {
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	series, err := s.readSeries(sh, key)
+	if err != nil {
+		return TSInfo{}, err
+	}
+	if series == nil {
+		return TSInfo{}, ErrNoSuchKey
+	}
+
+	info := TSInfo{
+		TotalSamples:    len(series.samples),
+		Retention:       time.Duration(series.retention) * time.Millisecond,
+		DuplicatePolicy: series.policy,
+		Labels:          make(map[string]string, len(series.labels)),
+		Source:          series.source,
+		Rules:           slices.Clone(series.rules),
+		MemoryUsage:     sh.data[key].size,
+	}
+	if len(series.samples) > 0 {
+		info.FirstTimestamp = series.samples[0].Timestamp
+		info.LastTimestamp = series.samples[len(series.samples)-1].Timestamp
+	}
+	for label, value := range series.labels {
+		info.Labels[label] = value
+	}
+	return info, nil
+}
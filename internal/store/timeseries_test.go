@@ -0,0 +1,225 @@
+package store
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/chaitanyayendru/fincache/internal/config"
+)
+
+func TestTimeSeriesAddAndRange(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	for i, v := range []float64{1, 2, 3, 4, 5, 6} {
+		if _, err := store.TSAdd("temp", int64(i)*500, v, TSAddOptions{}); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	if _, err := store.TSAdd("temp", 500, 10, TSAddOptions{}); !errors.Is(err, ErrTSDuplicate) {
+		t.Errorf("Expected the default policy to block duplicates, got %v", err)
+	}
+	store.TSAdd("temp", 500, 10, TSAddOptions{OnDuplicate: DuplicateSum})
+
+	samples, _ := store.TSRange("temp", 500, 2000, TSRangeOptions{})
+	if len(samples) != 4 || samples[0] != (Sample{500, 12}) || samples[3] != (Sample{2000, 5}) {
+		t.Errorf("Expected 4 samples from 500 to 2000, got %v", samples)
+	}
+
+	want := map[Aggregation][]Sample{
+		AggregationAvg:   {{0, 6.5}, {1000, 3.5}, {2000, 5.5}},
+		AggregationMin:   {{0, 1}, {1000, 3}, {2000, 5}},
+		AggregationMax:   {{0, 12}, {1000, 4}, {2000, 6}},
+		AggregationFirst: {{0, 1}, {1000, 3}, {2000, 5}},
+		AggregationLast:  {{0, 12}, {1000, 4}, {2000, 6}},
+		AggregationSum:   {{0, 13}, {1000, 7}, {2000, 11}},
+		AggregationCount: {{0, 2}, {1000, 2}, {2000, 2}},
+	}
+	for aggregation, expected := range want {
+		samples, _ := store.TSRange("temp", 0, 10000, TSRangeOptions{Bucket: time.Second, Aggregation: aggregation})
+		if !slices.Equal(samples, expected) {
+			t.Errorf("Expected %s buckets %v, got %v", aggregation, expected, samples)
+		}
+	}
+
+	samples, _ = store.TSRange("temp", 0, 10000, TSRangeOptions{Count: 2, Reverse: true})
+	if !slices.Equal(samples, []Sample{{2500, 6}, {2000, 5}}) {
+		t.Errorf("Expected the 2 newest samples, got %v", samples)
+	}
+	if last, ok, _ := store.TSGet("temp"); !ok || last != (Sample{2500, 6}) {
+		t.Errorf("Expected the newest sample, got %v", last)
+	}
+	if err := store.TSMAdd([]TSInput{{Key: "missing", Timestamp: 1, Value: 1}})[0]; !errors.Is(err, ErrNoSuchKey) {
+		t.Errorf("Expected TSMAdd not to create series, got %v", err)
+	}
+}
+
+func TestTimeSeriesRejectsNonFiniteValues(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	store.TSAdd("price", 1, 100, TSAddOptions{})
+	for _, v := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		if _, err := store.TSAdd("price", 2, v, TSAddOptions{}); !errors.Is(err, ErrTSInvalidValue) {
+			t.Errorf("Expected ErrTSInvalidValue for %v, got %v", v, err)
+		}
+		if err := store.TSMAdd([]TSInput{{Key: "price", Timestamp: 3, Value: v}})[0]; !errors.Is(err, ErrTSInvalidValue) {
+			t.Errorf("Expected TSMAdd to reject %v, got %v", v, err)
+		}
+	}
+
+	samples, _ := store.TSRange("price", 0, 10, TSRangeOptions{Bucket: time.Second, Aggregation: AggregationAvg})
+	if !slices.Equal(samples, []Sample{{0, 100}}) {
+		t.Errorf("Expected the average to be unaffected, got %v", samples)
+	}
+}
+
+func TestTimeSeriesRetention(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	store.TSCreate("cpu", TSOptions{Retention: time.Second})
+	for _, ts := range []int64{0, 400, 800, 1200, 1600} {
+		store.TSAdd("cpu", ts, 1, TSAddOptions{})
+	}
+	if _, err := store.TSAdd("cpu", 500, 1, TSAddOptions{}); !errors.Is(err, ErrTSTooOld) {
+		t.Errorf("Expected ErrTSTooOld, got %v", err)
+	}
+	samples, _ := store.TSRange("cpu", 0, 2000, TSRangeOptions{})
+	if len(samples) != 3 || samples[0].Timestamp != 800 {
+		t.Errorf("Expected samples before 600 to be trimmed, got %v", samples)
+	}
+	if err := store.TSCreate("cpu", TSOptions{}); !errors.Is(err, ErrTSKeyExists) {
+		t.Errorf("Expected ErrTSKeyExists, got %v", err)
+	}
+}
+
+func TestTimeSeriesCompaction(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	store.TSCreate("raw", TSOptions{})
+	store.TSCreate("raw:max", TSOptions{})
+	store.TSCreate("raw:avg", TSOptions{})
+	if err := store.TSCreateRule("raw", "raw:max", AggregationMax, time.Minute); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	store.TSCreateRule("raw", "raw:avg", AggregationAvg, time.Minute)
+
+	if err := store.TSCreateRule("other", "raw:max", AggregationMin, time.Minute); !errors.Is(err, ErrNoSuchKey) {
+		t.Errorf("Expected ErrNoSuchKey, got %v", err)
+	}
+	store.TSCreate("other", TSOptions{})
+	if err := store.TSCreateRule("other", "raw:max", AggregationMin, time.Minute); !errors.Is(err, ErrTSRuleExists) {
+		t.Errorf("Expected a destination to have one source, got %v", err)
+	}
+	if err := store.TSCreateRule("raw:max", "other", AggregationMin, time.Minute); !errors.Is(err, ErrTSInvalidRule) {
+		t.Errorf("Expected rules not to chain, got %v", err)
+	}
+
+	for i, v := range []float64{3, 9, 6, 2} {
+		store.TSAdd("raw", int64(i)*30_000, v, TSAddOptions{})
+	}
+	// The open bucket is kept up to date as samples arrive
+	if samples, _ := store.TSRange("raw:max", 0, math.MaxInt64, TSRangeOptions{}); !slices.Equal(samples, []Sample{{0, 9}, {60_000, 6}}) {
+		t.Errorf("Expected max buckets, got %v", samples)
+	}
+	if samples, _ := store.TSRange("raw:avg", 0, math.MaxInt64, TSRangeOptions{}); !slices.Equal(samples, []Sample{{0, 6}, {60_000, 4}}) {
+		t.Errorf("Expected avg buckets, got %v", samples)
+	}
+
+	if err := store.TSDeleteRule("raw", "raw:avg"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	store.TSAdd("raw", 120_000, 100, TSAddOptions{})
+	if samples, _ := store.TSRange("raw:avg", 0, math.MaxInt64, TSRangeOptions{}); len(samples) != 2 {
+		t.Errorf("Expected a deleted rule to stop compacting, got %v", samples)
+	}
+
+	// Deleting the source frees the destination for another rule
+	store.Delete("raw")
+	if err := store.TSCreateRule("other", "raw:max", AggregationMin, time.Minute); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
+
+func TestTimeSeriesMRange(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	store.TSCreate("temp:1", TSOptions{Labels: map[string]string{"type": "temp", "room": "kitchen"}})
+	store.TSCreate("temp:2", TSOptions{Labels: map[string]string{"type": "temp", "room": "hall"}})
+	store.TSCreate("temp:3", TSOptions{Labels: map[string]string{"type": "temp"}})
+	store.TSCreate("hum:1", TSOptions{Labels: map[string]string{"type": "humidity", "room": "kitchen"}})
+	for _, key := range []string{"temp:1", "temp:2", "temp:3", "hum:1"} {
+		store.TSAdd(key, 1000, 20, TSAddOptions{})
+	}
+
+	tests := []struct {
+		filters []string
+		want    []string
+	}{
+		{[]string{"type=temp"}, []string{"temp:1", "temp:2", "temp:3"}},
+		{[]string{"type=temp", "room!=hall"}, []string{"temp:1", "temp:3"}},
+		{[]string{"type=temp", "room="}, []string{"temp:3"}},
+		{[]string{"type=temp", "room!="}, []string{"temp:1", "temp:2"}},
+		{[]string{"room=(kitchen,hall)"}, []string{"hum:1", "temp:1", "temp:2"}},
+		{[]string{"type!=(temp)", "room=kitchen"}, []string{"hum:1"}},
+	}
+	for _, tt := range tests {
+		results, err := store.TSMRange(0, 2000, tt.filters, TSRangeOptions{})
+		if err != nil {
+			t.Fatalf("Expected no error for %v, got %v", tt.filters, err)
+		}
+		var keys []string
+		for _, r := range results {
+			if len(r.Samples) != 1 {
+				t.Errorf("Expected one sample for %s, got %v", r.Key, r.Samples)
+			}
+			keys = append(keys, r.Key)
+		}
+		if !slices.Equal(keys, tt.want) {
+			t.Errorf("Expected %v for %v, got %v", tt.want, tt.filters, keys)
+		}
+	}
+
+	if _, err := store.TSMRange(0, 2000, []string{"room!=hall"}, TSRangeOptions{}); !errors.Is(err, ErrTSInvalidFilter) {
+		t.Errorf("Expected ErrTSInvalidFilter, got %v", err)
+	}
+}
+
+func TestTimeSeriesPersists(t *testing.T) {
+	cfg := aofConfig(t.TempDir())
+	store := NewStore(cfg)
+	store.TSCreate("raw", TSOptions{Labels: map[string]string{"sensor": "a"}, DuplicatePolicy: DuplicateMax})
+	store.TSCreate("raw:sum", TSOptions{})
+	store.TSCreateRule("raw", "raw:sum", AggregationSum, time.Second)
+	store.TSAdd("raw", 100, 1, TSAddOptions{})
+	if err := store.SaveSnapshot(); err != nil {
+		t.Fatalf("Expected no error when saving snapshot: %v", err)
+	}
+	store.TSAdd("raw", 100, 5, TSAddOptions{})
+	store.TSAdd("raw", 200, 2, TSAddOptions{})
+	store.TSAdd("events", 300, 1, TSAddOptions{TSOptions: TSOptions{Labels: map[string]string{"kind": "event"}}})
+	store.Close()
+
+	restored := NewStore(cfg)
+	defer restored.Close()
+
+	if samples, _ := restored.TSRange("raw", 0, 1000, TSRangeOptions{}); !slices.Equal(samples, []Sample{{100, 5}, {200, 2}}) {
+		t.Errorf("Expected the samples after replay, got %v", samples)
+	}
+	if samples, _ := restored.TSRange("raw:sum", 0, 1000, TSRangeOptions{}); !slices.Equal(samples, []Sample{{0, 7}}) {
+		t.Errorf("Expected the compacted bucket after replay, got %v", samples)
+	}
+	info, err := restored.TSInfo("raw")
+	if err != nil || info.DuplicatePolicy != DuplicateMax || info.Labels["sensor"] != "a" || len(info.Rules) != 1 {
+		t.Errorf("Expected the settings after replay, got %+v, %v", info, err)
+	}
+	if results, _ := restored.TSMRange(0, 1000, []string{"kind=event"}, TSRangeOptions{}); len(results) != 1 {
+		t.Errorf("Expected the series created by TSAdd after replay, got %v", results)
+	}
+}
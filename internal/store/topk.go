@@ -0,0 +1,451 @@
+package store
+
+import (
+	"cmp"
+	"errors"
+	"math"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Defaults of Top-K sketches, as in RedisBloom.
+const (
+	defaultTopKWidth = 8
+	defaultTopKDepth = 7
+	defaultTopKDecay = 0.9
+)
+
+var ErrInvalidTopK = errors.New("k, width and depth must be positive and decay between 0 and 1")
+
+// TopKOptions configures a new Top-K sketch.
+type TopKOptions struct {
+	K int // number of heavy hitters kept
+	// Width and Depth size the counters; 0 uses the defaults.
+	Width int
+	Depth int
+	// Decay is the base of the probability decay^count that an item
+	// hashed to a counter held by another one decrements it; 0 uses the
+	// default.
+	Decay float64
+}
+
+func (opts *TopKOptions) validate() error {
+	if opts.Width == 0 {
+		opts.Width = defaultTopKWidth
+	}
+	if opts.Depth == 0 {
+		opts.Depth = defaultTopKDepth
+	}
+	if opts.Decay == 0 {
+		opts.Decay = defaultTopKDecay
+	}
+	if opts.K <= 0 || opts.Width <= 0 || opts.Depth <= 0 || opts.Width*opts.Depth > maxSketchCounters || !(opts.Decay > 0 && opts.Decay <= 1) {
+		return ErrInvalidTopK
+	}
+	return nil
+}
+
+// topkBucket is a HeavyKeeper counter: the fingerprint of the item that owns
+// it and the count of that item.
+type topkBucket struct {
+	fp    uint32
+	count uint64
+}
+
+// TopKItem is a heavy hitter of a Top-K sketch with its estimated count.
+type TopKItem struct {
+	Item  string
+	Count uint64
+}
+
+// TopK is the value of a Top-K key: a HeavyKeeper sketch, depth rows of
+// width counters each owned by one item, and the k items with the highest
+// estimates seen so far. Items that hash to a counter owned by another item
+// decay it with a probability falling exponentially with its count, so
+// heavy hitters keep their counters and light ones are washed out. Like
+// lists it is modified in place under the lock of the shard holding it.
+type TopK struct {
+	k       uint32
+	width   uint32
+	depth   uint32
+	decay   float64
+	buckets []topkBucket // row after row
+	heap    []TopKItem   // unordered, at most k
+	// rng is the state of the generator deciding decays; persisting it
+	// makes replaying the log reproduce the sketch exactly.
+	rng uint64
+}
+
+func newTopK(opts TopKOptions) *TopK {
+	return &TopK{
+		k:       uint32(opts.K),
+		width:   uint32(opts.Width),
+		depth:   uint32(opts.Depth),
+		decay:   opts.Decay,
+		buckets: make([]topkBucket, opts.Width*opts.Depth),
+	}
+}
+
+func (tk *TopK) cell(h1, h2 uint64, row uint32) int {
+	return int(row)*int(tk.width) + int((h1+uint64(row)*h2)%uint64(tk.width))
+}
+
+// random returns the next number in [0, 1) of a splitmix64 generator.
+func (tk *TopK) random() float64 {
+	tk.rng += 0x9e3779b97f4a7c15
+	return float64(fmix64(tk.rng)>>11) / (1 << 53)
+}
+
+// incrBy counts increment occurrences of item and returns the heavy hitter
+// it expelled from the top k, if any.
+func (tk *TopK) incrBy(item string, increment uint64) (*TopKItem, int64) {
+	h1, h2 := filterHash(item)
+	fp := uint32(h2)
+
+	var estimate uint64
+	for row := uint32(0); row < tk.depth; row++ {
+		b := &tk.buckets[tk.cell(h1, h2, row)]
+		switch {
+		case b.count == 0:
+			b.fp, b.count = fp, increment
+		case b.fp == fp:
+			b.count += increment
+		default:
+			for n := increment; n > 0; n-- {
+				if tk.random() >= math.Pow(tk.decay, float64(b.count)) {
+					continue
+				}
+				if b.count--; b.count == 0 {
+					// The item takes the counter over with what is left
+					b.fp, b.count = fp, n
+					break
+				}
+			}
+		}
+		if b.fp == fp {
+			estimate = max(estimate, b.count)
+		}
+	}
+	return tk.promote(item, estimate)
+}
+
+// promote updates the top k with the estimate of item and returns the heavy
+// hitter it expelled, if any, and the change of the size of the heap.
+func (tk *TopK) promote(item string, estimate uint64) (*TopKItem, int64) {
+	if i := tk.find(item); i >= 0 {
+		tk.heap[i].Count = max(tk.heap[i].Count, estimate)
+		return nil, 0
+	}
+	if estimate == 0 {
+		return nil, 0
+	}
+	if len(tk.heap) < int(tk.k) {
+		tk.heap = append(tk.heap, TopKItem{Item: item, Count: estimate})
+		return nil, int64(len(item)) + topkEntryOverhead
+	}
+	i := tk.smallest()
+	if estimate <= tk.heap[i].Count {
+		return nil, 0
+	}
+	expelled := tk.heap[i]
+	tk.heap[i] = TopKItem{Item: item, Count: estimate}
+	return &expelled, int64(len(item) - len(expelled.Item))
+}
+
+func (tk *TopK) find(item string) int {
+	return slices.IndexFunc(tk.heap, func(e TopKItem) bool { return e.Item == item })
+}
+
+// smallest returns the index of the heavy hitter with the lowest count. k is
+// small, so a scan beats keeping a heap ordered.
+func (tk *TopK) smallest() int {
+	lowest := 0
+	for i, e := range tk.heap {
+		if e.Count < tk.heap[lowest].Count {
+			lowest = i
+		}
+	}
+	return lowest
+}
+
+// estimate returns the highest count of the counters of item that it owns.
+func (tk *TopK) estimate(item string) uint64 {
+	h1, h2 := filterHash(item)
+	var estimate uint64
+	for row := uint32(0); row < tk.depth; row++ {
+		if b := tk.buckets[tk.cell(h1, h2, row)]; b.fp == uint32(h2) {
+			estimate = max(estimate, b.count)
+		}
+	}
+	return estimate
+}
+
+// list returns the heavy hitters by descending count.
+func (tk *TopK) list() []TopKItem {
+	items := slices.Clone(tk.heap)
+	slices.SortFunc(items, func(a, b TopKItem) int {
+		if c := cmp.Compare(b.Count, a.Count); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Item, b.Item)
+	})
+	return items
+}
+
+func (tk *TopK) size() int64 {
+	size := topkOverhead + int64(len(tk.buckets))*16
+	for _, e := range tk.heap {
+		size += int64(len(e.Item)) + topkEntryOverhead
+	}
+	return size
+}
+
+func (tk *TopK) clone() *TopK {
+	c := *tk
+	c.buckets = slices.Clone(tk.buckets)
+	c.heap = slices.Clone(tk.heap)
+	return &c
+}
+
+// Memory estimates for Top-K sketches.
+const (
+	topkOverhead      = 96 // TopK struct and its slices
+	topkEntryOverhead = 24 // TopKItem
+)
+
+// readTopK returns the Top-K sketch at key for a read, or nil if there is
+// none. The caller must hold sh.mu.
+func (s *Store) readTopK(sh *shard, key string) (*TopK, error) {
+	item, exists := sh.data[key]
+	if exists && item.ExpiresAt != nil && time.Now().After(*item.ExpiresAt) {
+		exists = false
+	}
+	if !exists {
+		if _, isZSet := sh.sortedSets[key]; isZSet {
+			return nil, ErrWrongType
+		}
+		s.stats.recordLookup(false)
+		return nil, nil
+	}
+
+	tk, ok := item.Value.(*TopK)
+	if !ok {
+		return nil, ErrWrongType
+	}
+	s.stats.recordLookup(true)
+	s.touch(item)
+	return tk, nil
+}
+
+// writeTopK returns the item holding the Top-K sketch at key for a write,
+// deleting it first if it has expired. It returns a nil item if there is no
+// sketch. The caller must hold sh.mu.
+func (s *Store) writeTopK(sh *shard, key string) (*Item, *TopK, error) {
+	if _, isZSet := sh.sortedSets[key]; isZSet {
+		return nil, nil, ErrWrongType
+	}
+	item, exists := sh.data[key]
+	if !exists {
+		return nil, nil, nil
+	}
+	if item.ExpiresAt != nil && time.Now().After(*item.ExpiresAt) {
+		s.deleteExpired(sh, key)
+		return nil, nil, nil
+	}
+
+	tk, ok := item.Value.(*TopK)
+	if !ok {
+		return nil, nil, ErrWrongType
+	}
+	s.touch(item)
+	return item, tk, nil
+}
+
+// TopKReserve creates an empty Top-K sketch at key. It fails with
+// ErrSketchExists if the key holds a value of any type.
+func (s *Store) TopKReserve(key string, opts TopKOptions) error {
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if item, _, err := s.writeTopK(sh, key); err != nil || item != nil {
+		return ErrSketchExists
+	}
+	return s.topkReserve(sh, key, opts)
+}
+
+// topkReserve stores a new sketch with opts at key. The caller must hold
+// sh.mu.
+func (s *Store) topkReserve(sh *shard, key string, opts TopKOptions) error {
+	tk := newTopK(opts)
+	if err := s.reserveMemory(sh, key, itemSize(key, tk)); err != nil {
+		return err
+	}
+	s.set(sh, key, tk, nil)
+
+	s.propagate("TOPK.RESERVE", key, strconv.Itoa(opts.K), strconv.Itoa(opts.Width), strconv.Itoa(opts.Depth), formatFloat(opts.Decay))
+	s.notify(notifyModule, "topk.reserve", key)
+	return nil
+}
+
+// TopKAdd counts one occurrence of each of items in the Top-K sketch at key.
+// See TopKIncrBy.
+func (s *Store) TopKAdd(key string, items ...string) ([]*TopKItem, error) {
+	increments := make([]uint64, len(items))
+	for i := range increments {
+		increments[i] = 1
+	}
+	return s.TopKIncrBy(key, items, increments)
+}
+
+// TopKIncrBy counts the matching increment of occurrences of each of items
+// in the Top-K sketch at key and returns, for each, the heavy hitter it
+// expelled from the top k, or nil. It fails with ErrNoSuchKey if there is no
+// sketch. Items counted before an error are kept.
+func (s *Store) TopKIncrBy(key string, items []string, increments []uint64) ([]*TopKItem, error) {
+	if len(items) != len(increments) {
+		return nil, errors.New("each item needs an increment")
+	}
+
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	return s.topkIncrBy(sh, key, items, increments)
+}
+
+// topkIncrBy implements TopKIncrBy. The caller must hold sh.mu.
+func (s *Store) topkIncrBy(sh *shard, key string, items []string, increments []uint64) ([]*TopKItem, error) {
+	item, tk, err := s.writeTopK(sh, key)
+	if err != nil {
+		return nil, err
+	}
+	if item == nil {
+		return nil, ErrNoSuchKey
+	}
+
+	expelled := make([]*TopKItem, 0, len(items))
+	for i, member := range items {
+		if increments[i] == 0 {
+			expelled = append(expelled, nil)
+			continue
+		}
+		if err := s.reserveMemory(sh, key, int64(len(member))+topkEntryOverhead); err != nil {
+			return expelled, err
+		}
+		out, delta := tk.incrBy(member, increments[i])
+		s.resize(item, delta)
+		item.UpdatedAt = time.Now()
+		expelled = append(expelled, out)
+
+		s.propagate("TOPK.INCRBY", key, member, strconv.FormatUint(increments[i], 10))
+		s.notify(notifyModule, "topk.add", key)
+	}
+	return expelled, nil
+}
+
+// TopKQuery reports for each of items whether it is one of the heavy
+// hitters of the Top-K sketch at key. It fails with ErrNoSuchKey if there is
+// no sketch.
+func (s *Store) TopKQuery(key string, items ...string) ([]bool, error) {
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	tk, err := s.readTopK(sh, key)
+	if err != nil {
+		return nil, err
+	}
+	if tk == nil {
+		return nil, ErrNoSuchKey
+	}
+	found := make([]bool, len(items))
+	for i, member := range items {
+		found[i] = tk.find(member) >= 0
+	}
+	return found, nil
+}
+
+// TopKList returns the heavy hitters of the Top-K sketch at key by
+// descending count. It fails with ErrNoSuchKey if there is no sketch.
+func (s *Store) TopKList(key string) ([]TopKItem, error) {
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	tk, err := s.readTopK(sh, key)
+	if err != nil {
+		return nil, err
+	}
+	if tk == nil {
+		return nil, ErrNoSuchKey
+	}
+	return tk.list(), nil
+}
+
+// TopKMerge replaces the Top-K sketch at dest with the union of the
+// sketches at sources, e.g. to find the heavy hitters of a day from those
+// of its hours. All of them must exist and have the same k, width and depth;
+// dest keeps its decay. Counters owned by the same item add up; otherwise
+// the larger one wins. The heavy hitters are the k highest of those of the
+// sources, counted in the merged counters. dest may be one of the sources.
+func (s *Store) TopKMerge(dest string, sources ...string) error {
+	if len(sources) == 0 {
+		return errors.New("at least one source is required")
+	}
+
+	unlock := s.lockKeys(append([]string{dest}, sources...)...)
+	defer unlock()
+
+	sh := s.shardFor(dest)
+	item, target, err := s.writeTopK(sh, dest)
+	if err != nil {
+		return err
+	}
+	if item == nil {
+		return ErrNoSuchKey
+	}
+
+	merged := &TopK{k: target.k, width: target.width, depth: target.depth, decay: target.decay, rng: target.rng}
+	merged.buckets = make([]topkBucket, len(target.buckets))
+	candidates := make(map[string]uint64)
+	for _, key := range sources {
+		_, tk, err := s.writeTopK(s.shardFor(key), key)
+		if err != nil {
+			return err
+		}
+		if tk == nil {
+			return ErrNoSuchKey
+		}
+		if tk.k != merged.k || tk.width != merged.width || tk.depth != merged.depth {
+			return ErrSketchMismatch
+		}
+		for i, b := range tk.buckets {
+			m := &merged.buckets[i]
+			switch {
+			case m.count == 0 || b.fp == m.fp:
+				m.fp, m.count = b.fp, m.count+b.count
+			case b.count > m.count:
+				*m = b
+			}
+		}
+		for _, e := range tk.heap {
+			candidates[e.Item] = max(candidates[e.Item], e.Count)
+		}
+	}
+
+	for candidate, count := range candidates {
+		merged.heap = append(merged.heap, TopKItem{Item: candidate, Count: max(count, merged.estimate(candidate))})
+	}
+	merged.heap = merged.list()
+	if len(merged.heap) > int(merged.k) {
+		merged.heap = merged.heap[:merged.k]
+	}
+
+	return s.storeMerged(sh, dest, item, merged, "topk.merge")
+}
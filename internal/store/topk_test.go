@@ -0,0 +1,113 @@
+package store
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/chaitanyayendru/fincache/internal/config"
+)
+
+// addTraffic adds heavy items hit:0 to hit:4, hit:i seen 1000-100*i times,
+// interleaved with 2000 items seen once.
+func addTraffic(t *testing.T, store *Store, key string) {
+	t.Helper()
+	for round := 0; round < 1000; round++ {
+		for i := 0; i < 5; i++ {
+			if round < 1000-100*i {
+				if _, err := store.TopKAdd(key, "hit:"+strconv.Itoa(i)); err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+			}
+		}
+		store.TopKAdd(key, key+":noise:"+strconv.Itoa(2*round), key+":noise:"+strconv.Itoa(2*round+1))
+	}
+}
+
+func TestTopK(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	if err := store.TopKReserve("urls", TopKOptions{K: 5, Width: 50, Depth: 4}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := store.TopKReserve("urls", TopKOptions{K: 5}); !errors.Is(err, ErrSketchExists) {
+		t.Errorf("Expected ErrSketchExists, got %v", err)
+	}
+	addTraffic(t, store, "urls")
+
+	list, _ := store.TopKList("urls")
+	var items []string
+	for _, e := range list {
+		items = append(items, e.Item)
+	}
+	if !slices.Equal(items, []string{"hit:0", "hit:1", "hit:2", "hit:3", "hit:4"}) {
+		t.Fatalf("Expected the heavy hitters by count, got %v", list)
+	}
+	if list[0].Count < 900 || list[0].Count > 1000 {
+		t.Errorf("Expected hit:0 to be counted about 1000 times, got %d", list[0].Count)
+	}
+
+	found, _ := store.TopKQuery("urls", "hit:3", "urls:noise:7")
+	if !slices.Equal(found, []bool{true, false}) {
+		t.Errorf("Expected only the heavy hitter to be found, got %v", found)
+	}
+
+	expelled, _ := store.TopKIncrBy("urls", []string{"burst"}, []uint64{5000})
+	if expelled[0] == nil || expelled[0].Item != "hit:4" {
+		t.Errorf("Expected the burst to expel hit:4, got %v", expelled[0])
+	}
+
+	if _, err := store.TopKAdd("missing", "a"); !errors.Is(err, ErrNoSuchKey) {
+		t.Errorf("Expected ErrNoSuchKey, got %v", err)
+	}
+	if err := store.TopKReserve("bad", TopKOptions{K: 5, Decay: 2}); !errors.Is(err, ErrInvalidTopK) {
+		t.Errorf("Expected ErrInvalidTopK, got %v", err)
+	}
+}
+
+func TestTopKMerge(t *testing.T) {
+	store := NewStore(config.StoreConfig{})
+	defer store.Close()
+
+	for _, key := range []string{"urls:1", "urls:2", "urls:day"} {
+		store.TopKReserve(key, TopKOptions{K: 3, Width: 50, Depth: 4})
+	}
+	store.TopKReserve("other", TopKOptions{K: 4, Width: 50, Depth: 4})
+	store.TopKIncrBy("urls:1", []string{"a", "b", "c", "d"}, []uint64{50, 40, 30, 5})
+	store.TopKIncrBy("urls:2", []string{"d", "b", "e"}, []uint64{80, 20, 10})
+
+	if err := store.TopKMerge("urls:day", "urls:1", "urls:2"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	list, _ := store.TopKList("urls:day")
+	if !slices.Equal(list, []TopKItem{{"d", 85}, {"b", 60}, {"a", 50}}) {
+		t.Errorf("Expected the heavy hitters of both windows, got %v", list)
+	}
+
+	if err := store.TopKMerge("urls:day", "other"); !errors.Is(err, ErrSketchMismatch) {
+		t.Errorf("Expected ErrSketchMismatch, got %v", err)
+	}
+}
+
+func TestTopKPersists(t *testing.T) {
+	cfg := aofConfig(t.TempDir())
+	store := NewStore(cfg)
+	store.TopKReserve("urls", TopKOptions{K: 5, Width: 20, Depth: 3})
+	store.TopKAdd("urls", "a", "b", "a")
+	if err := store.SaveSnapshot(); err != nil {
+		t.Fatalf("Expected no error when saving snapshot: %v", err)
+	}
+	// A narrow sketch makes decays, which replay must reproduce
+	addTraffic(t, store, "urls")
+	want, _ := store.TopKList("urls")
+	store.Close()
+
+	restored := NewStore(cfg)
+	defer restored.Close()
+
+	if list, err := restored.TopKList("urls"); err != nil || !slices.Equal(list, want) {
+		t.Errorf("Expected %v after replay, got %v, %v", want, list, err)
+	}
+}